@@ -0,0 +1,286 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+	"google.golang.org/protobuf/proto"
+)
+
+// Users follow redis 6 ACLs. Rules are applied by the storage servers so
+// every proxy ends up with the same users, the proxies check them on every
+// command. The default user allows everything until it is changed.
+
+const DefaultUser = "default"
+
+var (
+	ErrNoAuth          = errors.New("NOAUTH Authentication required.")
+	ErrWrongPass       = errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+	ErrUnknownCategory = errors.New("Unknown category")
+)
+
+// NoPermCommand is returned for a command the user can not run.
+func NoPermCommand(command string) error {
+	return fmt.Errorf("NOPERM this user has no permissions to run the '%s' command or its subcommand", command)
+}
+
+// ErrNoPermKey is returned when a key is outside the user's patterns.
+var ErrNoPermKey = errors.New("NOPERM this user has no permissions to access one of the keys used as arguments")
+
+// NewUser returns the user before any rules are applied, new users are
+// disabled and can do nothing.
+func NewUser(name string) *chickaree.ACLUser {
+	if name == DefaultUser {
+		return &chickaree.ACLUser{
+			Name:     name,
+			Enabled:  true,
+			Nopass:   true,
+			Commands: []string{"+@all"},
+			Keys:     []string{"*"},
+		}
+	}
+	return &chickaree.ACLUser{Name: name}
+}
+
+// SetUser applies ACL SETUSER rules, the user is left unchanged if any rule
+// is invalid.
+func SetUser(user *chickaree.ACLUser, rules []string) error {
+	updated := proto.Clone(user).(*chickaree.ACLUser)
+	for _, rule := range rules {
+		if err := applyRule(updated, rule); err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': %w", rule, err)
+		}
+	}
+	proto.Reset(user)
+	proto.Merge(user, updated)
+	return nil
+}
+
+func applyRule(user *chickaree.ACLUser, rule string) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		user.Enabled = true
+	case "off":
+		user.Enabled = false
+	case "nopass":
+		user.Nopass = true
+		user.Passwords = nil
+	case "resetpass":
+		user.Nopass = false
+		user.Passwords = nil
+	case "allkeys":
+		user.Keys = []string{"*"}
+	case "resetkeys":
+		user.Keys = nil
+	case "allcommands":
+		user.Commands = []string{"+@all"}
+	case "nocommands":
+		user.Commands = nil
+	case "reset":
+		name := user.Name
+		proto.Reset(user)
+		user.Name = name
+	default:
+		return applyValueRule(user, rule)
+	}
+	return nil
+}
+
+func applyValueRule(user *chickaree.ACLUser, rule string) error {
+	if len(rule) < 2 {
+		return errors.New("Syntax error")
+	}
+	val := rule[1:]
+	switch rule[0] {
+	case '>':
+		addPassword(user, HashPassword(val))
+	case '<':
+		removePassword(user, HashPassword(val))
+	case '#':
+		if b, err := hex.DecodeString(val); err != nil || len(b) != sha256.Size {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		addPassword(user, strings.ToLower(val))
+	case '!':
+		removePassword(user, strings.ToLower(val))
+	case '~':
+		if !contains(user.Keys, val) {
+			user.Keys = append(user.Keys, val)
+		}
+	case '+', '-':
+		return addCommandRule(user, rule)
+	default:
+		return errors.New("Syntax error")
+	}
+	return nil
+}
+
+func addPassword(user *chickaree.ACLUser, hash string) {
+	user.Nopass = false
+	if !contains(user.Passwords, hash) {
+		user.Passwords = append(user.Passwords, hash)
+	}
+}
+
+func removePassword(user *chickaree.ACLUser, hash string) {
+	passwords := user.Passwords[:0]
+	for _, p := range user.Passwords {
+		if p != hash {
+			passwords = append(passwords, p)
+		}
+	}
+	user.Passwords = passwords
+}
+
+// addCommandRule appends +cmd, -cmd, +@category or -@category. Rules are
+// checked in order so +@all and -@all replace every earlier rule.
+func addCommandRule(user *chickaree.ACLUser, rule string) error {
+	rule = strings.ToLower(rule)
+	name := rule[1:]
+	if strings.HasPrefix(name, "@") {
+		cat := name[1:]
+		if cat != "all" && !contains(Categories(), cat) {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		if cat == "all" {
+			user.Commands = nil
+			if rule[0] == '-' {
+				return nil
+			}
+		}
+	} else if _, ok := categories[name]; !ok {
+		return errors.New("Unknown command or category name in ACL")
+	}
+	user.Commands = append(user.Commands, rule)
+	return nil
+}
+
+// HashPassword returns the sha256 hex digest redis stores passwords as.
+func HashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckPassword reports whether an enabled user can log in with password.
+func CheckPassword(user *chickaree.ACLUser, password string) bool {
+	if user == nil || !user.Enabled {
+		return false
+	}
+	if user.Nopass {
+		return true
+	}
+	hash := HashPassword(password)
+	for _, p := range user.Passwords {
+		if subtle.ConstantTimeCompare([]byte(p), []byte(hash)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed checks the user can run a command on keys.
+func Allowed(user *chickaree.ACLUser, command string, keys []string) error {
+	command = strings.ToLower(command)
+	if !commandAllowed(user, command) {
+		return NoPermCommand(command)
+	}
+	for _, key := range keys {
+		if !keyAllowed(user, key) {
+			return ErrNoPermKey
+		}
+	}
+	return nil
+}
+
+func commandAllowed(user *chickaree.ACLUser, command string) bool {
+	cats := categories[command]
+	allowed := false
+	for _, rule := range user.Commands {
+		name := rule[1:]
+		var match bool
+		switch {
+		case name == "@all":
+			match = true
+		case strings.HasPrefix(name, "@"):
+			match = contains(cats, name[1:])
+		default:
+			match = name == command
+		}
+		if match {
+			allowed = rule[0] == '+'
+		}
+	}
+	return allowed
+}
+
+func keyAllowed(user *chickaree.ACLUser, key string) bool {
+	for _, pattern := range user.Keys {
+		if Match(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Describe returns the user as ACL LIST shows it.
+func Describe(user *chickaree.ACLUser) string {
+	fields := []string{"user", user.Name}
+	fields = append(fields, Flags(user)...)
+	for _, p := range user.Passwords {
+		fields = append(fields, "#"+p)
+	}
+	for _, k := range user.Keys {
+		fields = append(fields, "~"+k)
+	}
+	fields = append(fields, Commands(user))
+	return strings.Join(fields, " ")
+}
+
+// Rules returns the ACL SETUSER rules that rebuild user from a reset.
+func Rules(user *chickaree.ACLUser) []string {
+	rules := []string{"reset", "off"}
+	if user.Enabled {
+		rules[1] = "on"
+	}
+	if user.Nopass {
+		rules = append(rules, "nopass")
+	}
+	for _, p := range user.Passwords {
+		rules = append(rules, "#"+p)
+	}
+	for _, k := range user.Keys {
+		rules = append(rules, "~"+k)
+	}
+	return append(rules, user.Commands...)
+}
+
+// Flags returns the flags ACL GETUSER shows.
+func Flags(user *chickaree.ACLUser) []string {
+	flags := []string{"off"}
+	if user.Enabled {
+		flags[0] = "on"
+	}
+	if len(user.Keys) == 1 && user.Keys[0] == "*" {
+		flags = append(flags, "allkeys")
+	}
+	if len(user.Commands) == 1 && user.Commands[0] == "+@all" {
+		flags = append(flags, "allcommands")
+	}
+	if user.Nopass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+// Commands returns the command rules as one string, -@all when empty.
+func Commands(user *chickaree.ACLUser) string {
+	if len(user.Commands) == 0 || user.Commands[0] != "+@all" {
+		return strings.Join(append([]string{"-@all"}, user.Commands...), " ")
+	}
+	return strings.Join(user.Commands, " ")
+}
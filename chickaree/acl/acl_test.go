@@ -0,0 +1,106 @@
+package acl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultUser(t *testing.T) {
+	user := NewUser(DefaultUser)
+	if !CheckPassword(user, "anything") {
+		t.Error("expected default user to need no password")
+	}
+	if err := Allowed(user, "set", []string{"foo"}); err != nil {
+		t.Errorf("expected default user to run any command: %s", err)
+	}
+	if got := Describe(user); got != "user default on allkeys allcommands nopass ~* +@all" {
+		t.Errorf("unexpected description %q", got)
+	}
+}
+
+func TestSetUser(t *testing.T) {
+	user := NewUser("alice")
+	if CheckPassword(user, "") {
+		t.Error("expected new user to be disabled")
+	}
+	if err := SetUser(user, []string{"on", ">secret", "~cache:*", "+@read", "-hgetall", "+set"}); err != nil {
+		t.Fatal(err)
+	}
+	if !CheckPassword(user, "secret") || CheckPassword(user, "other") {
+		t.Error("expected only the password set to be accepted")
+	}
+	tests := []struct {
+		command string
+		keys    []string
+		err     string
+	}{
+		{"get", []string{"cache:a"}, ""},
+		{"SET", []string{"cache:a"}, ""},
+		{"hgetall", []string{"cache:a"}, "NOPERM this user has no permissions to run the 'hgetall'"},
+		{"del", []string{"cache:a"}, "NOPERM this user has no permissions to run the 'del'"},
+		{"get", []string{"session:a"}, ErrNoPermKey.Error()},
+	}
+	for _, test := range tests {
+		err := Allowed(user, test.command, test.keys)
+		if test.err == "" && err != nil {
+			t.Errorf("expected %s to be allowed got %s", test.command, err)
+		}
+		if test.err != "" && (err == nil || !strings.HasPrefix(err.Error(), test.err)) {
+			t.Errorf("expected %s to fail with %q got %v", test.command, test.err, err)
+		}
+	}
+
+	// invalid rules leave the user unchanged
+	if err := SetUser(user, []string{"off", "+nosuchcommand"}); err == nil {
+		t.Error("expected unknown command to be rejected")
+	}
+	if !user.Enabled {
+		t.Error("expected user to be unchanged by a failed update")
+	}
+
+	if err := SetUser(user, []string{"<secret", "-@all"}); err != nil {
+		t.Fatal(err)
+	}
+	if CheckPassword(user, "secret") {
+		t.Error("expected removed password to be refused")
+	}
+	if got := Commands(user); got != "-@all" {
+		t.Errorf("expected -@all to clear command rules got %q", got)
+	}
+}
+
+func TestCategoryCommands(t *testing.T) {
+	commands, err := CategoryCommands("hyperloglog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(commands, ",") != "pfadd,pfcount,pfmerge" {
+		t.Errorf("unexpected commands %v", commands)
+	}
+	if _, err := CategoryCommands("nosuchcategory"); err != ErrUnknownCategory {
+		t.Errorf("expected unknown category got %v", err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, key string
+		match        bool
+	}{
+		{"*", "a/b", true},
+		{"user:*", "user:1", true},
+		{"user:*", "session:1", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+	}
+	for _, test := range tests {
+		if got := Match(test.pattern, test.key); got != test.match {
+			t.Errorf("Match(%q, %q) = %t", test.pattern, test.key, got)
+		}
+	}
+}
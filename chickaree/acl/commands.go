@@ -0,0 +1,86 @@
+package acl
+
+import "sort"
+
+// categories are the redis ACL categories of each command the proxy
+// answers.
+var categories = map[string][]string{
+	"acl":         {"admin", "slow", "dangerous"},
+	"asking":      {"fast", "connection"},
+	"auth":        {"fast", "connection"},
+	"bitcount":    {"read", "bitmap", "slow"},
+	"bitfield":    {"write", "bitmap", "slow"},
+	"bitfield_ro": {"read", "bitmap", "fast"},
+	"bitop":       {"write", "bitmap", "slow"},
+	"bitpos":      {"read", "bitmap", "slow"},
+	"cluster":     {"admin", "slow"},
+	"command":     {"slow", "connection"},
+	"del":         {"keyspace", "write", "slow"},
+	"expire":      {"keyspace", "write", "fast"},
+	"geoadd":      {"write", "geo", "slow"},
+	"geodist":     {"read", "geo", "slow"},
+	"geohash":     {"read", "geo", "slow"},
+	"geopos":      {"read", "geo", "slow"},
+	"geosearch":   {"read", "geo", "slow"},
+	"get":         {"read", "string", "fast"},
+	"getbit":      {"read", "bitmap", "fast"},
+	"hexists":     {"read", "hash", "fast"},
+	"hget":        {"read", "hash", "fast"},
+	"hgetall":     {"read", "hash", "slow"},
+	"hset":        {"write", "hash", "fast"},
+	"lock":        {"write", "slow"},
+	"persist":     {"keyspace", "write", "fast"},
+	"pexpire":     {"keyspace", "write", "fast"},
+	"pfadd":       {"write", "hyperloglog", "fast"},
+	"pfcount":     {"read", "hyperloglog", "slow"},
+	"pfmerge":     {"write", "hyperloglog", "slow"},
+	"ping":        {"fast", "connection"},
+	"pttl":        {"keyspace", "read", "fast"},
+	"readonly":    {"fast", "connection"},
+	"readwrite":   {"fast", "connection"},
+	"refresh":     {"write", "fast"},
+	"set":         {"write", "string", "slow"},
+	"setbit":      {"write", "bitmap", "slow"},
+	"ttl":         {"keyspace", "read", "fast"},
+	"unlock":      {"write", "fast"},
+}
+
+// Categories returns every category name.
+func Categories() []string {
+	seen := map[string]bool{"all": true}
+	for _, cats := range categories {
+		for _, cat := range cats {
+			seen[cat] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for cat := range seen {
+		names = append(names, cat)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CategoryCommands returns the commands in a category.
+func CategoryCommands(category string) ([]string, error) {
+	var commands []string
+	for cmd, cats := range categories {
+		if category == "all" || contains(cats, category) {
+			commands = append(commands, cmd)
+		}
+	}
+	if len(commands) == 0 {
+		return nil, ErrUnknownCategory
+	}
+	sort.Strings(commands)
+	return commands, nil
+}
+
+func contains(values []string, val string) bool {
+	for _, v := range values {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package chickaree
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// UserKey is the metadata key carrying the redis user a request is made
+// for, storage servers record it with the caller.
+const UserKey = "chickaree-user"
+
+// TokenCredentials sends a bearer token with every request. Like redis AUTH
+// it is also sent without tls.
+type TokenCredentials string
+
+func (t TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t TokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// WithToken returns the dial options sending token, none if it is empty.
+func WithToken(token string) []grpc.DialOption {
+	if token == "" {
+		return nil
+	}
+	return []grpc.DialOption{grpc.WithPerRPCCredentials(TokenCredentials(token))}
+}
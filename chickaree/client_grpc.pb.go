@@ -19,9 +19,32 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ChickareeDBClient interface {
 	GetServers(ctx context.Context, in *GetServersRequest, opts ...grpc.CallOption) (*GetServersResponse, error)
+	GetShards(ctx context.Context, in *GetShardsRequest, opts ...grpc.CallOption) (*GetShardsResponse, error)
 	EventLog(ctx context.Context, in *EventLogRequest, opts ...grpc.CallOption) (ChickareeDB_EventLogClient, error)
 	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
 	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	SetBit(ctx context.Context, in *SetBitRequest, opts ...grpc.CallOption) (*SetBitResponse, error)
+	GetBit(ctx context.Context, in *GetBitRequest, opts ...grpc.CallOption) (*GetBitResponse, error)
+	BitCount(ctx context.Context, in *BitCountRequest, opts ...grpc.CallOption) (*BitCountResponse, error)
+	BitPos(ctx context.Context, in *BitPosRequest, opts ...grpc.CallOption) (*BitPosResponse, error)
+	BitOp(ctx context.Context, in *BitOpRequest, opts ...grpc.CallOption) (*BitOpResponse, error)
+	BitField(ctx context.Context, in *BitFieldRequest, opts ...grpc.CallOption) (*BitFieldResponse, error)
+	PFAdd(ctx context.Context, in *PFAddRequest, opts ...grpc.CallOption) (*PFAddResponse, error)
+	PFCount(ctx context.Context, in *PFCountRequest, opts ...grpc.CallOption) (*PFCountResponse, error)
+	PFMerge(ctx context.Context, in *PFMergeRequest, opts ...grpc.CallOption) (*PFMergeResponse, error)
+	GeoAdd(ctx context.Context, in *GeoAddRequest, opts ...grpc.CallOption) (*GeoAddResponse, error)
+	GeoPos(ctx context.Context, in *GeoPosRequest, opts ...grpc.CallOption) (*GeoPosResponse, error)
+	GeoDist(ctx context.Context, in *GeoDistRequest, opts ...grpc.CallOption) (*GeoDistResponse, error)
+	GeoHash(ctx context.Context, in *GeoHashRequest, opts ...grpc.CallOption) (*GeoHashResponse, error)
+	GeoSearch(ctx context.Context, in *GeoSearchRequest, opts ...grpc.CallOption) (*GeoSearchResponse, error)
+	Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*LockResponse, error)
+	Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*UnlockResponse, error)
+	Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*RefreshResponse, error)
+	Expire(ctx context.Context, in *ExpireRequest, opts ...grpc.CallOption) (*ExpireResponse, error)
+	TTL(ctx context.Context, in *TTLRequest, opts ...grpc.CallOption) (*TTLResponse, error)
+	SetUser(ctx context.Context, in *SetUserRequest, opts ...grpc.CallOption) (*SetUserResponse, error)
+	DeleteUsers(ctx context.Context, in *DeleteUsersRequest, opts ...grpc.CallOption) (*DeleteUsersResponse, error)
+	GetUsers(ctx context.Context, in *GetUsersRequest, opts ...grpc.CallOption) (*GetUsersResponse, error)
 }
 
 type chickareeDBClient struct {
@@ -41,6 +64,15 @@ func (c *chickareeDBClient) GetServers(ctx context.Context, in *GetServersReques
 	return out, nil
 }
 
+func (c *chickareeDBClient) GetShards(ctx context.Context, in *GetShardsRequest, opts ...grpc.CallOption) (*GetShardsResponse, error) {
+	out := new(GetShardsResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/GetShards", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *chickareeDBClient) EventLog(ctx context.Context, in *EventLogRequest, opts ...grpc.CallOption) (ChickareeDB_EventLogClient, error) {
 	stream, err := c.cc.NewStream(ctx, &ChickareeDB_ServiceDesc.Streams[0], "/client.v1.ChickareeDB/EventLog", opts...)
 	if err != nil {
@@ -91,14 +123,235 @@ func (c *chickareeDBClient) Set(ctx context.Context, in *SetRequest, opts ...grp
 	return out, nil
 }
 
+func (c *chickareeDBClient) SetBit(ctx context.Context, in *SetBitRequest, opts ...grpc.CallOption) (*SetBitResponse, error) {
+	out := new(SetBitResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/SetBit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) GetBit(ctx context.Context, in *GetBitRequest, opts ...grpc.CallOption) (*GetBitResponse, error) {
+	out := new(GetBitResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/GetBit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) BitCount(ctx context.Context, in *BitCountRequest, opts ...grpc.CallOption) (*BitCountResponse, error) {
+	out := new(BitCountResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/BitCount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) BitPos(ctx context.Context, in *BitPosRequest, opts ...grpc.CallOption) (*BitPosResponse, error) {
+	out := new(BitPosResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/BitPos", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) BitOp(ctx context.Context, in *BitOpRequest, opts ...grpc.CallOption) (*BitOpResponse, error) {
+	out := new(BitOpResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/BitOp", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) BitField(ctx context.Context, in *BitFieldRequest, opts ...grpc.CallOption) (*BitFieldResponse, error) {
+	out := new(BitFieldResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/BitField", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) PFAdd(ctx context.Context, in *PFAddRequest, opts ...grpc.CallOption) (*PFAddResponse, error) {
+	out := new(PFAddResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/PFAdd", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) PFCount(ctx context.Context, in *PFCountRequest, opts ...grpc.CallOption) (*PFCountResponse, error) {
+	out := new(PFCountResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/PFCount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) PFMerge(ctx context.Context, in *PFMergeRequest, opts ...grpc.CallOption) (*PFMergeResponse, error) {
+	out := new(PFMergeResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/PFMerge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) GeoAdd(ctx context.Context, in *GeoAddRequest, opts ...grpc.CallOption) (*GeoAddResponse, error) {
+	out := new(GeoAddResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/GeoAdd", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) GeoPos(ctx context.Context, in *GeoPosRequest, opts ...grpc.CallOption) (*GeoPosResponse, error) {
+	out := new(GeoPosResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/GeoPos", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) GeoDist(ctx context.Context, in *GeoDistRequest, opts ...grpc.CallOption) (*GeoDistResponse, error) {
+	out := new(GeoDistResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/GeoDist", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) GeoHash(ctx context.Context, in *GeoHashRequest, opts ...grpc.CallOption) (*GeoHashResponse, error) {
+	out := new(GeoHashResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/GeoHash", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) GeoSearch(ctx context.Context, in *GeoSearchRequest, opts ...grpc.CallOption) (*GeoSearchResponse, error) {
+	out := new(GeoSearchResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/GeoSearch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*LockResponse, error) {
+	out := new(LockResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/Lock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*UnlockResponse, error) {
+	out := new(UnlockResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/Unlock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*RefreshResponse, error) {
+	out := new(RefreshResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/Refresh", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) Expire(ctx context.Context, in *ExpireRequest, opts ...grpc.CallOption) (*ExpireResponse, error) {
+	out := new(ExpireResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/Expire", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) TTL(ctx context.Context, in *TTLRequest, opts ...grpc.CallOption) (*TTLResponse, error) {
+	out := new(TTLResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/TTL", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) SetUser(ctx context.Context, in *SetUserRequest, opts ...grpc.CallOption) (*SetUserResponse, error) {
+	out := new(SetUserResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/SetUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) DeleteUsers(ctx context.Context, in *DeleteUsersRequest, opts ...grpc.CallOption) (*DeleteUsersResponse, error) {
+	out := new(DeleteUsersResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/DeleteUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chickareeDBClient) GetUsers(ctx context.Context, in *GetUsersRequest, opts ...grpc.CallOption) (*GetUsersResponse, error) {
+	out := new(GetUsersResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.ChickareeDB/GetUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ChickareeDBServer is the server API for ChickareeDB service.
 // All implementations must embed UnimplementedChickareeDBServer
 // for forward compatibility
 type ChickareeDBServer interface {
 	GetServers(context.Context, *GetServersRequest) (*GetServersResponse, error)
+	GetShards(context.Context, *GetShardsRequest) (*GetShardsResponse, error)
 	EventLog(*EventLogRequest, ChickareeDB_EventLogServer) error
 	Get(context.Context, *GetRequest) (*GetResponse, error)
 	Set(context.Context, *SetRequest) (*SetResponse, error)
+	SetBit(context.Context, *SetBitRequest) (*SetBitResponse, error)
+	GetBit(context.Context, *GetBitRequest) (*GetBitResponse, error)
+	BitCount(context.Context, *BitCountRequest) (*BitCountResponse, error)
+	BitPos(context.Context, *BitPosRequest) (*BitPosResponse, error)
+	BitOp(context.Context, *BitOpRequest) (*BitOpResponse, error)
+	BitField(context.Context, *BitFieldRequest) (*BitFieldResponse, error)
+	PFAdd(context.Context, *PFAddRequest) (*PFAddResponse, error)
+	PFCount(context.Context, *PFCountRequest) (*PFCountResponse, error)
+	PFMerge(context.Context, *PFMergeRequest) (*PFMergeResponse, error)
+	GeoAdd(context.Context, *GeoAddRequest) (*GeoAddResponse, error)
+	GeoPos(context.Context, *GeoPosRequest) (*GeoPosResponse, error)
+	GeoDist(context.Context, *GeoDistRequest) (*GeoDistResponse, error)
+	GeoHash(context.Context, *GeoHashRequest) (*GeoHashResponse, error)
+	GeoSearch(context.Context, *GeoSearchRequest) (*GeoSearchResponse, error)
+	Lock(context.Context, *LockRequest) (*LockResponse, error)
+	Unlock(context.Context, *UnlockRequest) (*UnlockResponse, error)
+	Refresh(context.Context, *RefreshRequest) (*RefreshResponse, error)
+	Expire(context.Context, *ExpireRequest) (*ExpireResponse, error)
+	TTL(context.Context, *TTLRequest) (*TTLResponse, error)
+	SetUser(context.Context, *SetUserRequest) (*SetUserResponse, error)
+	DeleteUsers(context.Context, *DeleteUsersRequest) (*DeleteUsersResponse, error)
+	GetUsers(context.Context, *GetUsersRequest) (*GetUsersResponse, error)
 	mustEmbedUnimplementedChickareeDBServer()
 }
 
@@ -109,6 +362,9 @@ type UnimplementedChickareeDBServer struct {
 func (UnimplementedChickareeDBServer) GetServers(context.Context, *GetServersRequest) (*GetServersResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetServers not implemented")
 }
+func (UnimplementedChickareeDBServer) GetShards(context.Context, *GetShardsRequest) (*GetShardsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetShards not implemented")
+}
 func (UnimplementedChickareeDBServer) EventLog(*EventLogRequest, ChickareeDB_EventLogServer) error {
 	return status.Errorf(codes.Unimplemented, "method EventLog not implemented")
 }
@@ -118,6 +374,72 @@ func (UnimplementedChickareeDBServer) Get(context.Context, *GetRequest) (*GetRes
 func (UnimplementedChickareeDBServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
 }
+func (UnimplementedChickareeDBServer) SetBit(context.Context, *SetBitRequest) (*SetBitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetBit not implemented")
+}
+func (UnimplementedChickareeDBServer) GetBit(context.Context, *GetBitRequest) (*GetBitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBit not implemented")
+}
+func (UnimplementedChickareeDBServer) BitCount(context.Context, *BitCountRequest) (*BitCountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BitCount not implemented")
+}
+func (UnimplementedChickareeDBServer) BitPos(context.Context, *BitPosRequest) (*BitPosResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BitPos not implemented")
+}
+func (UnimplementedChickareeDBServer) BitOp(context.Context, *BitOpRequest) (*BitOpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BitOp not implemented")
+}
+func (UnimplementedChickareeDBServer) BitField(context.Context, *BitFieldRequest) (*BitFieldResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BitField not implemented")
+}
+func (UnimplementedChickareeDBServer) PFAdd(context.Context, *PFAddRequest) (*PFAddResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PFAdd not implemented")
+}
+func (UnimplementedChickareeDBServer) PFCount(context.Context, *PFCountRequest) (*PFCountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PFCount not implemented")
+}
+func (UnimplementedChickareeDBServer) PFMerge(context.Context, *PFMergeRequest) (*PFMergeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PFMerge not implemented")
+}
+func (UnimplementedChickareeDBServer) GeoAdd(context.Context, *GeoAddRequest) (*GeoAddResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GeoAdd not implemented")
+}
+func (UnimplementedChickareeDBServer) GeoPos(context.Context, *GeoPosRequest) (*GeoPosResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GeoPos not implemented")
+}
+func (UnimplementedChickareeDBServer) GeoDist(context.Context, *GeoDistRequest) (*GeoDistResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GeoDist not implemented")
+}
+func (UnimplementedChickareeDBServer) GeoHash(context.Context, *GeoHashRequest) (*GeoHashResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GeoHash not implemented")
+}
+func (UnimplementedChickareeDBServer) GeoSearch(context.Context, *GeoSearchRequest) (*GeoSearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GeoSearch not implemented")
+}
+func (UnimplementedChickareeDBServer) Lock(context.Context, *LockRequest) (*LockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lock not implemented")
+}
+func (UnimplementedChickareeDBServer) Unlock(context.Context, *UnlockRequest) (*UnlockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unlock not implemented")
+}
+func (UnimplementedChickareeDBServer) Refresh(context.Context, *RefreshRequest) (*RefreshResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Refresh not implemented")
+}
+func (UnimplementedChickareeDBServer) Expire(context.Context, *ExpireRequest) (*ExpireResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Expire not implemented")
+}
+func (UnimplementedChickareeDBServer) TTL(context.Context, *TTLRequest) (*TTLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TTL not implemented")
+}
+func (UnimplementedChickareeDBServer) SetUser(context.Context, *SetUserRequest) (*SetUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetUser not implemented")
+}
+func (UnimplementedChickareeDBServer) DeleteUsers(context.Context, *DeleteUsersRequest) (*DeleteUsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUsers not implemented")
+}
+func (UnimplementedChickareeDBServer) GetUsers(context.Context, *GetUsersRequest) (*GetUsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUsers not implemented")
+}
 func (UnimplementedChickareeDBServer) mustEmbedUnimplementedChickareeDBServer() {}
 
 // UnsafeChickareeDBServer may be embedded to opt out of forward compatibility for this service.
@@ -149,6 +471,24 @@ func _ChickareeDB_GetServers_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ChickareeDB_GetShards_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetShardsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).GetShards(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/GetShards",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).GetShards(ctx, req.(*GetShardsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _ChickareeDB_EventLog_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(EventLogRequest)
 	if err := stream.RecvMsg(m); err != nil {
@@ -206,32 +546,1362 @@ func _ChickareeDB_Set_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
-// ChickareeDB_ServiceDesc is the grpc.ServiceDesc for ChickareeDB service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var ChickareeDB_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "client.v1.ChickareeDB",
-	HandlerType: (*ChickareeDBServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "GetServers",
-			Handler:    _ChickareeDB_GetServers_Handler,
-		},
-		{
-			MethodName: "Get",
-			Handler:    _ChickareeDB_Get_Handler,
-		},
-		{
-			MethodName: "Set",
-			Handler:    _ChickareeDB_Set_Handler,
-		},
-	},
-	Streams: []grpc.StreamDesc{
-		{
-			StreamName:    "EventLog",
-			Handler:       _ChickareeDB_EventLog_Handler,
-			ServerStreams: true,
+func _ChickareeDB_SetBit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetBitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).SetBit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/SetBit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).SetBit(ctx, req.(*SetBitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_GetBit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).GetBit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/GetBit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).GetBit(ctx, req.(*GetBitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_BitCount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BitCountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).BitCount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/BitCount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).BitCount(ctx, req.(*BitCountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_BitPos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BitPosRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).BitPos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/BitPos",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).BitPos(ctx, req.(*BitPosRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_BitOp_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BitOpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).BitOp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/BitOp",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).BitOp(ctx, req.(*BitOpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_BitField_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BitFieldRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).BitField(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/BitField",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).BitField(ctx, req.(*BitFieldRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_PFAdd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PFAddRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).PFAdd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/PFAdd",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).PFAdd(ctx, req.(*PFAddRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_PFCount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PFCountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).PFCount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/PFCount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).PFCount(ctx, req.(*PFCountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_PFMerge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PFMergeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).PFMerge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/PFMerge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).PFMerge(ctx, req.(*PFMergeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_GeoAdd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GeoAddRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).GeoAdd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/GeoAdd",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).GeoAdd(ctx, req.(*GeoAddRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_GeoPos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GeoPosRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).GeoPos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/GeoPos",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).GeoPos(ctx, req.(*GeoPosRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_GeoDist_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GeoDistRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).GeoDist(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/GeoDist",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).GeoDist(ctx, req.(*GeoDistRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_GeoHash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GeoHashRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).GeoHash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/GeoHash",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).GeoHash(ctx, req.(*GeoHashRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_GeoSearch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GeoSearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).GeoSearch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/GeoSearch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).GeoSearch(ctx, req.(*GeoSearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_Lock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).Lock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/Lock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).Lock(ctx, req.(*LockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_Unlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).Unlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/Unlock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).Unlock(ctx, req.(*UnlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_Refresh_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).Refresh(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/Refresh",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).Refresh(ctx, req.(*RefreshRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_Expire_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExpireRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).Expire(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/Expire",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).Expire(ctx, req.(*ExpireRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_TTL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TTLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).TTL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/TTL",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).TTL(ctx, req.(*TTLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_SetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).SetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/SetUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).SetUser(ctx, req.(*SetUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_DeleteUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).DeleteUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/DeleteUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).DeleteUsers(ctx, req.(*DeleteUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChickareeDB_GetUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChickareeDBServer).GetUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.ChickareeDB/GetUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChickareeDBServer).GetUsers(ctx, req.(*GetUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ChickareeDB_ServiceDesc is the grpc.ServiceDesc for ChickareeDB service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ChickareeDB_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "client.v1.ChickareeDB",
+	HandlerType: (*ChickareeDBServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetServers",
+			Handler:    _ChickareeDB_GetServers_Handler,
+		},
+		{
+			MethodName: "GetShards",
+			Handler:    _ChickareeDB_GetShards_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _ChickareeDB_Get_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _ChickareeDB_Set_Handler,
+		},
+		{
+			MethodName: "SetBit",
+			Handler:    _ChickareeDB_SetBit_Handler,
+		},
+		{
+			MethodName: "GetBit",
+			Handler:    _ChickareeDB_GetBit_Handler,
+		},
+		{
+			MethodName: "BitCount",
+			Handler:    _ChickareeDB_BitCount_Handler,
+		},
+		{
+			MethodName: "BitPos",
+			Handler:    _ChickareeDB_BitPos_Handler,
+		},
+		{
+			MethodName: "BitOp",
+			Handler:    _ChickareeDB_BitOp_Handler,
+		},
+		{
+			MethodName: "BitField",
+			Handler:    _ChickareeDB_BitField_Handler,
+		},
+		{
+			MethodName: "PFAdd",
+			Handler:    _ChickareeDB_PFAdd_Handler,
+		},
+		{
+			MethodName: "PFCount",
+			Handler:    _ChickareeDB_PFCount_Handler,
+		},
+		{
+			MethodName: "PFMerge",
+			Handler:    _ChickareeDB_PFMerge_Handler,
+		},
+		{
+			MethodName: "GeoAdd",
+			Handler:    _ChickareeDB_GeoAdd_Handler,
+		},
+		{
+			MethodName: "GeoPos",
+			Handler:    _ChickareeDB_GeoPos_Handler,
+		},
+		{
+			MethodName: "GeoDist",
+			Handler:    _ChickareeDB_GeoDist_Handler,
+		},
+		{
+			MethodName: "GeoHash",
+			Handler:    _ChickareeDB_GeoHash_Handler,
+		},
+		{
+			MethodName: "GeoSearch",
+			Handler:    _ChickareeDB_GeoSearch_Handler,
+		},
+		{
+			MethodName: "Lock",
+			Handler:    _ChickareeDB_Lock_Handler,
+		},
+		{
+			MethodName: "Unlock",
+			Handler:    _ChickareeDB_Unlock_Handler,
+		},
+		{
+			MethodName: "Refresh",
+			Handler:    _ChickareeDB_Refresh_Handler,
+		},
+		{
+			MethodName: "Expire",
+			Handler:    _ChickareeDB_Expire_Handler,
+		},
+		{
+			MethodName: "TTL",
+			Handler:    _ChickareeDB_TTL_Handler,
+		},
+		{
+			MethodName: "SetUser",
+			Handler:    _ChickareeDB_SetUser_Handler,
+		},
+		{
+			MethodName: "DeleteUsers",
+			Handler:    _ChickareeDB_DeleteUsers_Handler,
+		},
+		{
+			MethodName: "GetUsers",
+			Handler:    _ChickareeDB_GetUsers_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "EventLog",
+			Handler:       _ChickareeDB_EventLog_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "client.proto",
+}
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	AddVoter(ctx context.Context, in *AddVoterRequest, opts ...grpc.CallOption) (*AddVoterResponse, error)
+	AddNonvoter(ctx context.Context, in *AddNonvoterRequest, opts ...grpc.CallOption) (*AddNonvoterResponse, error)
+	RemoveServer(ctx context.Context, in *RemoveServerRequest, opts ...grpc.CallOption) (*RemoveServerResponse, error)
+	DemoteVoter(ctx context.Context, in *DemoteVoterRequest, opts ...grpc.CallOption) (*DemoteVoterResponse, error)
+	TransferLeadership(ctx context.Context, in *TransferLeadershipRequest, opts ...grpc.CallOption) (*TransferLeadershipResponse, error)
+	GetConfiguration(ctx context.Context, in *GetConfigurationRequest, opts ...grpc.CallOption) (*GetConfigurationResponse, error)
+	ServerStats(ctx context.Context, in *ServerStatsRequest, opts ...grpc.CallOption) (*ServerStatsResponse, error)
+	AutopilotHealth(ctx context.Context, in *AutopilotHealthRequest, opts ...grpc.CallOption) (*AutopilotHealthResponse, error)
+	DumpSlot(ctx context.Context, in *DumpSlotRequest, opts ...grpc.CallOption) (*DumpSlotResponse, error)
+	RestoreKeys(ctx context.Context, in *RestoreKeysRequest, opts ...grpc.CallOption) (*RestoreKeysResponse, error)
+	SetSlotState(ctx context.Context, in *SlotStateRequest, opts ...grpc.CallOption) (*SlotStateResponse, error)
+	GetSlots(ctx context.Context, in *GetSlotsRequest, opts ...grpc.CallOption) (*SlotConfig, error)
+	MigrateSlots(ctx context.Context, in *MigrateSlotsRequest, opts ...grpc.CallOption) (*MigrateSlotsResponse, error)
+	Rebalance(ctx context.Context, in *RebalanceRequest, opts ...grpc.CallOption) (*RebalanceResponse, error)
+	ReadLog(ctx context.Context, in *ReadLogRequest, opts ...grpc.CallOption) (*ReadLogResponse, error)
+	Replicate(ctx context.Context, in *ReplicateRequest, opts ...grpc.CallOption) (*ReplicateResponse, error)
+	SetReadOnly(ctx context.Context, in *ReadOnlyRequest, opts ...grpc.CallOption) (*ReadOnlyResponse, error)
+	GetReadOnly(ctx context.Context, in *GetReadOnlyRequest, opts ...grpc.CallOption) (*ReadOnlyResponse, error)
+	ListKeys(ctx context.Context, in *KeyringRequest, opts ...grpc.CallOption) (*KeyringResponse, error)
+	InstallKey(ctx context.Context, in *KeyringRequest, opts ...grpc.CallOption) (*KeyringResponse, error)
+	UseKey(ctx context.Context, in *KeyringRequest, opts ...grpc.CallOption) (*KeyringResponse, error)
+	RemoveKey(ctx context.Context, in *KeyringRequest, opts ...grpc.CallOption) (*KeyringResponse, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) AddVoter(ctx context.Context, in *AddVoterRequest, opts ...grpc.CallOption) (*AddVoterResponse, error) {
+	out := new(AddVoterResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/AddVoter", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) AddNonvoter(ctx context.Context, in *AddNonvoterRequest, opts ...grpc.CallOption) (*AddNonvoterResponse, error) {
+	out := new(AddNonvoterResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/AddNonvoter", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RemoveServer(ctx context.Context, in *RemoveServerRequest, opts ...grpc.CallOption) (*RemoveServerResponse, error) {
+	out := new(RemoveServerResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/RemoveServer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DemoteVoter(ctx context.Context, in *DemoteVoterRequest, opts ...grpc.CallOption) (*DemoteVoterResponse, error) {
+	out := new(DemoteVoterResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/DemoteVoter", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) TransferLeadership(ctx context.Context, in *TransferLeadershipRequest, opts ...grpc.CallOption) (*TransferLeadershipResponse, error) {
+	out := new(TransferLeadershipResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/TransferLeadership", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetConfiguration(ctx context.Context, in *GetConfigurationRequest, opts ...grpc.CallOption) (*GetConfigurationResponse, error) {
+	out := new(GetConfigurationResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/GetConfiguration", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ServerStats(ctx context.Context, in *ServerStatsRequest, opts ...grpc.CallOption) (*ServerStatsResponse, error) {
+	out := new(ServerStatsResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/ServerStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) AutopilotHealth(ctx context.Context, in *AutopilotHealthRequest, opts ...grpc.CallOption) (*AutopilotHealthResponse, error) {
+	out := new(AutopilotHealthResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/AutopilotHealth", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DumpSlot(ctx context.Context, in *DumpSlotRequest, opts ...grpc.CallOption) (*DumpSlotResponse, error) {
+	out := new(DumpSlotResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/DumpSlot", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RestoreKeys(ctx context.Context, in *RestoreKeysRequest, opts ...grpc.CallOption) (*RestoreKeysResponse, error) {
+	out := new(RestoreKeysResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/RestoreKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetSlotState(ctx context.Context, in *SlotStateRequest, opts ...grpc.CallOption) (*SlotStateResponse, error) {
+	out := new(SlotStateResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/SetSlotState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetSlots(ctx context.Context, in *GetSlotsRequest, opts ...grpc.CallOption) (*SlotConfig, error) {
+	out := new(SlotConfig)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/GetSlots", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) MigrateSlots(ctx context.Context, in *MigrateSlotsRequest, opts ...grpc.CallOption) (*MigrateSlotsResponse, error) {
+	out := new(MigrateSlotsResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/MigrateSlots", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Rebalance(ctx context.Context, in *RebalanceRequest, opts ...grpc.CallOption) (*RebalanceResponse, error) {
+	out := new(RebalanceResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/Rebalance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ReadLog(ctx context.Context, in *ReadLogRequest, opts ...grpc.CallOption) (*ReadLogResponse, error) {
+	out := new(ReadLogResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/ReadLog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Replicate(ctx context.Context, in *ReplicateRequest, opts ...grpc.CallOption) (*ReplicateResponse, error) {
+	out := new(ReplicateResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/Replicate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetReadOnly(ctx context.Context, in *ReadOnlyRequest, opts ...grpc.CallOption) (*ReadOnlyResponse, error) {
+	out := new(ReadOnlyResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/SetReadOnly", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetReadOnly(ctx context.Context, in *GetReadOnlyRequest, opts ...grpc.CallOption) (*ReadOnlyResponse, error) {
+	out := new(ReadOnlyResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/GetReadOnly", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListKeys(ctx context.Context, in *KeyringRequest, opts ...grpc.CallOption) (*KeyringResponse, error) {
+	out := new(KeyringResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/ListKeys", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) InstallKey(ctx context.Context, in *KeyringRequest, opts ...grpc.CallOption) (*KeyringResponse, error) {
+	out := new(KeyringResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/InstallKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) UseKey(ctx context.Context, in *KeyringRequest, opts ...grpc.CallOption) (*KeyringResponse, error) {
+	out := new(KeyringResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/UseKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RemoveKey(ctx context.Context, in *KeyringRequest, opts ...grpc.CallOption) (*KeyringResponse, error) {
+	out := new(KeyringResponse)
+	err := c.cc.Invoke(ctx, "/client.v1.Admin/RemoveKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	AddVoter(context.Context, *AddVoterRequest) (*AddVoterResponse, error)
+	AddNonvoter(context.Context, *AddNonvoterRequest) (*AddNonvoterResponse, error)
+	RemoveServer(context.Context, *RemoveServerRequest) (*RemoveServerResponse, error)
+	DemoteVoter(context.Context, *DemoteVoterRequest) (*DemoteVoterResponse, error)
+	TransferLeadership(context.Context, *TransferLeadershipRequest) (*TransferLeadershipResponse, error)
+	GetConfiguration(context.Context, *GetConfigurationRequest) (*GetConfigurationResponse, error)
+	ServerStats(context.Context, *ServerStatsRequest) (*ServerStatsResponse, error)
+	AutopilotHealth(context.Context, *AutopilotHealthRequest) (*AutopilotHealthResponse, error)
+	DumpSlot(context.Context, *DumpSlotRequest) (*DumpSlotResponse, error)
+	RestoreKeys(context.Context, *RestoreKeysRequest) (*RestoreKeysResponse, error)
+	SetSlotState(context.Context, *SlotStateRequest) (*SlotStateResponse, error)
+	GetSlots(context.Context, *GetSlotsRequest) (*SlotConfig, error)
+	MigrateSlots(context.Context, *MigrateSlotsRequest) (*MigrateSlotsResponse, error)
+	Rebalance(context.Context, *RebalanceRequest) (*RebalanceResponse, error)
+	ReadLog(context.Context, *ReadLogRequest) (*ReadLogResponse, error)
+	Replicate(context.Context, *ReplicateRequest) (*ReplicateResponse, error)
+	SetReadOnly(context.Context, *ReadOnlyRequest) (*ReadOnlyResponse, error)
+	GetReadOnly(context.Context, *GetReadOnlyRequest) (*ReadOnlyResponse, error)
+	ListKeys(context.Context, *KeyringRequest) (*KeyringResponse, error)
+	InstallKey(context.Context, *KeyringRequest) (*KeyringResponse, error)
+	UseKey(context.Context, *KeyringRequest) (*KeyringResponse, error)
+	RemoveKey(context.Context, *KeyringRequest) (*KeyringResponse, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) AddVoter(context.Context, *AddVoterRequest) (*AddVoterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddVoter not implemented")
+}
+func (UnimplementedAdminServer) AddNonvoter(context.Context, *AddNonvoterRequest) (*AddNonvoterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddNonvoter not implemented")
+}
+func (UnimplementedAdminServer) RemoveServer(context.Context, *RemoveServerRequest) (*RemoveServerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveServer not implemented")
+}
+func (UnimplementedAdminServer) DemoteVoter(context.Context, *DemoteVoterRequest) (*DemoteVoterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DemoteVoter not implemented")
+}
+func (UnimplementedAdminServer) TransferLeadership(context.Context, *TransferLeadershipRequest) (*TransferLeadershipResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TransferLeadership not implemented")
+}
+func (UnimplementedAdminServer) GetConfiguration(context.Context, *GetConfigurationRequest) (*GetConfigurationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConfiguration not implemented")
+}
+func (UnimplementedAdminServer) ServerStats(context.Context, *ServerStatsRequest) (*ServerStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ServerStats not implemented")
+}
+func (UnimplementedAdminServer) AutopilotHealth(context.Context, *AutopilotHealthRequest) (*AutopilotHealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AutopilotHealth not implemented")
+}
+func (UnimplementedAdminServer) DumpSlot(context.Context, *DumpSlotRequest) (*DumpSlotResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DumpSlot not implemented")
+}
+func (UnimplementedAdminServer) RestoreKeys(context.Context, *RestoreKeysRequest) (*RestoreKeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreKeys not implemented")
+}
+func (UnimplementedAdminServer) SetSlotState(context.Context, *SlotStateRequest) (*SlotStateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetSlotState not implemented")
+}
+func (UnimplementedAdminServer) GetSlots(context.Context, *GetSlotsRequest) (*SlotConfig, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSlots not implemented")
+}
+func (UnimplementedAdminServer) MigrateSlots(context.Context, *MigrateSlotsRequest) (*MigrateSlotsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MigrateSlots not implemented")
+}
+func (UnimplementedAdminServer) Rebalance(context.Context, *RebalanceRequest) (*RebalanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rebalance not implemented")
+}
+func (UnimplementedAdminServer) ReadLog(context.Context, *ReadLogRequest) (*ReadLogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadLog not implemented")
+}
+func (UnimplementedAdminServer) Replicate(context.Context, *ReplicateRequest) (*ReplicateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Replicate not implemented")
+}
+func (UnimplementedAdminServer) SetReadOnly(context.Context, *ReadOnlyRequest) (*ReadOnlyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetReadOnly not implemented")
+}
+func (UnimplementedAdminServer) GetReadOnly(context.Context, *GetReadOnlyRequest) (*ReadOnlyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReadOnly not implemented")
+}
+func (UnimplementedAdminServer) ListKeys(context.Context, *KeyringRequest) (*KeyringResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListKeys not implemented")
+}
+func (UnimplementedAdminServer) InstallKey(context.Context, *KeyringRequest) (*KeyringResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InstallKey not implemented")
+}
+func (UnimplementedAdminServer) UseKey(context.Context, *KeyringRequest) (*KeyringResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UseKey not implemented")
+}
+func (UnimplementedAdminServer) RemoveKey(context.Context, *KeyringRequest) (*KeyringResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveKey not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_AddVoter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddVoterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).AddVoter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/AddVoter",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).AddVoter(ctx, req.(*AddVoterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_AddNonvoter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddNonvoterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).AddNonvoter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/AddNonvoter",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).AddNonvoter(ctx, req.(*AddNonvoterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RemoveServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RemoveServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/RemoveServer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RemoveServer(ctx, req.(*RemoveServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DemoteVoter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DemoteVoterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DemoteVoter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/DemoteVoter",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DemoteVoter(ctx, req.(*DemoteVoterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_TransferLeadership_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferLeadershipRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).TransferLeadership(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/TransferLeadership",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).TransferLeadership(ctx, req.(*TransferLeadershipRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetConfiguration_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConfigurationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetConfiguration(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/GetConfiguration",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetConfiguration(ctx, req.(*GetConfigurationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ServerStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServerStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ServerStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/ServerStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ServerStats(ctx, req.(*ServerStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_AutopilotHealth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AutopilotHealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).AutopilotHealth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/AutopilotHealth",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).AutopilotHealth(ctx, req.(*AutopilotHealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DumpSlot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DumpSlotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DumpSlot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/DumpSlot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DumpSlot(ctx, req.(*DumpSlotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RestoreKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RestoreKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/RestoreKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RestoreKeys(ctx, req.(*RestoreKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetSlotState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SlotStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetSlotState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/SetSlotState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetSlotState(ctx, req.(*SlotStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetSlots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSlotsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetSlots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/GetSlots",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetSlots(ctx, req.(*GetSlotsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_MigrateSlots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MigrateSlotsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).MigrateSlots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/MigrateSlots",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).MigrateSlots(ctx, req.(*MigrateSlotsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Rebalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RebalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Rebalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/Rebalance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Rebalance(ctx, req.(*RebalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ReadLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ReadLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/ReadLog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ReadLog(ctx, req.(*ReadLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Replicate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplicateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Replicate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/Replicate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Replicate(ctx, req.(*ReplicateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetReadOnly_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadOnlyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetReadOnly(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/SetReadOnly",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetReadOnly(ctx, req.(*ReadOnlyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetReadOnly_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetReadOnlyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetReadOnly(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/GetReadOnly",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetReadOnly(ctx, req.(*GetReadOnlyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyringRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/ListKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListKeys(ctx, req.(*KeyringRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_InstallKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyringRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).InstallKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/InstallKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).InstallKey(ctx, req.(*KeyringRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_UseKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyringRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).UseKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/UseKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).UseKey(ctx, req.(*KeyringRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RemoveKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyringRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RemoveKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/client.v1.Admin/RemoveKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RemoveKey(ctx, req.(*KeyringRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "client.v1.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddVoter",
+			Handler:    _Admin_AddVoter_Handler,
+		},
+		{
+			MethodName: "AddNonvoter",
+			Handler:    _Admin_AddNonvoter_Handler,
+		},
+		{
+			MethodName: "RemoveServer",
+			Handler:    _Admin_RemoveServer_Handler,
+		},
+		{
+			MethodName: "DemoteVoter",
+			Handler:    _Admin_DemoteVoter_Handler,
+		},
+		{
+			MethodName: "TransferLeadership",
+			Handler:    _Admin_TransferLeadership_Handler,
+		},
+		{
+			MethodName: "GetConfiguration",
+			Handler:    _Admin_GetConfiguration_Handler,
+		},
+		{
+			MethodName: "ServerStats",
+			Handler:    _Admin_ServerStats_Handler,
+		},
+		{
+			MethodName: "AutopilotHealth",
+			Handler:    _Admin_AutopilotHealth_Handler,
+		},
+		{
+			MethodName: "DumpSlot",
+			Handler:    _Admin_DumpSlot_Handler,
+		},
+		{
+			MethodName: "RestoreKeys",
+			Handler:    _Admin_RestoreKeys_Handler,
+		},
+		{
+			MethodName: "SetSlotState",
+			Handler:    _Admin_SetSlotState_Handler,
+		},
+		{
+			MethodName: "GetSlots",
+			Handler:    _Admin_GetSlots_Handler,
+		},
+		{
+			MethodName: "MigrateSlots",
+			Handler:    _Admin_MigrateSlots_Handler,
+		},
+		{
+			MethodName: "Rebalance",
+			Handler:    _Admin_Rebalance_Handler,
+		},
+		{
+			MethodName: "ReadLog",
+			Handler:    _Admin_ReadLog_Handler,
+		},
+		{
+			MethodName: "Replicate",
+			Handler:    _Admin_Replicate_Handler,
+		},
+		{
+			MethodName: "SetReadOnly",
+			Handler:    _Admin_SetReadOnly_Handler,
+		},
+		{
+			MethodName: "GetReadOnly",
+			Handler:    _Admin_GetReadOnly_Handler,
+		},
+		{
+			MethodName: "ListKeys",
+			Handler:    _Admin_ListKeys_Handler,
+		},
+		{
+			MethodName: "InstallKey",
+			Handler:    _Admin_InstallKey_Handler,
+		},
+		{
+			MethodName: "UseKey",
+			Handler:    _Admin_UseKey_Handler,
+		},
+		{
+			MethodName: "RemoveKey",
+			Handler:    _Admin_RemoveKey_Handler,
 		},
 	},
+	Streams:  []grpc.StreamDesc{},
 	Metadata: "client.proto",
 }
@@ -0,0 +1,137 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Seeds are host:port addresses or DNS names resolved before every join
+// attempt so pods of a headless service can start in any order:
+//
+//	dns+name:port   every A/AAAA record of name with the port
+//	dnssrv+name     the target and port of every SRV record of name
+const (
+	dnsPrefix    = "dns+"
+	dnsSRVPrefix = "dnssrv+"
+)
+
+const (
+	defaultRetryJoinInterval = time.Second
+	maxRetryJoinInterval     = 30 * time.Second
+	dnsTimeout               = 5 * time.Second
+)
+
+type resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// ParseSeeds splits a comma separated list of seeds.
+func ParseSeeds(val string) []string {
+	var seeds []string
+	for _, seed := range strings.Split(val, ",") {
+		if seed = strings.TrimSpace(seed); seed != "" {
+			seeds = append(seeds, seed)
+		}
+	}
+	return seeds
+}
+
+// resolveSeeds returns the addresses of the seeds, a seed that can not be
+// resolved is skipped as its pods may not exist yet.
+func resolveSeeds(ctx context.Context, r resolver, seeds []string) []string {
+	var addrs []string
+	seen := make(map[string]bool)
+	add := func(addr string) {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	for _, seed := range seeds {
+		switch {
+		case strings.HasPrefix(seed, dnsSRVPrefix):
+			name := strings.TrimPrefix(seed, dnsSRVPrefix)
+			_, records, err := r.LookupSRV(ctx, "", "", name)
+			if err != nil {
+				log.Warn().Err(err).Str("seed", seed).Msg("unable to resolve seed")
+				continue
+			}
+			for _, srv := range records {
+				add(net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+			}
+		case strings.HasPrefix(seed, dnsPrefix):
+			host, port, err := net.SplitHostPort(strings.TrimPrefix(seed, dnsPrefix))
+			if err != nil {
+				log.Warn().Err(err).Str("seed", seed).Msg("invalid seed")
+				continue
+			}
+			hosts, err := r.LookupHost(ctx, host)
+			if err != nil {
+				log.Warn().Err(err).Str("seed", seed).Msg("unable to resolve seed")
+				continue
+			}
+			for _, h := range hosts {
+				add(net.JoinHostPort(h, port))
+			}
+		default:
+			add(seed)
+		}
+	}
+	return addrs
+}
+
+// retryJoin joins the seeds until one other member answers, waiting twice
+// as long after each failed attempt. It gives up after RetryJoinMax
+// attempts when set.
+func (m *Membership) retryJoin() {
+	interval := m.RetryJoinInterval
+	for attempt := 1; ; attempt++ {
+		err := m.join()
+		if err == nil {
+			return
+		}
+		if m.RetryJoinMax > 0 && attempt >= m.RetryJoinMax {
+			log.Error().Err(err).Int("attempts", attempt).Strs("seeds", m.StartJoinAddrs).Msg("giving up joining cluster")
+			return
+		}
+		log.Warn().Err(err).Int("attempt", attempt).Dur("retry", interval).Msg("unable to join cluster")
+		select {
+		case <-m.shutdown:
+			return
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxRetryJoinInterval {
+			interval = maxRetryJoinInterval
+		}
+	}
+}
+
+func (m *Membership) join() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+	local := m.serf.LocalMember()
+	self := net.JoinHostPort(local.Addr.String(), strconv.Itoa(int(local.Port)))
+	var addrs []string
+	for _, addr := range resolveSeeds(ctx, m.resolver, m.StartJoinAddrs) {
+		// joining ourselves would count as joining the cluster
+		if addr != self && addr != m.BindAddr {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("no seeds found")
+	}
+	n, err := m.serf.Join(addrs, true)
+	if err != nil && n == 0 {
+		return err
+	}
+	log.Info().Int("joined", n).Strs("addrs", addrs).Msg("joined cluster")
+	return nil
+}
@@ -0,0 +1,103 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeResolver struct {
+	hosts map[string][]string
+	srvs  map[string][]*net.SRV
+}
+
+func (r fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := r.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func (r fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if records, ok := r.srvs[name]; ok {
+		return name, records, nil
+	}
+	return "", nil, errors.New("no such host")
+}
+
+func TestParseSeeds(t *testing.T) {
+	seeds := ParseSeeds(" a:8401, dnssrv+_serf._tcp.chickaree,,dns+b:8401 ")
+	expected := []string{"a:8401", "dnssrv+_serf._tcp.chickaree", "dns+b:8401"}
+	if !reflect.DeepEqual(seeds, expected) {
+		t.Errorf("expected %v got %v", expected, seeds)
+	}
+}
+
+func TestResolveSeeds(t *testing.T) {
+	r := fakeResolver{
+		hosts: map[string][]string{"storage": {"10.0.0.1", "10.0.0.2"}},
+		srvs: map[string][]*net.SRV{"_serf-tcp._tcp.storage": {
+			{Target: "storage-0.storage.", Port: 8401},
+			{Target: "storage-1.storage.", Port: 8401},
+		}},
+	}
+	addrs := resolveSeeds(context.Background(), r, []string{
+		"10.0.0.9:8401",
+		"dns+storage:8401",
+		"dns+missing:8401",
+		"dnssrv+_serf-tcp._tcp.storage",
+		"10.0.0.1:8401",
+	})
+	expected := []string{
+		"10.0.0.9:8401",
+		"10.0.0.1:8401",
+		"10.0.0.2:8401",
+		"storage-0.storage:8401",
+		"storage-1.storage:8401",
+	}
+	if !reflect.DeepEqual(addrs, expected) {
+		t.Errorf("expected %v got %v", expected, addrs)
+	}
+}
+
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestRetryJoin(t *testing.T) {
+	seed := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	// the seed starts after the member trying to join it
+	first, err := New(Config{
+		NodeName:          "first",
+		BindAddr:          fmt.Sprintf("127.0.0.1:%d", freePort(t)),
+		StartJoinAddrs:    []string{seed},
+		RetryJoinInterval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Leave()
+	time.Sleep(100 * time.Millisecond)
+	second, err := New(Config{NodeName: "second", BindAddr: seed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Leave()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(second.Members()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the retried join to succeed got %d members", len(second.Members()))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
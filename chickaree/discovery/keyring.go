@@ -0,0 +1,134 @@
+package discovery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/hashicorp/serf/serf"
+	"github.com/rs/zerolog/log"
+)
+
+// Gossip is encrypted once a key is configured. The keyring is kept in
+// KeyringFile, which serf rewrites whenever keys are installed, used or
+// removed, so rotated keys survive a restart. The configured key only
+// seeds a new keyring file.
+
+var ErrEncryptionDisabled = errors.New("gossip encryption is not enabled")
+
+// loadKeyring returns nil when there is neither a keyring file nor a key.
+func loadKeyring(path, key string) (*memberlist.Keyring, error) {
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err == nil {
+			keyring, err := parseKeyring(b)
+			if err != nil {
+				log.Error().Err(err).Str("path", path).Msg("unable to parse keyring")
+				return nil, errors.New("unable to load keyring")
+			}
+			if key != "" && !hasKey(keyring, key) {
+				log.Warn().Str("path", path).Msg("encrypt key is not in the keyring file, using the keyring file")
+			}
+			return keyring, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Error().Err(err).Str("path", path).Msg("unable to read keyring")
+			return nil, errors.New("unable to load keyring")
+		}
+	}
+	if key == "" {
+		return nil, nil
+	}
+	k, err := DecodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		b, err := json.Marshal([]string{key})
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, b, 0600); err != nil {
+			log.Error().Err(err).Str("path", path).Msg("unable to write keyring")
+			return nil, errors.New("unable to load keyring")
+		}
+	}
+	return memberlist.NewKeyring(nil, k)
+}
+
+// parseKeyring reads serf's keyring file, a json list of base64 keys with
+// the primary key first.
+func parseKeyring(b []byte) (*memberlist.Keyring, error) {
+	var encoded []string
+	if err := json.Unmarshal(b, &encoded); err != nil {
+		return nil, err
+	}
+	if len(encoded) == 0 {
+		return nil, errors.New("keyring is empty")
+	}
+	keys := make([][]byte, len(encoded))
+	for i, key := range encoded {
+		k, err := DecodeKey(key)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = k
+	}
+	return memberlist.NewKeyring(keys, keys[0])
+}
+
+func hasKey(keyring *memberlist.Keyring, key string) bool {
+	for _, k := range keyring.GetKeys() {
+		if base64.StdEncoding.EncodeToString(k) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeKey decodes a base64 AES key of 16, 24 or 32 bytes.
+func DecodeKey(key string) ([]byte, error) {
+	k, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.New("encrypt key must be base64 encoded")
+	}
+	switch len(k) {
+	case 16, 24, 32:
+		return k, nil
+	}
+	return nil, errors.New("encrypt key must be 16, 24 or 32 bytes")
+}
+
+// ListKeys asks every member for its keys.
+func (m *Membership) ListKeys() (*serf.KeyResponse, error) {
+	if !m.serf.EncryptionEnabled() {
+		return nil, ErrEncryptionDisabled
+	}
+	return m.serf.KeyManager().ListKeys()
+}
+
+// InstallKey adds a key to every member's keyring without using it.
+func (m *Membership) InstallKey(key string) (*serf.KeyResponse, error) {
+	if !m.serf.EncryptionEnabled() {
+		return nil, ErrEncryptionDisabled
+	}
+	return m.serf.KeyManager().InstallKey(key)
+}
+
+// UseKey makes an installed key the one every member encrypts with.
+func (m *Membership) UseKey(key string) (*serf.KeyResponse, error) {
+	if !m.serf.EncryptionEnabled() {
+		return nil, ErrEncryptionDisabled
+	}
+	return m.serf.KeyManager().UseKey(key)
+}
+
+// RemoveKey removes a key that is no longer used from every member.
+func (m *Membership) RemoveKey(key string) (*serf.KeyResponse, error) {
+	if !m.serf.EncryptionEnabled() {
+		return nil, ErrEncryptionDisabled
+	}
+	return m.serf.KeyManager().RemoveKey(key)
+}
@@ -0,0 +1,126 @@
+package discovery
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func TestDecodeKey(t *testing.T) {
+	if _, err := DecodeKey(testKey('a')); err != nil {
+		t.Errorf("expected 32 byte key to be valid: %s", err)
+	}
+	if _, err := DecodeKey(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("expected short key to be invalid")
+	}
+	if _, err := DecodeKey("not base64!"); err == nil {
+		t.Error("expected key that is not base64 to be invalid")
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "serf.keyring")
+
+	keyring, err := loadKeyring(path, "")
+	if err != nil || keyring != nil {
+		t.Fatalf("expected no keyring without a key got %v %v", keyring, err)
+	}
+
+	// the key seeds the keyring file
+	if _, err := loadKeyring(path, testKey('a')); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := fmt.Sprintf("[%q]", testKey('a')); string(b) != expected {
+		t.Errorf("expected keyring file %s got %s", expected, b)
+	}
+
+	// rotated keys in the file win over the configured key
+	content := fmt.Sprintf("[%q,%q]", testKey('b'), testKey('a'))
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyring, err = loadKeyring(path, testKey('a'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyring.GetKeys()) != 2 {
+		t.Errorf("expected 2 keys got %d", len(keyring.GetKeys()))
+	}
+	if primary := base64.StdEncoding.EncodeToString(keyring.GetPrimaryKey()); primary != testKey('b') {
+		t.Errorf("expected first key in file to be primary got %s", primary)
+	}
+
+	if _, err := loadKeyring("", "bad"); err == nil {
+		t.Error("expected invalid key to fail")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	seed := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	first, err := New(Config{
+		NodeName:    "first",
+		BindAddr:    seed,
+		EncryptKey:  testKey('a'),
+		KeyringFile: filepath.Join(t.TempDir(), "serf.keyring"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Leave()
+	second, err := New(Config{
+		NodeName:       "second",
+		BindAddr:       fmt.Sprintf("127.0.0.1:%d", freePort(t)),
+		StartJoinAddrs: []string{seed},
+		EncryptKey:     testKey('a'),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Leave()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(first.Members()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected encrypted join got %d members", len(first.Members()))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if _, err := first.InstallKey(testKey('b')); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.UseKey(testKey('b')); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.RemoveKey(testKey('a')); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := second.ListKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Keys) != 1 || resp.Keys[testKey('b')] != 2 {
+		t.Errorf("expected only the new key on both members got %v", resp.Keys)
+	}
+
+	// the keyring file follows the rotation
+	b, err := os.ReadFile(first.KeyringFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), testKey('b')) || strings.Contains(string(b), testKey('a')) {
+		t.Errorf("expected keyring file to hold only the new key got %s", b)
+	}
+}
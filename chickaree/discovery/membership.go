@@ -3,30 +3,84 @@ package discovery
 import (
 	"errors"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/hashicorp/serf/serf"
 )
 
+const defaultReconcileInterval = 30 * time.Second
+
+// Tags every member advertises through serf.
+const (
+	RPCAddrTag = "rpc_addr"
+	RoleTag    = "role"
+	// ExpectTag is the number of voters a node waits for before
+	// bootstrapping, it is only set with bootstrap-expect.
+	ExpectTag = "expect"
+
+	// RoleVoter members take part in quorum, RoleNonvoter members only
+	// replicate the log to serve reads.
+	RoleVoter    = "voter"
+	RoleNonvoter = "nonvoter"
+)
+
 type Config struct {
-	NodeName       string
-	BindAddr       string
-	Tags           map[string]string
+	NodeName string
+	BindAddr string
+	Tags     map[string]string
+	// StartJoinAddrs are the seeds joined at startup, seeds prefixed with
+	// dns+ or dnssrv+ are looked up before each attempt.
 	StartJoinAddrs []string
+	// RetryJoinInterval is the wait after the first failed join, doubling
+	// up to 30 seconds, defaults to one second.
+	RetryJoinInterval time.Duration
+	// RetryJoinMax is the number of join attempts, 0 retries forever.
+	RetryJoinMax int
+	// EncryptKey is a base64 key encrypting gossip, it seeds KeyringFile
+	// when the file does not exist yet.
+	EncryptKey  string
+	KeyringFile string
+	// ReconcileInterval is how often the leader compares serf members with
+	// the raft configuration, defaults to 30 seconds.
+	ReconcileInterval time.Duration
 }
 
+// Membership keeps the raft configuration in line with serf. Only the
+// leader can change the configuration so followers ignore member events,
+// events missed while leadership changes hands are picked up by the
+// reconcile loop on the new leader. Failed members are left in place for
+// the handler to clean up, a failure is often a restart, and are only
+// removed here once serf reaps them.
 type Membership struct {
 	Config
-	handler Handler
-	serf    *serf.Serf
-	events  chan serf.Event
+	handlers  []Handler
+	resolver  resolver
+	serf      *serf.Serf
+	events    chan serf.Event
+	reconcile chan struct{}
+
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 }
 
-func New(handler Handler, config Config) (*Membership, error) {
+// New joins the serf cluster, each handler manages the membership of one
+// raft group.
+func New(config Config, handlers ...Handler) (*Membership, error) {
+	if config.ReconcileInterval == 0 {
+		config.ReconcileInterval = defaultReconcileInterval
+	}
+	if config.RetryJoinInterval == 0 {
+		config.RetryJoinInterval = defaultRetryJoinInterval
+	}
 	c := &Membership{
-		Config:  config,
-		handler: handler,
+		Config:    config,
+		handlers:  handlers,
+		resolver:  net.DefaultResolver,
+		reconcile: make(chan struct{}, 1),
+		shutdown:  make(chan struct{}),
 	}
 	if err := c.setupSerf(); err != nil {
 		return nil, err
@@ -35,8 +89,12 @@ func New(handler Handler, config Config) (*Membership, error) {
 }
 
 type Handler interface {
-	Join(name, addr string) error
+	// Join adds the member to raft, as a nonvoter when it is a read replica.
+	Join(name, addr string, nonvoter bool) error
 	Leave(name string) error
+	IsLeader() bool
+	// Servers returns the raft address of each server keyed by id.
+	Servers() (map[string]string, error)
 }
 
 func (m *Membership) setupSerf() (err error) {
@@ -55,6 +113,16 @@ func (m *Membership) setupSerf() (err error) {
 	config.EventCh = m.events
 	config.Tags = m.Tags
 	config.NodeName = m.Config.NodeName
+	keyring, err := loadKeyring(m.KeyringFile, m.EncryptKey)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to load keyring")
+		return errors.New("unable to setup serf")
+	}
+	if keyring != nil {
+		log.Info().Int("keys", len(keyring.GetKeys())).Msg("encrypting gossip")
+		config.MemberlistConfig.Keyring = keyring
+		config.KeyringFile = m.KeyringFile
+	}
 	m.serf, err = serf.Create(config)
 	if err != nil {
 		log.Error().Err(err).Msg("unable to create serf config")
@@ -62,12 +130,10 @@ func (m *Membership) setupSerf() (err error) {
 	}
 
 	go m.eventHandler()
-	if m.StartJoinAddrs != nil {
-		_, err = m.serf.Join(m.StartJoinAddrs, true)
-		if err != nil {
-			log.Error().Err(err).Strs("addrs", m.StartJoinAddrs).Msg("unable join")
-			return errors.New("unable to setup serf")
-		}
+	go m.reconcileLoop()
+	// seeds may not be up yet so joining never fails startup
+	if len(m.StartJoinAddrs) > 0 {
+		go m.retryJoin()
 	}
 	log.Info().Msg("serf setup.")
 	return nil
@@ -77,53 +143,134 @@ func (m *Membership) setupSerf() (err error) {
 func (m *Membership) eventHandler() {
 	for e := range m.events {
 		switch e.EventType() {
-		case serf.EventMemberJoin:
+		case serf.EventMemberJoin, serf.EventMemberLeave, serf.EventMemberReap:
+		default:
+			continue
+		}
+		for _, handler := range m.handlers {
+			if !handler.IsLeader() {
+				log.Debug().Str("event", e.String()).Msg("not leader, deferring member event")
+				continue
+			}
 			for _, member := range e.(serf.MemberEvent).Members {
 				if m.isLocal(member) {
 					continue
 				}
-				m.handleJoin(member)
-			}
-		case serf.EventMemberLeave, serf.EventMemberFailed:
-			for _, member := range e.(serf.MemberEvent).Members {
-				if m.isLocal(member) {
-					return
+				switch e.EventType() {
+				case serf.EventMemberJoin:
+					m.handleJoin(handler, member)
+				default:
+					m.handleLeave(handler, member)
 				}
-				m.handleLeave(member)
 			}
 		}
 	}
 }
 
-func (m *Membership) handleJoin(member serf.Member) {
-	if err := m.handler.Join(
+// Reconcile asks the leader to compare serf members against the raft
+// configuration without waiting for the next interval.
+func (m *Membership) Reconcile() {
+	select {
+	case m.reconcile <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Membership) reconcileLoop() {
+	ticker := time.NewTicker(m.ReconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.shutdown:
+			return
+		case <-ticker.C:
+		case <-m.reconcile:
+		}
+		for _, handler := range m.handlers {
+			if !handler.IsLeader() {
+				continue
+			}
+			if err := m.reconcileMembers(handler); err != nil {
+				log.Error().Err(err).Msg("unable to reconcile members")
+			}
+		}
+	}
+}
+
+func (m *Membership) reconcileMembers(handler Handler) error {
+	servers, err := handler.Servers()
+	if err != nil {
+		return err
+	}
+	joins, leaves := diffMembers(m.serf.Members(), servers, m.serf.LocalMember().Name)
+	for _, member := range joins {
+		m.handleJoin(handler, member)
+	}
+	for _, member := range leaves {
+		m.handleLeave(handler, member)
+	}
+	return nil
+}
+
+// diffMembers returns the alive members missing from the raft servers, or
+// registered with a different address, and the servers whose members have
+// left. Servers serf does not know are kept, a new leader may not have
+// heard of every member yet, reaped members are removed by their event and
+// autopilot cleans up the rest. The local node is never included.
+func diffMembers(members []serf.Member, servers map[string]string, local string) ([]serf.Member, []serf.Member) {
+	var joins, leaves []serf.Member
+	for _, member := range members {
+		if member.Name == local {
+			continue
+		}
+		addr, ok := servers[member.Name]
+		switch member.Status {
+		case serf.StatusAlive:
+			if !ok || addr != member.Tags[RPCAddrTag] {
+				joins = append(joins, member)
+			}
+		case serf.StatusLeft:
+			if ok {
+				leaves = append(leaves, member)
+			}
+		}
+	}
+	return joins, leaves
+}
+
+func (m *Membership) handleJoin(handler Handler, member serf.Member) {
+	if err := handler.Join(
 		member.Name,
-		member.Tags["rpc_addr"],
+		member.Tags[RPCAddrTag],
+		member.Tags[RoleTag] == RoleNonvoter,
 	); err != nil {
 		m.logError(err, "failed to join", member)
+		return
 	}
-	log.Info().Str("name", member.Name).Str("addr", member.Tags["rpc_addr"]).Msg("member joined")
+	log.Info().Str("name", member.Name).Str("addr", member.Tags[RPCAddrTag]).Msg("member joined")
 }
-func (m *Membership) handleLeave(member serf.Member) {
-	if err := m.handler.Leave(
+func (m *Membership) handleLeave(handler Handler, member serf.Member) {
+	if err := handler.Leave(
 		member.Name,
 	); err != nil {
 		m.logError(err, "failed to leave", member)
+		return
 	}
-	log.Info().Str("name", member.Name).Str("addr", member.Tags["rpc_addr"]).Msg("member left")
+	log.Info().Str("name", member.Name).Str("addr", member.Tags[RPCAddrTag]).Msg("member left")
 }
 
 func (m *Membership) isLocal(member serf.Member) bool {
 	return m.serf.LocalMember().Name == member.Name
 }
 func (m *Membership) Members() []serf.Member {
-	log.Info().Msg("finding members...")
+	log.Debug().Msg("finding members...")
 	return m.serf.Members()
 }
 func (m *Membership) Leave() error {
 	log.Info().Msg("leaving...")
+	m.shutdownOnce.Do(func() { close(m.shutdown) })
 	return m.serf.Leave()
 }
 func (m *Membership) logError(err error, msg string, member serf.Member) {
-	log.Error().Err(err).Str("name", member.Name).Str("addr", member.Tags["rpc_addr"]).Msg(msg)
+	log.Error().Err(err).Str("name", member.Name).Str("addr", member.Tags[RPCAddrTag]).Msg(msg)
 }
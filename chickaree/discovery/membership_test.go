@@ -0,0 +1,48 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/hashicorp/serf/serf"
+)
+
+func member(name, addr string, status serf.MemberStatus) serf.Member {
+	return serf.Member{Name: name, Tags: map[string]string{RPCAddrTag: addr}, Status: status}
+}
+
+func TestDiffMembers(t *testing.T) {
+	members := []serf.Member{
+		member("local", "10.0.0.1:8400", serf.StatusAlive),
+		member("new", "10.0.0.2:8400", serf.StatusAlive),
+		member("moved", "10.0.0.9:8400", serf.StatusAlive),
+		member("same", "10.0.0.4:8400", serf.StatusAlive),
+		member("failed", "10.0.0.5:8400", serf.StatusFailed),
+		member("left", "10.0.0.6:8400", serf.StatusLeft),
+	}
+	servers := map[string]string{
+		"local":  "10.0.0.1:8400",
+		"moved":  "10.0.0.3:8400",
+		"same":   "10.0.0.4:8400",
+		"failed": "10.0.0.5:8400",
+		"left":   "10.0.0.6:8400",
+		// not yet gossiped to a new leader, or reaped
+		"unknown": "10.0.0.7:8400",
+	}
+	joins, leaves := diffMembers(members, servers, "local")
+
+	names := func(members []serf.Member) map[string]bool {
+		res := make(map[string]bool)
+		for _, m := range members {
+			res[m.Name] = true
+		}
+		return res
+	}
+	j := names(joins)
+	if len(j) != 2 || !j["new"] || !j["moved"] {
+		t.Errorf("expected new and moved to join got %v", j)
+	}
+	l := names(leaves)
+	if len(l) != 1 || !l["left"] {
+		t.Errorf("expected only left to leave got %v", l)
+	}
+}
@@ -0,0 +1,326 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Values are sealed with a random data key which is itself sealed with the
+// primary key of a local keyfile, so rotating only needs the data keys to
+// be rewrapped. A sealed value is
+//
+//	magic | key id | nonce | sealed data key | nonce | sealed value
+//
+// The keyfile holds one base64 AES-256 key per line, the first is the
+// primary used for new values and the rest are only used to read values
+// sealed before a rotation.
+
+const (
+	keySize   = 32
+	idSize    = 4
+	nonceSize = 12
+)
+
+var magic = []byte("CKE1")
+
+// MagicSize is the length of the prefix IsEncrypted and IsStream look for.
+const MagicSize = 4
+
+// check is sealed into every encrypted file so a wrong key is noticed
+// before any data is read.
+var check = []byte("chickaree encryption check")
+
+var (
+	ErrKeyMismatch  = errors.New("encryption key does not match the data, check the keyfile")
+	ErrNotEncrypted = errors.New("data is not encrypted")
+	ErrNoKeys       = errors.New("keyfile has no keys")
+)
+
+// DefaultReloadInterval is how often Watch checks the keyfile.
+const DefaultReloadInterval = 10 * time.Second
+
+// Overhead is the number of bytes sealing adds to a value.
+var Overhead = len(magic) + idSize + 2*nonceSize + keySize + 2*tagSize
+
+type key struct {
+	id   [idSize]byte
+	aead cipher.AEAD
+}
+
+// Keyring holds the keys of a keyfile and reloads them when it changes.
+type Keyring struct {
+	mu       sync.RWMutex
+	path     string
+	keys     []key
+	modified time.Time
+}
+
+// Load reads a keyfile.
+func Load(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Keyring) load() error {
+	fi, err := os.Stat(k.path)
+	if err != nil {
+		log.Error().Err(err).Str("path", k.path).Msg("unable to read keyfile")
+		return errors.New("unable to load keyfile")
+	}
+	b, err := os.ReadFile(k.path)
+	if err != nil {
+		log.Error().Err(err).Str("path", k.path).Msg("unable to read keyfile")
+		return errors.New("unable to load keyfile")
+	}
+	keys, err := parseKeys(b)
+	if err != nil {
+		log.Error().Err(err).Str("path", k.path).Msg("unable to parse keyfile")
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.modified = fi.ModTime()
+	return nil
+}
+
+func parseKeys(b []byte) ([]key, error) {
+	var keys []key
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(raw) != keySize {
+			return nil, errors.New("keys must be base64 encoded 32 byte keys")
+		}
+		k, err := newKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	return keys, nil
+}
+
+func newKey(raw []byte) (key, error) {
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return key{}, err
+	}
+	sum := sha256.Sum256(raw)
+	k := key{aead: aead}
+	copy(k.id[:], sum[:])
+	return k, nil
+}
+
+func newAEAD(raw []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Watch reloads the keyfile when it changes until done is closed, calling
+// changed after the primary key changes. A keyfile that can not be loaded
+// is logged and the previous keys kept.
+func (k *Keyring) Watch(interval time.Duration, done <-chan struct{}, changed func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(k.path)
+		if err != nil {
+			log.Warn().Err(err).Str("path", k.path).Msg("unable to check keyfile")
+			continue
+		}
+		k.mu.RLock()
+		modified := k.modified
+		primary := k.keys[0].id
+		k.mu.RUnlock()
+		if !fi.ModTime().After(modified) {
+			continue
+		}
+		if err := k.load(); err != nil {
+			log.Warn().Err(err).Msg("keeping previous encryption keys")
+			continue
+		}
+		log.Info().Str("path", k.path).Msg("encryption keys reloaded")
+		if k.primary().id != primary && changed != nil {
+			changed()
+		}
+	}
+}
+
+func (k *Keyring) primary() key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[0]
+}
+
+func (k *Keyring) find(id []byte) (key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if bytes.Equal(key.id[:], id) {
+			return key, true
+		}
+	}
+	return key{}, false
+}
+
+// Encrypt seals a value with a new data key wrapped by the primary key.
+func (k *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	out := make([]byte, 0, len(plaintext)+Overhead)
+	out, aead, err := k.wrapKey(append(out, magic...))
+	if err != nil {
+		return nil, err
+	}
+	return seal(out, aead, plaintext, magic)
+}
+
+// wrapKey appends the primary key id and a new data key sealed with it to
+// dst, returning the data key's cipher.
+func (k *Keyring) wrapKey(dst []byte) ([]byte, cipher.AEAD, error) {
+	primary := k.primary()
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	dst = append(dst, primary.id[:]...)
+	if dst, err = seal(dst, primary.aead, dataKey, magic); err != nil {
+		return nil, nil, err
+	}
+	return dst, aead, nil
+}
+
+// seal appends a random nonce and the sealed plaintext to dst.
+func seal(dst []byte, aead cipher.AEAD, plaintext, data []byte) ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	dst = append(dst, nonce...)
+	return aead.Seal(dst, nonce, plaintext, data), nil
+}
+
+// Decrypt opens a value sealed with any key of the keyring.
+func (k *Keyring) Decrypt(b []byte) ([]byte, error) {
+	dataKey, sealed, err := k.unwrap(b)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], magic)
+	if err != nil {
+		return nil, ErrKeyMismatch
+	}
+	return plaintext, nil
+}
+
+// unwrap opens the data key of a sealed value, returning it with the
+// sealed value.
+func (k *Keyring) unwrap(b []byte) ([]byte, []byte, error) {
+	if !IsEncrypted(b) || len(b) < Overhead {
+		return nil, nil, ErrNotEncrypted
+	}
+	b = b[len(magic):]
+	dataKey, err := k.openKey(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataKey, b[idSize+nonceSize+keySize+tagSize:], nil
+}
+
+// openKey opens a data key written by wrapKey.
+func (k *Keyring) openKey(b []byte) ([]byte, error) {
+	master, ok := k.find(b[:idSize])
+	if !ok {
+		return nil, ErrKeyMismatch
+	}
+	b = b[idSize:]
+	dataKey, err := master.aead.Open(nil, b[:nonceSize], b[nonceSize:nonceSize+keySize+tagSize], magic)
+	if err != nil {
+		return nil, ErrKeyMismatch
+	}
+	return dataKey, nil
+}
+
+// IsEncrypted reports whether b looks like a sealed value.
+func IsEncrypted(b []byte) bool {
+	return bytes.HasPrefix(b, magic)
+}
+
+// IsPrimary reports whether b was sealed with the primary key, values that
+// are not need to be encrypted again before older keys are removed.
+func (k *Keyring) IsPrimary(b []byte) bool {
+	primary := k.primary()
+	return IsEncrypted(b) && len(b) >= len(magic)+idSize &&
+		bytes.Equal(b[len(magic):len(magic)+idSize], primary.id[:])
+}
+
+// Reencrypt wraps the data key of a value with the primary key, the value
+// itself is left as it is.
+func (k *Keyring) Reencrypt(b []byte) ([]byte, error) {
+	dataKey, sealed, err := k.unwrap(b)
+	if err != nil {
+		return nil, err
+	}
+	primary := k.primary()
+	out := make([]byte, 0, len(b))
+	out = append(out, magic...)
+	out = append(out, primary.id[:]...)
+	if out, err = seal(out, primary.aead, dataKey, magic); err != nil {
+		return nil, err
+	}
+	return append(out, sealed...), nil
+}
+
+// Check returns a value to store beside encrypted data for Verify.
+func (k *Keyring) Check() ([]byte, error) {
+	return k.Encrypt(check)
+}
+
+// Verify returns ErrKeyMismatch unless a value from Check can be opened.
+func (k *Keyring) Verify(b []byte) error {
+	plaintext, err := k.Decrypt(b)
+	if err != nil {
+		return ErrKeyMismatch
+	}
+	if !bytes.Equal(plaintext, check) {
+		return ErrKeyMismatch
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newKeyLine(t *testing.T) string {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func writeKeyfile(t *testing.T, path string, keys ...string) {
+	if err := os.WriteFile(path, []byte(strings.Join(keys, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	writeKeyfile(t, path, "# primary", newKeyLine(t))
+	keys, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := keys.Encrypt([]byte("secret value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) || len(sealed) != len("secret value")+Overhead {
+		t.Errorf("unexpected sealed value %q", sealed)
+	}
+	plaintext, err := keys.Decrypt(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "secret value" {
+		t.Errorf("expected value to round trip got %q", plaintext)
+	}
+	if _, err := keys.Decrypt([]byte("plaintext")); err != ErrNotEncrypted {
+		t.Errorf("expected plaintext to be rejected got %v", err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := keys.Decrypt(sealed); err != ErrKeyMismatch {
+		t.Errorf("expected tampered value to be rejected got %v", err)
+	}
+
+	writeKeyfile(t, path, newKeyLine(t))
+	other, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, err := keys.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Verify(check); err != ErrKeyMismatch {
+		t.Errorf("expected another key to be refused got %v", err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	writeKeyfile(t, path, "# no keys")
+	if _, err := Load(path); err != ErrNoKeys {
+		t.Errorf("expected empty keyfile to be refused got %v", err)
+	}
+	writeKeyfile(t, path, base64.StdEncoding.EncodeToString([]byte("short")))
+	if _, err := Load(path); err == nil {
+		t.Error("expected short key to be refused")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	old, next := newKeyLine(t), newKeyLine(t)
+	writeKeyfile(t, path, old)
+	keys, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := keys.Encrypt([]byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan struct{}, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go keys.Watch(10*time.Millisecond, done, func() { changed <- struct{}{} })
+	time.Sleep(20 * time.Millisecond)
+	writeKeyfile(t, path, next, old)
+	now := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, now, now); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected primary key change to be noticed")
+	}
+
+	if keys.IsPrimary(sealed) {
+		t.Error("expected value to use the old key")
+	}
+	rotated, err := keys.Reencrypt(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !keys.IsPrimary(rotated) {
+		t.Error("expected value to use the new key")
+	}
+
+	// the old key is no longer needed
+	writeKeyfile(t, path, next)
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := reloaded.Decrypt(rotated); err != nil || string(plaintext) != "value" {
+		t.Errorf("expected rotated value to decrypt got %q %v", plaintext, err)
+	}
+	if _, err := reloaded.Decrypt(sealed); err != ErrKeyMismatch {
+		t.Errorf("expected old value to need the old key got %v", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	writeKeyfile(t, path, newKeyLine(t))
+	keys, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 10, chunkSize, chunkSize + 1, 3*chunkSize + 7} {
+		plaintext := bytes.Repeat([]byte("s"), size)
+		var sealed bytes.Buffer
+		w, err := keys.NewWriter(&sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// odd sized writes cross chunk boundaries
+		for p := plaintext; len(p) > 0; {
+			n := 1000
+			if n > len(p) {
+				n = len(p)
+			}
+			w.Write(p[:n])
+			p = p[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if size > 0 && bytes.Contains(sealed.Bytes(), plaintext[:10]) {
+			t.Errorf("%d: expected stream to be sealed", size)
+		}
+		if got := StreamSize(int64(sealed.Len())); got != int64(size) {
+			t.Errorf("%d: unexpected stream size %d", size, got)
+		}
+		r, err := keys.NewReader(bytes.NewReader(sealed.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, err := io.ReadAll(r); err != nil || !bytes.Equal(b, plaintext) {
+			t.Errorf("%d: expected stream to round trip got %d bytes %v", size, len(b), err)
+		}
+	}
+
+	var sealed bytes.Buffer
+	w, _ := keys.NewWriter(&sealed)
+	w.Write(bytes.Repeat([]byte("s"), 2*chunkSize))
+	w.Close()
+	b := sealed.Bytes()
+	// cut after the first chunk, which is not the last
+	r, _ := keys.NewReader(bytes.NewReader(b[:streamHeaderSize+chunkSize+chunkOverhead]))
+	if _, err := io.ReadAll(r); err != ErrTruncated {
+		t.Errorf("expected truncated stream to be refused got %v", err)
+	}
+	b[len(b)-1] ^= 1
+	r, _ = keys.NewReader(bytes.NewReader(b))
+	if _, err := io.ReadAll(r); err != ErrKeyMismatch {
+		t.Errorf("expected tampered stream to be refused got %v", err)
+	}
+}
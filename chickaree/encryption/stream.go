@@ -0,0 +1,175 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Streams such as raft snapshots are too large to seal whole, they are
+// sealed in chunks with one data key:
+//
+//	stream magic | key id | nonce | sealed data key | chunk ...
+//
+// Each chunk is its sealed length followed by up to chunkSize bytes sealed
+// with the chunk's number as the nonce. The top bit of the length marks
+// the last chunk and is part of its nonce, so a stream cut short between
+// chunks is refused as well as a changed one.
+
+const (
+	chunkSize = 64 << 10
+	tagSize   = 16
+	// chunkOverhead is the length prefix and tag of each chunk.
+	chunkOverhead = 4 + tagSize
+	lastChunk     = 1 << 31
+)
+
+var streamMagic = []byte("CKS1")
+
+var streamHeaderSize = len(streamMagic) + idSize + nonceSize + keySize + tagSize
+
+var ErrTruncated = errors.New("encrypted stream is truncated")
+
+// StreamSize returns the length of the plaintext of a sealed stream of
+// size bytes.
+func StreamSize(size int64) int64 {
+	size -= int64(streamHeaderSize)
+	chunks := (size + chunkSize + chunkOverhead - 1) / (chunkSize + chunkOverhead)
+	return size - chunks*chunkOverhead
+}
+
+// IsStream reports whether b looks like the start of a sealed stream.
+func IsStream(b []byte) bool {
+	return bytes.HasPrefix(b, streamMagic)
+}
+
+func chunkNonce(n uint64, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	if last {
+		nonce[0] = 1
+	}
+	binary.BigEndian.PutUint64(nonce[nonceSize-8:], n)
+	return nonce
+}
+
+type streamWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	count uint64
+}
+
+// NewWriter seals everything written to it into w with a new data key
+// wrapped by the primary key. Close writes the last chunk, it does not
+// close w.
+func (k *Keyring) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	header, aead, err := k.wrapKey(append([]byte{}, streamMagic...))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &streamWriter{w: w, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// a full chunk is only sealed once there is more to write, so
+		// the last one is sealed by Close
+		if len(s.buf) == chunkSize {
+			if err := s.seal(false); err != nil {
+				return n - len(p), err
+			}
+		}
+		c := copy(s.buf[len(s.buf):chunkSize], p)
+		s.buf = s.buf[:len(s.buf)+c]
+		p = p[c:]
+	}
+	return n, nil
+}
+
+func (s *streamWriter) Close() error {
+	return s.seal(true)
+}
+
+func (s *streamWriter) seal(last bool) error {
+	out := s.aead.Seal(make([]byte, 4, 4+len(s.buf)+tagSize), chunkNonce(s.count, last), s.buf, streamMagic)
+	size := uint32(len(out) - 4)
+	if last {
+		size |= lastChunk
+	}
+	binary.BigEndian.PutUint32(out, size)
+	s.count++
+	s.buf = s.buf[:0]
+	_, err := s.w.Write(out)
+	return err
+}
+
+type streamReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	buf   []byte
+	count uint64
+	done  bool
+}
+
+// NewReader opens a stream sealed by NewWriter with any key of the
+// keyring, chunks are opened as they are read.
+func (k *Keyring) NewReader(r io.Reader) (io.Reader, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil || !IsStream(header) {
+		return nil, ErrNotEncrypted
+	}
+	dataKey, err := k.openKey(header[len(streamMagic):])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{r: r, aead: aead}, nil
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+func (s *streamReader) open() error {
+	var prefix [4]byte
+	if _, err := io.ReadFull(s.r, prefix[:]); err != nil {
+		return ErrTruncated
+	}
+	size := binary.BigEndian.Uint32(prefix[:])
+	last := size&lastChunk != 0
+	size &^= lastChunk
+	if size < tagSize || size > chunkSize+tagSize {
+		return ErrKeyMismatch
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(s.r, sealed); err != nil {
+		return ErrTruncated
+	}
+	plaintext, err := s.aead.Open(sealed[:0], chunkNonce(s.count, last), sealed, streamMagic)
+	if err != nil {
+		return ErrKeyMismatch
+	}
+	s.count++
+	s.buf = plaintext
+	s.done = last
+	return nil
+}
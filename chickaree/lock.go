@@ -0,0 +1,162 @@
+package chickaree
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLockHeld     = errors.New("lock is held by another owner")
+	ErrLockNotHeld  = errors.New("lock is not held")
+	ErrLockLost     = errors.New("lock has expired or been taken by another owner")
+	ErrLockTTLShort = errors.New("lock ttl must be at least a millisecond")
+)
+
+// Lock is a helper around the Lock, Unlock and Refresh rpcs. Writes must be
+// sent to the leader so the client should be connected to it.
+//
+// Token returns the fencing token of the current acquisition, pass it along
+// with any writes protected by the lock so stale holders can be rejected.
+type Lock struct {
+	client ChickareeDBClient
+	name   string
+	owner  string
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	token uint64
+	held  bool
+}
+
+func NewLock(client ChickareeDBClient, name, owner string, ttl time.Duration) *Lock {
+	return &Lock{
+		client: client,
+		name:   name,
+		owner:  owner,
+		ttl:    ttl,
+	}
+}
+
+// TryAcquire attempts to take the lock once.
+func (l *Lock) TryAcquire(ctx context.Context) (uint64, error) {
+	if l.ttl < time.Millisecond {
+		return 0, ErrLockTTLShort
+	}
+	resp, err := l.client.Lock(ctx, &LockRequest{
+		Name:  l.name,
+		Owner: l.owner,
+		TtlMs: l.ttl.Milliseconds(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Acquired {
+		return 0, ErrLockHeld
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.token = resp.Token
+	l.held = true
+	return resp.Token, nil
+}
+
+// Acquire retries until the lock is taken or the context is done.
+func (l *Lock) Acquire(ctx context.Context, retry time.Duration) (uint64, error) {
+	ticker := time.NewTicker(retry)
+	defer ticker.Stop()
+	for {
+		token, err := l.TryAcquire(ctx)
+		if err != ErrLockHeld {
+			return token, err
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh extends the lease, returning ErrLockLost if the lock has expired.
+func (l *Lock) Refresh(ctx context.Context) error {
+	token, held := l.state()
+	if !held {
+		return ErrLockNotHeld
+	}
+	resp, err := l.client.Refresh(ctx, &RefreshRequest{
+		Name:  l.name,
+		Owner: l.owner,
+		Token: token,
+		TtlMs: l.ttl.Milliseconds(),
+	})
+	if err != nil {
+		return err
+	}
+	if !resp.Refreshed {
+		l.mu.Lock()
+		l.held = false
+		l.mu.Unlock()
+		return ErrLockLost
+	}
+	return nil
+}
+
+// KeepAlive refreshes the lease every third of the ttl until the context is
+// done or the lock is lost, the returned channel receives the reason it
+// stopped.
+func (l *Lock) KeepAlive(ctx context.Context) <-chan error {
+	errs := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			case <-ticker.C:
+				if err := l.Refresh(ctx); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}
+	}()
+	return errs
+}
+
+// Release gives up the lock if it is still held.
+func (l *Lock) Release(ctx context.Context) error {
+	token, held := l.state()
+	if !held {
+		return ErrLockNotHeld
+	}
+	resp, err := l.client.Unlock(ctx, &UnlockRequest{
+		Name:  l.name,
+		Owner: l.owner,
+		Token: token,
+	})
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.held = false
+	l.mu.Unlock()
+	if !resp.Released {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (l *Lock) Token() uint64 {
+	token, _ := l.state()
+	return token
+}
+
+func (l *Lock) state() (uint64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.token, l.held
+}
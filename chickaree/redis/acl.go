@@ -0,0 +1,252 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/acl"
+	"github.com/rs/zerolog/log"
+)
+
+// Users are kept by the storage servers and reloaded every second, changes
+// made through this proxy are seen at once. Until the default user is
+// stored it is the proxy's own, protected by requirepass when set, and the
+// first ACL SETUSER default stores it before applying its rules.
+
+// users caches the ACL users of the cluster.
+type users struct {
+	mu       sync.RWMutex
+	stored   map[string]*chickaree.ACLUser
+	fallback *chickaree.ACLUser
+}
+
+func newUsers(requirePass string) *users {
+	fallback := acl.NewUser(acl.DefaultUser)
+	if requirePass != "" {
+		acl.SetUser(fallback, []string{">" + requirePass})
+	}
+	return &users{stored: make(map[string]*chickaree.ACLUser), fallback: fallback}
+}
+
+// refresh reloads the users, keeping the previous ones if it fails.
+func (u *users) refresh(ctx context.Context, client chickaree.ChickareeDBClient) error {
+	resp, err := client.GetUsers(ctx, &chickaree.GetUsersRequest{})
+	if err != nil {
+		log.Error().Err(err).Msg("unable to load acl users")
+		return err
+	}
+	stored := make(map[string]*chickaree.ACLUser, len(resp.Users))
+	for _, user := range resp.Users {
+		stored[user.Name] = user
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.stored = stored
+	return nil
+}
+
+// seed returns the rules that store the proxy's default user before it is
+// changed, so ACL SETUSER default keeps the requirepass password.
+func (u *users) seed(name string) []string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	if _, ok := u.stored[name]; ok || name != acl.DefaultUser {
+		return nil
+	}
+	return acl.Rules(u.fallback)
+}
+
+// get returns a user or nil if it does not exist.
+func (u *users) get(name string) *chickaree.ACLUser {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	if user, ok := u.stored[name]; ok {
+		return user
+	}
+	if name == acl.DefaultUser {
+		return u.fallback
+	}
+	return nil
+}
+
+// list returns every user sorted by name.
+func (u *users) list() []*chickaree.ACLUser {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	list := make([]*chickaree.ACLUser, 0, len(u.stored)+1)
+	if _, ok := u.stored[acl.DefaultUser]; !ok {
+		list = append(list, u.fallback)
+	}
+	for _, user := range u.stored {
+		list = append(list, user)
+	}
+	sortUsers(list)
+	return list
+}
+
+func sortUsers(list []*chickaree.ACLUser) {
+	for i := 1; i < len(list); i++ {
+		for j := i; j > 0 && list[j].Name < list[j-1].Name; j-- {
+			list[j], list[j-1] = list[j-1], list[j]
+		}
+	}
+}
+
+// currentUser returns the user the connection runs commands as. A
+// connection that has not authenticated is the default user if it needs no
+// password.
+func (c *Client) currentUser() *chickaree.ACLUser {
+	if c.users == nil {
+		return nil
+	}
+	if c.username == "" {
+		if user := c.users.get(acl.DefaultUser); user != nil && user.Enabled && user.Nopass {
+			return user
+		}
+		return nil
+	}
+	user := c.users.get(c.username)
+	if user == nil || !user.Enabled {
+		return nil
+	}
+	return user
+}
+
+// authorize returns NOAUTH or NOPERM if the command can not be run.
+func (c *Client) authorize(req Request) error {
+	if c.users == nil || strings.EqualFold(req.Command, "auth") {
+		return nil
+	}
+	user := c.currentUser()
+	if user == nil {
+		return acl.ErrNoAuth
+	}
+	return acl.Allowed(user, req.Command, commandKeys(req))
+}
+
+// auth logs in with a password for the default user or a username and
+// password.
+func (c *Client) auth(args []Arg) Response {
+	var name, password string
+	switch len(args) {
+	case 1:
+		name, password = acl.DefaultUser, string(args[0])
+	case 2:
+		name, password = string(args[0]), string(args[1])
+	default:
+		return ErrResponse(errWrongArgs("auth"))
+	}
+	if c.users == nil {
+		return ErrResponse(errors.New("AUTH <password> called without any password configured for the default user"))
+	}
+	if !acl.CheckPassword(c.users.get(name), password) {
+		log.Warn().Str("user", name).Msg("authentication failed")
+		return ErrResponse(acl.ErrWrongPass)
+	}
+	c.username = name
+	return OkResp
+}
+
+func (c *Client) acl(args []Arg) Encoder {
+	if c.users == nil {
+		return ErrResponse(errors.New("acl is disabled"))
+	}
+	if len(args) < 1 {
+		return ErrResponse(errWrongArgs("acl"))
+	}
+	ctx := c.context()
+	switch strings.ToLower(string(args[0])) {
+	case "setuser":
+		if len(args) < 2 {
+			return ErrResponse(errWrongArgs("acl|setuser"))
+		}
+		if err := c.users.refresh(ctx, c.client); err != nil {
+			return ErrResponse(err)
+		}
+		req := &chickaree.SetUserRequest{Name: string(args[1]), Rules: c.users.seed(string(args[1]))}
+		for _, rule := range args[2:] {
+			req.Rules = append(req.Rules, string(rule))
+		}
+		if _, err := c.client.SetUser(ctx, req); err != nil {
+			return ErrResponse(err)
+		}
+		c.users.refresh(ctx, c.client)
+		return OkResp
+	case "deluser":
+		if len(args) < 2 {
+			return ErrResponse(errWrongArgs("acl|deluser"))
+		}
+		req := &chickaree.DeleteUsersRequest{}
+		for _, name := range args[1:] {
+			req.Names = append(req.Names, string(name))
+		}
+		resp, err := c.client.DeleteUsers(ctx, req)
+		if err != nil {
+			return ErrResponse(err)
+		}
+		c.users.refresh(ctx, c.client)
+		return IntResponse(resp.Count)
+	case "getuser":
+		if len(args) != 2 {
+			return ErrResponse(errWrongArgs("acl|getuser"))
+		}
+		user := c.users.get(string(args[1]))
+		if user == nil {
+			return NilArrayResp
+		}
+		return describeUser(user)
+	case "list":
+		var res ResponseArray
+		for _, user := range c.users.list() {
+			res = append(res, BulkResponse([]byte(acl.Describe(user))))
+		}
+		return res
+	case "users":
+		var res ResponseArray
+		for _, user := range c.users.list() {
+			res = append(res, BulkResponse([]byte(user.Name)))
+		}
+		return res
+	case "whoami":
+		if c.username == "" {
+			return BulkResponse([]byte(acl.DefaultUser))
+		}
+		return BulkResponse([]byte(c.username))
+	case "cat":
+		names := acl.Categories()
+		if len(args) == 2 {
+			var err error
+			if names, err = acl.CategoryCommands(strings.ToLower(string(args[1]))); err != nil {
+				return ErrResponse(err)
+			}
+		}
+		var res ResponseArray
+		for _, name := range names {
+			res = append(res, BulkResponse([]byte(name)))
+		}
+		return res
+	default:
+		return ErrResponse(fmt.Errorf("unknown subcommand '%s'", args[0]))
+	}
+}
+
+// describeUser answers ACL GETUSER.
+func describeUser(user *chickaree.ACLUser) ResponseArray {
+	bulks := func(values []string) ResponseArray {
+		res := ResponseArray{}
+		for _, v := range values {
+			res = append(res, BulkResponse([]byte(v)))
+		}
+		return res
+	}
+	return ResponseArray{
+		BulkResponse([]byte("flags")), bulks(acl.Flags(user)),
+		BulkResponse([]byte("passwords")), bulks(user.Passwords),
+		BulkResponse([]byte("commands")), BulkResponse([]byte(acl.Commands(user))),
+		BulkResponse([]byte("keys")), bulks(user.Keys),
+	}
+}
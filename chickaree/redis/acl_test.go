@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/acl"
+	"google.golang.org/grpc"
+)
+
+// usersClient answers GetUsers with fixed users.
+type usersClient struct {
+	chickaree.ChickareeDBClient
+	users []*chickaree.ACLUser
+}
+
+func (c usersClient) GetUsers(ctx context.Context, in *chickaree.GetUsersRequest, opts ...grpc.CallOption) (*chickaree.GetUsersResponse, error) {
+	return &chickaree.GetUsersResponse{Users: c.users}, nil
+}
+
+func TestRequirePass(t *testing.T) {
+	c := &Client{users: newUsers("secret")}
+	if res := string(c.Handle(Request{Command: "ping"})); !strings.HasPrefix(res, "-NOAUTH") {
+		t.Errorf("expected NOAUTH got %q", res)
+	}
+	if res := string(c.Handle(Request{Command: "auth", Args: []Arg{Arg("wrong")}})); !strings.HasPrefix(res, "-WRONGPASS") {
+		t.Errorf("expected WRONGPASS got %q", res)
+	}
+	if res := string(c.Handle(Request{Command: "auth", Args: []Arg{Arg("secret")}})); res != "+OK\r\n" {
+		t.Errorf("expected auth to succeed got %q", res)
+	}
+	if res := string(c.Handle(Request{Command: "ping"})); res != "+PONG\r\n" {
+		t.Errorf("expected PONG got %q", res)
+	}
+}
+
+func TestACLPermissions(t *testing.T) {
+	alice := acl.NewUser("alice")
+	if err := acl.SetUser(alice, []string{"on", ">pw", "~cache:*", "+@read", "+ping", "+acl"}); err != nil {
+		t.Fatal(err)
+	}
+	u := newUsers("")
+	if err := u.refresh(context.Background(), usersClient{users: []*chickaree.ACLUser{alice}}); err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{users: u}
+	if res := string(c.Handle(Request{Command: "auth", Args: []Arg{Arg("alice"), Arg("pw")}})); res != "+OK\r\n" {
+		t.Fatalf("expected auth to succeed got %q", res)
+	}
+	if res := string(c.Handle(Request{Command: "acl", Args: []Arg{Arg("whoami")}})); res != "$5\r\nalice\r\n" {
+		t.Errorf("unexpected whoami %q", res)
+	}
+	if res := string(c.Handle(Request{Command: "set", Args: []Arg{Arg("cache:a"), Arg("1")}})); !strings.HasPrefix(res, "-NOPERM this user has no permissions to run the 'set'") {
+		t.Errorf("expected command NOPERM got %q", res)
+	}
+	if res := string(c.Handle(Request{Command: "get", Args: []Arg{Arg("session:a")}})); !strings.HasPrefix(res, "-NOPERM this user has no permissions to access") {
+		t.Errorf("expected key NOPERM got %q", res)
+	}
+	res := string(c.Handle(Request{Command: "acl", Args: []Arg{Arg("users")}}))
+	if res != "*2\r\n$5\r\nalice\r\n$7\r\ndefault\r\n" {
+		t.Errorf("unexpected users %q", res)
+	}
+}
+
+// aclClient keeps users the way the storage servers do.
+type aclClient struct {
+	chickaree.ChickareeDBClient
+	users map[string]*chickaree.ACLUser
+}
+
+func (c *aclClient) GetUsers(ctx context.Context, in *chickaree.GetUsersRequest, opts ...grpc.CallOption) (*chickaree.GetUsersResponse, error) {
+	resp := &chickaree.GetUsersResponse{}
+	for _, user := range c.users {
+		resp.Users = append(resp.Users, user)
+	}
+	return resp, nil
+}
+
+func (c *aclClient) SetUser(ctx context.Context, in *chickaree.SetUserRequest, opts ...grpc.CallOption) (*chickaree.SetUserResponse, error) {
+	user, ok := c.users[in.Name]
+	if !ok {
+		user = acl.NewUser(in.Name)
+	}
+	if err := acl.SetUser(user, in.Rules); err != nil {
+		return nil, err
+	}
+	c.users[in.Name] = user
+	return &chickaree.SetUserResponse{}, nil
+}
+
+func TestSetUserKeepsRequirePass(t *testing.T) {
+	c := &Client{users: newUsers("secret"), client: &aclClient{users: make(map[string]*chickaree.ACLUser)}}
+	if res := string(c.Handle(Request{Command: "auth", Args: []Arg{Arg("secret")}})); res != "+OK\r\n" {
+		t.Fatalf("expected auth to succeed got %q", res)
+	}
+	if res := string(c.Handle(Request{Command: "acl", Args: []Arg{Arg("setuser"), Arg("default"), Arg("-@dangerous")}})); res != "+OK\r\n" {
+		t.Fatalf("expected setuser to succeed got %q", res)
+	}
+
+	other := &Client{users: c.users, client: c.client}
+	if res := string(other.Handle(Request{Command: "ping"})); !strings.HasPrefix(res, "-NOAUTH") {
+		t.Errorf("expected NOAUTH got %q", res)
+	}
+	if res := string(other.Handle(Request{Command: "auth", Args: []Arg{Arg("secret")}})); res != "+OK\r\n" {
+		t.Errorf("expected auth to succeed got %q", res)
+	}
+	if res := string(other.Handle(Request{Command: "acl", Args: []Arg{Arg("whoami")}})); !strings.HasPrefix(res, "-NOPERM") {
+		t.Errorf("expected NOPERM got %q", res)
+	}
+}
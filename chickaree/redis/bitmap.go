@@ -0,0 +1,219 @@
+package redis
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+)
+
+var (
+	errBitValue  = errors.New("bit is not an integer or out of range")
+	errBitOffset = errors.New("bit offset is not an integer or out of range")
+)
+
+func parseBit(arg Arg) (bool, error) {
+	switch string(arg) {
+	case "0":
+		return false, nil
+	case "1":
+		return true, nil
+	}
+	return false, errBitValue
+}
+
+// parseBitUnit reads the optional BYTE|BIT argument of BITCOUNT and BITPOS.
+func parseBitUnit(arg Arg) (bool, error) {
+	switch strings.ToLower(string(arg)) {
+	case "byte":
+		return false, nil
+	case "bit":
+		return true, nil
+	}
+	return false, errSyntax
+}
+
+func (c *Client) setBit(args []Arg) Response {
+	if len(args) != 3 {
+		return ErrResponse(errWrongArgs("setbit"))
+	}
+	offset, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return ErrResponse(errBitOffset)
+	}
+	bit, err := parseBit(args[2])
+	if err != nil {
+		return ErrResponse(err)
+	}
+	resp, err := c.leader(string(args[0])).SetBit(c.context(), &chickaree.SetBitRequest{
+		Key:    string(args[0]),
+		Offset: offset,
+		Value:  bit,
+	})
+	if err != nil {
+		return ErrResponse(err)
+	}
+	return IntResponse(resp.Previous)
+}
+
+func (c *Client) getBit(args []Arg) Response {
+	if len(args) != 2 {
+		return ErrResponse(errWrongArgs("getbit"))
+	}
+	offset, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return ErrResponse(errBitOffset)
+	}
+	resp, err := c.client.GetBit(c.context(), &chickaree.GetBitRequest{
+		Key:    string(args[0]),
+		Offset: offset,
+	})
+	if err != nil {
+		return ErrResponse(err)
+	}
+	return IntResponse(resp.Value)
+}
+
+func (c *Client) bitCount(args []Arg) Response {
+	if len(args) != 1 && len(args) != 3 && len(args) != 4 {
+		return ErrResponse(errSyntax)
+	}
+	req := &chickaree.BitCountRequest{Key: string(args[0])}
+	if len(args) > 1 {
+		var err error
+		req.HasRange = true
+		if req.Start, err = parseInt(args[1]); err != nil {
+			return ErrResponse(err)
+		}
+		if req.End, err = parseInt(args[2]); err != nil {
+			return ErrResponse(err)
+		}
+	}
+	if len(args) == 4 {
+		unit, err := parseBitUnit(args[3])
+		if err != nil {
+			return ErrResponse(err)
+		}
+		req.BitUnit = unit
+	}
+	resp, err := c.client.BitCount(c.context(), req)
+	if err != nil {
+		return ErrResponse(err)
+	}
+	return IntResponse(resp.Count)
+}
+
+func (c *Client) bitPos(args []Arg) Response {
+	if len(args) < 2 || len(args) > 5 {
+		return ErrResponse(errWrongArgs("bitpos"))
+	}
+	bit, err := parseBit(args[1])
+	if err != nil {
+		return ErrResponse(errors.New("The bit argument must be 1 or 0."))
+	}
+	req := &chickaree.BitPosRequest{
+		Key: string(args[0]),
+		Bit: bit,
+	}
+	if len(args) > 2 {
+		req.HasStart = true
+		if req.Start, err = parseInt(args[2]); err != nil {
+			return ErrResponse(err)
+		}
+	}
+	if len(args) > 3 {
+		req.HasEnd = true
+		if req.End, err = parseInt(args[3]); err != nil {
+			return ErrResponse(err)
+		}
+	}
+	if len(args) > 4 {
+		if req.BitUnit, err = parseBitUnit(args[4]); err != nil {
+			return ErrResponse(err)
+		}
+	}
+	resp, err := c.client.BitPos(c.context(), req)
+	if err != nil {
+		return ErrResponse(err)
+	}
+	return IntResponse(resp.Position)
+}
+
+func (c *Client) bitOp(args []Arg) Response {
+	if len(args) < 3 {
+		return ErrResponse(errWrongArgs("bitop"))
+	}
+	req := &chickaree.BitOpRequest{
+		Operation:   strings.ToLower(string(args[0])),
+		Destination: string(args[1]),
+	}
+	for _, key := range args[2:] {
+		req.Keys = append(req.Keys, string(key))
+	}
+	resp, err := c.leader(req.Destination).BitOp(c.context(), req)
+	if err != nil {
+		return ErrResponse(err)
+	}
+	return IntResponse(resp.Length)
+}
+
+func (c *Client) bitField(args []Arg, readOnly bool) Encoder {
+	if len(args) < 1 {
+		return ErrResponse(errWrongArgs("bitfield"))
+	}
+	req := &chickaree.BitFieldRequest{
+		Key:      string(args[0]),
+		ReadOnly: readOnly,
+	}
+	for i := 1; i < len(args); {
+		op := &chickaree.BitFieldOperation{Command: strings.ToLower(string(args[i]))}
+		var argc int
+		switch op.Command {
+		case "get":
+			argc = 2
+		case "set", "incrby":
+			argc = 3
+		case "overflow":
+			argc = 1
+		default:
+			return ErrResponse(errSyntax)
+		}
+		if i+argc >= len(args) {
+			return ErrResponse(errSyntax)
+		}
+		if op.Command == "overflow" {
+			op.Overflow = strings.ToLower(string(args[i+1]))
+		} else {
+			op.Encoding = string(args[i+1])
+			op.Offset = string(args[i+2])
+		}
+		if argc == 3 {
+			v, err := parseInt(args[i+3])
+			if err != nil {
+				return ErrResponse(err)
+			}
+			op.Value = v
+		}
+		req.Operations = append(req.Operations, op)
+		i += argc + 1
+	}
+
+	client := c.leader(req.Key)
+	if readOnly {
+		client = c.client
+	}
+	resp, err := client.BitField(c.context(), req)
+	if err != nil {
+		return ErrResponse(err)
+	}
+	res := ResponseArray{}
+	for _, r := range resp.Results {
+		if r.Nil {
+			res = append(res, NilStringResp)
+			continue
+		}
+		res = append(res, IntResponse(r.Value))
+	}
+	return res
+}
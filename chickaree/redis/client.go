@@ -6,20 +6,58 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/holmes89/chickaree-db/chickaree"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/metadata"
 )
 
+var (
+	errSyntax     = errors.New("syntax error")
+	errNotInteger = errors.New("value is not an integer or out of range")
+)
+
+func errWrongArgs(command string) error {
+	return fmt.Errorf("wrong number of arguments for '%s' command", command)
+}
+
+func parseInt(arg Arg) (int64, error) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	return n, nil
+}
+
 type Client struct {
 	// incoming chan string
-	outgoing     chan []byte
-	reader       *bufio.Reader
-	writer       *bufio.Writer
-	conn         net.Conn
-	client       chickaree.ChickareeDBClient
-	leaderClient chickaree.ChickareeDBClient
+	outgoing chan []byte
+	reader   *bufio.Reader
+	writer   *bufio.Writer
+	conn     net.Conn
+	client   chickaree.ChickareeDBClient
+	router   *router
+	// clusterView is nil unless cluster support is enabled.
+	clusterView *cluster
+	// asking is set by ASKING for the following command.
+	asking bool
+	// users is nil when ACLs are not checked, username is empty until AUTH.
+	users    *users
+	username string
+}
+
+// leader returns the client for writes to a key, the leader of its group
+// when known.
+func (c *Client) leader(key string) chickaree.ChickareeDBClient {
+	if c.router != nil {
+		if lc := c.router.client(key); lc != nil {
+			return lc
+		}
+	}
+	return c.client
 }
 
 func (c *Client) Read() {
@@ -49,7 +87,7 @@ func (client *Client) Listen() {
 	go client.Write()
 }
 
-func NewClient(connection net.Conn, lc, cl chickaree.ChickareeDBClient) *Client {
+func NewClient(connection net.Conn, r *router, cl chickaree.ChickareeDBClient, view *cluster, u *users) *Client {
 	if connection == nil {
 		panic("no connection")
 	}
@@ -57,22 +95,85 @@ func NewClient(connection net.Conn, lc, cl chickaree.ChickareeDBClient) *Client
 	reader := bufio.NewReader(connection)
 
 	client := &Client{
-		outgoing:     make(chan []byte),
-		conn:         connection,
-		reader:       reader,
-		writer:       writer,
-		client:       cl,
-		leaderClient: lc,
+		outgoing: make(chan []byte),
+		conn:     connection,
+		reader:   reader,
+		writer:   writer,
+		client:   cl,
+		router:   r,
+
+		clusterView: view,
+		users:       u,
 	}
 	client.Listen()
 
 	return client
 }
 
+// Handle runs a command. With cluster support enabled keys must share a
+// slot and migrations or leadership changes are redirected, otherwise
+// commands on a migrating slot are retried until it has moved. Every
+// command but AUTH is checked against the user's ACL first.
 func (c *Client) Handle(req Request) []byte {
+	if err := c.authorize(req); err != nil {
+		return ErrResponse(err).Encode()
+	}
+	if strings.EqualFold(req.Command, "asking") {
+		c.asking = true
+		return OkResp.Encode()
+	}
+	defer func() { c.asking = false }()
+	if c.clusterView == nil {
+		res := c.handle(req)
+		for i := 0; i < migrationRetries; i++ {
+			if _, ok := migrationError(res); !ok {
+				break
+			}
+			time.Sleep(migrationBackoff)
+			res = c.handle(req)
+		}
+		return res
+	}
+	keys := commandKeys(req)
+	slot, err := checkSlots(keys)
+	if err != nil {
+		return ErrResponse(err).Encode()
+	}
+	res := c.handle(req)
+	if msg, ok := migrationError(res); ok {
+		return c.clusterView.redirect(msg).Encode()
+	}
+	if len(keys) > 0 && leadershipChanged(res) {
+		return c.clusterView.moved(slot).Encode()
+	}
+	return res
+}
+
+// context marks commands sent after ASKING so the storage server knows the
+// client followed a redirect, and passes on the redis user.
+func (c *Client) context() context.Context {
+	ctx := context.Background()
+	if c.asking {
+		ctx = metadata.AppendToOutgoingContext(ctx, chickaree.AskingKey, "true")
+	}
+	if user := c.currentUser(); user != nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, chickaree.UserKey, user.Name)
+	}
+	return ctx
+}
+
+func (c *Client) handle(req Request) []byte {
 	switch strings.ToLower(req.Command) {
 	case "command":
 		return OkResp.Encode()
+	case "cluster":
+		return c.cluster(req.Args).Encode()
+	case "readonly", "readwrite":
+		return OkResp.Encode()
+	case "auth":
+		return c.auth(req.Args).Encode()
+	case "acl":
+		return c.acl(req.Args).Encode()
 	case "ping":
 		return Response{
 			rtype:   SimpleString,
@@ -92,6 +193,52 @@ func (c *Client) Handle(req Request) []byte {
 		return c.get(req.Args).Encode()
 	case "del":
 		return c.del(req.Args).Encode()
+	case "setbit":
+		return c.setBit(req.Args).Encode()
+	case "getbit":
+		return c.getBit(req.Args).Encode()
+	case "bitcount":
+		return c.bitCount(req.Args).Encode()
+	case "bitpos":
+		return c.bitPos(req.Args).Encode()
+	case "bitop":
+		return c.bitOp(req.Args).Encode()
+	case "bitfield":
+		return c.bitField(req.Args, false).Encode()
+	case "bitfield_ro":
+		return c.bitField(req.Args, true).Encode()
+	case "pfadd":
+		return c.pfAdd(req.Args).Encode()
+	case "pfcount":
+		return c.pfCount(req.Args).Encode()
+	case "pfmerge":
+		return c.pfMerge(req.Args).Encode()
+	case "geoadd":
+		return c.geoAdd(req.Args).Encode()
+	case "geopos":
+		return c.geoPos(req.Args).Encode()
+	case "geodist":
+		return c.geoDist(req.Args).Encode()
+	case "geohash":
+		return c.geoHash(req.Args).Encode()
+	case "geosearch":
+		return c.geoSearch(req.Args).Encode()
+	case "lock":
+		return c.lock(req.Args).Encode()
+	case "unlock":
+		return c.unlock(req.Args).Encode()
+	case "refresh":
+		return c.refresh(req.Args).Encode()
+	case "expire":
+		return c.expire(req.Args, time.Second).Encode()
+	case "pexpire":
+		return c.expire(req.Args, time.Millisecond).Encode()
+	case "persist":
+		return c.persist(req.Args).Encode()
+	case "ttl":
+		return c.ttl(req.Args, time.Second).Encode()
+	case "pttl":
+		return c.ttl(req.Args, time.Millisecond).Encode()
 	default:
 		log.Error().Str("command", req.Command).Msg("unknown command")
 		err := fmt.Errorf("unknown command '%s'", req.Command)
@@ -100,7 +247,7 @@ func (c *Client) Handle(req Request) []byte {
 }
 
 func (c *Client) set(args []Arg) Response {
-	ctx := context.TODO()
+	ctx := c.context()
 	if len(args)%2 != 0 {
 		return ErrResponse(errors.New("invalid request"))
 	}
@@ -108,7 +255,7 @@ func (c *Client) set(args []Arg) Response {
 		Key:   string(args[0]),
 		Value: args[1],
 	}
-	_, err := c.leaderClient.Set(ctx, req)
+	_, err := c.leader(req.Key).Set(ctx, req)
 	if err != nil {
 		return ErrResponse(err)
 	}
@@ -116,7 +263,7 @@ func (c *Client) set(args []Arg) Response {
 }
 
 func (c *Client) get(args []Arg) Response {
-	ctx := context.TODO()
+	ctx := c.context()
 	req := &chickaree.GetRequest{
 		Key: string(args[0]),
 	}
@@ -0,0 +1,379 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+)
+
+// Every proxy can serve every slot so cluster aware clients are given a
+// view where each raft group is a redis master with its followers as
+// replicas, all reachable through the proxy's announced address. A server
+// takes part in every group so each of its group memberships is a separate
+// redis node.
+
+const (
+	// commands on a migrating slot are retried for up to two seconds for
+	// clients that do not follow redirects.
+	migrationRetries = 40
+	migrationBackoff = 50 * time.Millisecond
+)
+
+var (
+	errCrossSlot       = errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+	errClusterDisabled = errors.New("This instance has cluster support disabled")
+)
+
+// cluster answers redis cluster commands from the router's topology.
+type cluster struct {
+	host   string
+	port   int
+	router *router
+	client chickaree.ChickareeDBClient
+}
+
+func newCluster(announce string, r *router, client chickaree.ChickareeDBClient) (*cluster, error) {
+	host, port, err := net.SplitHostPort(announce)
+	if err != nil {
+		log.Error().Err(err).Str("announce", announce).Msg("invalid cluster announce address")
+		return nil, errors.New("unable to enable cluster")
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		log.Error().Err(err).Str("announce", announce).Msg("invalid cluster announce port")
+		return nil, errors.New("unable to enable cluster")
+	}
+	return &cluster{host: host, port: p, router: r, client: client}, nil
+}
+
+// clusterNodeID returns the 40 character id of a server in a group.
+func clusterNodeID(server string, group uint32) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s/%d", server, group)))
+	return hex.EncodeToString(sum[:])
+}
+
+func shardLeader(shard *chickaree.Shard) *chickaree.Server {
+	for _, sv := range shard.Servers {
+		if sv.IsLeader {
+			return sv
+		}
+	}
+	return nil
+}
+
+func serverHealth(sv *chickaree.Server) string {
+	if sv.SerfStatus == "" || sv.SerfStatus == "alive" {
+		return "online"
+	}
+	return "failed"
+}
+
+func (c *Client) cluster(args []Arg) Encoder {
+	if c.clusterView == nil {
+		return ErrResponse(errClusterDisabled)
+	}
+	if len(args) < 1 {
+		return ErrResponse(errWrongArgs("cluster"))
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "keyslot":
+		if len(args) != 2 {
+			return ErrResponse(errWrongArgs("cluster|keyslot"))
+		}
+		return IntResponse(int64(chickaree.KeySlot(string(args[1]))))
+	case "info":
+		return c.clusterView.info()
+	case "slots":
+		return c.clusterView.slots()
+	case "shards":
+		return c.clusterView.shards()
+	case "nodes":
+		return c.clusterView.nodes()
+	case "myid":
+		return BulkResponse([]byte(c.clusterView.myID()))
+	default:
+		return ErrResponse(fmt.Errorf("unknown subcommand '%s'", args[0]))
+	}
+}
+
+func (cl *cluster) topology() *chickaree.GetShardsResponse {
+	topology := cl.router.Topology()
+	if topology == nil {
+		cl.router.refresh(context.Background(), cl.client)
+		topology = cl.router.Topology()
+	}
+	if topology == nil {
+		return &chickaree.GetShardsResponse{}
+	}
+	return topology
+}
+
+// myID is the node answering for the proxy, the first group's leader.
+func (cl *cluster) myID() string {
+	for _, shard := range cl.topology().Shards {
+		if leader := shardLeader(shard); leader != nil {
+			return clusterNodeID(leader.Id, shard.Group)
+		}
+	}
+	return clusterNodeID("", 0)
+}
+
+func (cl *cluster) info() Response {
+	shards := cl.topology().Shards
+	var assigned, ok int64
+	var nodes int
+	var size int
+	for _, shard := range shards {
+		var count int64
+		for _, r := range shard.Slots {
+			count += int64(r.End-r.Start) + 1
+		}
+		assigned += count
+		nodes += len(shard.Servers)
+		if shardLeader(shard) != nil {
+			ok += count
+			size++
+		}
+	}
+	state := "ok"
+	if ok != chickaree.SlotCount {
+		state = "fail"
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "cluster_enabled:1\r\n")
+	fmt.Fprintf(buf, "cluster_state:%s\r\n", state)
+	fmt.Fprintf(buf, "cluster_slots_assigned:%d\r\n", assigned)
+	fmt.Fprintf(buf, "cluster_slots_ok:%d\r\n", ok)
+	fmt.Fprintf(buf, "cluster_slots_pfail:0\r\n")
+	fmt.Fprintf(buf, "cluster_slots_fail:%d\r\n", assigned-ok)
+	fmt.Fprintf(buf, "cluster_known_nodes:%d\r\n", nodes)
+	fmt.Fprintf(buf, "cluster_size:%d\r\n", size)
+	fmt.Fprintf(buf, "cluster_current_epoch:%d\r\n", len(shards))
+	fmt.Fprintf(buf, "cluster_my_epoch:1\r\n")
+	return BulkResponse(buf.Bytes())
+}
+
+// slots lists each range of slots with its group's leader first.
+func (cl *cluster) slots() ResponseArray {
+	res := ResponseArray{}
+	for _, shard := range cl.topology().Shards {
+		leader := shardLeader(shard)
+		if leader == nil {
+			continue
+		}
+		for _, r := range shard.Slots {
+			entry := ResponseArray{
+				IntResponse(int64(r.Start)),
+				IntResponse(int64(r.End)),
+				cl.endpoint(leader, shard.Group),
+			}
+			for _, sv := range shard.Servers {
+				if sv != leader {
+					entry = append(entry, cl.endpoint(sv, shard.Group))
+				}
+			}
+			res = append(res, entry)
+		}
+	}
+	return res
+}
+
+func (cl *cluster) endpoint(sv *chickaree.Server, group uint32) ResponseArray {
+	return ResponseArray{
+		BulkResponse([]byte(cl.host)),
+		IntResponse(int64(cl.port)),
+		BulkResponse([]byte(clusterNodeID(sv.Id, group))),
+	}
+}
+
+func (cl *cluster) shards() ResponseArray {
+	res := ResponseArray{}
+	for _, shard := range cl.topology().Shards {
+		nodes := ResponseArray{}
+		for _, sv := range shard.Servers {
+			role := "replica"
+			if sv.IsLeader {
+				role = "master"
+			}
+			nodes = append(nodes, ResponseArray{
+				BulkResponse([]byte("id")), BulkResponse([]byte(clusterNodeID(sv.Id, shard.Group))),
+				BulkResponse([]byte("port")), IntResponse(int64(cl.port)),
+				BulkResponse([]byte("ip")), BulkResponse([]byte(cl.host)),
+				BulkResponse([]byte("endpoint")), BulkResponse([]byte(cl.host)),
+				BulkResponse([]byte("role")), BulkResponse([]byte(role)),
+				BulkResponse([]byte("replication-offset")), IntResponse(int64(sv.AppliedIndex)),
+				BulkResponse([]byte("health")), BulkResponse([]byte(serverHealth(sv))),
+			})
+		}
+		slots := ResponseArray{}
+		for _, r := range shard.Slots {
+			slots = append(slots, IntResponse(int64(r.Start)), IntResponse(int64(r.End)))
+		}
+		res = append(res, ResponseArray{
+			BulkResponse([]byte("slots")),
+			slots,
+			BulkResponse([]byte("nodes")),
+			nodes,
+		})
+	}
+	return res
+}
+
+// nodes returns the topology in the CLUSTER NODES format, one line per
+// node. Masters list their slots and any slots migrating from or to them.
+func (cl *cluster) nodes() Response {
+	myID := cl.myID()
+	topology := cl.topology()
+	masters := make(map[uint32]string)
+	for _, shard := range topology.Shards {
+		if leader := shardLeader(shard); leader != nil {
+			masters[shard.Group] = clusterNodeID(leader.Id, shard.Group)
+		}
+	}
+	buf := new(bytes.Buffer)
+	for _, shard := range topology.Shards {
+		master, ok := masters[shard.Group]
+		if !ok {
+			master = "-"
+		}
+		for _, sv := range shard.Servers {
+			id := clusterNodeID(sv.Id, shard.Group)
+			flags := []string{}
+			if id == myID {
+				flags = append(flags, "myself")
+			}
+			if sv.IsLeader {
+				flags = append(flags, "master")
+			} else {
+				flags = append(flags, "slave")
+			}
+			if serverHealth(sv) != "online" {
+				flags = append(flags, "fail")
+			}
+			replicaOf, slots := master, ""
+			if sv.IsLeader {
+				replicaOf = "-"
+				slots = nodeSlots(shard, topology.Migrations, masters)
+			}
+			fmt.Fprintf(buf, "%s %s:%d@%d,%s %s %s 0 0 %d connected%s\n",
+				id, cl.host, cl.port, cl.port+10000, cl.host, strings.Join(flags, ","), replicaOf, shard.Group+1, slots)
+		}
+	}
+	return BulkResponse(buf.Bytes())
+}
+
+func nodeSlots(shard *chickaree.Shard, migrations []*chickaree.SlotMigration, masters map[uint32]string) string {
+	buf := new(bytes.Buffer)
+	for _, r := range shard.Slots {
+		if r.Start == r.End {
+			fmt.Fprintf(buf, " %d", r.Start)
+		} else {
+			fmt.Fprintf(buf, " %d-%d", r.Start, r.End)
+		}
+	}
+	for _, mig := range migrations {
+		if mig.State != chickaree.MigrationState_MIGRATION_MIGRATING {
+			continue
+		}
+		switch shard.Group {
+		case mig.Source:
+			fmt.Fprintf(buf, " [%d->-%s]", mig.Slot, masters[mig.Target])
+		case mig.Target:
+			fmt.Fprintf(buf, " [%d-<-%s]", mig.Slot, masters[mig.Source])
+		}
+	}
+	return buf.String()
+}
+
+// commandKeys returns the keys a command reads or writes.
+func commandKeys(req Request) []string {
+	args := req.Args
+	var keys []Arg
+	switch strings.ToLower(req.Command) {
+	case "bitop":
+		if len(args) > 1 {
+			keys = args[1:]
+		}
+	case "pfcount", "pfmerge", "del":
+		keys = args
+	case "command", "ping", "cluster", "asking", "readonly", "readwrite", "auth", "acl":
+	default:
+		if len(args) > 0 {
+			keys = args[:1]
+		}
+	}
+	res := make([]string, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, string(key))
+	}
+	return res
+}
+
+// checkSlots returns the slot all keys hash to or CROSSSLOT if they differ.
+func checkSlots(keys []string) (uint16, error) {
+	var slot uint16
+	for i, key := range keys {
+		s := chickaree.KeySlot(key)
+		if i > 0 && s != slot {
+			return 0, errCrossSlot
+		}
+		slot = s
+	}
+	return slot, nil
+}
+
+// leadershipChanged reports if an error was caused by the leader a write
+// was sent to stepping down.
+func leadershipChanged(res []byte) bool {
+	if len(res) == 0 || res[0] != byte(Errors) {
+		return false
+	}
+	for _, msg := range []string{"node is not the leader", "leadership lost", "no leader available", "Unavailable"} {
+		if bytes.Contains(res, []byte(msg)) {
+			return true
+		}
+	}
+	return false
+}
+
+// migrationError returns the ASK or TRYAGAIN error sent by a storage server
+// for a slot being migrated.
+func migrationError(res []byte) (string, bool) {
+	if len(res) == 0 || res[0] != byte(Errors) {
+		return "", false
+	}
+	for _, code := range []string{"ASK ", "TRYAGAIN "} {
+		if i := bytes.Index(res, []byte(code)); i >= 0 {
+			return string(bytes.TrimSpace(res[i:])), true
+		}
+	}
+	return "", false
+}
+
+// redirect rewrites a storage server's ASK, which names the target group, to
+// point at the proxy which routes by slot anyway.
+func (cl *cluster) redirect(msg string) Response {
+	fields := strings.Fields(msg)
+	if fields[0] == "ASK" && len(fields) == 3 {
+		msg = fmt.Sprintf("ASK %s %s", fields[1], net.JoinHostPort(cl.host, strconv.Itoa(cl.port)))
+	}
+	return ErrResponse(errors.New(msg))
+}
+
+// moved redirects the client to retry after refreshing the topology, the
+// proxy does the same so the retry reaches the new leader.
+func (cl *cluster) moved(slot uint16) Response {
+	cl.router.refresh(context.Background(), cl.client)
+	return ErrResponse(fmt.Errorf("MOVED %d %s", slot, net.JoinHostPort(cl.host, strconv.Itoa(cl.port))))
+}
@@ -0,0 +1,182 @@
+package redis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+)
+
+func testCluster(t *testing.T) *Client {
+	r := newRouter()
+	r.topology = &chickaree.GetShardsResponse{Shards: []*chickaree.Shard{
+		{Group: 0, Slots: []*chickaree.SlotRange{{Start: 0, End: 8191}}, Servers: []*chickaree.Server{
+			{Id: "a", IsLeader: true},
+			{Id: "b"},
+		}},
+		{Group: 1, Slots: []*chickaree.SlotRange{{Start: 8192, End: 16383}}, Servers: []*chickaree.Server{
+			{Id: "a"},
+			{Id: "b", IsLeader: true, SerfStatus: "alive"},
+		}},
+	}}
+	view, err := newCluster("proxy:6379", r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Client{router: r, clusterView: view}
+}
+
+func TestClusterDisabled(t *testing.T) {
+	c := &Client{}
+	res := string(c.Handle(Request{Command: "CLUSTER", Args: []Arg{Arg("info")}}))
+	if !strings.HasPrefix(res, "-This instance has cluster support disabled") {
+		t.Errorf("unexpected response %q", res)
+	}
+}
+
+func TestClusterKeySlot(t *testing.T) {
+	c := testCluster(t)
+	res := string(c.Handle(Request{Command: "cluster", Args: []Arg{Arg("keyslot"), Arg("foo")}}))
+	if res != ":12182\r\n" {
+		t.Errorf("unexpected response %q", res)
+	}
+}
+
+func TestClusterSlots(t *testing.T) {
+	c := testCluster(t)
+	a := clusterNodeID("a", 0)
+	b := clusterNodeID("b", 0)
+	b1 := clusterNodeID("b", 1)
+	a1 := clusterNodeID("a", 1)
+	expected := "*2\r\n" +
+		"*4\r\n:0\r\n:8191\r\n" +
+		"*3\r\n$5\r\nproxy\r\n:6379\r\n$40\r\n" + a + "\r\n" +
+		"*3\r\n$5\r\nproxy\r\n:6379\r\n$40\r\n" + b + "\r\n" +
+		"*4\r\n:8192\r\n:16383\r\n" +
+		"*3\r\n$5\r\nproxy\r\n:6379\r\n$40\r\n" + b1 + "\r\n" +
+		"*3\r\n$5\r\nproxy\r\n:6379\r\n$40\r\n" + a1 + "\r\n"
+	if res := string(c.Handle(Request{Command: "cluster", Args: []Arg{Arg("slots")}})); res != expected {
+		t.Errorf("unexpected response %q", res)
+	}
+}
+
+func TestClusterNodes(t *testing.T) {
+	c := testCluster(t)
+	res := string(c.clusterView.nodes().content)
+	lines := strings.Split(strings.TrimSpace(res), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 nodes got %d", len(lines))
+	}
+	a := clusterNodeID("a", 0)
+	if !strings.HasPrefix(lines[0], a+" proxy:6379@16379,proxy myself,master - ") || !strings.HasSuffix(lines[0], " 0-8191") {
+		t.Errorf("unexpected master %q", lines[0])
+	}
+	if !strings.Contains(lines[1], " slave "+a+" ") {
+		t.Errorf("unexpected replica %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[3], " 8192-16383") {
+		t.Errorf("unexpected master %q", lines[3])
+	}
+}
+
+func TestClusterInfo(t *testing.T) {
+	c := testCluster(t)
+	res := string(c.clusterView.info().content)
+	for _, line := range []string{"cluster_state:ok", "cluster_slots_ok:16384", "cluster_size:2", "cluster_known_nodes:4"} {
+		if !strings.Contains(res, line+"\r\n") {
+			t.Errorf("expected %s in %q", line, res)
+		}
+	}
+	c.router.topology.Shards[1].Servers[1].IsLeader = false
+	res = string(c.clusterView.info().content)
+	if !strings.Contains(res, "cluster_state:fail\r\n") {
+		t.Errorf("expected failed state in %q", res)
+	}
+}
+
+func TestCrossSlot(t *testing.T) {
+	c := testCluster(t)
+	res := string(c.Handle(Request{Command: "pfcount", Args: []Arg{Arg("foo"), Arg("bar")}}))
+	if !strings.HasPrefix(res, "-CROSSSLOT") {
+		t.Errorf("unexpected response %q", res)
+	}
+	if _, err := checkSlots([]string{"{user}.a", "{user}.b"}); err != nil {
+		t.Errorf("keys with the same hash tag should share a slot")
+	}
+}
+
+func TestCommandKeys(t *testing.T) {
+	tests := []struct {
+		req  Request
+		keys int
+	}{
+		{Request{Command: "GET", Args: []Arg{Arg("a")}}, 1},
+		{Request{Command: "bitop", Args: []Arg{Arg("and"), Arg("d"), Arg("a"), Arg("b")}}, 3},
+		{Request{Command: "pfmerge", Args: []Arg{Arg("d"), Arg("a")}}, 2},
+		{Request{Command: "ping"}, 0},
+		{Request{Command: "cluster", Args: []Arg{Arg("info")}}, 0},
+	}
+	for _, test := range tests {
+		if keys := commandKeys(test.req); len(keys) != test.keys {
+			t.Errorf("%s: expected %d keys got %v", test.req.Command, test.keys, keys)
+		}
+	}
+}
+
+func TestLeadershipChanged(t *testing.T) {
+	if !leadershipChanged([]byte("-rpc error: code = Unknown desc = node is not the leader\r\n")) {
+		t.Errorf("expected not leader error to be a leadership change")
+	}
+	if leadershipChanged([]byte("+OK\r\n")) {
+		t.Errorf("expected ok not to be a leadership change")
+	}
+}
+
+func TestClusterNodesMigrating(t *testing.T) {
+	c := testCluster(t)
+	c.router.topology.Shards[0].Slots = []*chickaree.SlotRange{{Start: 0, End: 100}, {Start: 102, End: 8191}}
+	c.router.topology.Shards[1].Slots = append(c.router.topology.Shards[1].Slots, &chickaree.SlotRange{Start: 101, End: 101})
+	c.router.topology.Migrations = []*chickaree.SlotMigration{
+		{Slot: 5, Source: 0, Target: 1, State: chickaree.MigrationState_MIGRATION_MIGRATING},
+	}
+	res := string(c.clusterView.nodes().content)
+	lines := strings.Split(strings.TrimSpace(res), "\n")
+	if !strings.HasSuffix(lines[0], " 0-100 102-8191 [5->-"+clusterNodeID("b", 1)+"]") {
+		t.Errorf("unexpected source %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[3], " 8192-16383 101 [5-<-"+clusterNodeID("a", 0)+"]") {
+		t.Errorf("unexpected target %q", lines[3])
+	}
+}
+
+func TestMigrationRedirect(t *testing.T) {
+	c := testCluster(t)
+	msg, ok := migrationError([]byte("-rpc error: code = Unknown desc = ASK 5 1\r\n"))
+	if !ok {
+		t.Fatal("expected an ASK error")
+	}
+	if res := string(c.clusterView.redirect(msg).Encode()); res != "-ASK 5 proxy:6379\r\n" {
+		t.Errorf("unexpected redirect %q", res)
+	}
+	msg, ok = migrationError([]byte("-rpc error: code = Unknown desc = TRYAGAIN Slot is being migrated\r\n"))
+	if !ok || msg != "TRYAGAIN Slot is being migrated" {
+		t.Errorf("unexpected try again %q", msg)
+	}
+	if _, ok := migrationError([]byte("-WRONGTYPE Operation against a key\r\n")); ok {
+		t.Errorf("expected other errors to be left alone")
+	}
+}
+
+func TestAsking(t *testing.T) {
+	c := testCluster(t)
+	if res := string(c.Handle(Request{Command: "ASKING"})); res != "+OK\r\n" {
+		t.Fatalf("unexpected response %q", res)
+	}
+	if !c.asking {
+		t.Errorf("expected asking to be set")
+	}
+	c.Handle(Request{Command: "ping"})
+	if c.asking {
+		t.Errorf("expected asking to only last for one command")
+	}
+}
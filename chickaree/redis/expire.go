@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+)
+
+func (c *Client) expire(args []Arg, unit time.Duration) Response {
+	if len(args) != 2 {
+		return ErrResponse(errWrongArgs("expire"))
+	}
+	ttl, err := parseInt(args[1])
+	if err != nil {
+		return ErrResponse(err)
+	}
+	resp, err := c.leader(string(args[0])).Expire(c.context(), &chickaree.ExpireRequest{
+		Key:   string(args[0]),
+		TtlMs: ttl * int64(unit/time.Millisecond),
+	})
+	if err != nil {
+		return ErrResponse(err)
+	}
+	if resp.Updated {
+		return IntResponse(1)
+	}
+	return IntResponse(0)
+}
+
+func (c *Client) persist(args []Arg) Response {
+	if len(args) != 1 {
+		return ErrResponse(errWrongArgs("persist"))
+	}
+	resp, err := c.leader(string(args[0])).Expire(c.context(), &chickaree.ExpireRequest{
+		Key:     string(args[0]),
+		Persist: true,
+	})
+	if err != nil {
+		return ErrResponse(err)
+	}
+	if resp.Updated {
+		return IntResponse(1)
+	}
+	return IntResponse(0)
+}
+
+func (c *Client) ttl(args []Arg, unit time.Duration) Response {
+	if len(args) != 1 {
+		return ErrResponse(errWrongArgs("ttl"))
+	}
+	resp, err := c.client.TTL(c.context(), &chickaree.TTLRequest{Key: string(args[0])})
+	if err != nil {
+		return ErrResponse(err)
+	}
+	if resp.TtlMs < 0 {
+		return IntResponse(resp.TtlMs)
+	}
+	ms := int64(unit / time.Millisecond)
+	// round to the nearest unit as redis does
+	return IntResponse((resp.TtlMs + ms/2) / ms)
+}
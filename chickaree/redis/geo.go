@@ -0,0 +1,268 @@
+package redis
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+)
+
+var errNotFloat = errors.New("value is not a valid float")
+
+func parseFloat(arg Arg) (float64, error) {
+	f, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil {
+		return 0, errNotFloat
+	}
+	return f, nil
+}
+
+// humanFloat formats coordinates the same way redis replies with long doubles.
+func humanFloat(f float64) Response {
+	s := strconv.FormatFloat(f, 'f', 17, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return BulkResponse([]byte(s))
+}
+
+func distanceResponse(d float64) Response {
+	return BulkResponse([]byte(strconv.FormatFloat(d, 'f', 4, 64)))
+}
+
+func (c *Client) geoAdd(args []Arg) Response {
+	if len(args) < 4 {
+		return ErrResponse(errWrongArgs("geoadd"))
+	}
+	req := &chickaree.GeoAddRequest{Key: string(args[0])}
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			req.Nx = true
+		case "xx":
+			req.Xx = true
+		case "ch":
+			req.Ch = true
+		default:
+			break options
+		}
+	}
+	if req.Nx && req.Xx {
+		return ErrResponse(errors.New("XX and NX options at the same time are not compatible"))
+	}
+	if (len(args)-i)%3 != 0 || i == len(args) {
+		return ErrResponse(errSyntax)
+	}
+	for ; i < len(args); i += 3 {
+		long, err := parseFloat(args[i])
+		if err != nil {
+			return ErrResponse(err)
+		}
+		lat, err := parseFloat(args[i+1])
+		if err != nil {
+			return ErrResponse(err)
+		}
+		req.Points = append(req.Points, &chickaree.GeoPoint{
+			Member:    string(args[i+2]),
+			Longitude: long,
+			Latitude:  lat,
+		})
+	}
+	resp, err := c.leader(req.Key).GeoAdd(c.context(), req)
+	if err != nil {
+		return ErrResponse(err)
+	}
+	return IntResponse(resp.Count)
+}
+
+func (c *Client) geoPos(args []Arg) Encoder {
+	if len(args) < 1 {
+		return ErrResponse(errWrongArgs("geopos"))
+	}
+	req := &chickaree.GeoPosRequest{Key: string(args[0])}
+	for _, member := range args[1:] {
+		req.Members = append(req.Members, string(member))
+	}
+	resp, err := c.client.GeoPos(c.context(), req)
+	if err != nil {
+		return ErrResponse(err)
+	}
+	res := ResponseArray{}
+	for _, pos := range resp.Positions {
+		if !pos.Exists {
+			res = append(res, NilArrayResp)
+			continue
+		}
+		res = append(res, ResponseArray{humanFloat(pos.Longitude), humanFloat(pos.Latitude)})
+	}
+	return res
+}
+
+func (c *Client) geoDist(args []Arg) Response {
+	if len(args) != 3 && len(args) != 4 {
+		return ErrResponse(errWrongArgs("geodist"))
+	}
+	req := &chickaree.GeoDistRequest{
+		Key:     string(args[0]),
+		Member1: string(args[1]),
+		Member2: string(args[2]),
+	}
+	if len(args) == 4 {
+		req.Unit = string(args[3])
+	}
+	resp, err := c.client.GeoDist(c.context(), req)
+	if err != nil {
+		return ErrResponse(err)
+	}
+	if !resp.Exists {
+		return NilStringResp
+	}
+	return distanceResponse(resp.Distance)
+}
+
+func (c *Client) geoHash(args []Arg) Encoder {
+	if len(args) < 1 {
+		return ErrResponse(errWrongArgs("geohash"))
+	}
+	req := &chickaree.GeoHashRequest{Key: string(args[0])}
+	for _, member := range args[1:] {
+		req.Members = append(req.Members, string(member))
+	}
+	resp, err := c.client.GeoHash(c.context(), req)
+	if err != nil {
+		return ErrResponse(err)
+	}
+	res := ResponseArray{}
+	for _, hash := range resp.Hashes {
+		if !hash.Exists {
+			res = append(res, NilStringResp)
+			continue
+		}
+		res = append(res, BulkResponse([]byte(hash.Hash)))
+	}
+	return res
+}
+
+func (c *Client) geoSearch(args []Arg) Encoder {
+	if len(args) < 1 {
+		return ErrResponse(errWrongArgs("geosearch"))
+	}
+	req := &chickaree.GeoSearchRequest{Key: string(args[0])}
+	var fromSet, shapeSet, withCoord, withDist, withHash bool
+	for i := 1; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		var err error
+		switch strings.ToLower(string(args[i])) {
+		case "frommember":
+			if remaining < 1 || fromSet {
+				return ErrResponse(errSyntax)
+			}
+			req.FromMember = string(args[i+1])
+			fromSet = true
+			i++
+		case "fromlonlat":
+			if remaining < 2 || fromSet {
+				return ErrResponse(errSyntax)
+			}
+			req.FromLonLat = true
+			if req.Longitude, err = parseFloat(args[i+1]); err != nil {
+				return ErrResponse(err)
+			}
+			if req.Latitude, err = parseFloat(args[i+2]); err != nil {
+				return ErrResponse(err)
+			}
+			fromSet = true
+			i += 2
+		case "byradius":
+			if remaining < 2 || shapeSet {
+				return ErrResponse(errSyntax)
+			}
+			if req.Radius, err = parseFloat(args[i+1]); err != nil {
+				return ErrResponse(err)
+			}
+			if req.Radius < 0 {
+				return ErrResponse(errors.New("radius cannot be negative"))
+			}
+			req.Unit = string(args[i+2])
+			shapeSet = true
+			i += 2
+		case "bybox":
+			if remaining < 3 || shapeSet {
+				return ErrResponse(errSyntax)
+			}
+			req.ByBox = true
+			if req.Width, err = parseFloat(args[i+1]); err != nil {
+				return ErrResponse(err)
+			}
+			if req.Height, err = parseFloat(args[i+2]); err != nil {
+				return ErrResponse(err)
+			}
+			if req.Width < 0 || req.Height < 0 {
+				return ErrResponse(errors.New("height or width cannot be negative"))
+			}
+			req.Unit = string(args[i+3])
+			shapeSet = true
+			i += 3
+		case "asc", "desc":
+			req.Sort = strings.ToLower(string(args[i]))
+		case "count":
+			if remaining < 1 {
+				return ErrResponse(errSyntax)
+			}
+			if req.Count, err = parseInt(args[i+1]); err != nil {
+				return ErrResponse(err)
+			}
+			if req.Count <= 0 {
+				return ErrResponse(errors.New("COUNT must be > 0"))
+			}
+			i++
+			if remaining > 1 && strings.ToLower(string(args[i+1])) == "any" {
+				req.Any = true
+				i++
+			}
+		case "withcoord":
+			withCoord = true
+		case "withdist":
+			withDist = true
+		case "withhash":
+			withHash = true
+		default:
+			return ErrResponse(errSyntax)
+		}
+	}
+	if !fromSet {
+		return ErrResponse(errors.New("exactly one of FROMMEMBER or FROMLONLAT can be specified for geosearch"))
+	}
+	if !shapeSet {
+		return ErrResponse(errors.New("exactly one of BYRADIUS and BYBOX can be specified for geosearch"))
+	}
+	if req.Any && req.Count == 0 {
+		return ErrResponse(errors.New("the ANY argument requires COUNT argument"))
+	}
+
+	resp, err := c.client.GeoSearch(c.context(), req)
+	if err != nil {
+		return ErrResponse(err)
+	}
+	res := ResponseArray{}
+	for _, r := range resp.Results {
+		member := BulkResponse([]byte(r.Member))
+		if !withCoord && !withDist && !withHash {
+			res = append(res, member)
+			continue
+		}
+		item := ResponseArray{member}
+		if withDist {
+			item = append(item, distanceResponse(r.Distance))
+		}
+		if withHash {
+			item = append(item, IntResponse(int64(r.Hash)))
+		}
+		if withCoord {
+			item = append(item, ResponseArray{humanFloat(r.Longitude), humanFloat(r.Latitude)})
+		}
+		res = append(res, item)
+	}
+	return res
+}
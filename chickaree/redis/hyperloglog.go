@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"github.com/holmes89/chickaree-db/chickaree"
+)
+
+func (c *Client) pfAdd(args []Arg) Response {
+	if len(args) < 1 {
+		return ErrResponse(errWrongArgs("pfadd"))
+	}
+	req := &chickaree.PFAddRequest{Key: string(args[0])}
+	for _, elem := range args[1:] {
+		req.Elements = append(req.Elements, elem)
+	}
+	resp, err := c.leader(req.Key).PFAdd(c.context(), req)
+	if err != nil {
+		return ErrResponse(err)
+	}
+	if resp.Updated {
+		return IntResponse(1)
+	}
+	return IntResponse(0)
+}
+
+func (c *Client) pfCount(args []Arg) Response {
+	if len(args) < 1 {
+		return ErrResponse(errWrongArgs("pfcount"))
+	}
+	req := &chickaree.PFCountRequest{}
+	for _, key := range args {
+		req.Keys = append(req.Keys, string(key))
+	}
+	resp, err := c.client.PFCount(c.context(), req)
+	if err != nil {
+		return ErrResponse(err)
+	}
+	return IntResponse(resp.Count)
+}
+
+func (c *Client) pfMerge(args []Arg) Response {
+	if len(args) < 1 {
+		return ErrResponse(errWrongArgs("pfmerge"))
+	}
+	req := &chickaree.PFMergeRequest{Destination: string(args[0])}
+	for _, key := range args[1:] {
+		req.Keys = append(req.Keys, string(key))
+	}
+	if _, err := c.leader(req.Destination).PFMerge(c.context(), req); err != nil {
+		return ErrResponse(err)
+	}
+	return OkResp
+}
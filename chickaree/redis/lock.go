@@ -0,0 +1,82 @@
+package redis
+
+import (
+	"strconv"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+)
+
+// lock handles LOCK name owner ttl-ms returning the fencing token or nil if
+// the lock is held by someone else.
+func (c *Client) lock(args []Arg) Response {
+	if len(args) != 3 {
+		return ErrResponse(errWrongArgs("lock"))
+	}
+	ttl, err := parseInt(args[2])
+	if err != nil {
+		return ErrResponse(err)
+	}
+	resp, err := c.leader(string(args[0])).Lock(c.context(), &chickaree.LockRequest{
+		Name:  string(args[0]),
+		Owner: string(args[1]),
+		TtlMs: ttl,
+	})
+	if err != nil {
+		return ErrResponse(err)
+	}
+	if !resp.Acquired {
+		return NilStringResp
+	}
+	return IntResponse(int64(resp.Token))
+}
+
+// unlock handles UNLOCK name owner token.
+func (c *Client) unlock(args []Arg) Response {
+	if len(args) != 3 {
+		return ErrResponse(errWrongArgs("unlock"))
+	}
+	token, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil {
+		return ErrResponse(errNotInteger)
+	}
+	resp, err := c.leader(string(args[0])).Unlock(c.context(), &chickaree.UnlockRequest{
+		Name:  string(args[0]),
+		Owner: string(args[1]),
+		Token: token,
+	})
+	if err != nil {
+		return ErrResponse(err)
+	}
+	if resp.Released {
+		return IntResponse(1)
+	}
+	return IntResponse(0)
+}
+
+// refresh handles REFRESH name owner token ttl-ms.
+func (c *Client) refresh(args []Arg) Response {
+	if len(args) != 4 {
+		return ErrResponse(errWrongArgs("refresh"))
+	}
+	token, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil {
+		return ErrResponse(errNotInteger)
+	}
+	ttl, err := parseInt(args[3])
+	if err != nil {
+		return ErrResponse(err)
+	}
+	resp, err := c.leader(string(args[0])).Refresh(c.context(), &chickaree.RefreshRequest{
+		Name:  string(args[0]),
+		Owner: string(args[1]),
+		Token: token,
+		TtlMs: ttl,
+	})
+	if err != nil {
+		return ErrResponse(err)
+	}
+	if resp.Refreshed {
+		return IntResponse(1)
+	}
+	return IntResponse(0)
+}
@@ -27,7 +27,13 @@ type Response struct {
 	content []byte
 }
 
-type ResponseArray []Response
+// Encoder is implemented by anything that can be written back to a client.
+type Encoder interface {
+	Encode() []byte
+}
+
+// ResponseArray may hold nested arrays as well as responses.
+type ResponseArray []Encoder
 
 func (res ResponseArray) Encode() []byte {
 	length := strconv.Itoa(len(res))
@@ -59,12 +65,17 @@ func (res Response) Encode() []byte {
 		buf.Write(res.content)
 	case BulkStrings:
 		buf.WriteString(length)
+		if res.length < 0 {
+			break
+		}
 		buf.Write(TerminationSeq)
 		buf.Write(res.content)
 	case Integers:
 		buf.Write(res.content)
 	case Errors:
 		buf.Write(res.content)
+	case Arrays:
+		buf.WriteString(length)
 	}
 	buf.Write(TerminationSeq)
 	return buf.Bytes()
@@ -92,11 +103,31 @@ var NilStringResp = Response{
 	length: -1,
 }
 
+var NilArrayResp = Response{
+	rtype:  Arrays,
+	length: -1,
+}
+
 var OkResp = Response{
 	rtype:   SimpleString,
 	content: []byte("OK"),
 }
 
+func IntResponse(n int64) Response {
+	return Response{
+		rtype:   Integers,
+		content: []byte(strconv.FormatInt(n, 10)),
+	}
+}
+
+func BulkResponse(b []byte) Response {
+	return Response{
+		rtype:   BulkStrings,
+		length:  len(b),
+		content: b,
+	}
+}
+
 func ErrResponse(err error) Response {
 	return Response{
 		rtype:   Errors,
@@ -15,3 +15,16 @@ func TestGetSize(t *testing.T) {
 		t.Errorf("should be 1 not %d", res)
 	}
 }
+
+func TestEncodeNil(t *testing.T) {
+	if res := string(NilStringResp.Encode()); res != "$-1\r\n" {
+		t.Errorf("unexpected nil encoding %q", res)
+	}
+}
+
+func TestEncodeNestedArray(t *testing.T) {
+	res := ResponseArray{IntResponse(1), ResponseArray{BulkResponse([]byte("a"))}, NilArrayResp}
+	if enc := string(res.Encode()); enc != "*3\r\n:1\r\n*1\r\n$1\r\na\r\n*-1\r\n" {
+		t.Errorf("unexpected encoding %q", enc)
+	}
+}
@@ -0,0 +1,142 @@
+package redis
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+)
+
+// router sends writes straight to the leader of the raft group owning the
+// key's slot. Writes for unknown slots go through the default client and
+// are forwarded by the storage server.
+type router struct {
+	mu       sync.RWMutex
+	shards   []shardRoute
+	topology *chickaree.GetShardsResponse
+	conns    map[string]*grpc.ClientConn
+	clients  map[string]chickaree.ChickareeDBClient
+	opts     []grpc.DialOption
+}
+
+type shardRoute struct {
+	start, end uint16
+	leader     string
+}
+
+// newRouter dials leaders with opts, without tls when there are none.
+func newRouter(opts ...grpc.DialOption) *router {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	return &router{
+		conns:   make(map[string]*grpc.ClientConn),
+		clients: make(map[string]chickaree.ChickareeDBClient),
+		opts:    opts,
+	}
+}
+
+// client returns a client for the leader of the key's group or nil if it is
+// not known.
+func (r *router) client(key string) chickaree.ChickareeDBClient {
+	slot := chickaree.KeySlot(key)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	i := sort.Search(len(r.shards), func(i int) bool { return r.shards[i].end >= slot })
+	if i == len(r.shards) || r.shards[i].start > slot {
+		return nil
+	}
+	return r.clients[r.shards[i].leader]
+}
+
+// refresh reloads the shard leaders, dialing new leaders and closing
+// connections no group uses anymore.
+func (r *router) refresh(ctx context.Context, client chickaree.ChickareeDBClient) {
+	resp, err := client.GetShards(ctx, &chickaree.GetShardsRequest{})
+	if err != nil || resp == nil {
+		log.Error().Err(err).Msg("unable to find shards")
+		return
+	}
+	shards := shardRoutes(resp.Shards)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	used := make(map[string]bool)
+	for _, sh := range shards {
+		if sh.leader == "" {
+			log.Warn().Uint16("start", sh.start).Uint16("end", sh.end).Msg("no leader for shard")
+			continue
+		}
+		used[sh.leader] = true
+		if _, ok := r.conns[sh.leader]; ok {
+			continue
+		}
+		log.Info().Str("url", sh.leader).Msg("dialing leader...")
+		conn, err := grpc.Dial(sh.leader, r.opts...)
+		if err != nil {
+			log.Error().Err(err).Str("url", sh.leader).Msg("failed to dial leader GRPC")
+			continue
+		}
+		r.conns[sh.leader] = conn
+		r.clients[sh.leader] = chickaree.NewChickareeDBClient(conn)
+	}
+	for addr, conn := range r.conns {
+		if used[addr] {
+			continue
+		}
+		if err := conn.Close(); err != nil {
+			log.Error().Err(err).Msg("error closing leader conn")
+		}
+		delete(r.conns, addr)
+		delete(r.clients, addr)
+	}
+	r.shards = shards
+	r.topology = resp
+}
+
+// Topology returns the groups, their servers and the slots migrating
+// between them from the last refresh.
+func (r *router) Topology() *chickaree.GetShardsResponse {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.topology
+}
+
+// shardRoutes returns the leader address of every slot range sorted by
+// slot.
+func shardRoutes(shards []*chickaree.Shard) []shardRoute {
+	var routes []shardRoute
+	for _, sh := range shards {
+		leader := ""
+		for _, sv := range sh.Servers {
+			if sv.IsLeader {
+				leader = sv.RpcAddr
+			}
+		}
+		for _, r := range sh.Slots {
+			routes = append(routes, shardRoute{start: uint16(r.Start), end: uint16(r.End), leader: leader})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].start < routes[j].start })
+	return routes
+}
+
+func (r *router) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	for addr, conn := range r.conns {
+		if cerr := conn.Close(); cerr != nil {
+			err = cerr
+		}
+		delete(r.conns, addr)
+		delete(r.clients, addr)
+	}
+	r.shards = nil
+	r.topology = nil
+	return err
+}
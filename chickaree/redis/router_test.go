@@ -0,0 +1,49 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+)
+
+func TestShardRoutes(t *testing.T) {
+	routes := shardRoutes([]*chickaree.Shard{
+		{Group: 1, Slots: []*chickaree.SlotRange{{Start: 8192, End: 16383}}, Servers: []*chickaree.Server{
+			{Id: "a", RpcAddr: "a:8400"},
+			{Id: "b", RpcAddr: "b:8400", IsLeader: true},
+		}},
+		{Group: 0, Slots: []*chickaree.SlotRange{{Start: 0, End: 8191}}, Servers: []*chickaree.Server{
+			{Id: "a", RpcAddr: "a:8400", IsLeader: true},
+		}},
+	})
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes got %d", len(routes))
+	}
+	if routes[0].start != 0 || routes[0].leader != "a:8400" {
+		t.Errorf("unexpected first route %+v", routes[0])
+	}
+	if routes[1].start != 8192 || routes[1].leader != "b:8400" {
+		t.Errorf("unexpected second route %+v", routes[1])
+	}
+}
+
+func TestRouterClient(t *testing.T) {
+	r := newRouter()
+	if r.client("foo") != nil {
+		t.Errorf("expected no client without shards")
+	}
+	leader := chickaree.NewChickareeDBClient(nil)
+	r.shards = []shardRoute{
+		{start: 0, end: 8191, leader: "a:8400"},
+		{start: 8192, end: 16383, leader: "b:8400"},
+	}
+	r.clients["b:8400"] = leader
+	// foo is in slot 12182
+	if r.client("foo") != leader {
+		t.Errorf("expected the leader of the second shard")
+	}
+	// bar is in slot 5061
+	if r.client("bar") != nil {
+		t.Errorf("expected no client for a shard that has not been dialed")
+	}
+}
@@ -2,6 +2,8 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"net"
 	"time"
 
@@ -12,37 +14,42 @@ import (
 )
 
 type TcpServer struct {
-	listener     net.Listener
-	client       chickaree.ChickareeDBClient
-	leaderConn   *grpc.ClientConn
-	leaderClient chickaree.ChickareeDBClient
-	leaderURL    string
-	errch        chan error
-	done         chan bool
-	ticker       *time.Ticker
+	listeners []net.Listener
+	client    chickaree.ChickareeDBClient
+	router    *router
+	cluster   *cluster
+	users     *users
+	errch     chan error
+	done      chan bool
+	ticker    *time.Ticker
+	aclTicker *time.Ticker
 }
 
-func NewTCPServer(port string, client chickaree.ChickareeDBClient) *TcpServer {
-
-	if port[0] != ':' {
-		port = ":" + port
-	}
-
-	listener, err := net.Listen("tcp", port)
-	if err != nil {
-		log.Fatal().Err(err).Str("port", port).Msg("failed to listen")
-	}
-
-	log.Info().Str("port", port).Msg("listening...")
+// NewTCPServer proxies to the storage client, opts are used to dial group
+// leaders directly. An empty port only serves the ports added with
+// ListenTLS.
+func NewTCPServer(port string, client chickaree.ChickareeDBClient, opts ...grpc.DialOption) *TcpServer {
 
 	errch := make(chan error)
 	s := &TcpServer{
-		listener: listener,
-		errch:    errch,
-		client:   client,
+		errch:  errch,
+		client: client,
+		router: newRouter(opts...),
+		users:  newUsers(""),
+	}
+	if port != "" {
+		port = listenAddr(port)
+		listener, err := net.Listen("tcp", port)
+		if err != nil {
+			log.Fatal().Err(err).Str("port", port).Msg("failed to listen")
+		}
+		log.Info().Str("port", port).Msg("listening...")
+		s.listeners = append(s.listeners, listener)
 	}
-	s.setLeaderClient()
+	s.refreshShards()
+	s.refreshUsers()
 	s.ticker = time.NewTicker(30 * time.Second)
+	s.aclTicker = time.NewTicker(time.Second)
 	s.done = make(chan bool)
 	go func() {
 		for {
@@ -50,7 +57,9 @@ func NewTCPServer(port string, client chickaree.ChickareeDBClient) *TcpServer {
 			case <-s.done:
 				return
 			case <-s.ticker.C:
-				s.setLeaderClient()
+				s.refreshShards()
+			case <-s.aclTicker.C:
+				s.refreshUsers()
 			}
 		}
 	}()
@@ -58,61 +67,88 @@ func NewTCPServer(port string, client chickaree.ChickareeDBClient) *TcpServer {
 	return s
 }
 
+// EnableCluster answers redis cluster commands, announcing every node at the
+// proxy's address. It must be called before Run.
+func (s *TcpServer) EnableCluster(announce string) error {
+	c, err := newCluster(announce, s.router, s.client)
+	if err != nil {
+		return err
+	}
+	s.cluster = c
+	return nil
+}
+
+// RequirePass sets the password of the default user until ACL SETUSER
+// changes it. It must be called before Run.
+func (s *TcpServer) RequirePass(password string) {
+	s.users = newUsers(password)
+	s.refreshUsers()
+}
+
+// ListenTLS also serves RESP over tls on port. It must be called before
+// Run.
+func (s *TcpServer) ListenTLS(port string, config *tls.Config) error {
+	port = listenAddr(port)
+	listener, err := tls.Listen("tcp", port, config)
+	if err != nil {
+		log.Error().Err(err).Str("port", port).Msg("failed to listen tls")
+		return errors.New("unable to listen tls")
+	}
+	log.Info().Str("port", port).Msg("listening tls...")
+	s.listeners = append(s.listeners, listener)
+	return nil
+}
+
+func listenAddr(port string) string {
+	if port[0] != ':' {
+		return ":" + port
+	}
+	return port
+}
+
 func (s *TcpServer) Run() <-chan error {
-	go func() {
-		for {
-			conn, err := s.listener.Accept()
-			if err != nil {
-				s.errch <- err
+	for _, listener := range s.listeners {
+		go s.accept(listener)
+	}
+	return s.errch
+}
+
+func (s *TcpServer) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case s.errch <- err:
+			case <-s.done:
 			}
-			_ = NewClient(conn, s.leaderClient, s.client)
-			log.Info().Msg("client connected")
+			return
 		}
-	}()
-	return s.errch
+		_ = NewClient(conn, s.router, s.client, s.cluster, s.users)
+		log.Info().Msg("client connected")
+	}
 }
 
 func (s *TcpServer) Close() error {
 	log.Info().Msg("closing server...")
-	close(s.errch)
 	s.ticker.Stop()
-	s.done <- true
+	s.aclTicker.Stop()
+	// stops the refresh loop and any listener still reporting its error
 	close(s.done)
-	s.leaderConn.Close()
-	return s.listener.Close()
+	s.router.Close()
+	var err error
+	for _, listener := range s.listeners {
+		if cerr := listener.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
 }
 
-func (s *TcpServer) setLeaderClient() {
-	log.Info().Msg("setting leader client...")
-	resp, err := s.client.GetServers(context.Background(), &chickaree.GetServersRequest{})
-	if err != nil || resp == nil || resp.Servers == nil {
-		log.Error().Err(err).Msg("unable to find servers")
-		return
-	}
-	for _, sv := range resp.Servers {
-		if sv.IsLeader {
-			if sv.RpcAddr == s.leaderURL {
-				log.Info().Str("url", sv.RpcAddr).Msg("leader has not changed.")
-				return
-			}
-			opts := []grpc.DialOption{grpc.WithInsecure()}
-			conn, err := grpc.Dial(sv.RpcAddr, opts...)
-			log.Info().Str("url", sv.RpcAddr).Msg("dialing leader...")
-			if err != nil {
-				log.Fatal().Err(err).Str("url", sv.RpcAddr).Msg("failed to dial leader GRPC")
-				return
-			}
-			if s.leaderConn != nil {
-				if err := s.leaderConn.Close(); err != nil {
-					log.Error().Err(err).Msg("error closing leader conn")
-				}
-			}
+func (s *TcpServer) refreshShards() {
+	log.Info().Msg("refreshing shard leaders...")
+	s.router.refresh(context.Background(), s.client)
+}
 
-			s.leaderConn = conn
-			s.leaderClient = chickaree.NewChickareeDBClient(conn)
-			log.Info().Msg("leader client set.")
-			return
-		}
-	}
-	log.Error().Msg("unable to find leader")
+func (s *TcpServer) refreshUsers() {
+	s.users.refresh(context.Background(), s.client)
 }
@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+	"google.golang.org/grpc"
+)
+
+type noShardsClient struct {
+	chickaree.ChickareeDBClient
+}
+
+func (noShardsClient) GetShards(ctx context.Context, in *chickaree.GetShardsRequest, opts ...grpc.CallOption) (*chickaree.GetShardsResponse, error) {
+	return nil, errors.New("no shards")
+}
+
+func (noShardsClient) GetUsers(ctx context.Context, in *chickaree.GetUsersRequest, opts ...grpc.CallOption) (*chickaree.GetUsersResponse, error) {
+	return nil, errors.New("no users")
+}
+
+func selfSigned(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func ping(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("*1\r\n$4\r\nPING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "+PONG\r\n" {
+		t.Errorf("expected PONG got %q", line)
+	}
+}
+
+func TestListenTLS(t *testing.T) {
+	s := NewTCPServer(":0", noShardsClient{})
+	defer s.Close()
+	config := &tls.Config{Certificates: []tls.Certificate{selfSigned(t)}}
+	if err := s.ListenTLS(":0", config); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.listeners) != 2 {
+		t.Fatalf("expected plaintext and tls listeners got %d", len(s.listeners))
+	}
+	s.Run()
+
+	conn, err := net.Dial("tcp", s.listeners[0].Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ping(t, conn)
+
+	tlsConn, err := tls.Dial("tcp", s.listeners[1].Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ping(t, tlsConn)
+}
@@ -0,0 +1,272 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/storage"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// The agent tails the log of every raft group of the primary and replays
+// the writes on a read only secondary, which routes them to the leaders of
+// its own groups. Each group of the primary is tailed on its own so writes
+// are only ordered within a group. When the primary has compacted its log
+// past the checkpoint the group's slots are copied instead.
+
+const (
+	defaultBatchSize    = 500
+	defaultPollInterval = 100 * time.Millisecond
+	retryInterval       = time.Second
+)
+
+// ErrPromoted stops the agent once the secondary accepts its own writes.
+var ErrPromoted = errors.New("secondary has been promoted")
+
+type Config struct {
+	// Checkpoint is the file the last replicated indexes are saved to.
+	Checkpoint   string
+	BatchSize    uint32
+	PollInterval time.Duration
+}
+
+type Agent struct {
+	config     Config
+	primary    chickaree.AdminClient
+	shards     chickaree.ChickareeDBClient
+	secondary  chickaree.AdminClient
+	checkpoint *checkpoint
+
+	mu     sync.Mutex
+	groups map[uint32]*groupStatus
+}
+
+type groupStatus struct {
+	checkpoint uint64
+	applied    uint64
+	// appendedAt is when the primary appended the last replicated entry.
+	appendedAt int64
+	caughtUp   bool
+	resyncs    int
+}
+
+func NewAgent(primary, secondary grpc.ClientConnInterface, config Config) (*Agent, error) {
+	if config.BatchSize == 0 {
+		config.BatchSize = defaultBatchSize
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = defaultPollInterval
+	}
+	cp, err := loadCheckpoint(config.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &Agent{
+		config:     config,
+		primary:    chickaree.NewAdminClient(primary),
+		shards:     chickaree.NewChickareeDBClient(primary),
+		secondary:  chickaree.NewAdminClient(secondary),
+		checkpoint: cp,
+		groups:     make(map[uint32]*groupStatus),
+	}, nil
+}
+
+// Run replicates every group of the primary until ctx is done or the
+// secondary is promoted.
+func (a *Agent) Run(ctx context.Context) error {
+	shards, err := a.shards.GetShards(ctx, &chickaree.GetShardsRequest{})
+	if err != nil {
+		log.Error().Err(err).Msg("unable to get primary shards")
+		return errors.New("unable to start replication")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(shards.Shards))
+	for _, shard := range shards.Shards {
+		go func(group uint32) {
+			errs <- a.tail(ctx, group)
+		}(shard.Group)
+	}
+	err = <-errs
+	cancel()
+	for i := 1; i < len(shards.Shards); i++ {
+		<-errs
+	}
+	return err
+}
+
+func (a *Agent) tail(ctx context.Context, group uint32) error {
+	log.Info().Uint32("group", group).Uint64("checkpoint", a.checkpoint.get(group)).Msg("replicating group")
+	for {
+		caughtUp, err := a.step(ctx, group)
+		if errors.Is(err, ErrPromoted) {
+			log.Warn().Uint32("group", group).Msg("secondary promoted, stopping replication")
+			return err
+		}
+		wait := a.config.PollInterval
+		if err != nil {
+			log.Error().Err(err).Uint32("group", group).Msg("unable to replicate")
+			wait = retryInterval
+		} else if !caughtUp {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// step replicates one batch of a group, it reports whether the secondary
+// has caught up with the primary.
+func (a *Agent) step(ctx context.Context, group uint32) (bool, error) {
+	after := a.checkpoint.get(group)
+	resp, err := a.primary.ReadLog(ctx, &chickaree.ReadLogRequest{
+		Group: group,
+		After: after,
+		Limit: a.config.BatchSize,
+	})
+	if err != nil {
+		return false, err
+	}
+	if resp.FirstIndex > after+1 {
+		return false, a.resync(ctx, group, resp.AppliedIndex)
+	}
+	if len(resp.Entries) > 0 {
+		if err := a.replicate(ctx, resp.Entries); err != nil {
+			return false, err
+		}
+	}
+	if resp.Last != after {
+		if err := a.checkpoint.set(group, resp.Last); err != nil {
+			return false, err
+		}
+	}
+	caughtUp := resp.Last >= resp.AppliedIndex
+	a.update(group, func(s *groupStatus) {
+		s.checkpoint = resp.Last
+		s.applied = resp.AppliedIndex
+		s.caughtUp = caughtUp
+		if n := len(resp.Entries); n > 0 {
+			s.appendedAt = resp.Entries[n-1].AppendedAt
+		}
+	})
+	return caughtUp, nil
+}
+
+func (a *Agent) replicate(ctx context.Context, entries []*chickaree.LogEntry) error {
+	_, err := a.secondary.Replicate(ctx, &chickaree.ReplicateRequest{Entries: entries})
+	if err != nil && status.Convert(err).Message() == storage.ErrNotReplica.Error() {
+		return ErrPromoted
+	}
+	return err
+}
+
+// resync copies every slot the group owns and deletes keys the secondary
+// has that the primary does not. Writes made during the copy are replayed
+// again from the applied index.
+func (a *Agent) resync(ctx context.Context, group uint32, applied uint64) error {
+	log.Warn().Uint32("group", group).Uint64("checkpoint", a.checkpoint.get(group)).Msg("primary log compacted, copying slots")
+	primary, err := a.primary.GetSlots(ctx, &chickaree.GetSlotsRequest{})
+	if err != nil {
+		return err
+	}
+	secondary, err := a.secondary.GetSlots(ctx, &chickaree.GetSlotsRequest{})
+	if err != nil {
+		return err
+	}
+	for slot, owner := range primary.Owners {
+		if owner != group {
+			continue
+		}
+		if err := a.copySlot(ctx, group, secondary.Owners[slot], uint32(slot)); err != nil {
+			return err
+		}
+	}
+	if err := a.checkpoint.set(group, applied); err != nil {
+		return err
+	}
+	a.update(group, func(s *groupStatus) {
+		s.checkpoint = applied
+		s.resyncs++
+	})
+	log.Info().Uint32("group", group).Uint64("checkpoint", applied).Msg("copied slots")
+	return nil
+}
+
+func (a *Agent) copySlot(ctx context.Context, group, secondaryGroup, slot uint32) error {
+	keep := make(map[string]bool)
+	if err := dumpSlot(ctx, a.primary, group, slot, func(entries []*chickaree.KeyDump) error {
+		for _, entry := range entries {
+			keep[entry.Key] = true
+		}
+		return a.restore(ctx, entries)
+	}); err != nil {
+		return err
+	}
+	return dumpSlot(ctx, a.secondary, secondaryGroup, slot, func(entries []*chickaree.KeyDump) error {
+		var stale []*chickaree.KeyDump
+		for _, entry := range entries {
+			if !keep[entry.Key] {
+				stale = append(stale, &chickaree.KeyDump{Key: entry.Key})
+			}
+		}
+		if len(stale) == 0 {
+			return nil
+		}
+		return a.restore(ctx, stale)
+	})
+}
+
+// restore replicates the dumped keys as a restore command so the secondary
+// routes them like any other write.
+func (a *Agent) restore(ctx context.Context, entries []*chickaree.KeyDump) error {
+	b, err := proto.Marshal(&chickaree.RestoreKeysRequest{Entries: entries})
+	if err != nil {
+		return err
+	}
+	data := append([]byte{byte(storage.RestoreKeysRequestType)}, b...)
+	return a.replicate(ctx, []*chickaree.LogEntry{{Data: data}})
+}
+
+func dumpSlot(ctx context.Context, c chickaree.AdminClient, group, slot uint32, fn func([]*chickaree.KeyDump) error) error {
+	after := ""
+	for {
+		resp, err := c.DumpSlot(ctx, &chickaree.DumpSlotRequest{
+			Group:       group,
+			Slot:        slot,
+			After:       after,
+			KeepChanges: true,
+		})
+		if err != nil {
+			return err
+		}
+		if len(resp.Entries) > 0 {
+			if err := fn(resp.Entries); err != nil {
+				return err
+			}
+		}
+		if resp.Next == "" {
+			return nil
+		}
+		after = resp.Next
+	}
+}
+
+func (a *Agent) update(group uint32, fn func(*groupStatus)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.groups[group]
+	if !ok {
+		s = &groupStatus{}
+		a.groups[group] = s
+	}
+	fn(s)
+}
@@ -0,0 +1,183 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type fakeAdmin struct {
+	chickaree.AdminClient
+	log        []*chickaree.LogEntry
+	first      uint64
+	owners     []uint32
+	keys       map[uint32][]*chickaree.KeyDump
+	replicated []*chickaree.LogEntry
+	err        error
+}
+
+func (f *fakeAdmin) ReadLog(ctx context.Context, req *chickaree.ReadLogRequest, opts ...grpc.CallOption) (*chickaree.ReadLogResponse, error) {
+	resp := &chickaree.ReadLogResponse{Last: req.After, FirstIndex: f.first, AppliedIndex: uint64(len(f.log))}
+	if req.After+1 < f.first {
+		return resp, nil
+	}
+	for _, entry := range f.log {
+		if entry.Index > req.After && len(resp.Entries) < int(req.Limit) {
+			resp.Entries = append(resp.Entries, entry)
+			resp.Last = entry.Index
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeAdmin) Replicate(ctx context.Context, req *chickaree.ReplicateRequest, opts ...grpc.CallOption) (*chickaree.ReplicateResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.replicated = append(f.replicated, req.Entries...)
+	return &chickaree.ReplicateResponse{}, nil
+}
+
+func (f *fakeAdmin) GetSlots(ctx context.Context, req *chickaree.GetSlotsRequest, opts ...grpc.CallOption) (*chickaree.SlotConfig, error) {
+	return &chickaree.SlotConfig{Owners: f.owners}, nil
+}
+
+func (f *fakeAdmin) DumpSlot(ctx context.Context, req *chickaree.DumpSlotRequest, opts ...grpc.CallOption) (*chickaree.DumpSlotResponse, error) {
+	if !req.KeepChanges {
+		return nil, errors.New("expected changes to be kept")
+	}
+	return &chickaree.DumpSlotResponse{Entries: f.keys[req.Slot]}, nil
+}
+
+func testAgent(t *testing.T, primary, secondary *fakeAdmin) *Agent {
+	cp, err := loadCheckpoint(filepath.Join(t.TempDir(), "checkpoint.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Agent{
+		config:     Config{BatchSize: 2},
+		primary:    primary,
+		secondary:  secondary,
+		checkpoint: cp,
+		groups:     make(map[uint32]*groupStatus),
+	}
+}
+
+func logEntries(n int) []*chickaree.LogEntry {
+	var entries []*chickaree.LogEntry
+	for i := 1; i <= n; i++ {
+		entries = append(entries, &chickaree.LogEntry{Index: uint64(i), Data: []byte{0}, AppendedAt: 1000})
+	}
+	return entries
+}
+
+func TestAgentStep(t *testing.T) {
+	primary := &fakeAdmin{log: logEntries(3), first: 1}
+	secondary := &fakeAdmin{}
+	a := testAgent(t, primary, secondary)
+	ctx := context.Background()
+
+	caughtUp, err := a.step(ctx, 0)
+	if err != nil || caughtUp {
+		t.Fatalf("expected a partial batch got %v %v", caughtUp, err)
+	}
+	if cp := a.checkpoint.get(0); cp != 2 {
+		t.Errorf("expected checkpoint 2 got %d", cp)
+	}
+	caughtUp, err = a.step(ctx, 0)
+	if err != nil || !caughtUp {
+		t.Fatalf("expected to catch up got %v %v", caughtUp, err)
+	}
+	if len(secondary.replicated) != 3 {
+		t.Errorf("expected 3 entries replicated got %d", len(secondary.replicated))
+	}
+
+	reloaded, err := loadCheckpoint(a.checkpoint.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp := reloaded.get(0); cp != 3 {
+		t.Errorf("expected the checkpoint to be saved got %d", cp)
+	}
+
+	secondary.err = status.Error(codes.Unknown, storage.ErrNotReplica.Error())
+	primary.log = logEntries(4)
+	if _, err := a.step(ctx, 0); !errors.Is(err, ErrPromoted) {
+		t.Errorf("expected promotion to stop replication got %v", err)
+	}
+	if cp := a.checkpoint.get(0); cp != 3 {
+		t.Errorf("expected the checkpoint to stay at 3 got %d", cp)
+	}
+}
+
+func TestAgentResync(t *testing.T) {
+	owners := make([]uint32, chickaree.SlotCount)
+	owners[1] = 1
+	primary := &fakeAdmin{log: logEntries(5), first: 4, owners: owners, keys: map[uint32][]*chickaree.KeyDump{
+		0: {{Key: "a", Exists: true, Value: []byte("1")}},
+		1: {{Key: "other", Exists: true}},
+	}}
+	secondary := &fakeAdmin{owners: owners, keys: map[uint32][]*chickaree.KeyDump{
+		0: {{Key: "a", Exists: true}, {Key: "stale", Exists: true}},
+	}}
+	a := testAgent(t, primary, secondary)
+	if _, err := a.step(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if cp := a.checkpoint.get(0); cp != 5 {
+		t.Errorf("expected to resume from the applied index got %d", cp)
+	}
+	var restored []*chickaree.KeyDump
+	for _, entry := range secondary.replicated {
+		if storage.RequestType(entry.Data[0]) != storage.RestoreKeysRequestType {
+			t.Fatalf("expected restore commands got %d", entry.Data[0])
+		}
+		var req chickaree.RestoreKeysRequest
+		if err := proto.Unmarshal(entry.Data[1:], &req); err != nil {
+			t.Fatal(err)
+		}
+		restored = append(restored, req.Entries...)
+	}
+	if len(restored) != 2 {
+		t.Fatalf("expected a restore and a delete got %v", restored)
+	}
+	if restored[0].Key != "a" || !bytes.Equal(restored[0].Value, []byte("1")) {
+		t.Errorf("unexpected restore %v", restored[0])
+	}
+	if restored[1].Key != "stale" || restored[1].Exists {
+		t.Errorf("expected stale key to be deleted got %v", restored[1])
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	a := &Agent{groups: map[uint32]*groupStatus{
+		1: {checkpoint: 5, applied: 9, appendedAt: 1000},
+		0: {checkpoint: 3, applied: 3, caughtUp: true, resyncs: 1},
+	}}
+	var b bytes.Buffer
+	a.writeMetrics(&b, time.Unix(3, 0))
+	out := b.String()
+	for _, line := range []string{
+		`chickaree_replication_lag_entries{group="0"} 0`,
+		`chickaree_replication_lag_entries{group="1"} 4`,
+		`chickaree_replication_lag_seconds{group="0"} 0`,
+		`chickaree_replication_lag_seconds{group="1"} 2`,
+		`chickaree_replication_resyncs_total{group="0"} 1`,
+		`# TYPE chickaree_replication_resyncs_total counter`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected %s in\n%s", line, out)
+		}
+	}
+}
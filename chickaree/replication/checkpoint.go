@@ -0,0 +1,69 @@
+package replication
+
+import (
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// checkpoint is the last index replicated from each group of the primary,
+// it is saved after every batch so a restarted agent resumes where it
+// stopped.
+type checkpoint struct {
+	mu      sync.Mutex
+	path    string
+	indexes map[uint32]uint64
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	c := &checkpoint{path: path, indexes: make(map[uint32]uint64)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		log.Error().Err(err).Str("path", path).Msg("unable to read checkpoint")
+		return nil, errors.New("unable to load checkpoint")
+	}
+	var saved chickaree.ReplicationCheckpoint
+	if err := proto.Unmarshal(b, &saved); err != nil {
+		log.Error().Err(err).Str("path", path).Msg("unable to parse checkpoint")
+		return nil, errors.New("unable to load checkpoint")
+	}
+	for group, index := range saved.Indexes {
+		c.indexes[group] = index
+	}
+	return c, nil
+}
+
+func (c *checkpoint) get(group uint32) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.indexes[group]
+}
+
+// set records the index and writes the checkpoint, the file is replaced
+// so a crash leaves either the old or new checkpoint.
+func (c *checkpoint) set(group uint32, index uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.indexes[group] = index
+	b, err := proto.Marshal(&chickaree.ReplicationCheckpoint{Indexes: c.indexes})
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		log.Error().Err(err).Str("path", tmp).Msg("unable to write checkpoint")
+		return errors.New("unable to save checkpoint")
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		log.Error().Err(err).Str("path", c.path).Msg("unable to replace checkpoint")
+		return errors.New("unable to save checkpoint")
+	}
+	return nil
+}
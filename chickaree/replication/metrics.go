@@ -0,0 +1,65 @@
+package replication
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ServeHTTP writes the replication lag of each group in the prometheus text
+// format.
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	a.writeMetrics(w, time.Now())
+}
+
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(*groupStatus) float64
+}
+
+func (a *Agent) writeMetrics(w io.Writer, now time.Time) {
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	metrics := []metric{
+		{"chickaree_replication_checkpoint_index", "gauge", "Last primary index replicated.", func(s *groupStatus) float64 {
+			return float64(s.checkpoint)
+		}},
+		{"chickaree_replication_primary_applied_index", "gauge", "Last index applied by the primary.", func(s *groupStatus) float64 {
+			return float64(s.applied)
+		}},
+		{"chickaree_replication_lag_entries", "gauge", "Primary log entries not yet replicated.", func(s *groupStatus) float64 {
+			if s.applied <= s.checkpoint {
+				return 0
+			}
+			return float64(s.applied - s.checkpoint)
+		}},
+		{"chickaree_replication_lag_seconds", "gauge", "Age of the last replicated write, zero once caught up.", func(s *groupStatus) float64 {
+			if s.caughtUp || s.appendedAt == 0 {
+				return 0
+			}
+			return float64(nowMs-s.appendedAt) / 1000
+		}},
+		{"chickaree_replication_resyncs_total", "counter", "Times the group was copied after the primary compacted its log.", func(s *groupStatus) float64 {
+			return float64(s.resyncs)
+		}},
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	groups := make([]uint32, 0, len(a.groups))
+	for group := range a.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+		for _, group := range groups {
+			fmt.Fprintf(w, "%s{group=\"%d\"} %g\n", m.name, group, m.value(a.groups[group]))
+		}
+	}
+}
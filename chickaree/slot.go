@@ -0,0 +1,38 @@
+package chickaree
+
+import "strings"
+
+// SlotCount is the number of hash slots keys are spread across, the same as
+// redis cluster so clients compute identical slots.
+const SlotCount = 16384
+
+// AskingKey is the metadata key set on requests sent after an ASK redirect.
+const AskingKey = "chickaree-asking"
+
+// KeySlot returns the hash slot of a key. When the key contains a non empty
+// hash tag such as {user1000} only the tag is hashed so related keys can be
+// kept in the same slot.
+func KeySlot(key string) uint16 {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return crc16(key) % SlotCount
+}
+
+// crc16 is the XMODEM variant used by redis cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
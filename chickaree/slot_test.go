@@ -0,0 +1,22 @@
+package chickaree
+
+import "testing"
+
+func TestKeySlot(t *testing.T) {
+	tests := map[string]uint16{
+		"":                     0,
+		"foo":                  12182,
+		"bar":                  5061,
+		"123456789":            12739,
+		"{user1000}.following": KeySlot("user1000"),
+		"{user1000}.followers": KeySlot("user1000"),
+		"foo{}{bar}":           KeySlot("foo{}{bar}"),
+		"foo{{bar}}zap":        KeySlot("{bar"),
+		"foo{bar}{zap}":        KeySlot("bar"),
+	}
+	for key, expected := range tests {
+		if slot := KeySlot(key); slot != expected {
+			t.Errorf("%q should be in slot %d not %d", key, expected, slot)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/acl"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// ACL users are replicated through group 0 like the slot assignment and
+// saved beside its raft data. The index of the last entry applied is saved
+// with them so entries replayed on restart are not applied twice.
+
+const aclFile = "acl.dat"
+
+var ErrDefaultUser = errors.New("The 'default' user cannot be removed")
+
+type aclMap struct {
+	mu     sync.RWMutex
+	path   string
+	config *api.ACLConfig
+}
+
+func newACLMap(path string) (*aclMap, error) {
+	m := &aclMap{path: path, config: &api.ACLConfig{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		log.Error().Err(err).Str("path", path).Msg("unable to read acl")
+		return nil, errors.New("unable to load acl")
+	}
+	if err := proto.Unmarshal(b, m.config); err != nil {
+		log.Error().Err(err).Str("path", path).Msg("unable to parse acl")
+		return nil, errors.New("unable to load acl")
+	}
+	return m, nil
+}
+
+// Users returns a copy of every user sorted by name.
+func (m *aclMap) Users() []*api.ACLUser {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	users := make([]*api.ACLUser, len(m.config.Users))
+	for i, user := range m.config.Users {
+		users[i] = proto.Clone(user).(*api.ACLUser)
+	}
+	return users
+}
+
+func (m *aclMap) find(name string) int {
+	for i, user := range m.config.Users {
+		if user.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// applied reports whether the entry at index was applied before a restart,
+// entries restored from a snapshot have no index and are always applied.
+func (m *aclMap) applied(index uint64) bool {
+	return index != 0 && index <= m.config.Index
+}
+
+func (m *aclMap) setUser(index uint64, req *api.SetUserRequest) (*api.ACLUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.find(req.Name)
+	if m.applied(index) {
+		if i < 0 {
+			// deleted by a later entry
+			return acl.NewUser(req.Name), nil
+		}
+		return proto.Clone(m.config.Users[i]).(*api.ACLUser), nil
+	}
+	user := acl.NewUser(req.Name)
+	if i >= 0 {
+		user = proto.Clone(m.config.Users[i]).(*api.ACLUser)
+	}
+	if err := acl.SetUser(user, req.Rules); err != nil {
+		return nil, err
+	}
+	config := proto.Clone(m.config).(*api.ACLConfig)
+	if i >= 0 {
+		config.Users[i] = user
+	} else {
+		config.Users = append(config.Users, user)
+		sort.Slice(config.Users, func(i, j int) bool { return config.Users[i].Name < config.Users[j].Name })
+	}
+	if err := m.save(index, config); err != nil {
+		return nil, err
+	}
+	return proto.Clone(user).(*api.ACLUser), nil
+}
+
+func (m *aclMap) deleteUsers(index uint64, names []string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range names {
+		if name == acl.DefaultUser {
+			return 0, ErrDefaultUser
+		}
+	}
+	if m.applied(index) {
+		return 0, nil
+	}
+	config := proto.Clone(m.config).(*api.ACLConfig)
+	var count int64
+	for _, name := range names {
+		for i, user := range config.Users {
+			if user.Name == name {
+				config.Users = append(config.Users[:i], config.Users[i+1:]...)
+				count++
+				break
+			}
+		}
+	}
+	if err := m.save(index, config); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (m *aclMap) save(index uint64, config *api.ACLConfig) error {
+	if index > config.Index {
+		config.Index = index
+	}
+	b, err := proto.Marshal(config)
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		log.Error().Err(err).Str("path", tmp).Msg("unable to write acl")
+		return errors.New("unable to save acl")
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		log.Error().Err(err).Str("path", m.path).Msg("unable to replace acl")
+		return errors.New("unable to save acl")
+	}
+	m.config = config
+	return nil
+}
+
+// SetUser replicates ACL SETUSER, only group 0 keeps users.
+func (s *DistributedStorage) SetUser(req *api.SetUserRequest) (*api.SetUserResponse, error) {
+	res, err := s.apply(SetUserRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.SetUserResponse), nil
+}
+
+func (s *DistributedStorage) DeleteUsers(req *api.DeleteUsersRequest) (*api.DeleteUsersResponse, error) {
+	res, err := s.apply(DeleteUsersRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.DeleteUsersResponse), nil
+}
+
+func (s *fsm) applySetUser(index uint64, b []byte) interface{} {
+	var req api.SetUserRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	if s.acls == nil {
+		return errors.New("acl users are kept by group 0")
+	}
+	user, err := s.acls.setUser(index, &req)
+	if err != nil {
+		return err
+	}
+	return &api.SetUserResponse{User: user}
+}
+
+func (s *fsm) applyDeleteUsers(index uint64, b []byte) interface{} {
+	var req api.DeleteUsersRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	if s.acls == nil {
+		return errors.New("acl users are kept by group 0")
+	}
+	count, err := s.acls.deleteUsers(index, req.Names)
+	if err != nil {
+		return err
+	}
+	return &api.DeleteUsersResponse{Count: count}
+}
+
+// SetUser is forwarded to the leader of group 0 by ForwardWrites.
+func (s *Server) SetUser(ctx context.Context, req *api.SetUserRequest) (*api.SetUserResponse, error) {
+	if req.Name == "" {
+		return nil, errors.New("user name is required")
+	}
+	return s.groups[0].store.SetUser(req)
+}
+
+func (s *Server) DeleteUsers(ctx context.Context, req *api.DeleteUsersRequest) (*api.DeleteUsersResponse, error) {
+	return s.groups[0].store.DeleteUsers(req)
+}
+
+// GetUsers is answered from this node's copy of the users.
+func (s *Server) GetUsers(ctx context.Context, req *api.GetUsersRequest) (*api.GetUsersResponse, error) {
+	return &api.GetUsersResponse{Users: s.acls.Users()}, nil
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+)
+
+func TestACLMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), aclFile)
+	m, err := newACLMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := m.setUser(1, &api.SetUserRequest{Name: "alice", Rules: []string{"on", "+get"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.Enabled || len(user.Commands) != 1 {
+		t.Errorf("unexpected user %v", user)
+	}
+	if _, err := m.setUser(2, &api.SetUserRequest{Name: "bob", Rules: []string{"on"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.deleteUsers(3, []string{"default"}); !errors.Is(err, ErrDefaultUser) {
+		t.Errorf("expected default user to be kept got %v", err)
+	}
+	count, err := m.deleteUsers(3, []string{"bob", "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected one user to be deleted got %d", count)
+	}
+
+	// entries replayed after a restart are not applied again
+	reloaded, err := newACLMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.setUser(1, &api.SetUserRequest{Name: "alice", Rules: []string{"+set"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.setUser(2, &api.SetUserRequest{Name: "bob", Rules: []string{"on"}}); err != nil {
+		t.Fatal(err)
+	}
+	users := reloaded.Users()
+	if len(users) != 1 || users[0].Name != "alice" || len(users[0].Commands) != 1 {
+		t.Errorf("unexpected users after replay %v", users)
+	}
+}
@@ -0,0 +1,487 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
+	"github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/discovery"
+	"github.com/rs/zerolog/log"
+)
+
+// Membership changes can only be made by the leader so admin requests made
+// to a follower are forwarded to the leader.
+
+const membershipTimeout = 10 * time.Second
+
+func (s *DistributedStorage) AddVoter(id, addr string, prevIndex uint64) (uint64, error) {
+	f := s.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(addr), prevIndex, membershipTimeout)
+	if err := f.Error(); err != nil {
+		log.Error().Err(err).Str("id", id).Str("addr", addr).Msg("unable to add voter")
+		return 0, err
+	}
+	log.Info().Str("id", id).Str("addr", addr).Msg("added voter")
+	return f.Index(), nil
+}
+
+func (s *DistributedStorage) AddNonvoter(id, addr string, prevIndex uint64) (uint64, error) {
+	f := s.raft.AddNonvoter(raft.ServerID(id), raft.ServerAddress(addr), prevIndex, membershipTimeout)
+	if err := f.Error(); err != nil {
+		log.Error().Err(err).Str("id", id).Str("addr", addr).Msg("unable to add nonvoter")
+		return 0, err
+	}
+	log.Info().Str("id", id).Str("addr", addr).Msg("added nonvoter")
+	return f.Index(), nil
+}
+
+func (s *DistributedStorage) RemoveServer(id string, prevIndex uint64) (uint64, error) {
+	f := s.raft.RemoveServer(raft.ServerID(id), prevIndex, membershipTimeout)
+	if err := f.Error(); err != nil {
+		log.Error().Err(err).Str("id", id).Msg("unable to remove server")
+		return 0, err
+	}
+	log.Info().Str("id", id).Msg("removed server")
+	return f.Index(), nil
+}
+
+func (s *DistributedStorage) DemoteVoter(id string, prevIndex uint64) (uint64, error) {
+	f := s.raft.DemoteVoter(raft.ServerID(id), prevIndex, membershipTimeout)
+	if err := f.Error(); err != nil {
+		log.Error().Err(err).Str("id", id).Msg("unable to demote voter")
+		return 0, err
+	}
+	log.Info().Str("id", id).Msg("demoted voter")
+	return f.Index(), nil
+}
+
+// TransferLeadership hands leadership to the server, or to the most up to
+// date voter when id is empty.
+func (s *DistributedStorage) TransferLeadership(id, addr string) error {
+	var f raft.Future
+	if id == "" {
+		f = s.raft.LeadershipTransfer()
+	} else {
+		f = s.raft.LeadershipTransferToServer(raft.ServerID(id), raft.ServerAddress(addr))
+	}
+	if err := f.Error(); err != nil {
+		log.Error().Err(err).Str("id", id).Msg("unable to transfer leadership")
+		return err
+	}
+	log.Info().Str("id", id).Str("leader", string(s.raft.Leader())).Msg("transferred leadership")
+	return nil
+}
+
+func (s *DistributedStorage) Configuration() (raft.Configuration, uint64, error) {
+	f := s.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		log.Error().Err(err).Msg("unable to get configuration")
+		return raft.Configuration{}, 0, err
+	}
+	return f.Configuration(), f.Index(), nil
+}
+
+// Leader returns the raft address of the current leader, empty if unknown.
+func (s *DistributedStorage) Leader() string {
+	return string(s.raft.Leader())
+}
+
+// LeaderCh receives true when this node becomes leader and false when it
+// steps down. Only one caller should consume it.
+func (s *DistributedStorage) LeaderCh() <-chan bool {
+	return s.raft.LeaderCh()
+}
+
+type adminServer struct {
+	chickaree.UnimplementedAdminServer
+	server *Server
+}
+
+// Admin returns the admin service, requests pick the raft group they are
+// for.
+func (s *Server) Admin() chickaree.AdminServer {
+	return &adminServer{server: s}
+}
+
+// forward calls fn with a client connected to the group's leader. It returns
+// false if this node is the leader and the request should be handled locally.
+func (a *adminServer) forward(ctx context.Context, store *DistributedStorage, fn func(context.Context, chickaree.AdminClient) error) (bool, error) {
+	conn, ctx, err := a.server.leader(ctx, store)
+	if err != nil {
+		return true, err
+	}
+	if conn == nil {
+		return false, nil
+	}
+	return true, fn(ctx, chickaree.NewAdminClient(conn))
+}
+
+func (a *adminServer) AddVoter(ctx context.Context, req *chickaree.AddVoterRequest) (resp *chickaree.AddVoterResponse, err error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.AddVoter(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	index, err := g.store.AddVoter(req.Id, req.Address, req.PrevIndex)
+	if err != nil {
+		return nil, err
+	}
+	return &chickaree.AddVoterResponse{Index: index}, nil
+}
+
+func (a *adminServer) AddNonvoter(ctx context.Context, req *chickaree.AddNonvoterRequest) (resp *chickaree.AddNonvoterResponse, err error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.AddNonvoter(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	index, err := g.store.AddNonvoter(req.Id, req.Address, req.PrevIndex)
+	if err != nil {
+		return nil, err
+	}
+	return &chickaree.AddNonvoterResponse{Index: index}, nil
+}
+
+func (a *adminServer) RemoveServer(ctx context.Context, req *chickaree.RemoveServerRequest) (resp *chickaree.RemoveServerResponse, err error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.RemoveServer(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	index, err := g.store.RemoveServer(req.Id, req.PrevIndex)
+	if err != nil {
+		return nil, err
+	}
+	return &chickaree.RemoveServerResponse{Index: index}, nil
+}
+
+func (a *adminServer) DemoteVoter(ctx context.Context, req *chickaree.DemoteVoterRequest) (resp *chickaree.DemoteVoterResponse, err error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.DemoteVoter(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	index, err := g.store.DemoteVoter(req.Id, req.PrevIndex)
+	if err != nil {
+		return nil, err
+	}
+	return &chickaree.DemoteVoterResponse{Index: index}, nil
+}
+
+func (a *adminServer) TransferLeadership(ctx context.Context, req *chickaree.TransferLeadershipRequest) (resp *chickaree.TransferLeadershipResponse, err error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.TransferLeadership(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	if err := g.store.TransferLeadership(req.Id, req.Address); err != nil {
+		return nil, err
+	}
+	return &chickaree.TransferLeadershipResponse{}, nil
+}
+
+// GetConfiguration is answered by the leader when there is one, otherwise
+// the local view is returned so a cluster without quorum can be inspected.
+func (a *adminServer) GetConfiguration(ctx context.Context, req *chickaree.GetConfigurationRequest) (resp *chickaree.GetConfigurationResponse, err error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if g.store.Leader() != "" {
+		if forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+			resp, err = c.GetConfiguration(ctx, req)
+			return err
+		}); forwarded {
+			return resp, err
+		}
+	}
+	config, index, err := g.store.Configuration()
+	if err != nil {
+		return nil, errors.New("unable to get configuration")
+	}
+	return configurationResponse(config, index, g.store.Leader()), nil
+}
+
+// ServerStats is never forwarded, autopilot uses it to check each server.
+func (a *adminServer) ServerStats(ctx context.Context, req *chickaree.ServerStatsRequest) (*chickaree.ServerStatsResponse, error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	return g.store.Stats(), nil
+}
+
+func (a *adminServer) AutopilotHealth(ctx context.Context, req *chickaree.AutopilotHealthRequest) (resp *chickaree.AutopilotHealthResponse, err error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.AutopilotHealth(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	return g.autopilot.Health()
+}
+
+func (a *adminServer) DumpSlot(ctx context.Context, req *chickaree.DumpSlotRequest) (resp *chickaree.DumpSlotResponse, err error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.DumpSlot(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	return g.store.DumpSlot(req)
+}
+
+func (a *adminServer) RestoreKeys(ctx context.Context, req *chickaree.RestoreKeysRequest) (resp *chickaree.RestoreKeysResponse, err error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.RestoreKeys(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	if err := g.store.RestoreKeys(req.Entries); err != nil {
+		return nil, err
+	}
+	return &chickaree.RestoreKeysResponse{}, nil
+}
+
+func (a *adminServer) SetSlotState(ctx context.Context, req *chickaree.SlotStateRequest) (resp *chickaree.SlotStateResponse, err error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.SetSlotState(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	if err := g.store.SetSlotState(req); err != nil {
+		return nil, err
+	}
+	return &chickaree.SlotStateResponse{}, nil
+}
+
+// GetSlots is answered from this node's copy of the slot assignment.
+func (a *adminServer) GetSlots(ctx context.Context, req *chickaree.GetSlotsRequest) (*chickaree.SlotConfig, error) {
+	return a.server.slots.Config(), nil
+}
+
+// MigrateSlots queues slots to move to the target group, slots already
+// moving or owned by the target are skipped.
+func (a *adminServer) MigrateSlots(ctx context.Context, req *chickaree.MigrateSlotsRequest) (resp *chickaree.MigrateSlotsResponse, err error) {
+	if err := validMigrations(req, len(a.server.groups)); err != nil {
+		return nil, err
+	}
+	if forwarded, err := a.forward(ctx, a.server.groups[0].store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.MigrateSlots(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	resp = &chickaree.MigrateSlotsResponse{}
+	if _, err := a.server.updateSlots(func(config *chickaree.SlotConfig) error {
+		migrations := make([]*chickaree.SlotMigration, 0, len(req.Slots))
+		for _, slot := range req.Slots {
+			migrations = append(migrations, &chickaree.SlotMigration{Slot: slot, Target: req.Target})
+		}
+		resp.Migrations = queueMigrations(config, migrations)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Rebalance queues migrations evening out the slots owned by each group.
+func (a *adminServer) Rebalance(ctx context.Context, req *chickaree.RebalanceRequest) (resp *chickaree.RebalanceResponse, err error) {
+	if forwarded, err := a.forward(ctx, a.server.groups[0].store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.Rebalance(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	resp = &chickaree.RebalanceResponse{}
+	if req.DryRun {
+		resp.Migrations = planRebalance(a.server.slots.Config(), len(a.server.groups))
+		return resp, nil
+	}
+	if _, err := a.server.updateSlots(func(config *chickaree.SlotConfig) error {
+		resp.Migrations = queueMigrations(config, planRebalance(config, len(a.server.groups)))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (a *adminServer) ReadLog(ctx context.Context, req *chickaree.ReadLogRequest) (resp *chickaree.ReadLogResponse, err error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.ReadLog(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	return g.store.ReadLog(req)
+}
+
+// Replicate applies the entries of each group through its leader, in the
+// order they were read.
+func (a *adminServer) Replicate(ctx context.Context, req *chickaree.ReplicateRequest) (*chickaree.ReplicateResponse, error) {
+	batches := make([][]*chickaree.LogEntry, len(a.server.groups))
+	for _, entry := range req.Entries {
+		g, err := a.server.entryGroup(entry)
+		if err != nil {
+			return nil, err
+		}
+		batches[g.id] = append(batches[g.id], entry)
+	}
+	for id, entries := range batches {
+		if len(entries) == 0 {
+			continue
+		}
+		g := a.server.groups[id]
+		forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+			_, err := c.Replicate(ctx, &chickaree.ReplicateRequest{Entries: entries})
+			return err
+		})
+		if !forwarded {
+			err = g.store.Replicate(entries)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &chickaree.ReplicateResponse{}, nil
+}
+
+func (a *adminServer) SetReadOnly(ctx context.Context, req *chickaree.ReadOnlyRequest) (resp *chickaree.ReadOnlyResponse, err error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if forwarded, err := a.forward(ctx, g.store, func(ctx context.Context, c chickaree.AdminClient) error {
+		resp, err = c.SetReadOnly(ctx, req)
+		return err
+	}); forwarded {
+		return resp, err
+	}
+	if err := g.store.SetReadOnly(req.ReadOnly); err != nil {
+		return nil, err
+	}
+	log.Info().Uint32("group", req.Group).Bool("read-only", req.ReadOnly).Msg("changed replica mode")
+	return &chickaree.ReadOnlyResponse{ReadOnly: req.ReadOnly}, nil
+}
+
+// GetReadOnly is answered from this node's copy of the group.
+func (a *adminServer) GetReadOnly(ctx context.Context, req *chickaree.GetReadOnlyRequest) (*chickaree.ReadOnlyResponse, error) {
+	g, err := a.server.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	return &chickaree.ReadOnlyResponse{ReadOnly: g.store.ReadOnly()}, nil
+}
+
+// The keyring calls are answered by any node, serf sends them to every
+// member and waits for the answers.
+
+func (a *adminServer) ListKeys(ctx context.Context, req *chickaree.KeyringRequest) (*chickaree.KeyringResponse, error) {
+	return keyringResponse(a.server.membership.ListKeys())
+}
+
+func (a *adminServer) InstallKey(ctx context.Context, req *chickaree.KeyringRequest) (*chickaree.KeyringResponse, error) {
+	if _, err := discovery.DecodeKey(req.Key); err != nil {
+		return nil, err
+	}
+	log.Info().Msg("installing gossip key")
+	return keyringResponse(a.server.membership.InstallKey(req.Key))
+}
+
+func (a *adminServer) UseKey(ctx context.Context, req *chickaree.KeyringRequest) (*chickaree.KeyringResponse, error) {
+	log.Info().Msg("changing primary gossip key")
+	return keyringResponse(a.server.membership.UseKey(req.Key))
+}
+
+func (a *adminServer) RemoveKey(ctx context.Context, req *chickaree.KeyringRequest) (*chickaree.KeyringResponse, error) {
+	log.Info().Msg("removing gossip key")
+	return keyringResponse(a.server.membership.RemoveKey(req.Key))
+}
+
+// keyringResponse keeps the answers when some members failed so the
+// caller can see which ones.
+func keyringResponse(resp *serf.KeyResponse, err error) (*chickaree.KeyringResponse, error) {
+	if err != nil && (resp == nil || resp.NumErr == 0) {
+		log.Error().Err(err).Msg("unable to query keyring")
+		return nil, err
+	}
+	res := &chickaree.KeyringResponse{
+		Keys:        make(map[string]int32, len(resp.Keys)),
+		PrimaryKeys: make(map[string]int32, len(resp.PrimaryKeys)),
+		NumNodes:    int32(resp.NumNodes),
+		NumResp:     int32(resp.NumResp),
+		NumErr:      int32(resp.NumErr),
+		Messages:    resp.Messages,
+	}
+	for key, n := range resp.Keys {
+		res.Keys[key] = int32(n)
+	}
+	for key, n := range resp.PrimaryKeys {
+		res.PrimaryKeys[key] = int32(n)
+	}
+	return res, nil
+}
+
+func configurationResponse(config raft.Configuration, index uint64, leader string) *chickaree.GetConfigurationResponse {
+	resp := &chickaree.GetConfigurationResponse{Index: index}
+	for _, srv := range config.Servers {
+		resp.Servers = append(resp.Servers, &chickaree.RaftServer{
+			Id:       string(srv.ID),
+			Address:  string(srv.Address),
+			Suffrage: srv.Suffrage.String(),
+			IsLeader: string(srv.Address) == leader,
+		})
+	}
+	return resp
+}
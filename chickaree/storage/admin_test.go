@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestConfigurationResponse(t *testing.T) {
+	config := raft.Configuration{Servers: []raft.Server{
+		{ID: "a", Address: "10.0.0.1:8400", Suffrage: raft.Voter},
+		{ID: "b", Address: "10.0.0.2:8400", Suffrage: raft.Nonvoter},
+	}}
+	resp := configurationResponse(config, 7, "10.0.0.1:8400")
+	if resp.Index != 7 || len(resp.Servers) != 2 {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if !resp.Servers[0].IsLeader || resp.Servers[0].Suffrage != "Voter" {
+		t.Errorf("expected a to be the voting leader %+v", resp.Servers[0])
+	}
+	if resp.Servers[1].IsLeader || resp.Servers[1].Suffrage != "Nonvoter" {
+		t.Errorf("expected b to be a nonvoter follower %+v", resp.Servers[1])
+	}
+}
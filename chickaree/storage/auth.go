@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/acl"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Callers are principals identified by a bearer token or the common name of
+// their client certificate. Each has a role allowing reads, writes or admin
+// requests, nodes may also do anything and forward requests for others
+// with the original principal in the metadata so the leader authorizes and
+// records the caller rather than the forwarding node. Only nodes and
+// proxies, such as the redis server, may name the redis user a request is
+// made for, anyone else is recorded by principal alone.
+
+const principalKey = "chickaree-principal"
+
+const (
+	RoleRead  = "read"
+	RoleWrite = "write"
+	RoleAdmin = "admin"
+	RoleNode  = "node"
+)
+
+var roleLevels = map[string]int{
+	RoleRead:  1,
+	RoleWrite: 2,
+	RoleAdmin: 3,
+	RoleNode:  4,
+}
+
+var (
+	ErrUnauthenticated  = status.Error(codes.Unauthenticated, "unauthenticated")
+	ErrPermissionDenied = status.Error(codes.PermissionDenied, "permission denied")
+)
+
+// adminMethods are the ChickareeDB rpcs needing the admin role, every Admin
+// rpc does too.
+var adminMethods = map[string]bool{
+	"/client.v1.ChickareeDB/SetUser":     true,
+	"/client.v1.ChickareeDB/DeleteUsers": true,
+	"/client.v1.ChickareeDB/GetUsers":    true,
+}
+
+type Principal struct {
+	Name string `yaml:"name"`
+	// Token authenticates the principal, without one Name is matched
+	// against the client certificate's common name and may be a glob.
+	Token string `yaml:"token"`
+	Role  string `yaml:"role"`
+	// Proxy is trusted to name the redis user of its requests.
+	Proxy bool `yaml:"proxy"`
+}
+
+type AuthConfig struct {
+	// Principals may call the api, every caller is allowed when empty.
+	Principals []Principal `yaml:"principals"`
+	// Token is sent by this node to the others, it must belong to a
+	// principal with the node role unless the node certificate does.
+	Token string `yaml:"token"`
+}
+
+func (c AuthConfig) Enabled() bool {
+	return len(c.Principals) > 0
+}
+
+func (c AuthConfig) Validate() error {
+	names := make(map[string]bool)
+	for _, p := range c.Principals {
+		if p.Name == "" {
+			return errors.New("principal name is required")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate principal %s", p.Name)
+		}
+		names[p.Name] = true
+		if _, ok := roleLevels[p.Role]; !ok {
+			return fmt.Errorf("invalid role %s for principal %s", p.Role, p.Name)
+		}
+	}
+	return nil
+}
+
+// parsePrincipals reads a comma separated list of name:role or
+// name:role:token.
+func parsePrincipals(val string) []Principal {
+	var principals []Principal
+	for _, entry := range strings.Split(val, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		p := Principal{Name: parts[0]}
+		if len(parts) > 1 {
+			p.Role = parts[1]
+		}
+		if len(parts) > 2 {
+			p.Token = parts[2]
+		}
+		principals = append(principals, p)
+	}
+	return principals
+}
+
+// methodRole returns the role needed to call a method with req, req is nil
+// for streams.
+func methodRole(method string, req interface{}) string {
+	switch {
+	case strings.HasPrefix(method, "/client.v1.Admin/"), adminMethods[method]:
+		return RoleAdmin
+	case isWrite(method, req):
+		return RoleWrite
+	default:
+		return RoleRead
+	}
+}
+
+// caller is the authenticated principal of a request and the redis user it
+// was made for.
+type caller struct {
+	principal *Principal
+	user      string
+}
+
+type callerKey struct{}
+
+func callerFrom(ctx context.Context) (caller, bool) {
+	c, ok := ctx.Value(callerKey{}).(caller)
+	return c, ok
+}
+
+// principal finds the caller by token or client certificate.
+func (c AuthConfig) principal(ctx context.Context) *Principal {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, val := range md.Get("authorization") {
+		token := strings.TrimPrefix(val, "Bearer ")
+		for i := range c.Principals {
+			p := &c.Principals[i]
+			if p.Token != "" && subtle.ConstantTimeCompare([]byte(p.Token), []byte(token)) == 1 {
+				return p
+			}
+		}
+		return nil
+	}
+	pr, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := pr.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 {
+		return nil
+	}
+	name := info.State.VerifiedChains[0][0].Subject.CommonName
+	for i := range c.Principals {
+		p := &c.Principals[i]
+		if p.Token == "" && acl.Match(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (c AuthConfig) find(name string) *Principal {
+	for i := range c.Principals {
+		if c.Principals[i].Name == name {
+			return &c.Principals[i]
+		}
+	}
+	return nil
+}
+
+// authenticate checks the caller may call method and returns a context
+// holding it.
+func (s *Server) authenticate(ctx context.Context, method string, req interface{}) (context.Context, error) {
+	auth := s.ServerConfig.Auth
+	if !auth.Enabled() {
+		return ctx, nil
+	}
+	p := auth.principal(ctx)
+	if p == nil {
+		log.Warn().Str("method", method).Msg("unauthenticated request")
+		return nil, ErrUnauthenticated
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	// nodes only forward users the first node they reached accepted
+	trusted := p.Role == RoleNode || p.Proxy
+	if names := md.Get(principalKey); len(names) > 0 && p.Role == RoleNode {
+		if p = auth.find(names[0]); p == nil {
+			log.Warn().Str("method", method).Str("principal", names[0]).Msg("unknown forwarded principal")
+			return nil, ErrUnauthenticated
+		}
+	}
+	c := caller{principal: p}
+	if users := md.Get(api.UserKey); len(users) > 0 {
+		if trusted {
+			c.user = users[0]
+		} else {
+			log.Warn().Str("method", method).Str("principal", p.Name).Str("user", users[0]).Msg("ignoring user from untrusted principal")
+		}
+	}
+	role := methodRole(method, req)
+	if roleLevels[p.Role] < roleLevels[role] {
+		log.Warn().Str("method", method).Str("principal", p.Name).Str("user", c.user).Msg("permission denied")
+		return nil, ErrPermissionDenied
+	}
+	event := log.Debug()
+	if role != RoleRead {
+		event = log.Info()
+	}
+	event.Str("method", method).Str("principal", p.Name).Str("user", c.user).Msg("authorized request")
+	return context.WithValue(ctx, callerKey{}, c), nil
+}
+
+// forwardCaller adds the caller to a request forwarded to another node.
+func forwardCaller(ctx context.Context) context.Context {
+	c, ok := callerFrom(ctx)
+	if !ok {
+		return ctx
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, principalKey, c.principal.Name)
+	if c.user != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, api.UserKey, c.user)
+	}
+	return ctx
+}
+
+// Authenticate is a unary interceptor checking the caller's role, it must
+// run before ForwardWrites.
+func (s *Server) Authenticate(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod, req)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// AuthenticateStream is Authenticate for streaming rpcs.
+func (s *Server) AuthenticateStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod, nil)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+}
+
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
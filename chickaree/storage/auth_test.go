@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func authServer() *Server {
+	principals := parsePrincipals("reader:read:r-token, proxy:admin:p-token, node-*:node, peer:node:n-token")
+	principals[1].Proxy = true
+	return &Server{ServerConfig: ServerConfig{Auth: AuthConfig{Principals: principals}}}
+}
+
+func withToken(token string, kv ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(append([]string{"authorization", "Bearer " + token}, kv...)...))
+}
+
+func withCert(name string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+	info := credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: info})
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := authServer()
+	if err := s.ServerConfig.Auth.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		code   codes.Code
+		caller string
+	}{
+		{"no credentials", context.Background(), "/client.v1.ChickareeDB/Get", codes.Unauthenticated, ""},
+		{"wrong token", withToken("nope"), "/client.v1.ChickareeDB/Get", codes.Unauthenticated, ""},
+		{"read", withToken("r-token"), "/client.v1.ChickareeDB/Get", codes.OK, "reader"},
+		{"write as reader", withToken("r-token"), "/client.v1.ChickareeDB/Set", codes.PermissionDenied, ""},
+		{"users as reader", withToken("r-token"), "/client.v1.ChickareeDB/GetUsers", codes.PermissionDenied, ""},
+		{"admin", withToken("p-token"), "/client.v1.Admin/AddVoter", codes.OK, "proxy"},
+		{"certificate", withCert("node-1"), "/client.v1.Admin/AddVoter", codes.OK, "node-1"},
+		{"unknown certificate", withCert("other"), "/client.v1.ChickareeDB/Get", codes.Unauthenticated, ""},
+		{"forwarded", withToken("n-token", principalKey, "reader"), "/client.v1.ChickareeDB/Set", codes.PermissionDenied, ""},
+		{"forwarded read", withToken("n-token", principalKey, "reader"), "/client.v1.ChickareeDB/Get", codes.OK, "reader"},
+		{"forwarded by non node", withToken("r-token", principalKey, "proxy"), "/client.v1.ChickareeDB/Set", codes.PermissionDenied, ""},
+	}
+	for _, test := range tests {
+		ctx, err := s.authenticate(test.ctx, test.method, nil)
+		if code := status.Code(err); code != test.code {
+			t.Errorf("%s: expected %s got %s", test.name, test.code, code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		c, ok := callerFrom(ctx)
+		if !ok {
+			t.Errorf("%s: expected caller in context", test.name)
+			continue
+		}
+		// certificate principals are recorded by pattern
+		if c.principal.Name != test.caller && c.principal.Name != "node-*" {
+			t.Errorf("%s: expected caller %s got %s", test.name, test.caller, c.principal.Name)
+		}
+	}
+	bitfield := "/client.v1.ChickareeDB/BitField"
+	if _, err := s.authenticate(withToken("r-token"), bitfield, &api.BitFieldRequest{ReadOnly: true}); err != nil {
+		t.Errorf("expected a reader to call read only bitfield got %s", err)
+	}
+	if _, err := s.authenticate(withToken("r-token"), bitfield, &api.BitFieldRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected a reader to be denied bitfield writes got %s", err)
+	}
+}
+
+func TestForwardCaller(t *testing.T) {
+	s := authServer()
+	ctx, err := s.authenticate(withToken("p-token", api.UserKey, "alice"), "/client.v1.ChickareeDB/Set", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, _ := metadata.FromOutgoingContext(forwardCaller(ctx))
+	if got := md.Get(principalKey); len(got) != 1 || got[0] != "proxy" {
+		t.Errorf("expected principal to be forwarded got %v", got)
+	}
+	if got := md.Get(api.UserKey); len(got) != 1 || got[0] != "alice" {
+		t.Errorf("expected user to be forwarded got %v", got)
+	}
+}
+
+func TestCallerUser(t *testing.T) {
+	s := authServer()
+	for name, test := range map[string]struct {
+		ctx  context.Context
+		user string
+	}{
+		"proxy":     {withToken("p-token", api.UserKey, "alice"), "alice"},
+		"untrusted": {withToken("r-token", api.UserKey, "alice"), ""},
+		"forwarded": {withToken("n-token", principalKey, "proxy", api.UserKey, "alice"), "alice"},
+	} {
+		ctx, err := s.authenticate(test.ctx, "/client.v1.ChickareeDB/Get", nil)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if c, _ := callerFrom(ctx); c.user != test.user {
+			t.Errorf("%s: expected user %q got %q", name, test.user, c.user)
+		}
+	}
+}
+
+func TestAuthDisabled(t *testing.T) {
+	s := &Server{}
+	if _, err := s.authenticate(context.Background(), "/client.v1.Admin/AddVoter", nil); err != nil {
+		t.Errorf("expected every caller to be allowed got %s", err)
+	}
+}
+
+func TestValidateAuth(t *testing.T) {
+	if err := (AuthConfig{Principals: parsePrincipals("a:root")}).Validate(); err == nil {
+		t.Error("expected invalid role to be rejected")
+	}
+	if err := (AuthConfig{Principals: parsePrincipals("a:read,a:write")}).Validate(); err == nil {
+		t.Error("expected duplicate principal to be rejected")
+	}
+}
@@ -0,0 +1,380 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/discovery"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+)
+
+// Autopilot runs on the leader. New servers join as nonvoters and are only
+// promoted once they have kept up with the leader for the stabilization
+// time, which keeps a slow or flapping node from counting towards quorum.
+// Read replicas stay nonvoters. Servers that serf reports as failed, or no
+// longer knows about, are removed once the dead server timeout has passed.
+// Operators demoting a healthy server should expect it to be promoted
+// again.
+
+const (
+	autopilotInterval = 2 * time.Second
+	statsTimeout      = time.Second
+)
+
+var ErrAutopilotNotReady = errors.New("autopilot has no health information yet")
+
+type AutopilotConfig struct {
+	// CleanupDeadServers removes servers that have failed for longer than
+	// DeadServerTimeout.
+	CleanupDeadServers bool          `yaml:"cleanup-dead-servers"`
+	DeadServerTimeout  time.Duration `yaml:"dead-server-timeout"`
+	// LastContactThreshold is how long a server can go without hearing from
+	// the leader before it is unhealthy.
+	LastContactThreshold time.Duration `yaml:"last-contact-threshold"`
+	// MaxTrailingLogs is how far behind the leader a server can be and
+	// still be healthy.
+	MaxTrailingLogs uint64 `yaml:"max-trailing-logs"`
+	// ServerStabilizationTime is how long a nonvoter must be healthy before
+	// it is promoted.
+	ServerStabilizationTime time.Duration `yaml:"server-stabilization-time"`
+}
+
+func DefaultAutopilotConfig() AutopilotConfig {
+	return AutopilotConfig{
+		CleanupDeadServers:      true,
+		DeadServerTimeout:       5 * time.Minute,
+		LastContactThreshold:    200 * time.Millisecond,
+		MaxTrailingLogs:         250,
+		ServerStabilizationTime: 10 * time.Second,
+	}
+}
+
+type serverHealth struct {
+	id           string
+	address      string
+	serfStatus   serf.MemberStatus
+	suffrage     raft.ServerSuffrage
+	leader       bool
+	replica      bool
+	healthy      bool
+	lastContact  int64
+	lastIndex    uint64
+	appliedIndex uint64
+	stableSince  time.Time
+	failedSince  time.Time
+}
+
+type autopilot struct {
+	group   uint32
+	config  AutopilotConfig
+	store   *DistributedStorage
+	members func() []serf.Member
+
+	mu     sync.Mutex
+	health map[string]*serverHealth
+	conns  map[string]*grpc.ClientConn
+	opts   []grpc.DialOption
+}
+
+func newAutopilot(config AutopilotConfig, store *DistributedStorage, members func() []serf.Member) *autopilot {
+	defaults := DefaultAutopilotConfig()
+	if config.DeadServerTimeout == 0 {
+		config.DeadServerTimeout = defaults.DeadServerTimeout
+	}
+	if config.LastContactThreshold == 0 {
+		config.LastContactThreshold = defaults.LastContactThreshold
+	}
+	if config.MaxTrailingLogs == 0 {
+		config.MaxTrailingLogs = defaults.MaxTrailingLogs
+	}
+	if config.ServerStabilizationTime == 0 {
+		config.ServerStabilizationTime = defaults.ServerStabilizationTime
+	}
+	return &autopilot{
+		config:  config,
+		store:   store,
+		members: members,
+		health:  make(map[string]*serverHealth),
+		conns:   make(map[string]*grpc.ClientConn),
+	}
+}
+
+func (a *autopilot) run(done <-chan struct{}) {
+	ticker := time.NewTicker(autopilotInterval)
+	defer ticker.Stop()
+	defer a.closeConns()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if !a.store.IsLeader() {
+				a.reset()
+				continue
+			}
+			if err := a.step(time.Now()); err != nil {
+				log.Error().Err(err).Msg("autopilot step failed")
+			}
+		}
+	}
+}
+
+// reset forgets health information so a server that regains leadership
+// does not act on stale stabilization times.
+func (a *autopilot) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.health) > 0 {
+		a.health = make(map[string]*serverHealth)
+	}
+}
+
+func (a *autopilot) step(now time.Time) error {
+	config, _, err := a.store.Configuration()
+	if err != nil {
+		return err
+	}
+	members := make(map[string]serf.Member)
+	for _, m := range a.members() {
+		members[m.Name] = m
+	}
+	local := a.store.Stats()
+	stats := make(map[string]*api.ServerStatsResponse)
+	for _, srv := range config.Servers {
+		if string(srv.ID) == local.Id {
+			stats[local.Id] = local
+			continue
+		}
+		stats[string(srv.ID)] = a.fetchStats(string(srv.Address))
+	}
+
+	a.mu.Lock()
+	servers := make(map[string]bool)
+	for _, srv := range config.Servers {
+		id := string(srv.ID)
+		servers[id] = true
+		h, ok := a.health[id]
+		if !ok {
+			h = &serverHealth{id: id}
+			a.health[id] = h
+		}
+		h.address = string(srv.Address)
+		h.suffrage = srv.Suffrage
+		h.leader = id == local.Id
+		member, ok := members[id]
+		a.updateHealth(h, member, ok, stats[id], local.LastIndex, now)
+	}
+	for id, h := range a.health {
+		if !servers[id] {
+			delete(a.health, id)
+			if conn, ok := a.conns[h.address]; ok {
+				conn.Close()
+				delete(a.conns, h.address)
+			}
+		}
+	}
+	promote, remove := a.plan(now)
+	a.mu.Unlock()
+
+	for _, h := range remove {
+		log.Warn().Str("id", h.id).Str("addr", h.address).Msg("autopilot removing dead server")
+		if _, err := a.store.RemoveServer(h.id, 0); err != nil {
+			return err
+		}
+	}
+	for _, h := range promote {
+		log.Info().Str("id", h.id).Str("addr", h.address).Msg("autopilot promoting stable server")
+		if _, err := a.store.AddVoter(h.id, h.address, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchStats asks a server for its raft progress, returning nil if it can
+// not be reached. Connections are only used by the autopilot loop.
+func (a *autopilot) fetchStats(addr string) *api.ServerStatsResponse {
+	conn, ok := a.conns[addr]
+	if !ok {
+		var err error
+		opts := a.opts
+		if len(opts) == 0 {
+			opts = []grpc.DialOption{grpc.WithInsecure()}
+		}
+		conn, err = grpc.Dial(addr, opts...)
+		if err != nil {
+			log.Error().Err(err).Str("addr", addr).Msg("unable to dial server")
+			return nil
+		}
+		a.conns[addr] = conn
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+	stats, err := api.NewAdminClient(conn).ServerStats(ctx, &api.ServerStatsRequest{Group: a.group})
+	if err != nil {
+		log.Debug().Err(err).Str("addr", addr).Msg("unable to get server stats")
+		return nil
+	}
+	return stats
+}
+
+func (a *autopilot) closeConns() {
+	for addr, conn := range a.conns {
+		conn.Close()
+		delete(a.conns, addr)
+	}
+}
+
+func (a *autopilot) updateHealth(h *serverHealth, member serf.Member, known bool, stats *api.ServerStatsResponse, leaderIndex uint64, now time.Time) {
+	h.serfStatus = serf.StatusNone
+	if known {
+		h.serfStatus = member.Status
+		h.replica = member.Tags[discovery.RoleTag] == discovery.RoleNonvoter
+	}
+	if h.serfStatus == serf.StatusAlive {
+		h.failedSince = time.Time{}
+	} else if h.failedSince.IsZero() {
+		h.failedSince = now
+	}
+
+	healthy := h.serfStatus == serf.StatusAlive && stats != nil
+	if stats != nil {
+		h.lastContact = stats.LastContactMs
+		h.lastIndex = stats.LastIndex
+		h.appliedIndex = stats.AppliedIndex
+		if stats.LastContactMs < 0 || time.Duration(stats.LastContactMs)*time.Millisecond > a.config.LastContactThreshold {
+			healthy = false
+		}
+		if leaderIndex > stats.LastIndex && leaderIndex-stats.LastIndex > a.config.MaxTrailingLogs {
+			healthy = false
+		}
+	}
+	if healthy && !h.healthy {
+		h.stableSince = now
+	}
+	if !healthy {
+		h.stableSince = time.Time{}
+	}
+	h.healthy = healthy
+}
+
+// plan returns the servers to promote and remove. Dead voters are only
+// removed while they are a minority so a partitioned leader can not strip
+// the configuration down to itself. Must be called with the lock held.
+func (a *autopilot) plan(now time.Time) ([]*serverHealth, []*serverHealth) {
+	var promote, remove []*serverHealth
+	var voters, deadVoters int
+	for _, h := range a.sorted() {
+		if h.suffrage == raft.Voter {
+			voters++
+		}
+		if a.config.CleanupDeadServers && !h.leader && !h.failedSince.IsZero() && now.Sub(h.failedSince) >= a.config.DeadServerTimeout {
+			remove = append(remove, h)
+			if h.suffrage == raft.Voter {
+				deadVoters++
+			}
+			continue
+		}
+		if h.suffrage == raft.Nonvoter && !h.replica && h.healthy && now.Sub(h.stableSince) >= a.config.ServerStabilizationTime {
+			promote = append(promote, h)
+		}
+	}
+	if deadVoters > (voters-1)/2 {
+		log.Warn().Int("dead", deadVoters).Int("voters", voters).Msg("too many dead voters to remove safely")
+		var nonvoters []*serverHealth
+		for _, h := range remove {
+			if h.suffrage != raft.Voter {
+				nonvoters = append(nonvoters, h)
+			}
+		}
+		remove = nonvoters
+	}
+	return promote, remove
+}
+
+func (a *autopilot) sorted() []*serverHealth {
+	servers := make([]*serverHealth, 0, len(a.health))
+	for _, h := range a.health {
+		servers = append(servers, h)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].id < servers[j].id })
+	return servers
+}
+
+// serverHealth returns a copy of the last known health of each server.
+func (a *autopilot) serverHealth() map[string]serverHealth {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	res := make(map[string]serverHealth, len(a.health))
+	for id, h := range a.health {
+		res[id] = *h
+	}
+	return res
+}
+
+// Health reports the last known health of every server.
+func (a *autopilot) Health() (*api.AutopilotHealthResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.health) == 0 {
+		return nil, ErrAutopilotNotReady
+	}
+	resp := &api.AutopilotHealthResponse{Healthy: true}
+	var voters, healthyVoters int32
+	for _, h := range a.sorted() {
+		if h.suffrage == raft.Voter {
+			voters++
+			if h.healthy {
+				healthyVoters++
+			}
+		}
+		if !h.healthy {
+			resp.Healthy = false
+		}
+		var stableSince int64
+		if !h.stableSince.IsZero() {
+			stableSince = h.stableSince.UnixNano() / int64(time.Millisecond)
+		}
+		resp.Servers = append(resp.Servers, &api.ServerHealth{
+			Id:            h.id,
+			Address:       h.address,
+			SerfStatus:    h.serfStatus.String(),
+			Suffrage:      h.suffrage.String(),
+			IsLeader:      h.leader,
+			Healthy:       h.healthy,
+			LastContactMs: h.lastContact,
+			LastIndex:     h.lastIndex,
+			StableSince:   stableSince,
+		})
+	}
+	if tolerance := healthyVoters - (voters/2 + 1); tolerance > 0 {
+		resp.FailureTolerance = tolerance
+	}
+	return resp, nil
+}
+
+// Stats reports this server's raft progress for the leader's autopilot and
+// how well its data compresses.
+func (s *DistributedStorage) Stats() *api.ServerStatsResponse {
+	lastContact := int64(-1)
+	if s.IsLeader() {
+		lastContact = 0
+	} else if t := s.raft.LastContact(); !t.IsZero() {
+		lastContact = time.Since(t).Milliseconds()
+	}
+	return &api.ServerStatsResponse{
+		Id:            string(s.config.Raft.LocalID),
+		State:         s.raft.State().String(),
+		LastIndex:     s.raft.LastIndex(),
+		AppliedIndex:  s.raft.AppliedIndex(),
+		LastContactMs: lastContact,
+		Compression:   s.config.compressor.Stats(),
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/discovery"
+)
+
+func TestAutopilotPromotion(t *testing.T) {
+	a := newAutopilot(AutopilotConfig{}, nil, nil)
+	now := time.Now()
+	h := &serverHealth{id: "b", suffrage: raft.Nonvoter}
+	a.health["b"] = h
+	alive := serf.Member{Name: "b", Status: serf.StatusAlive}
+
+	a.updateHealth(h, alive, true, &api.ServerStatsResponse{LastIndex: 100, LastContactMs: 10}, 1000, now)
+	if h.healthy {
+		t.Errorf("server trailing by 900 logs should be unhealthy")
+	}
+	a.updateHealth(h, alive, true, &api.ServerStatsResponse{LastIndex: 1000, LastContactMs: 10}, 1000, now)
+	if !h.healthy || !h.stableSince.Equal(now) {
+		t.Fatalf("server should be healthy %+v", h)
+	}
+	if promote, _ := a.plan(now.Add(time.Second)); len(promote) != 0 {
+		t.Errorf("server should not be promoted before it is stable")
+	}
+	if promote, _ := a.plan(now.Add(a.config.ServerStabilizationTime)); len(promote) != 1 {
+		t.Errorf("stable server should be promoted")
+	}
+	replica := serf.Member{Name: "b", Status: serf.StatusAlive, Tags: map[string]string{discovery.RoleTag: discovery.RoleNonvoter}}
+	a.updateHealth(h, replica, true, &api.ServerStatsResponse{LastIndex: 1000, LastContactMs: 10}, 1000, now)
+	if promote, _ := a.plan(now.Add(a.config.ServerStabilizationTime)); len(promote) != 0 {
+		t.Errorf("read replicas should not be promoted")
+	}
+	a.updateHealth(h, alive, true, &api.ServerStatsResponse{LastIndex: 1000, LastContactMs: -1}, 1000, now)
+	if h.healthy || !h.stableSince.IsZero() {
+		t.Errorf("server that has not heard from the leader should be unhealthy")
+	}
+}
+
+func TestAutopilotDeadServers(t *testing.T) {
+	a := newAutopilot(AutopilotConfig{CleanupDeadServers: true}, nil, nil)
+	now := time.Now()
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		a.health[id] = &serverHealth{id: id, suffrage: raft.Voter, healthy: true}
+	}
+	a.health["a"].leader = true
+	failed := serf.Member{Status: serf.StatusFailed}
+	a.updateHealth(a.health["d"], failed, true, nil, 10, now)
+	a.updateHealth(a.health["e"], serf.Member{}, false, nil, 10, now)
+
+	if _, remove := a.plan(now.Add(time.Minute)); len(remove) != 0 {
+		t.Errorf("servers should not be removed before the timeout")
+	}
+	_, remove := a.plan(now.Add(a.config.DeadServerTimeout))
+	if len(remove) != 2 || remove[0].id != "d" || remove[1].id != "e" {
+		t.Errorf("expected d and e to be removed %+v", remove)
+	}
+	health, err := a.Health()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Healthy || health.FailureTolerance != 0 {
+		t.Errorf("expected unhealthy cluster with no failure tolerance %+v", health)
+	}
+
+	// a majority of dead voters is more likely a partition than failures
+	a.updateHealth(a.health["c"], failed, true, nil, 10, now)
+	if _, remove := a.plan(now.Add(a.config.DeadServerTimeout)); len(remove) != 0 {
+		t.Errorf("dead voters should not be removed without a majority %+v", remove)
+	}
+}
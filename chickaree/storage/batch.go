@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/rs/zerolog/log"
+)
+
+// Raft hands the fsm every entry committed together, up to
+// MaxAppendEntries, and the leader buffers applies so concurrent writes are
+// committed together. Each batch is applied to the data file in one
+// transaction rather than one or more per write. A write failing part way
+// through keeps what it wrote, as it did when each store call was its own
+// transaction.
+
+// batchStore runs the writes of fn in one transaction, committed if fn
+// returns nil. The storage and locks given to fn are only valid within it
+// and must only be used by the calling goroutine.
+type batchStore interface {
+	Batch(fn func(st storage, locks lockStore) error) error
+}
+
+var (
+	_ batchStore       = (*store)(nil)
+	_ batchStore       = (*trackedStore)(nil)
+	_ raft.BatchingFSM = (*fsm)(nil)
+	_ raft.FSM         = serialFSM{}
+)
+
+func (s *store) Batch(fn func(st storage, locks lockStore) error) error {
+	return s.db.Batch(func(tx Tx) error {
+		view := &store{
+			db:         txEngine{tx: tx},
+			path:       s.path,
+			keys:       s.keys,
+			compressor: s.compressor,
+		}
+		return fn(view, view)
+	})
+}
+
+func (s *trackedStore) Batch(fn func(st storage, locks lockStore) error) error {
+	b, ok := s.storage.(batchStore)
+	if !ok {
+		locks, _ := s.storage.(lockStore)
+		return fn(s, locks)
+	}
+	return b.Batch(func(st storage, locks lockStore) error {
+		return fn(&trackedStore{storage: st, trackedStats: s.trackedStats}, locks)
+	})
+}
+
+// txEngine runs every transaction of a store view in the batch's
+// transaction, so reads see the batch's writes.
+type txEngine struct {
+	tx Tx
+}
+
+func (e txEngine) Snapshot(fn func(tx Tx) error) error {
+	return fn(e.tx)
+}
+
+func (e txEngine) Batch(fn func(tx Tx) error) error {
+	return fn(e.tx)
+}
+
+func (e txEngine) Close() error {
+	return nil
+}
+
+// ApplyBatch applies the commands of a batch in one transaction. Raft calls
+// it from the same goroutine as Apply, Snapshot and Restore so the store
+// can be swapped for the batch's view while it runs.
+func (s *fsm) ApplyBatch(logs []*raft.Log) []interface{} {
+	res := make([]interface{}, len(logs))
+	b, ok := s.store.(batchStore)
+	if !ok {
+		for i, l := range logs {
+			if l.Type == raft.LogCommand {
+				res[i] = s.Apply(l)
+			}
+		}
+		return res
+	}
+	prevStore, prevLocks := s.store, s.locks
+	defer func() {
+		s.store, s.locks = prevStore, prevLocks
+	}()
+	err := b.Batch(func(st storage, locks lockStore) error {
+		s.store, s.locks = st, locks
+		for i, l := range logs {
+			if l.Type == raft.LogCommand {
+				res[i] = s.Apply(l)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// the entries are committed so carrying on would leave this node
+		// behind its peers, raft applies them again on restart
+		log.Fatal().Err(err).Uint64("index", logs[0].Index).Int("entries", len(logs)).Msg("unable to commit batch")
+	}
+	return res
+}
+
+// serialFSM hides ApplyBatch so raft applies one entry at a time.
+type serialFSM struct {
+	raft.FSM
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+)
+
+func logCommand(t *testing.T, index uint64, reqType RequestType, req proto.Message) *raft.Log {
+	return &raft.Log{Index: index, Type: raft.LogCommand, Data: command(t, reqType, req)}
+}
+
+func TestApplyBatch(t *testing.T) {
+	for _, engine := range Engines() {
+		t.Run(engine, func(t *testing.T) {
+			store, err := newStorage(Config{Engine: engine, StoragePath: filepath.Join(t.TempDir(), "data.db")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			tracked, err := newTrackedStore(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := &fsm{store: tracked, locks: store, migrations: newSlotStates()}
+
+			res := f.ApplyBatch([]*raft.Log{
+				logCommand(t, 1, SetRequestType, &api.SetRequest{Key: "a", Value: []byte("1")}),
+				{Index: 2, Type: raft.LogConfiguration},
+				logCommand(t, 3, ZAddRequestType, &api.ZAddRequest{Key: "a", Members: []*api.ZMember{{Member: []byte("m")}}}),
+				logCommand(t, 4, SetRequestType, &api.SetRequest{Key: "b", Value: []byte("22")}),
+				logCommand(t, 5, LockRequestType, &api.LockRequest{Name: "lock", Owner: "o", TtlMs: 1000, Now: 1}),
+				// later writes in a batch see earlier ones
+				logCommand(t, 6, DeleteRequestType, &api.DeleteRequest{Keys: []string{"b", "missing"}}),
+			})
+			if len(res) != 6 {
+				t.Fatalf("should be 6 not %d", len(res))
+			}
+			if res[0] != nil || res[1] != nil {
+				t.Errorf("unexpected responses %v %v", res[0], res[1])
+			}
+			if res[2] != ErrWrongType {
+				t.Errorf("expected wrong type got %v", res[2])
+			}
+			if lock, ok := res[4].(*api.LockResponse); !ok || !lock.Acquired || lock.Token != 5 {
+				t.Errorf("expected lock to be acquired got %v", res[4])
+			}
+			if del, ok := res[5].(*api.DeleteResponse); !ok || del.Count != 1 {
+				t.Errorf("expected one key deleted got %v", res[5])
+			}
+
+			if v, err := tracked.Get([]byte("a")); err != nil || string(v) != "1" {
+				t.Errorf("should be 1 not %q %v", v, err)
+			}
+			if v, _ := tracked.Get([]byte("b")); v != nil {
+				t.Errorf("expected b to be deleted got %q", v)
+			}
+			if state, _ := store.GetLock([]byte("lock")); state == nil {
+				t.Errorf("expected lock to be stored")
+			}
+			if used := tracked.Used(); used != 2 {
+				t.Errorf("should be 2 not %d", used)
+			}
+			if f.store != tracked || f.locks != store {
+				t.Errorf("expected store to be restored after the batch")
+			}
+		})
+	}
+}
+
+// startNode starts a single node group listening on addr, or any free port
+// when empty.
+func startNode(tb testing.TB, config Config, addr string) *DistributedStorage {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	config.Raft.StreamLayer = NewStreamLayer(ln, 0, nil, nil)
+	config.Raft.BindAddr = ln.Addr().String()
+	config.Raft.LocalID = "node"
+	config.Raft.Bootstrap = true
+	config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+	config.Raft.ElectionTimeout = 50 * time.Millisecond
+	config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+	store, err := newStorage(config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ds, err := NewDistributedStorage(store, config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := ds.WaitForLeader(5 * time.Second); err != nil {
+		tb.Fatal(err)
+	}
+	return ds
+}
+
+func newBenchStorage(b *testing.B, engine string, batch bool) *DistributedStorage {
+	dir := b.TempDir()
+	var config Config
+	config.Engine = engine
+	config.StoragePath = filepath.Join(dir, "data.db")
+	config.RaftDir = dir
+	config.BatchApplies = batch
+	ds := startNode(b, config, "")
+	b.Cleanup(func() { ds.Close() })
+	return ds
+}
+
+// BenchmarkConcurrentSet compares applying each write on its own with
+// batching under concurrent SET load, reporting latency percentiles.
+func BenchmarkConcurrentSet(b *testing.B) {
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	defer zerolog.SetGlobalLevel(level)
+
+	value := []byte(`{"name":"chickaree","kind":"benchmark"}`)
+	for _, engine := range []string{BoltEngine, MemoryEngine} {
+		for _, clients := range []int{1, 16, 64} {
+			for _, batch := range []bool{false, true} {
+				mode := "serial"
+				if batch {
+					mode = "batched"
+				}
+				b.Run(fmt.Sprintf("%s/%s/clients=%d", engine, mode, clients), func(b *testing.B) {
+					ds := newBenchStorage(b, engine, batch)
+					var (
+						mu        sync.Mutex
+						latencies []time.Duration
+						n         int64
+					)
+					b.SetParallelism(clients)
+					b.ResetTimer()
+					b.RunParallel(func(pb *testing.PB) {
+						var local []time.Duration
+						for pb.Next() {
+							key := []byte(fmt.Sprintf("key:%d", atomic.AddInt64(&n, 1)))
+							start := time.Now()
+							if err := ds.Set(key, value); err != nil {
+								b.Error(err)
+								return
+							}
+							local = append(local, time.Since(start))
+						}
+						mu.Lock()
+						latencies = append(latencies, local...)
+						mu.Unlock()
+					})
+					b.StopTimer()
+					reportLatencies(b, latencies)
+				})
+			}
+		}
+	}
+}
+
+func reportLatencies(b *testing.B, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) float64 {
+		return float64(latencies[int(p*float64(len(latencies)-1))].Nanoseconds())
+	}
+	b.ReportMetric(percentile(0.5), "p50-ns")
+	b.ReportMetric(percentile(0.99), "p99-ns")
+}
@@ -0,0 +1,417 @@
+package storage
+
+import (
+	"errors"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+)
+
+// Bit offsets follow the Redis convention: bit 0 is the most significant bit
+// of the first byte.
+
+var (
+	ErrBitOffset   = errors.New("bit offset is not an integer or out of range")
+	ErrBitEncoding = errors.New("invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	ErrBitOp       = errors.New("syntax error")
+	ErrBitOpNot    = errors.New("BITOP NOT must be called with a single source key.")
+)
+
+// maxBitOffset matches the 512MB string limit in redis.
+const maxBitOffset = 4*1024*1024*1024 - 1
+
+// setBit returns a copy of v with the bit at offset set along with the
+// previous value of the bit.
+func setBit(v []byte, offset uint64, value bool) ([]byte, int64) {
+	prev := getBit(v, offset)
+	v = growBits(v, offset, 1)
+	putBit(v, offset, value)
+	return v, prev
+}
+
+// putBit sets a bit in place, v must already be large enough.
+func putBit(v []byte, offset uint64, value bool) {
+	mask := byte(1 << (7 - offset&7))
+	if value {
+		v[offset>>3] |= mask
+	} else {
+		v[offset>>3] &^= mask
+	}
+}
+
+func getBit(v []byte, offset uint64) int64 {
+	byteIdx := offset >> 3
+	if byteIdx >= uint64(len(v)) {
+		return 0
+	}
+	if v[byteIdx]&byte(1<<(7-offset&7)) != 0 {
+		return 1
+	}
+	return 0
+}
+
+// growBits returns a copy of v large enough to hold width bits at offset.
+func growBits(v []byte, offset, width uint64) []byte {
+	size := (offset + width + 7) >> 3
+	if size < uint64(len(v)) {
+		size = uint64(len(v))
+	}
+	res := make([]byte, size)
+	copy(res, v)
+	return res
+}
+
+// bitRange resolves redis style (possibly negative) start and end indexes
+// against a length, returning ok false if the range is empty.
+func bitRange(start, end, length int64) (int64, int64, bool) {
+	if start < 0 {
+		start = length + start
+	}
+	if end < 0 {
+		end = length + end
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= length {
+		end = length - 1
+	}
+	if start > end || length == 0 {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+func bitCount(v []byte, req bitRangeRequest) int64 {
+	startBit, endBit, ok := req.bits(len(v))
+	if !ok {
+		return 0
+	}
+	var count int64
+	for i := startBit; i <= endBit; {
+		if i&7 == 0 && i+7 <= endBit {
+			count += int64(bits.OnesCount8(v[i>>3]))
+			i += 8
+			continue
+		}
+		count += getBit(v, uint64(i))
+		i++
+	}
+	return count
+}
+
+func bitPos(v []byte, bit bool, req bitRangeRequest) int64 {
+	if len(v) == 0 {
+		if bit {
+			return -1
+		}
+		return 0
+	}
+	if !req.hasStart {
+		req.start = 0
+	}
+	if !req.hasEnd {
+		req.end = -1
+	}
+	req.hasRange = true
+	startBit, endBit, ok := req.bits(len(v))
+	if !ok {
+		return -1
+	}
+	var want int64
+	var skip byte = 0xff
+	if bit {
+		want = 1
+		skip = 0
+	}
+	for i := startBit; i <= endBit; {
+		if i&7 == 0 && i+7 <= endBit && v[i>>3] == skip {
+			i += 8
+			continue
+		}
+		if getBit(v, uint64(i)) == want {
+			return i
+		}
+		i++
+	}
+	if !bit && !req.hasEnd {
+		// without an explicit end the string is considered padded with zeros
+		return endBit + 1
+	}
+	return -1
+}
+
+type bitRangeRequest struct {
+	hasRange bool
+	hasStart bool
+	hasEnd   bool
+	start    int64
+	end      int64
+	bitUnit  bool
+}
+
+// bits converts the request to an inclusive range of bit indexes.
+func (r bitRangeRequest) bits(length int) (int64, int64, bool) {
+	if !r.hasRange {
+		if length == 0 {
+			return 0, 0, false
+		}
+		return 0, int64(length)*8 - 1, true
+	}
+	if r.bitUnit {
+		return bitRange(r.start, r.end, int64(length)*8)
+	}
+	start, end, ok := bitRange(r.start, r.end, int64(length))
+	return start * 8, end*8 + 7, ok
+}
+
+func bitOp(op string, srcs [][]byte) ([]byte, error) {
+	op = strings.ToLower(op)
+	switch op {
+	case "and", "or", "xor", "not":
+	default:
+		return nil, ErrBitOp
+	}
+	if op == "not" {
+		if len(srcs) != 1 {
+			return nil, ErrBitOpNot
+		}
+		res := make([]byte, len(srcs[0]))
+		for i, b := range srcs[0] {
+			res[i] = ^b
+		}
+		return res, nil
+	}
+	var maxLen int
+	for _, src := range srcs {
+		if len(src) > maxLen {
+			maxLen = len(src)
+		}
+	}
+	res := make([]byte, maxLen)
+	for i := range res {
+		for j, src := range srcs {
+			var b byte
+			if i < len(src) {
+				b = src[i]
+			}
+			if j == 0 {
+				res[i] = b
+				continue
+			}
+			switch op {
+			case "and":
+				res[i] &= b
+			case "or":
+				res[i] |= b
+			case "xor":
+				res[i] ^= b
+			}
+		}
+	}
+	return res, nil
+}
+
+type bitfieldType struct {
+	signed bool
+	width  uint64
+}
+
+func parseBitfieldType(s string) (bitfieldType, error) {
+	if len(s) < 2 {
+		return bitfieldType{}, ErrBitEncoding
+	}
+	var t bitfieldType
+	switch s[0] {
+	case 'i', 'I':
+		t.signed = true
+	case 'u', 'U':
+	default:
+		return t, ErrBitEncoding
+	}
+	width, err := strconv.ParseUint(s[1:], 10, 8)
+	if err != nil || width == 0 || (t.signed && width > 64) || (!t.signed && width > 63) {
+		return t, ErrBitEncoding
+	}
+	t.width = width
+	return t, nil
+}
+
+// parseBitfieldOffset handles both absolute offsets and '#' prefixed offsets
+// which are multiplied by the type width.
+func parseBitfieldOffset(s string, t bitfieldType) (uint64, error) {
+	multiply := strings.HasPrefix(s, "#")
+	if multiply {
+		s = s[1:]
+	}
+	offset, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || offset > maxBitOffset {
+		return 0, ErrBitOffset
+	}
+	if multiply {
+		if offset > maxBitOffset/t.width {
+			return 0, ErrBitOffset
+		}
+		offset *= t.width
+	}
+	if offset > maxBitOffset-(t.width-1) {
+		return 0, ErrBitOffset
+	}
+	return offset, nil
+}
+
+func (t bitfieldType) get(v []byte, offset uint64) int64 {
+	var u uint64
+	for i := uint64(0); i < t.width; i++ {
+		u = u<<1 | uint64(getBit(v, offset+i))
+	}
+	if t.signed && t.width < 64 && u&(1<<(t.width-1)) != 0 {
+		u |= ^uint64(0) << t.width
+	}
+	return int64(u)
+}
+
+func (t bitfieldType) set(v []byte, offset uint64, value int64) []byte {
+	v = growBits(v, offset, t.width)
+	u := uint64(value)
+	for i := uint64(0); i < t.width; i++ {
+		putBit(v, offset+i, u&(1<<(t.width-1-i)) != 0)
+	}
+	return v
+}
+
+func (t bitfieldType) limits() (*big.Int, *big.Int) {
+	if t.signed {
+		max := new(big.Int).Lsh(big.NewInt(1), uint(t.width-1))
+		min := new(big.Int).Neg(max)
+		return min, max.Sub(max, big.NewInt(1))
+	}
+	max := new(big.Int).Lsh(big.NewInt(1), uint(t.width))
+	return big.NewInt(0), max.Sub(max, big.NewInt(1))
+}
+
+// overflow applies the overflow behaviour to a value, returning ok false when
+// the FAIL policy rejects the value.
+func (t bitfieldType) overflow(n *big.Int, policy string) (int64, bool) {
+	min, max := t.limits()
+	if n.Cmp(min) >= 0 && n.Cmp(max) <= 0 {
+		return n.Int64(), true
+	}
+	switch policy {
+	case "sat":
+		if n.Cmp(min) < 0 {
+			return min.Int64(), true
+		}
+		return max.Int64(), true
+	case "fail":
+		return 0, false
+	}
+	mod := new(big.Int).Lsh(big.NewInt(1), uint(t.width))
+	w := new(big.Int).Mod(n, mod)
+	if t.signed && w.Cmp(max) > 0 {
+		w.Sub(w, mod)
+	}
+	return w.Int64(), true
+}
+
+type bitfieldResult struct {
+	value int64
+	nil   bool
+}
+
+type bitfieldOperation struct {
+	command  string
+	encoding string
+	offset   string
+	value    int64
+	overflow string
+}
+
+// bitfield runs the operations against v returning the updated value, or nil
+// if no operation modified it.
+func bitfield(v []byte, ops []bitfieldOperation) ([]byte, []bitfieldResult, error) {
+	policy := "wrap"
+	var res []bitfieldResult
+	var written []byte
+	for _, op := range ops {
+		command := strings.ToLower(op.command)
+		if command == "overflow" {
+			policy = strings.ToLower(op.overflow)
+			switch policy {
+			case "wrap", "sat", "fail":
+			default:
+				return nil, nil, errors.New("invalid OVERFLOW type specified")
+			}
+			continue
+		}
+		t, err := parseBitfieldType(op.encoding)
+		if err != nil {
+			return nil, nil, err
+		}
+		offset, err := parseBitfieldOffset(op.offset, t)
+		if err != nil {
+			return nil, nil, err
+		}
+		old := t.get(v, offset)
+		switch command {
+		case "get":
+			res = append(res, bitfieldResult{value: old})
+		case "set":
+			n, ok := t.overflow(big.NewInt(op.value), policy)
+			if !ok {
+				res = append(res, bitfieldResult{nil: true})
+				continue
+			}
+			v = t.set(v, offset, n)
+			written = v
+			res = append(res, bitfieldResult{value: old})
+		case "incrby":
+			sum := new(big.Int).Add(big.NewInt(old), big.NewInt(op.value))
+			n, ok := t.overflow(sum, policy)
+			if !ok {
+				res = append(res, bitfieldResult{nil: true})
+				continue
+			}
+			v = t.set(v, offset, n)
+			written = v
+			res = append(res, bitfieldResult{value: n})
+		default:
+			return nil, nil, ErrBitOp
+		}
+	}
+	return written, res, nil
+}
+
+func applyBitFieldRequest(v []byte, req *api.BitFieldRequest) (*api.BitFieldResponse, []byte, error) {
+	ops := make([]bitfieldOperation, len(req.Operations))
+	for i, op := range req.Operations {
+		if req.ReadOnly && strings.ToLower(op.Command) != "get" {
+			return nil, nil, errors.New("BITFIELD_RO only supports the GET subcommand")
+		}
+		ops[i] = bitfieldOperation{
+			command:  op.Command,
+			encoding: op.Encoding,
+			offset:   op.Offset,
+			value:    op.Value,
+			overflow: op.Overflow,
+		}
+	}
+	v, results, err := bitfield(v, ops)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp := &api.BitFieldResponse{}
+	for _, r := range results {
+		resp.Results = append(resp.Results, &api.BitFieldResult{
+			Value: r.value,
+			Nil:   r.nil,
+		})
+	}
+	return resp, v, nil
+}
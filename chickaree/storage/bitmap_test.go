@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestSetBit(t *testing.T) {
+	v, prev := setBit(nil, 7, true)
+	if prev != 0 {
+		t.Errorf("should be 0 not %d", prev)
+	}
+	if string(v) != "\x01" {
+		t.Errorf("unexpected value %q", v)
+	}
+	v, prev = setBit(v, 7, false)
+	if prev != 1 {
+		t.Errorf("should be 1 not %d", prev)
+	}
+	if string(v) != "\x00" {
+		t.Errorf("unexpected value %q", v)
+	}
+	if res := getBit(v, 100); res != 0 {
+		t.Errorf("should be 0 not %d", res)
+	}
+}
+
+func TestBitCount(t *testing.T) {
+	v := []byte("foobar")
+	tests := []struct {
+		req      bitRangeRequest
+		expected int64
+	}{
+		{bitRangeRequest{}, 26},
+		{bitRangeRequest{hasRange: true, start: 0, end: 0}, 4},
+		{bitRangeRequest{hasRange: true, start: 1, end: 1}, 6},
+		{bitRangeRequest{hasRange: true, start: 5, end: 30, bitUnit: true}, 17},
+		{bitRangeRequest{hasRange: true, start: -2, end: -1}, 7},
+		{bitRangeRequest{hasRange: true, start: 4, end: 2}, 0},
+	}
+	for _, test := range tests {
+		if res := bitCount(v, test.req); res != test.expected {
+			t.Errorf("%+v should be %d not %d", test.req, test.expected, res)
+		}
+	}
+}
+
+func TestBitPos(t *testing.T) {
+	tests := []struct {
+		value    string
+		bit      bool
+		req      bitRangeRequest
+		expected int64
+	}{
+		{"\xff\xf0\x00", false, bitRangeRequest{}, 12},
+		{"\x00\xff\xf0", true, bitRangeRequest{hasStart: true, start: 0}, 8},
+		{"\x00\xff\xf0", true, bitRangeRequest{hasStart: true, start: 2}, 16},
+		{"\x00\xff\xf0", true, bitRangeRequest{hasStart: true, hasEnd: true, start: 2, end: -1}, 16},
+		{"\x00\xff\xf0", true, bitRangeRequest{hasStart: true, hasEnd: true, start: 7, end: 15, bitUnit: true}, 8},
+		{"\x00\x00\x00", true, bitRangeRequest{}, -1},
+		{"\xff\xff\xff", false, bitRangeRequest{}, 24},
+		{"\xff\xff\xff", false, bitRangeRequest{hasStart: true, hasEnd: true, start: 0, end: -1}, -1},
+		{"", false, bitRangeRequest{}, 0},
+	}
+	for _, test := range tests {
+		if res := bitPos([]byte(test.value), test.bit, test.req); res != test.expected {
+			t.Errorf("%q %+v should be %d not %d", test.value, test.req, test.expected, res)
+		}
+	}
+}
+
+func TestBitOp(t *testing.T) {
+	res, err := bitOp("AND", [][]byte{[]byte("foobar"), []byte("abcdef")})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if string(res) != "`bc`ab" {
+		t.Errorf("unexpected value %q", res)
+	}
+	res, err = bitOp("OR", [][]byte{[]byte("foo"), []byte("abcdef")})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if string(res) != "goodef" {
+		t.Errorf("unexpected value %q", res)
+	}
+	if _, err := bitOp("NOT", [][]byte{[]byte("a"), []byte("b")}); err != ErrBitOpNot {
+		t.Errorf("expected not error got %v", err)
+	}
+}
+
+func TestBitField(t *testing.T) {
+	v, res, err := bitfield(nil, []bitfieldOperation{
+		{command: "incrby", encoding: "i5", offset: "100", value: 1},
+		{command: "get", encoding: "u4", offset: "0"},
+	})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if len(res) != 2 || res[0].value != 1 || res[1].value != 0 {
+		t.Errorf("unexpected results %+v", res)
+	}
+
+	// values from the redis BITFIELD documentation overflow example
+	expected := [][2]int64{{1, 1}, {2, 2}, {3, 3}, {0, 3}}
+	v = nil
+	for _, e := range expected {
+		var written []byte
+		written, res, err = bitfield(v, []bitfieldOperation{
+			{command: "incrby", encoding: "u2", offset: "100", value: 1},
+			{command: "overflow", overflow: "sat"},
+			{command: "incrby", encoding: "u2", offset: "102", value: 1},
+		})
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		v = written
+		if res[0].value != e[0] || res[1].value != e[1] {
+			t.Errorf("expected %v got %+v", e, res)
+		}
+	}
+
+	_, res, _ = bitfield(v, []bitfieldOperation{
+		{command: "overflow", overflow: "fail"},
+		{command: "incrby", encoding: "u2", offset: "102", value: 1},
+	})
+	if !res[0].nil {
+		t.Errorf("expected nil got %+v", res)
+	}
+
+	v, res, _ = bitfield(nil, []bitfieldOperation{
+		{command: "set", encoding: "i8", offset: "#1", value: -100},
+		{command: "get", encoding: "i8", offset: "8"},
+		{command: "incrby", encoding: "i8", offset: "#1", value: -100},
+	})
+	if res[0].value != 0 || res[1].value != -100 || res[2].value != 56 {
+		t.Errorf("unexpected results %+v", res)
+	}
+	if len(v) != 2 {
+		t.Errorf("unexpected length %d", len(v))
+	}
+	if written, _, _ := bitfield(v, []bitfieldOperation{{command: "get", encoding: "u8", offset: "0"}}); written != nil {
+		t.Errorf("get should not modify value")
+	}
+	if _, _, err := bitfield(nil, []bitfieldOperation{{command: "get", encoding: "u64", offset: "0"}}); err != ErrBitEncoding {
+		t.Errorf("expected encoding error got %v", err)
+	}
+	for _, offset := range []string{"18446744073709551615", "#18446744073709551615", "#2305843009213693952", "4294967290", "#536870912"} {
+		if _, _, err := bitfield(nil, []bitfieldOperation{{command: "set", encoding: "u8", offset: offset, value: 1}}); err != ErrBitOffset {
+			t.Errorf("expected offset error for %s got %v", offset, err)
+		}
+	}
+	if _, err := parseBitfieldOffset("4294967288", bitfieldType{width: 8}); err != nil {
+		t.Errorf("expected last byte to be valid got %v", err)
+	}
+}
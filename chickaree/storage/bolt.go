@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltEngine keeps a data file in bolt, each bucket is a bolt bucket.
+type boltEngine struct {
+	db *bolt.DB
+}
+
+func openBolt(path string) (Engine, error) {
+	db, err := bolt.Open(path, 0666, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &boltEngine{db: db}, nil
+}
+
+func (e *boltEngine) Snapshot(fn func(tx Tx) error) error {
+	return boltError(e.db.View(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx: tx})
+	}))
+}
+
+func (e *boltEngine) Batch(fn func(tx Tx) error) error {
+	return boltError(e.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx: tx})
+	}))
+}
+
+func (e *boltEngine) Close() error {
+	return e.db.Close()
+}
+
+// boltError replaces bolt's errors with the engine's.
+func boltError(err error) error {
+	switch {
+	case errors.Is(err, bolt.ErrTxNotWritable):
+		return ErrTxNotWritable
+	case errors.Is(err, bolt.ErrIncompatibleValue):
+		return ErrIncompatibleValue
+	case errors.Is(err, bolt.ErrBucketNotFound):
+		return ErrBucketNotFound
+	case errors.Is(err, bolt.ErrKeyRequired), errors.Is(err, bolt.ErrBucketNameRequired):
+		return ErrKeyRequired
+	case errors.Is(err, bolt.ErrDatabaseNotOpen):
+		return ErrEngineClosed
+	default:
+		return err
+	}
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltTx) Bucket(name []byte) Bucket {
+	b := t.tx.Bucket(name)
+	if b == nil {
+		return nil
+	}
+	return boltBucket{b: b}
+}
+
+func (t boltTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, boltError(err)
+	}
+	return boltBucket{b: b}, nil
+}
+
+func (t boltTx) DeleteBucket(name []byte) error {
+	return boltError(t.tx.DeleteBucket(name))
+}
+
+func (t boltTx) Iterate(start []byte, fn func(key, value []byte) bool) error {
+	return iterate(t.tx.Cursor(), start, fn)
+}
+
+type boltBucket struct {
+	b *bolt.Bucket
+}
+
+func (b boltBucket) Get(key []byte) []byte {
+	return b.b.Get(key)
+}
+
+func (b boltBucket) Put(key, value []byte) error {
+	return boltError(b.b.Put(key, value))
+}
+
+func (b boltBucket) Delete(key []byte) error {
+	return boltError(b.b.Delete(key))
+}
+
+func (b boltBucket) Iterate(start []byte, fn func(key, value []byte) bool) error {
+	return iterate(b.b.Cursor(), start, fn)
+}
+
+func iterate(c *bolt.Cursor, start []byte, fn func(key, value []byte) bool) error {
+	k, v := c.First()
+	if start != nil {
+		k, v = c.Seek(start)
+	}
+	for ; k != nil; k, v = c.Next() {
+		if !fn(k, v) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (b boltBucket) Bucket(name []byte) Bucket {
+	nested := b.b.Bucket(name)
+	if nested == nil {
+		return nil
+	}
+	return boltBucket{b: nested}
+}
+
+func (b boltBucket) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	nested, err := b.b.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, boltError(err)
+	}
+	return boltBucket{b: nested}, nil
+}
+
+func (b boltBucket) DeleteBucket(name []byte) error {
+	return boltError(b.b.DeleteBucket(name))
+}
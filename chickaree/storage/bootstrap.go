@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
+	"github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/discovery"
+	"github.com/rs/zerolog/log"
+)
+
+// With bootstrap-expect no node is special. Voters advertise the expected
+// size through serf and once that many are alive the voters with the
+// lowest names bootstrap every group with themselves, so each of them
+// proposes the same configuration. Peers are asked first whether they
+// already have one so a restarted or late node never starts a second
+// cluster, nodes left out are joined by the leader as usual.
+
+const bootstrapInterval = time.Second
+
+func (s *Server) setupBootstrap() error {
+	if s.ServerConfig.BootstrapExpect > 0 {
+		go s.bootstrapExpect()
+	}
+	return nil
+}
+
+func (s *Server) bootstrapExpect() {
+	ticker := time.NewTicker(bootstrapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.shutdowns:
+			return
+		case <-ticker.C:
+		}
+		done, err := s.tryBootstrap()
+		if err != nil {
+			log.Warn().Err(err).Msg("unable to bootstrap yet")
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// tryBootstrap reports true once bootstrapping is no longer needed.
+func (s *Server) tryBootstrap() (bool, error) {
+	for _, g := range s.groups {
+		if g.store.Bootstrapped() {
+			return true, nil
+		}
+	}
+	servers, err := expectedServers(s.membership.Members(), s.ServerConfig.BootstrapExpect)
+	if err != nil || servers == nil {
+		return false, err
+	}
+	local := raft.ServerID(s.ServerConfig.NodeName)
+	found := false
+	for _, srv := range servers {
+		if srv.ID == local {
+			found = true
+			continue
+		}
+		bootstrapped, err := s.peerBootstrapped(string(srv.Address))
+		if err != nil {
+			return false, err
+		}
+		if bootstrapped {
+			log.Info().Str("peer", string(srv.ID)).Msg("peer already bootstrapped, waiting to be joined")
+			return true, nil
+		}
+	}
+	if !found {
+		log.Info().Int("expect", s.ServerConfig.BootstrapExpect).Msg("not an initial voter, waiting to be joined")
+		return true, nil
+	}
+	for _, g := range s.groups {
+		if err := g.store.BootstrapCluster(servers); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (s *Server) peerBootstrapped(addr string) (bool, error) {
+	conn, err := s.leaderConns.get(addr)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), bootstrapInterval)
+	defer cancel()
+	admin := chickaree.NewAdminClient(conn)
+	for _, g := range s.groups {
+		resp, err := admin.GetConfiguration(ctx, &chickaree.GetConfigurationRequest{Group: uint32(g.id)})
+		if err != nil {
+			return false, err
+		}
+		if len(resp.Servers) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// expectedServers returns the initial configuration once expect voters are
+// alive, nil until then. Every voter must expect the same size.
+func expectedServers(members []serf.Member, expect int) ([]raft.Server, error) {
+	var voters []serf.Member
+	for _, member := range members {
+		if member.Status != serf.StatusAlive || member.Tags[discovery.RoleTag] == discovery.RoleNonvoter {
+			continue
+		}
+		val, ok := member.Tags[discovery.ExpectTag]
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(val); err != nil || n != expect {
+			return nil, fmt.Errorf("member %s expects %s servers not %d", member.Name, val, expect)
+		}
+		voters = append(voters, member)
+	}
+	if len(voters) < expect {
+		return nil, nil
+	}
+	sort.Slice(voters, func(i, j int) bool { return voters[i].Name < voters[j].Name })
+	servers := make([]raft.Server, expect)
+	for i, member := range voters[:expect] {
+		addr := member.Tags[discovery.RPCAddrTag]
+		if addr == "" {
+			return nil, errors.New("member " + member.Name + " has no rpc address")
+		}
+		servers[i] = raft.Server{
+			ID:       raft.ServerID(member.Name),
+			Address:  raft.ServerAddress(addr),
+			Suffrage: raft.Voter,
+		}
+	}
+	return servers, nil
+}
+
+// Bootstrapped reports whether the group has a configuration, either
+// bootstrapped here or received from a leader.
+func (s *DistributedStorage) Bootstrapped() bool {
+	config, _, err := s.Configuration()
+	return err == nil && len(config.Servers) > 0
+}
+
+// BootstrapCluster starts the group with the servers, it does nothing if
+// the group already has state.
+func (s *DistributedStorage) BootstrapCluster(servers []raft.Server) error {
+	err := s.raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+	if errors.Is(err, raft.ErrCantBootstrap) {
+		return nil
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("unable to bootstrap cluster")
+		return err
+	}
+	log.Info().Int("servers", len(servers)).Msg("bootstrapped cluster")
+	return nil
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/hashicorp/serf/serf"
+	"github.com/holmes89/chickaree-db/chickaree/discovery"
+)
+
+func expectMember(name, expect, role string, status serf.MemberStatus) serf.Member {
+	tags := map[string]string{
+		discovery.RPCAddrTag: name + ":8400",
+		discovery.RoleTag:    role,
+	}
+	if expect != "" {
+		tags[discovery.ExpectTag] = expect
+	}
+	return serf.Member{Name: name, Tags: tags, Status: status}
+}
+
+func TestExpectedServers(t *testing.T) {
+	members := []serf.Member{
+		expectMember("c", "3", discovery.RoleVoter, serf.StatusAlive),
+		expectMember("a", "3", discovery.RoleVoter, serf.StatusAlive),
+		expectMember("replica", "", discovery.RoleNonvoter, serf.StatusAlive),
+		expectMember("b", "3", discovery.RoleVoter, serf.StatusFailed),
+	}
+	servers, err := expectedServers(members, 3)
+	if err != nil || servers != nil {
+		t.Fatalf("expected to wait for a third voter got %v %v", servers, err)
+	}
+
+	members = append(members,
+		expectMember("d", "3", discovery.RoleVoter, serf.StatusAlive),
+		expectMember("e", "3", discovery.RoleVoter, serf.StatusAlive),
+	)
+	servers, err = expectedServers(members, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 3 {
+		t.Fatalf("expected 3 servers got %v", servers)
+	}
+	for i, id := range []string{"a", "c", "d"} {
+		if string(servers[i].ID) != id || string(servers[i].Address) != id+":8400" {
+			t.Errorf("expected server %d to be %s got %+v", i, id, servers[i])
+		}
+	}
+
+	members = append(members, expectMember("f", "5", discovery.RoleVoter, serf.StatusAlive))
+	if _, err := expectedServers(members, 3); err == nil {
+		t.Errorf("expected an error when voters expect different sizes")
+	}
+}
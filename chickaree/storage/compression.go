@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/snappy"
+	"github.com/hashicorp/raft"
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"github.com/rs/zerolog/log"
+)
+
+// Values start with a header byte saying how they are compressed so
+// compressed and uncompressed values can be mixed, changing the algorithm or
+// threshold only affects new writes. Values are compressed before they are
+// encrypted. Raft log entries already start with their request type so
+// compressed entries start with entryHeader and the value's header instead.
+// Flate shrinks JSON the most, snappy is several times faster.
+
+const (
+	CompressionNone   = "none"
+	CompressionFlate  = "flate"
+	CompressionSnappy = "snappy"
+)
+
+const (
+	rawHeader    byte = 0x00
+	flateHeader  byte = 0x01
+	snappyHeader byte = 0x02
+
+	entryHeader byte = 0xc0
+	flateEntry       = entryHeader | flateHeader
+	snappyEntry      = entryHeader | snappyHeader
+)
+
+var (
+	metaBucket = []byte{0x5}
+	formatKey  = []byte("format")
+	// framingKey holds the last key framed while upgrading.
+	framingKey = []byte("framing")
+	// framedFormat is set once every value has a header byte.
+	framedFormat = []byte{1}
+)
+
+var ErrUnknownCompression = errors.New("unknown value compression")
+
+type CompressionConfig struct {
+	// Algorithm is none, flate or snappy.
+	Algorithm string `yaml:"algorithm"`
+	// Threshold is the smallest value or log entry compressed.
+	Threshold ByteSize `yaml:"threshold"`
+}
+
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{Algorithm: CompressionNone, Threshold: 1 << 10}
+}
+
+func (c CompressionConfig) Validate() error {
+	switch c.Algorithm {
+	case CompressionNone, CompressionFlate, CompressionSnappy:
+		return nil
+	default:
+		return fmt.Errorf("invalid compression %s", c.Algorithm)
+	}
+}
+
+// parseGroupCompression reads group:algorithm[:threshold] entries separated
+// by commas.
+func parseGroupCompression(val string) map[int]CompressionConfig {
+	configs := make(map[int]CompressionConfig)
+	for _, entry := range strings.Split(val, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		group, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) < 2 {
+			log.Warn().Str("entry", entry).Msg("ignoring invalid group compression")
+			continue
+		}
+		c := CompressionConfig{Algorithm: parts[1]}
+		if len(parts) > 2 {
+			if c.Threshold, err = ParseByteSize(parts[2]); err != nil {
+				log.Warn().Str("entry", entry).Msg("ignoring invalid group compression")
+				continue
+			}
+		}
+		configs[group] = c
+	}
+	return configs
+}
+
+// compressor compresses the values and log entries of a database and
+// counts how well it does.
+type compressor struct {
+	config  CompressionConfig
+	writers sync.Pool
+
+	values  uint64
+	entries uint64
+	raw     uint64
+	stored  uint64
+}
+
+func newCompressor(config CompressionConfig) *compressor {
+	return &compressor{config: config}
+}
+
+// compress returns b compressed and the header saying how, or nil when it
+// is too small or would not shrink.
+func (c *compressor) compress(b []byte) (byte, []byte) {
+	if c == nil || int64(len(b)) < int64(c.config.Threshold) {
+		return rawHeader, nil
+	}
+	var header byte
+	var compressed []byte
+	switch c.config.Algorithm {
+	case CompressionFlate:
+		header, compressed = flateHeader, c.deflate(b)
+	case CompressionSnappy:
+		header, compressed = snappyHeader, snappy.Encode(nil, b)
+	}
+	if compressed == nil || len(compressed) >= len(b) {
+		return rawHeader, nil
+	}
+	atomic.AddUint64(&c.raw, uint64(len(b)))
+	atomic.AddUint64(&c.stored, uint64(len(compressed)))
+	return header, compressed
+}
+
+func (c *compressor) deflate(b []byte) []byte {
+	var buf bytes.Buffer
+	w, _ := c.writers.Get().(*flate.Writer)
+	if w == nil {
+		w, _ = flate.NewWriter(&buf, flate.BestSpeed)
+	} else {
+		w.Reset(&buf)
+	}
+	defer c.writers.Put(w)
+	if _, err := w.Write(b); err != nil {
+		return nil
+	}
+	if err := w.Close(); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// decompress reverses compress.
+func decompress(header byte, b []byte) ([]byte, error) {
+	switch header {
+	case flateHeader:
+		r := flate.NewReader(bytes.NewReader(b))
+		defer r.Close()
+		return io.ReadAll(r)
+	case snappyHeader:
+		return snappy.Decode(nil, b)
+	default:
+		return nil, ErrUnknownCompression
+	}
+}
+
+// frame adds the header byte to a value, compressing it when worthwhile.
+func (c *compressor) frame(value []byte) []byte {
+	if header, compressed := c.compress(value); compressed != nil {
+		atomic.AddUint64(&c.values, 1)
+		return append([]byte{header}, compressed...)
+	}
+	return append([]byte{rawHeader}, value...)
+}
+
+// unframe returns a value without its header byte.
+func unframe(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, ErrUnknownCompression
+	}
+	if b[0] == rawHeader {
+		return b[1:], nil
+	}
+	return decompress(b[0], b[1:])
+}
+
+// Stats returns the compression counters.
+func (c *compressor) Stats() *api.CompressionStats {
+	if c == nil {
+		return &api.CompressionStats{Algorithm: CompressionNone}
+	}
+	return &api.CompressionStats{
+		Algorithm:         c.config.Algorithm,
+		Threshold:         uint64(c.config.Threshold),
+		CompressedValues:  atomic.LoadUint64(&c.values),
+		CompressedEntries: atomic.LoadUint64(&c.entries),
+		RawBytes:          atomic.LoadUint64(&c.raw),
+		StoredBytes:       atomic.LoadUint64(&c.stored),
+	}
+}
+
+// frameValues adds a header byte to the values of a data file written
+// before values were compressed. It runs once, resuming from the last batch
+// framed if it was interrupted.
+func (s *store) frameValues() error {
+	var framed bool
+	var after []byte
+	if err := s.db.Batch(func(tx Tx) error {
+		b, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(b.Get(formatKey), framedFormat) {
+			framed = true
+			return nil
+		}
+		if isEmpty(tx.Bucket(defaultBucket)) {
+			framed = true
+			return b.Put(formatKey, framedFormat)
+		}
+		after = append([]byte{}, b.Get(framingKey)...)
+		return nil
+	}); err != nil || framed {
+		return err
+	}
+	if len(after) == 0 {
+		after = nil
+	}
+	count, err := s.rewriteValues(defaultBucket, after, func(v []byte) ([]byte, error) {
+		plaintext, err := s.decrypt(v)
+		if err != nil {
+			return nil, err
+		}
+		return s.encrypt(append([]byte{rawHeader}, plaintext...))
+	}, func(tx Tx, last []byte) error {
+		return tx.Bucket(metaBucket).Put(framingKey, last)
+	})
+	if err != nil {
+		log.Error().Err(err).Str("path", s.path).Msg("unable to frame values")
+		return errors.New("unable to upgrade data file")
+	}
+	log.Info().Str("path", s.path).Int("values", count).Msg("values framed for compression")
+	return s.db.Batch(func(tx Tx) error {
+		b := tx.Bucket(metaBucket)
+		if err := b.Delete(framingKey); err != nil {
+			return err
+		}
+		return b.Put(formatKey, framedFormat)
+	})
+}
+
+// compressedLogStore compresses the data of raft commands.
+type compressedLogStore struct {
+	raft.LogStore
+	compressor *compressor
+}
+
+func (s *compressedLogStore) GetLog(index uint64, l *raft.Log) error {
+	if err := s.LogStore.GetLog(index, l); err != nil {
+		return err
+	}
+	if l.Type != raft.LogCommand || len(l.Data) == 0 || l.Data[0]&entryHeader != entryHeader {
+		return nil
+	}
+	data, err := decompress(l.Data[0]&^entryHeader, l.Data[1:])
+	if err != nil {
+		return err
+	}
+	l.Data = data
+	return nil
+}
+
+func (s *compressedLogStore) StoreLog(l *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{l})
+}
+
+func (s *compressedLogStore) StoreLogs(logs []*raft.Log) error {
+	compressed := make([]*raft.Log, len(logs))
+	for i, l := range logs {
+		compressed[i] = l
+		if l.Type != raft.LogCommand {
+			continue
+		}
+		if header, data := s.compressor.compress(l.Data); data != nil {
+			// raft keeps using the entries it stores
+			c := *l
+			c.Data = append([]byte{entryHeader | header}, data...)
+			compressed[i] = &c
+			atomic.AddUint64(&s.compressor.entries, 1)
+		}
+	}
+	return s.LogStore.StoreLogs(compressed)
+}
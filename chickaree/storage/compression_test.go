@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	boltdb "github.com/hashicorp/raft-boltdb"
+	bolt "go.etcd.io/bbolt"
+)
+
+func flateCompressor() *compressor {
+	return newCompressor(CompressionConfig{Algorithm: CompressionFlate, Threshold: 64})
+}
+
+// compressionHeaders are the value header of each algorithm.
+var compressionHeaders = map[string]byte{
+	CompressionFlate:  flateHeader,
+	CompressionSnappy: snappyHeader,
+}
+
+func TestCompressedStore(t *testing.T) {
+	for algorithm, header := range compressionHeaders {
+		t.Run(algorithm, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.db")
+			c := newCompressor(CompressionConfig{Algorithm: algorithm, Threshold: 64})
+			store, err := newStorage(Config{StoragePath: path, compressor: c})
+			if err != nil {
+				t.Fatal(err)
+			}
+			large := bytes.Repeat([]byte(`{"name":"chickaree"}`), 100)
+			if err := store.Set([]byte("large"), large); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Set([]byte("small"), []byte("small")); err != nil {
+				t.Fatal(err)
+			}
+			for key, expected := range map[string][]byte{"large": large, "small": []byte("small")} {
+				if v, err := store.Get([]byte(key)); err != nil || !bytes.Equal(v, expected) {
+					t.Errorf("expected %s to round trip got %v", key, err)
+				}
+			}
+			stats := c.Stats()
+			if stats.CompressedValues != 1 || stats.RawBytes != uint64(len(large)) || stats.StoredBytes >= stats.RawBytes {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+			store.Close()
+
+			if v := rawValue(t, path, []byte("large")); v[0] != header || len(v) >= len(large) {
+				t.Errorf("expected large value to be compressed")
+			}
+			if v := rawValue(t, path, []byte("small")); v[0] != rawHeader {
+				t.Errorf("expected small value to be stored raw")
+			}
+
+			// values stay readable when compression is turned off
+			store, err = newStorage(Config{StoragePath: path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if v, err := store.Get([]byte("large")); err != nil || !bytes.Equal(v, large) {
+				t.Errorf("expected compressed value to be read without compression got %v", err)
+			}
+		})
+	}
+}
+
+func TestFrameValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a data file from before values had a header
+	if err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(defaultBucket)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < rewriteBatch+10; i++ {
+			if err := b.Put([]byte{byte(i >> 8), byte(i)}, []byte("value")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	for i := 0; i < 2; i++ {
+		store, err := newStorage(Config{StoragePath: path, compressor: flateCompressor()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, err := store.Get([]byte{0, 1}); err != nil || string(v) != "value" {
+			t.Errorf("expected framed value got %q %v", v, err)
+		}
+		last := rewriteBatch + 9
+		if v, err := store.Get([]byte{byte(last >> 8), byte(last)}); err != nil || string(v) != "value" {
+			t.Errorf("expected framed value got %q %v", v, err)
+		}
+		store.Close()
+	}
+}
+
+func TestCompressedLogStore(t *testing.T) {
+	for algorithm, header := range compressionHeaders {
+		t.Run(algorithm, func(t *testing.T) {
+			boltStore, err := boltdb.NewBoltStore(filepath.Join(t.TempDir(), "logs.dat"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer boltStore.Close()
+			c := newCompressor(CompressionConfig{Algorithm: algorithm, Threshold: 64})
+			logs := &compressedLogStore{LogStore: boltStore, compressor: c}
+
+			large := append([]byte{byte(SetRequestType)}, bytes.Repeat([]byte("value"), 100)...)
+			small := []byte{byte(SetRequestType), 'a'}
+			entries := []*raft.Log{
+				{Index: 1, Type: raft.LogCommand, Data: large},
+				{Index: 2, Type: raft.LogCommand, Data: small},
+				{Index: 3, Type: raft.LogConfiguration, Data: bytes.Repeat([]byte("c"), 200)},
+			}
+			if err := logs.StoreLogs(entries); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(entries[0].Data, large) {
+				t.Errorf("expected stored entries to be left alone")
+			}
+			var raw raft.Log
+			if err := boltStore.GetLog(1, &raw); err != nil || raw.Data[0] != entryHeader|header {
+				t.Errorf("expected large entry to be compressed")
+			}
+			if err := boltStore.GetLog(3, &raw); err != nil || raw.Data[0] != 'c' {
+				t.Errorf("expected configuration to be stored raw")
+			}
+			for _, e := range entries {
+				var l raft.Log
+				if err := logs.GetLog(e.Index, &l); err != nil || !bytes.Equal(l.Data, e.Data) {
+					t.Errorf("expected entry %d to round trip got %v", e.Index, err)
+				}
+			}
+			if stats := c.Stats(); stats.CompressedEntries != 1 {
+				t.Errorf("should be 1 not %d", stats.CompressedEntries)
+			}
+		})
+	}
+}
+
+func TestCompressionConfig(t *testing.T) {
+	if err := DefaultCompressionConfig().Validate(); err != nil {
+		t.Errorf("expected default to be valid got %v", err)
+	}
+	if err := (CompressionConfig{Algorithm: "zip"}).Validate(); err == nil {
+		t.Errorf("expected error")
+	}
+	if stats := (*compressor)(nil).Stats(); stats.Algorithm != CompressionNone {
+		t.Errorf("should be none not %s", stats.Algorithm)
+	}
+
+	groups := parseGroupCompression("1:snappy, 2:flate:4kb, x:none, 3")
+	if len(groups) != 2 || groups[1].Algorithm != CompressionSnappy || groups[2].Threshold != 4<<10 {
+		t.Errorf("unexpected group compression %+v", groups)
+	}
+}
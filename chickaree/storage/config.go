@@ -5,12 +5,18 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"math"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/raft"
+	"github.com/holmes89/chickaree-db/chickaree/discovery"
+	"github.com/holmes89/chickaree-db/chickaree/encryption"
+	"github.com/holmes89/chickaree-db/chickaree/tlsconfig"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v2"
 )
@@ -18,18 +24,51 @@ import (
 type Config struct {
 	StoragePath string `yaml:"storage-path"`
 	RaftDir     string `yaml:"raft-dir"`
-	Raft        struct {
+	// Engine keeps the data file, bolt or memory for a cache that is
+	// rebuilt from raft on restart.
+	Engine string `yaml:"engine"`
+	// MaxMemory limits the size of the dataset, 0 is unlimited.
+	MaxMemory ByteSize `yaml:"maxmemory"`
+	// MaxMemoryPolicy decides what is evicted when over MaxMemory.
+	MaxMemoryPolicy  string          `yaml:"maxmemory-policy"`
+	MaxMemorySamples int             `yaml:"maxmemory-samples"`
+	Autopilot        AutopilotConfig `yaml:"autopilot"`
+	Raft             struct {
 		raft.Config
 		BindAddr    string
 		StreamLayer *StreamLayer
 		Bootstrap   bool
 	}
+	// EncryptionKeyFile enables encryption at rest with the keys in the
+	// file, the first key encrypts and the others only decrypt. Keys, lock
+	// names and sorted set members and scores are not encrypted.
+	EncryptionKeyFile string `yaml:"encryption-key-file"`
+	// BatchApplies applies the writes raft commits together in one
+	// transaction rather than one each.
+	BatchApplies bool `yaml:"batch-applies"`
+	// Compression compresses large values and raft log entries.
+	Compression CompressionConfig `yaml:"compression"`
+	// GroupCompression overrides Compression for some raft groups, unset
+	// fields are taken from Compression.
+	GroupCompression map[int]CompressionConfig `yaml:"group-compression"`
+	// slots and acls are set for group 0 which replicates the slot
+	// assignment and users.
+	slots *slotMap
+	acls  *aclMap
+	keys  *encryption.Keyring
+	// compressor is shared by the group's store and raft log.
+	compressor *compressor
 }
 
 type ServerConfig struct {
 	Config          `yaml:"config"`
 	ServerTLSConfig *tls.Config
 	PeerTLSConfig   *tls.Config
+	// TLS enables mutual tls for grpc and raft, ServerTLSConfig and
+	// PeerTLSConfig are built from it unless already set.
+	TLS tlsconfig.Config `yaml:"tls"`
+	// Auth authenticates and authorizes grpc callers.
+	Auth AuthConfig `yaml:"auth"`
 	// DataDir stores the log and raft data.
 	DataDir string `yaml:"data-dir"`
 	// BindAddr is the address serf runs on.
@@ -39,9 +78,29 @@ type ServerConfig struct {
 	SefPort int `yaml:"serf-port"`
 	// Raft server id.
 	NodeName string `yaml:"node-name"`
-	// Bootstrap should be set to true when starting the first node of the cluster.
+	// StartJoinAddrs are serf addresses to join, dns+host:port and
+	// dnssrv+name seeds are looked up in DNS.
 	StartJoinAddrs []string `yaml:"start-join-addrs"`
-	Bootstrap      bool     `yaml:"bootstrap"`
+	// RetryJoinInterval is the first wait between join attempts, it doubles
+	// after each failure.
+	RetryJoinInterval time.Duration `yaml:"retry-join-interval"`
+	// RetryJoinMax limits join attempts, 0 retries until joined.
+	RetryJoinMax int `yaml:"retry-join-max"`
+	// Encrypt is a base64 key of 16, 24 or 32 bytes encrypting gossip.
+	Encrypt string `yaml:"encrypt"`
+	// KeyringFile keeps rotated gossip keys, defaults to serf.keyring in
+	// the raft dir.
+	KeyringFile string `yaml:"keyring-file"`
+	// Bootstrap should be set to true when starting the first node of the cluster.
+	Bootstrap bool `yaml:"bootstrap"`
+	// BootstrapExpect bootstraps once this many voters have found each other
+	// through serf instead of relying on a single bootstrap node.
+	BootstrapExpect int `yaml:"bootstrap-expect"`
+	// Role is voter or nonvoter for read replicas that never join quorum.
+	Role string `yaml:"role"`
+	// RaftGroups is the number of raft groups the hash slots are split
+	// between, it must be the same on every node.
+	RaftGroups int `yaml:"raft-groups"`
 }
 
 func LoadConfiguration() (ServerConfig, error) {
@@ -58,13 +117,21 @@ func LoadConfiguration() (ServerConfig, error) {
 
 	cfg := ServerConfig{
 		Config: Config{
-			StoragePath: "chicakree.db",
-			RaftDir:     "/tmp",
+			StoragePath:      "chicakree.db",
+			Engine:           BoltEngine,
+			RaftDir:          "/tmp",
+			MaxMemoryPolicy:  NoEviction,
+			MaxMemorySamples: defaultSamples,
+			Autopilot:        DefaultAutopilotConfig(),
+			Compression:      DefaultCompressionConfig(),
+			BatchApplies:     true,
 		},
-		NodeName:  hostname,
-		RPCPort:   8400,
-		SefPort:   8401,
-		Bootstrap: defaultBootstrap,
+		NodeName:   hostname,
+		RPCPort:    8400,
+		SefPort:    8401,
+		Bootstrap:  defaultBootstrap,
+		Role:       discovery.RoleVoter,
+		RaftGroups: 1,
 	}
 
 	if cfgfilePtr != nil && *cfgfilePtr != "" { // #3
@@ -75,6 +142,61 @@ func LoadConfiguration() (ServerConfig, error) {
 
 	cfg.LoadFromEnv()
 
+	if !validPolicy(cfg.MaxMemoryPolicy) {
+		return cfg, fmt.Errorf("invalid maxmemory-policy: %s", cfg.MaxMemoryPolicy)
+	}
+
+	if !validEngine(cfg.Engine) {
+		return cfg, fmt.Errorf("invalid engine: %s, must be one of %s", cfg.Engine, strings.Join(Engines(), ", "))
+	}
+
+	if err := cfg.Compression.Validate(); err != nil {
+		return cfg, err
+	}
+	for group := range cfg.GroupCompression {
+		if group < 0 || group >= cfg.RaftGroups {
+			return cfg, fmt.Errorf("invalid group-compression group: %d", group)
+		}
+		if err := groupConfig(cfg.Config, group, cfg.RaftGroups).Compression.Validate(); err != nil {
+			return cfg, err
+		}
+	}
+
+	if cfg.RaftGroups < 1 || cfg.RaftGroups > math.MaxUint8+1 {
+		return cfg, fmt.Errorf("invalid raft-groups: %d", cfg.RaftGroups)
+	}
+	if cfg.Role != discovery.RoleVoter && cfg.Role != discovery.RoleNonvoter {
+		return cfg, fmt.Errorf("invalid role: %s", cfg.Role)
+	}
+	if cfg.BootstrapExpect < 0 {
+		return cfg, fmt.Errorf("invalid bootstrap-expect: %d", cfg.BootstrapExpect)
+	}
+	if cfg.BootstrapExpect > 0 {
+		if cfg.Bootstrap && !defaultBootstrap {
+			return cfg, errors.New("bootstrap and bootstrap-expect can not both be set")
+		}
+		// the hostname no longer decides who bootstraps
+		cfg.Bootstrap = false
+	}
+	if cfg.Role == discovery.RoleNonvoter && (cfg.Bootstrap || cfg.BootstrapExpect > 0) {
+		return cfg, errors.New("a nonvoter can not bootstrap the cluster")
+	}
+
+	if cfg.Encrypt != "" {
+		if _, err := discovery.DecodeKey(cfg.Encrypt); err != nil {
+			return cfg, fmt.Errorf("invalid encrypt: %w", err)
+		}
+	}
+	if err := cfg.TLS.Validate(); err != nil {
+		return cfg, err
+	}
+	if err := cfg.Auth.Validate(); err != nil {
+		return cfg, err
+	}
+	if cfg.KeyringFile == "" {
+		cfg.KeyringFile = filepath.Join(cfg.RaftDir, "serf.keyring")
+	}
+
 	if strings.Contains(cfg.BindAddr, "$HOSTNAME") {
 		cfg.BindAddr = strings.Replace(cfg.BindAddr, "$HOSTNAME", hostname, 1)
 	}
@@ -112,6 +234,10 @@ func (config *ServerConfig) LoadFromEnv() {
 		log.Info().Str("storage-path", val).Msg("update config from env")
 		config.Config.StoragePath = val
 	}
+	if val := os.Getenv("ENGINE"); val != "" {
+		log.Info().Str("engine", val).Msg("update config from env")
+		config.Config.Engine = val
+	}
 	if val := os.Getenv("NODE_NAME"); val != "" {
 		log.Info().Str("node-name", val).Msg("update config from env")
 		config.NodeName = val
@@ -130,9 +256,135 @@ func (config *ServerConfig) LoadFromEnv() {
 		log.Info().Str("bootstrap", val).Msg("update config from env")
 		config.Bootstrap = (val == "true" || val == "1")
 	}
+	if val := os.Getenv("BOOTSTRAP_EXPECT"); val != "" {
+		if v, err := strconv.Atoi(val); err == nil {
+			log.Info().Str("bootstrap-expect", val).Msg("update config from env")
+			config.BootstrapExpect = v
+		}
+	}
+	if val := os.Getenv("RAFT_GROUPS"); val != "" {
+		if v, err := strconv.Atoi(val); err == nil {
+			log.Info().Str("raft-groups", val).Msg("update config from env")
+			config.RaftGroups = v
+		}
+	}
+	if val := os.Getenv("ROLE"); val != "" {
+		log.Info().Str("role", val).Msg("update config from env")
+		config.Role = val
+	}
+	if val := os.Getenv("MAXMEMORY"); val != "" {
+		if v, err := ParseByteSize(val); err == nil {
+			log.Info().Str("maxmemory", val).Msg("update config from env")
+			config.Config.MaxMemory = v
+		}
+	}
+	if val := os.Getenv("MAXMEMORY_POLICY"); val != "" {
+		log.Info().Str("maxmemory-policy", val).Msg("update config from env")
+		config.Config.MaxMemoryPolicy = val
+	}
+	if val := os.Getenv("MAXMEMORY_SAMPLES"); val != "" {
+		if v, err := strconv.Atoi(val); err == nil {
+			log.Info().Str("maxmemory-samples", val).Msg("update config from env")
+			config.Config.MaxMemorySamples = v
+		}
+	}
+	if val := os.Getenv("AUTOPILOT_CLEANUP_DEAD_SERVERS"); val != "" {
+		log.Info().Str("autopilot-cleanup-dead-servers", val).Msg("update config from env")
+		config.Config.Autopilot.CleanupDeadServers = (val == "true" || val == "1")
+	}
+	if val := os.Getenv("AUTOPILOT_DEAD_SERVER_TIMEOUT"); val != "" {
+		if v, err := time.ParseDuration(val); err == nil {
+			log.Info().Str("autopilot-dead-server-timeout", val).Msg("update config from env")
+			config.Config.Autopilot.DeadServerTimeout = v
+		}
+	}
+	if val := os.Getenv("AUTOPILOT_SERVER_STABILIZATION_TIME"); val != "" {
+		if v, err := time.ParseDuration(val); err == nil {
+			log.Info().Str("autopilot-server-stabilization-time", val).Msg("update config from env")
+			config.Config.Autopilot.ServerStabilizationTime = v
+		}
+	}
 	if val := os.Getenv("START_JOIN_ADDRS"); val != "" {
 		log.Info().Str("start-join-addrs", val).Msg("update config from env")
-		config.StartJoinAddrs = []string{val}
+		config.StartJoinAddrs = discovery.ParseSeeds(val)
+	}
+	if val := os.Getenv("RETRY_JOIN_INTERVAL"); val != "" {
+		if v, err := time.ParseDuration(val); err == nil {
+			log.Info().Str("retry-join-interval", val).Msg("update config from env")
+			config.RetryJoinInterval = v
+		}
+	}
+	if val := os.Getenv("RETRY_JOIN_MAX"); val != "" {
+		if v, err := strconv.Atoi(val); err == nil {
+			log.Info().Str("retry-join-max", val).Msg("update config from env")
+			config.RetryJoinMax = v
+		}
+	}
+	if val := os.Getenv("ENCRYPT_KEY"); val != "" {
+		// the key itself is not logged
+		log.Info().Msg("update encrypt from env")
+		config.Encrypt = val
+	}
+	if val := os.Getenv("KEYRING_FILE"); val != "" {
+		log.Info().Str("keyring-file", val).Msg("update config from env")
+		config.KeyringFile = val
+	}
+	if val := os.Getenv("TLS_CERT_FILE"); val != "" {
+		log.Info().Str("tls-cert-file", val).Msg("update config from env")
+		config.TLS.CertFile = val
+	}
+	if val := os.Getenv("TLS_KEY_FILE"); val != "" {
+		log.Info().Str("tls-key-file", val).Msg("update config from env")
+		config.TLS.KeyFile = val
+	}
+	if val := os.Getenv("TLS_CA_FILE"); val != "" {
+		log.Info().Str("tls-ca-file", val).Msg("update config from env")
+		config.TLS.CAFile = val
+	}
+	if val := os.Getenv("TLS_SERVER_NAME"); val != "" {
+		log.Info().Str("tls-server-name", val).Msg("update config from env")
+		config.TLS.ServerName = val
+	}
+	if val := os.Getenv("ENCRYPTION_KEY_FILE"); val != "" {
+		log.Info().Str("encryption-key-file", val).Msg("update config from env")
+		config.EncryptionKeyFile = val
+	}
+	if val := os.Getenv("BATCH_APPLIES"); val != "" {
+		log.Info().Str("batch-applies", val).Msg("update config from env")
+		config.BatchApplies = (val == "true" || val == "1")
+	}
+	if val := os.Getenv("COMPRESSION"); val != "" {
+		log.Info().Str("compression", val).Msg("update config from env")
+		config.Compression.Algorithm = val
+	}
+	if val := os.Getenv("COMPRESSION_THRESHOLD"); val != "" {
+		if v, err := ParseByteSize(val); err == nil {
+			log.Info().Str("compression-threshold", val).Msg("update config from env")
+			config.Compression.Threshold = v
+		}
+	}
+	if val := os.Getenv("COMPRESSION_GROUPS"); val != "" {
+		log.Info().Str("compression-groups", val).Msg("update config from env")
+		config.GroupCompression = parseGroupCompression(val)
+	}
+	if val := os.Getenv("AUTH_PRINCIPALS"); val != "" {
+		// tokens are not logged
+		log.Info().Msg("update auth principals from env")
+		config.Auth.Principals = parsePrincipals(val)
+	}
+	if val := os.Getenv("AUTH_PROXIES"); val != "" {
+		log.Info().Str("auth-proxies", val).Msg("update config from env")
+		for _, name := range strings.Split(val, ",") {
+			for i := range config.Auth.Principals {
+				if config.Auth.Principals[i].Name == strings.TrimSpace(name) {
+					config.Auth.Principals[i].Proxy = true
+				}
+			}
+		}
+	}
+	if val := os.Getenv("AUTH_TOKEN"); val != "" {
+		log.Info().Msg("update auth token from env")
+		config.Auth.Token = val
 	}
 
 	return
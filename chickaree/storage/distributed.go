@@ -28,8 +28,16 @@ var logFile = "events.log"
 
 type DistributedStorage struct {
 	config Config
-	store  storage
+	store  *trackedStore
+	locks  lockStore
 	raft   *raft.Raft
+	fsm    *fsm
+	logs   raft.LogStore
+	// raftStores hold the raft log and stable state, closed with raft.
+	raftStores []*boltdb.BoltStore
+
+	evictLock sync.Mutex
+	done      chan struct{}
 }
 
 var (
@@ -37,19 +45,33 @@ var (
 )
 
 func NewDistributedStorage(store storage, config Config) (*DistributedStorage, error) {
+	tracked, err := newTrackedStore(store)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to load key statistics")
+		return nil, errors.New("failed to create storage")
+	}
 	l := &DistributedStorage{
 		config: config,
-		store:  store,
+		store:  tracked,
+		done:   make(chan struct{}),
+	}
+	if locks, ok := store.(lockStore); ok {
+		l.locks = locks
 	}
 
 	if err := l.setupRaft(); err != nil {
 		return nil, err
 	}
+	go l.runEvictions()
 	return l, nil
 }
 
 func (s *DistributedStorage) setupRaft() error {
 	baseDir := s.config.RaftDir
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		log.Error().Err(err).Str("raft-dir", baseDir).Msg("unable to create raft directory")
+		return errors.New("unable to setup raft")
+	}
 
 	logStore, err := boltdb.NewBoltStore(filepath.Join(baseDir, "logs.dat"))
 	if err != nil {
@@ -63,14 +85,42 @@ func (s *DistributedStorage) setupRaft() error {
 		return fmt.Errorf(`boltdb.NewBoltStore(%q): %v`, filepath.Join(baseDir, "stable.dat"), err)
 	}
 
+	s.raftStores = []*boltdb.BoltStore{logStore, stableStore}
+
 	snapshotStore, err := raft.NewFileSnapshotStore(baseDir, 3, os.Stderr)
 	if err != nil {
 		log.Error().Err(err).Msg("unable to create bolt sroage for snapshots")
 		return fmt.Errorf(`raft.NewFileSnapshotStore(%q, ...): %v`, baseDir, err)
 	}
 
+	if err := setupRaftEncryption(logStore, stableStore, s.config.keys); err != nil {
+		log.Error().Err(err).Str("raft-dir", baseDir).Msg("unable to open raft storage")
+		return err
+	}
+	var (
+		logs      raft.LogStore      = logStore
+		stable    raft.StableStore   = stableStore
+		snapshots raft.SnapshotStore = snapshotStore
+	)
+	if s.config.keys != nil {
+		logs = &encryptedLogStore{LogStore: logStore, keys: s.config.keys}
+		stable = &encryptedStableStore{StableStore: stableStore, keys: s.config.keys}
+		snapshots = &encryptedSnapshotStore{SnapshotStore: snapshotStore, keys: s.config.keys}
+	}
+	if s.config.compressor != nil {
+		logs = &compressedLogStore{LogStore: logs, compressor: s.config.compressor}
+	}
+
+	s.logs = logs
 	log.Info().Msg("distributed server raft storage created")
-	fsm := &fsm{store: s.store}
+	s.fsm = &fsm{
+		store:      s.store,
+		locks:      s.locks,
+		logFile:    filepath.Join(baseDir, logFile),
+		slots:      s.config.slots,
+		acls:       s.config.acls,
+		migrations: newSlotStates(),
+	}
 
 	maxPool := 5
 	timeout := 30 * time.Second
@@ -99,13 +149,28 @@ func (s *DistributedStorage) setupRaft() error {
 		log.Info().Dur("timeout", s.config.Raft.CommitTimeout).Msg("overriding commit timeout")
 		config.CommitTimeout = s.config.Raft.CommitTimeout
 	}
+	if s.config.Raft.MaxAppendEntries != 0 {
+		log.Info().Int("entries", s.config.Raft.MaxAppendEntries).Msg("overriding max append entries")
+		config.MaxAppendEntries = s.config.Raft.MaxAppendEntries
+	}
+	if s.config.Raft.TrailingLogs != 0 {
+		log.Info().Uint64("logs", s.config.Raft.TrailingLogs).Msg("overriding trailing logs")
+		config.TrailingLogs = s.config.Raft.TrailingLogs
+	}
+	var stateMachine raft.FSM = s.fsm
+	if s.config.BatchApplies {
+		// buffer applies so concurrent writes are committed together
+		config.BatchApplyCh = true
+	} else {
+		stateMachine = serialFSM{s.fsm}
+	}
 
 	s.raft, err = raft.NewRaft(
 		config,
-		fsm,
-		logStore,
-		stableStore,
-		snapshotStore,
+		stateMachine,
+		logs,
+		stable,
+		snapshots,
 		transport,
 	)
 	if err != nil {
@@ -143,9 +208,41 @@ var _ storage = &DistributedStorage{}
 type RequestType uint8
 
 const (
-	SetRequestType RequestType = 0
+	SetRequestType      RequestType = 0
+	SetBitRequestType   RequestType = 1
+	BitOpRequestType    RequestType = 2
+	BitFieldRequestType RequestType = 3
+	PFAddRequestType    RequestType = 4
+	PFMergeRequestType  RequestType = 5
+	ZAddRequestType     RequestType = 6
+	LockRequestType     RequestType = 7
+	UnlockRequestType   RequestType = 8
+	RefreshRequestType  RequestType = 9
+	DeleteRequestType   RequestType = 10
+	ExpireRequestType   RequestType = 11
+	// slot migration
+	UpdateSlotsRequestType RequestType = 12
+	SlotStateRequestType   RequestType = 13
+	RestoreKeysRequestType RequestType = 14
+	// replication
+	ReplicateRequestType RequestType = 15
+	ReadOnlyRequestType  RequestType = 16
+	// acl
+	SetUserRequestType     RequestType = 17
+	DeleteUsersRequestType RequestType = 18
 )
 
+// denyOOM are the requests rejected when over the memory limit.
+var denyOOM = map[RequestType]bool{
+	SetRequestType:      true,
+	SetBitRequestType:   true,
+	BitOpRequestType:    true,
+	BitFieldRequestType: true,
+	PFAddRequestType:    true,
+	PFMergeRequestType:  true,
+	ZAddRequestType:     true,
+}
+
 func (s *DistributedStorage) Set(key, value []byte) error {
 	_, err := s.apply(SetRequestType, &api.SetRequest{
 		Key:   string(key),
@@ -158,13 +255,152 @@ func (s *DistributedStorage) Set(key, value []byte) error {
 }
 
 func (s *DistributedStorage) Get(key []byte) ([]byte, error) {
+	if s.isExpired(key) {
+		return nil, nil
+	}
 	return s.store.Get(key)
 }
 
+func (s *DistributedStorage) Delete(key []byte) error {
+	_, err := s.delete([]string{string(key)})
+	return err
+}
+
+func (s *DistributedStorage) delete(keys []string) (int64, error) {
+	res, err := s.apply(DeleteRequestType, &api.DeleteRequest{Keys: keys})
+	if err != nil {
+		return 0, err
+	}
+	return res.(*api.DeleteResponse).Count, nil
+}
+
+func (s *DistributedStorage) Keys(fn func(key []byte) bool) error {
+	return s.store.Keys(func(key []byte) bool {
+		if s.isExpired(key) {
+			return true
+		}
+		return fn(key)
+	})
+}
+
+func (s *DistributedStorage) Size(key []byte) (int64, error) {
+	return s.store.Size(key)
+}
+
+func (s *DistributedStorage) Expire(key []byte, at int64) (bool, error) {
+	res, err := s.apply(ExpireRequestType, &api.ExpireRequest{
+		Key:       string(key),
+		Persist:   at == 0,
+		ExpiresAt: at,
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.(*api.ExpireResponse).Updated, nil
+}
+
+func (s *DistributedStorage) ExpiresAt(key []byte) (int64, error) {
+	return s.store.ExpiresAt(key)
+}
+
+// isExpired hides keys that have expired but have not yet been deleted by
+// the leader.
+func (s *DistributedStorage) isExpired(key []byte) bool {
+	at, err := s.store.ExpiresAt(key)
+	if err != nil || at == 0 {
+		return false
+	}
+	return at <= time.Now().UnixNano()/int64(time.Millisecond)
+}
+
+// IsLeader reports whether this node is the raft leader.
+func (s *DistributedStorage) IsLeader() bool {
+	return s.raft.State() == raft.Leader
+}
+
+func (s *DistributedStorage) ZAdd(key []byte, members []ScoredMember, opts ZAddOptions) (int64, error) {
+	req := &api.ZAddRequest{
+		Key: string(key),
+		Nx:  opts.NX,
+		Xx:  opts.XX,
+		Ch:  opts.CH,
+	}
+	for _, m := range members {
+		req.Members = append(req.Members, &api.ZMember{
+			Member: m.Member,
+			Score:  m.Score,
+		})
+	}
+	res, err := s.apply(ZAddRequestType, req)
+	if err != nil {
+		return 0, err
+	}
+	return res.(*api.ZAddResponse).Count, nil
+}
+
+func (s *DistributedStorage) ZScore(key, member []byte) (float64, bool, error) {
+	if s.isExpired(key) {
+		return 0, false, nil
+	}
+	return s.store.ZScore(key, member)
+}
+
+func (s *DistributedStorage) ZRangeByScore(key []byte, min, max float64, fn func(ScoredMember) bool) error {
+	if s.isExpired(key) {
+		return nil
+	}
+	return s.store.ZRangeByScore(key, min, max, fn)
+}
+
+func (s *DistributedStorage) SetBit(req *api.SetBitRequest) (*api.SetBitResponse, error) {
+	res, err := s.apply(SetBitRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.SetBitResponse), nil
+}
+
+func (s *DistributedStorage) BitOp(req *api.BitOpRequest) (*api.BitOpResponse, error) {
+	res, err := s.apply(BitOpRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.BitOpResponse), nil
+}
+
+func (s *DistributedStorage) BitField(req *api.BitFieldRequest) (*api.BitFieldResponse, error) {
+	res, err := s.apply(BitFieldRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.BitFieldResponse), nil
+}
+
+func (s *DistributedStorage) PFAdd(req *api.PFAddRequest) (*api.PFAddResponse, error) {
+	res, err := s.apply(PFAddRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.PFAddResponse), nil
+}
+
+func (s *DistributedStorage) PFMerge(req *api.PFMergeRequest) (*api.PFMergeResponse, error) {
+	res, err := s.apply(PFMergeRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.PFMergeResponse), nil
+}
+
 func (s *DistributedStorage) apply(reqType RequestType, req proto.Message) (
 	interface{},
 	error,
 ) {
+	if denyOOM[reqType] {
+		if err := s.checkMemory(); err != nil {
+			return nil, err
+		}
+	}
 	var buf bytes.Buffer
 	_, err := buf.Write([]byte{byte(reqType)})
 	if err != nil {
@@ -190,8 +426,10 @@ func (s *DistributedStorage) apply(reqType RequestType, req proto.Message) (
 	return res, nil
 }
 
-func (s *DistributedStorage) Join(id, addr string) error {
-	log.Info().Str("id", id).Str("addr", addr).Msg("joining cluster...")
+// Join adds the server as a nonvoter, autopilot promotes it once it is
+// stable unless it is a read replica.
+func (s *DistributedStorage) Join(id, addr string, nonvoter bool) error {
+	log.Info().Str("id", id).Str("addr", addr).Bool("nonvoter", nonvoter).Msg("joining cluster...")
 	configFuture := s.raft.GetConfiguration()
 	if err := configFuture.Error(); err != nil {
 		log.Error().Err(err).Msg("unable to get raft configuration")
@@ -202,6 +440,11 @@ func (s *DistributedStorage) Join(id, addr string) error {
 	for _, srv := range configFuture.Configuration().Servers {
 		if srv.ID == serverID || srv.Address == serverAddr {
 			if srv.ID == serverID && srv.Address == serverAddr {
+				if nonvoter && srv.Suffrage == raft.Voter {
+					// the server has restarted as a read replica
+					_, err := s.DemoteVoter(id, 0)
+					return err
+				}
 				log.Warn().Str("id", id).Str("addr", addr).Msg("server already joined")
 				return nil
 			}
@@ -213,9 +456,10 @@ func (s *DistributedStorage) Join(id, addr string) error {
 			}
 		}
 	}
-	addFuture := s.raft.AddVoter(serverID, serverAddr, 0, 0)
+	// servers join as nonvoters until autopilot sees they are stable
+	addFuture := s.raft.AddNonvoter(serverID, serverAddr, 0, 0)
 	if err := addFuture.Error(); err != nil {
-		log.Error().Err(err).Msg("unable to add voter")
+		log.Error().Err(err).Msg("unable to add nonvoter")
 		return err
 	}
 	log.Info().Str("id", id).Str("addr", addr).Msg("joined cluster")
@@ -227,6 +471,20 @@ func (s *DistributedStorage) Leave(id string) error {
 	return removeFuture.Error()
 }
 
+// Servers returns the address of every server in the raft configuration
+// keyed by id.
+func (s *DistributedStorage) Servers() (map[string]string, error) {
+	config, _, err := s.Configuration()
+	if err != nil {
+		return nil, err
+	}
+	servers := make(map[string]string)
+	for _, srv := range config.Servers {
+		servers[string(srv.ID)] = string(srv.Address)
+	}
+	return servers, nil
+}
+
 func (s *DistributedStorage) WaitForLeader(timeout time.Duration) error {
 	timeoutc := time.After(timeout)
 	ticker := time.NewTicker(time.Second)
@@ -245,55 +503,157 @@ func (s *DistributedStorage) WaitForLeader(timeout time.Duration) error {
 }
 
 func (s *DistributedStorage) Close() error {
+	close(s.done)
 	f := s.raft.Shutdown()
 	if err := f.Error(); err != nil {
 		log.Error().Err(err).Msg("unable to shutdown raft")
 		return err
 	}
+	for _, store := range s.raftStores {
+		if err := store.Close(); err != nil {
+			log.Error().Err(err).Msg("unable to close raft storage")
+			return err
+		}
+	}
 	return s.store.Close()
 }
 
-func (s *DistributedStorage) GetServers(nameIP map[string]string) ([]*api.Server, error) {
-	leaderIP := string(s.raft.Leader())
+// LeaderID returns the id of the current leader by finding its address in
+// the configuration, empty if there is no known leader.
+func (s *DistributedStorage) LeaderID() (string, error) {
+	config, _, err := s.Configuration()
+	if err != nil {
+		return "", err
+	}
+	return leaderID(config, s.raft.Leader()), nil
+}
+
+func leaderID(config raft.Configuration, leader raft.ServerAddress) string {
+	if leader == "" {
+		return ""
+	}
+	for _, srv := range config.Servers {
+		if srv.Address == leader {
+			return string(srv.ID)
+		}
+	}
+	return ""
+}
 
-	future := s.raft.GetConfiguration()
-	if err := future.Error(); err != nil {
-		log.Error().Err(err).Msg("unable to get configuration")
+// GetServers returns the servers in the raft configuration, progress and
+// serf status are filled in by the caller as they are not known here.
+func (s *DistributedStorage) GetServers() ([]*api.Server, error) {
+	config, _, err := s.Configuration()
+	if err != nil {
 		return nil, errors.New("unable to get servers")
 	}
+	leader := leaderID(config, s.raft.Leader())
 
 	var servers []*api.Server
-	for _, server := range future.Configuration().Servers {
-		ip := nameIP[string(server.Address)]
-		log.Info().Str("addr", string(server.Address)).Str("ip", ip).Str("leader", leaderIP).Bool("is-leader", leaderIP == ip).Msg("server")
+	for _, server := range config.Servers {
 		servers = append(servers, &api.Server{
-			Id:       string(server.ID),
-			RpcAddr:  string(server.Address),
-			IsLeader: leaderIP == ip,
+			Id:            string(server.ID),
+			RpcAddr:       string(server.Address),
+			IsLeader:      string(server.ID) == leader,
+			Role:          serverRole(server.Suffrage),
+			Suffrage:      server.Suffrage.String(),
+			LastContactMs: -1,
 		})
 	}
-	log.Info().Int("servers", len(servers)).Msg("returning servers")
+	log.Debug().Int("servers", len(servers)).Str("leader", leader).Msg("returning servers")
 	return servers, nil
 }
 
+// serverRole reports staging servers as nonvoters since they do not count
+// towards quorum.
+func serverRole(suffrage raft.ServerSuffrage) string {
+	if suffrage == raft.Voter {
+		return discovery.RoleVoter
+	}
+	return discovery.RoleNonvoter
+}
+
 var (
 	_ raft.FSM = (*fsm)(nil)
 )
 
 type fsm struct {
-	mu    sync.RWMutex
-	store storage
+	mu      sync.RWMutex
+	store   storage
+	locks   lockStore
+	logFile string
+	// slots and acls are only kept by group 0.
+	slots      *slotMap
+	acls       *aclMap
+	migrations *slotStates
+	// readOnly is set on a secondary, it only accepts replicated writes.
+	readOnly int32
 }
 
 func (s *fsm) Apply(record *raft.Log) interface{} {
-	return s.apply(record.Data)
+	return s.apply(record.Index, record.Data)
 }
 
-func (s *fsm) apply(buf []byte) interface{} {
+func (s *fsm) apply(index uint64, buf []byte) interface{} {
+	if _, ok := writeRequests[RequestType(buf[0])]; ok && s.isReadOnly() {
+		return ErrReadOnly
+	}
+	return s.applyWrite(index, buf)
+}
+
+func (s *fsm) applyWrite(index uint64, buf []byte) interface{} {
 	reqType := RequestType(buf[0])
+	keys, err := s.migrations.check(reqType, buf[1:])
+	if err != nil {
+		return err
+	}
+	res := s.applyRequest(index, reqType, buf)
+	if _, failed := res.(error); !failed {
+		s.migrations.changed(keys)
+	}
+	return res
+}
+
+func (s *fsm) applyRequest(index uint64, reqType RequestType, buf []byte) interface{} {
 	switch reqType {
 	case SetRequestType:
 		return s.applySet(buf[1:])
+	case SetBitRequestType:
+		return s.applySetBit(buf[1:])
+	case BitOpRequestType:
+		return s.applyBitOp(buf[1:])
+	case BitFieldRequestType:
+		return s.applyBitField(buf[1:])
+	case PFAddRequestType:
+		return s.applyPFAdd(buf[1:])
+	case PFMergeRequestType:
+		return s.applyPFMerge(buf[1:])
+	case ZAddRequestType:
+		return s.applyZAdd(buf[1:])
+	case LockRequestType:
+		return s.applyLock(index, buf[1:])
+	case UnlockRequestType:
+		return s.applyUnlock(buf[1:])
+	case RefreshRequestType:
+		return s.applyRefresh(buf[1:])
+	case DeleteRequestType:
+		return s.applyDelete(buf[1:])
+	case ExpireRequestType:
+		return s.applyExpire(buf[1:])
+	case UpdateSlotsRequestType:
+		return s.applyUpdateSlots(buf[1:])
+	case SlotStateRequestType:
+		return s.applySlotState(buf[1:])
+	case RestoreKeysRequestType:
+		return s.applyRestoreKeys(buf[1:])
+	case ReplicateRequestType:
+		return s.applyReplicate(index, buf[1:])
+	case ReadOnlyRequestType:
+		return s.applyReadOnly(buf[1:])
+	case SetUserRequestType:
+		return s.applySetUser(index, buf[1:])
+	case DeleteUsersRequestType:
+		return s.applyDeleteUsers(index, buf[1:])
 	}
 	s.write(buf)
 	return nil
@@ -309,15 +669,198 @@ func (s *fsm) applySet(b []byte) error {
 	if err := s.store.Set([]byte(req.Key), req.Value); err != nil {
 		return err
 	}
+	// SET discards any previous expiry
+	if _, err := s.store.Expire([]byte(req.Key), 0); err != nil {
+		return err
+	}
 	return nil
 }
 
+func (s *fsm) applyDelete(b []byte) interface{} {
+	var req api.DeleteRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	var count int64
+	for _, key := range req.Keys {
+		size, err := s.store.Size([]byte(key))
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			continue
+		}
+		if err := s.store.Delete([]byte(key)); err != nil {
+			return err
+		}
+		count++
+	}
+	return &api.DeleteResponse{Count: count}
+}
+
+func (s *fsm) applyExpire(b []byte) interface{} {
+	var req api.ExpireRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	at := req.ExpiresAt
+	if req.Persist {
+		at = 0
+	}
+	ok, err := s.store.Expire([]byte(req.Key), at)
+	if err != nil {
+		return err
+	}
+	return &api.ExpireResponse{Updated: ok}
+}
+
+func (s *fsm) applyZAdd(b []byte) interface{} {
+	var req api.ZAddRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	members := make([]ScoredMember, len(req.Members))
+	for i, m := range req.Members {
+		members[i] = ScoredMember{Member: m.Member, Score: m.Score}
+	}
+	count, err := s.store.ZAdd([]byte(req.Key), members, ZAddOptions{
+		NX: req.Nx,
+		XX: req.Xx,
+		CH: req.Ch,
+	})
+	if err != nil {
+		return err
+	}
+	return &api.ZAddResponse{Count: count}
+}
+
+func (s *fsm) applySetBit(b []byte) interface{} {
+	var req api.SetBitRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	if req.Offset > maxBitOffset {
+		return ErrBitOffset
+	}
+	v, err := s.store.Get([]byte(req.Key))
+	if err != nil {
+		return err
+	}
+	v, prev := setBit(v, req.Offset, req.Value)
+	if err := s.store.Set([]byte(req.Key), v); err != nil {
+		return err
+	}
+	return &api.SetBitResponse{Previous: prev}
+}
+
+func (s *fsm) applyBitOp(b []byte) interface{} {
+	var req api.BitOpRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	srcs := make([][]byte, len(req.Keys))
+	for i, key := range req.Keys {
+		v, err := s.store.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		srcs[i] = v
+	}
+	res, err := bitOp(req.Operation, srcs)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Set([]byte(req.Destination), res); err != nil {
+		return err
+	}
+	return &api.BitOpResponse{Length: int64(len(res))}
+}
+
+func (s *fsm) applyBitField(b []byte) interface{} {
+	var req api.BitFieldRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	v, err := s.store.Get([]byte(req.Key))
+	if err != nil {
+		return err
+	}
+	res, v, err := applyBitFieldRequest(v, &req)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		if err := s.store.Set([]byte(req.Key), v); err != nil {
+			return err
+		}
+	}
+	return res
+}
+
+func (s *fsm) applyPFAdd(b []byte) interface{} {
+	var req api.PFAddRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	v, err := s.store.Get([]byte(req.Key))
+	if err != nil {
+		return err
+	}
+	h, err := parseHyperLogLog(v)
+	if err != nil {
+		return err
+	}
+	updated := v == nil
+	for _, elem := range req.Elements {
+		if h.Add(elem) {
+			updated = true
+		}
+	}
+	if !updated {
+		return &api.PFAddResponse{}
+	}
+	h.invalidate()
+	if err := s.store.Set([]byte(req.Key), h.Encode()); err != nil {
+		return err
+	}
+	return &api.PFAddResponse{Updated: true}
+}
+
+func (s *fsm) applyPFMerge(b []byte) interface{} {
+	var req api.PFMergeRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	res := newHyperLogLog()
+	// the destination is included in the merge as redis does
+	for _, key := range append([]string{req.Destination}, req.Keys...) {
+		v, err := s.store.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			continue
+		}
+		h, err := parseHyperLogLog(v)
+		if err != nil {
+			return err
+		}
+		res.Merge(h)
+		res.sparse = res.sparse && h.sparse
+	}
+	res.invalidate()
+	if err := s.store.Set([]byte(req.Destination), res.Encode()); err != nil {
+		return err
+	}
+	return &api.PFMergeResponse{}
+}
+
 func (s *fsm) write(body []byte) {
 	body = append(body, '\n')
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	f, err := os.OpenFile(s.logFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
 	if err != nil {
 		log.Fatal().Err(err).Msg("unable to open log file")
 	}
@@ -328,28 +871,48 @@ func (s *fsm) write(body []byte) {
 	}
 }
 
+// Snapshot opens a view of the data file so nodes can be restored once the
+// log is compacted. Raft calls it between applies so the view matches the
+// index it is taken at, the copy is streamed to the sink by Persist.
 func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
-	fi, err := os.OpenFile(logFile, os.O_RDONLY, 0600)
-	if err != nil {
-		log.Fatal().Err(err).Msg("unable to open log file")
+	st, ok := f.store.(snapshotStore)
+	if !ok {
 		return nil, errors.New("failed to create snapshot")
 	}
-
-	defer fi.Close()
-	b, err := io.ReadAll(fi)
+	ss, err := st.Snapshot()
 	if err != nil {
-		log.Fatal().Err(err).Msg("unable to read log file")
 		return nil, errors.New("failed to create snapshot")
 	}
-	return &snapshot{reader: bytes.NewBuffer(b)}, nil
+	return &snapshot{state: f.state(), store: ss}, nil
 }
 
+// Restore replaces the data file and the state kept beside it with a
+// snapshot, snapshots taken before they held the data file are replayed as
+// events.
 func (f *fsm) Restore(r io.ReadCloser) error {
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		f.apply(scanner.Bytes())
+	defer r.Close()
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(len(snapshotHeader))
+	if !bytes.Equal(header, snapshotHeader) && !bytes.Equal(header, snapshotHeaderV1) {
+		scanner := bufio.NewScanner(br)
+		for scanner.Scan() {
+			f.apply(0, scanner.Bytes())
+		}
+		return nil
+	}
+	header = append([]byte{}, header...)
+	br.Discard(len(header))
+	st, ok := f.store.(snapshotStore)
+	if !ok {
+		return errors.New("failed to restore snapshot")
+	}
+	if err := f.restoreState(br, header); err != nil {
+		log.Error().Err(err).Msg("unable to restore snapshot state")
+		return errors.New("failed to restore snapshot")
+	}
+	if err := st.Load(br); err != nil {
+		log.Error().Err(err).Msg("unable to restore snapshot")
+		return errors.New("failed to restore snapshot")
 	}
 	return nil
 }
@@ -357,34 +920,56 @@ func (f *fsm) Restore(r io.ReadCloser) error {
 var _ raft.FSMSnapshot = (*snapshot)(nil)
 
 type snapshot struct {
-	reader io.Reader
+	state fsmState
+	store *storeSnapshot
 }
 
 func (s *snapshot) Persist(sink raft.SnapshotSink) error {
-	if _, err := io.Copy(sink, s.reader); err != nil {
+	if err := s.persist(sink); err != nil {
 		_ = sink.Cancel()
 		return err
 	}
 	return sink.Close()
 }
 
-func (s *snapshot) Release() {}
+func (s *snapshot) persist(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(snapshotHeader); err != nil {
+		return err
+	}
+	if err := s.state.write(bw); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return s.store.Dump(w)
+}
+
+func (s *snapshot) Release() {
+	s.store.Release()
+}
 
 var _ raft.StreamLayer = (*StreamLayer)(nil)
 
 type StreamLayer struct {
 	ln              net.Listener
+	group           uint8
 	serverTLSConfig *tls.Config
 	peerTLSConfig   *tls.Config
 }
 
+// NewStreamLayer creates the transport for a raft group, ln should only
+// receive connections for the group.
 func NewStreamLayer(
 	ln net.Listener,
+	group uint8,
 	serverTLSConfig,
 	peerTLSConfig *tls.Config,
 ) *StreamLayer {
 	return &StreamLayer{
 		ln:              ln,
+		group:           group,
 		serverTLSConfig: serverTLSConfig,
 		peerTLSConfig:   peerTLSConfig,
 	}
@@ -402,14 +987,20 @@ func (s *StreamLayer) Dial(
 		log.Error().Str("addr", string(addr)).Err(err).Msg("unable to dial")
 		return nil, errors.New("failed to dial")
 	}
-	// identify to mux this is a raft rpc
-	_, err = conn.Write([]byte{byte(RaftRPC)})
+	// identify to mux this is a raft rpc and the group it is for
+	_, err = conn.Write([]byte{byte(RaftRPC), s.group})
 	if err != nil {
 		log.Error().Err(err).Msg("unable to write raft rpc")
 		return nil, errors.New("failed to dial")
 	}
 	if s.peerTLSConfig != nil {
-		conn = tls.Client(conn, s.peerTLSConfig)
+		config := s.peerTLSConfig
+		if config.ServerName == "" {
+			// check the certificate against the host being dialed
+			config = config.Clone()
+			config.ServerName, _, _ = net.SplitHostPort(string(addr))
+		}
+		conn = tls.Client(conn, config)
 	}
 	return conn, nil
 }
@@ -417,18 +1008,9 @@ func (s *StreamLayer) Dial(
 func (s *StreamLayer) Accept() (net.Conn, error) {
 	conn, err := s.ln.Accept()
 	if err != nil {
-		log.Fatal().Err(err).Msg("unable to accept message")
+		log.Error().Err(err).Msg("unable to accept message")
 		return nil, errors.New("failed to accept")
 	}
-	b := make([]byte, 1)
-	_, err = conn.Read(b)
-	if err != nil {
-		log.Fatal().Err(err).Msg("unable to read connection")
-		return nil, errors.New("failed to accept")
-	}
-	if bytes.Compare([]byte{byte(RaftRPC)}, b) != 0 {
-		return nil, fmt.Errorf("not a raft rpc")
-	}
 	if s.serverTLSConfig != nil {
 		return tls.Server(conn, s.serverTLSConfig), nil
 	}
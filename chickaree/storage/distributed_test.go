@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestLeaderID(t *testing.T) {
+	config := raft.Configuration{Servers: []raft.Server{
+		{ID: "chickaree-0", Address: "chickaree-0.chickaree:9400"},
+		{ID: "chickaree-1", Address: "chickaree-1.chickaree:9400"},
+	}}
+	if id := leaderID(config, "chickaree-1.chickaree:9400"); id != "chickaree-1" {
+		t.Errorf("expected chickaree-1 got %q", id)
+	}
+	if id := leaderID(config, ""); id != "" {
+		t.Errorf("expected no leader got %q", id)
+	}
+	if id := leaderID(config, "10.0.0.1:8400"); id != "" {
+		t.Errorf("expected unknown leader got %q", id)
+	}
+}
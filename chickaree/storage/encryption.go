@@ -0,0 +1,360 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/hashicorp/raft"
+	boltdb "github.com/hashicorp/raft-boltdb"
+	"github.com/holmes89/chickaree-db/chickaree/encryption"
+	"github.com/rs/zerolog/log"
+)
+
+// With an encryption keyfile string values, lock records, raft log entries,
+// stable store values and snapshots are sealed before they are written.
+// Keys, lock names, sorted set members and scores stay in plaintext as the
+// engine orders and looks them up by them. Every file holds a check value so a wrong keyfile is refused at
+// startup, as is enabling encryption over existing plaintext data.
+//
+// When the primary key changes the data file is encrypted again in the
+// background. Raft log entries are not rewritten, the old key must be kept
+// in the keyfile until raft has compacted them.
+
+var (
+	encryptionBucket = []byte{0x4}
+	checkKey         = []byte("check")
+	stableCheckKey   = []byte("chickaree-encryption-check")
+)
+
+var (
+	ErrEncrypted = errors.New("data is encrypted, an encryption keyfile is required")
+	ErrPlaintext = errors.New("data is not encrypted, encryption can only be enabled on an empty node")
+)
+
+// setupEncryption verifies the check value or writes one to an empty data
+// file.
+func (s *store) setupEncryption(tx Tx) error {
+	var check []byte
+	if b := tx.Bucket(encryptionBucket); b != nil {
+		check = b.Get(checkKey)
+	}
+	if s.keys == nil {
+		if check != nil {
+			return ErrEncrypted
+		}
+		return nil
+	}
+	if check != nil {
+		return s.keys.Verify(check)
+	}
+	if !isEmpty(tx.Bucket(defaultBucket)) {
+		return ErrPlaintext
+	}
+	return s.putCheck(tx)
+}
+
+func (s *store) putCheck(tx Tx) error {
+	b, err := tx.CreateBucketIfNotExists(encryptionBucket)
+	if err != nil {
+		return err
+	}
+	check, err := s.keys.Check()
+	if err != nil {
+		return err
+	}
+	return b.Put(checkKey, check)
+}
+
+// rewriteBatch is the number of values rewritten per transaction.
+const rewriteBatch = 1000
+
+func (s *store) encrypt(value []byte) ([]byte, error) {
+	if s.keys == nil {
+		return value, nil
+	}
+	return s.keys.Encrypt(value)
+}
+
+func (s *store) decrypt(value []byte) ([]byte, error) {
+	if s.keys == nil || value == nil {
+		return value, nil
+	}
+	return s.keys.Decrypt(value)
+}
+
+// Reencrypt seals every value not using the primary key with it, a batch
+// at a time so writes are not blocked for long.
+func (s *store) Reencrypt() error {
+	if s.keys == nil {
+		return nil
+	}
+	s.reencryptLock.Lock()
+	defer s.reencryptLock.Unlock()
+	if err := s.db.Batch(s.putCheck); err != nil {
+		return err
+	}
+	count, err := s.rewriteValues(defaultBucket, nil, s.reencrypt, nil)
+	if err != nil {
+		log.Error().Err(err).Str("path", s.path).Msg("unable to encrypt values again")
+		return errors.New("unable to rotate encryption key")
+	}
+	locks, err := s.rewriteValues(lockBucket, nil, s.reencrypt, nil)
+	if err != nil {
+		log.Error().Err(err).Str("path", s.path).Msg("unable to encrypt locks again")
+		return errors.New("unable to rotate encryption key")
+	}
+	log.Info().Str("path", s.path).Int("values", count).Int("locks", locks).Msg("values encrypted with the primary key")
+	return nil
+}
+
+// reencrypt returns v sealed with the primary key or nil if it already is.
+// Lock records written before they were encrypted are sealed for the first
+// time.
+func (s *store) reencrypt(v []byte) ([]byte, error) {
+	switch {
+	case s.keys.IsPrimary(v):
+		return nil, nil
+	case !encryption.IsEncrypted(v):
+		return s.keys.Encrypt(v)
+	default:
+		return s.keys.Reencrypt(v)
+	}
+}
+
+// rewriteValues replaces each value of a bucket after the given key with
+// the one fn returns, unless it returns nil. checkpoint is called with the last
+// key of each batch in the same transaction so a rewrite can be resumed.
+func (s *store) rewriteValues(bucket, after []byte, fn func(v []byte) ([]byte, error), checkpoint func(tx Tx, last []byte) error) (int, error) {
+	count := 0
+	for {
+		done := true
+		err := s.db.Batch(func(tx Tx) error {
+			b := tx.Bucket(bucket)
+			if b == nil {
+				return nil
+			}
+			var keys, values [][]byte
+			var fnErr error
+			start, seen := after, 0
+			if err := b.Iterate(start, func(k, v []byte) bool {
+				if bytes.Equal(k, start) {
+					return true
+				}
+				if seen == rewriteBatch {
+					done = false
+					return false
+				}
+				seen++
+				after = append([]byte{}, k...)
+				value, err := fn(v)
+				if err != nil {
+					fnErr = err
+					return false
+				}
+				if value != nil {
+					keys = append(keys, after)
+					values = append(values, value)
+				}
+				return true
+			}); err != nil || fnErr != nil {
+				if err == nil {
+					err = fnErr
+				}
+				return err
+			}
+			// the bucket can not change while it is iterated
+			for i := range keys {
+				if err := b.Put(keys[i], values[i]); err != nil {
+					return err
+				}
+			}
+			count += len(keys)
+			if checkpoint != nil && after != nil {
+				return checkpoint(tx, after)
+			}
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+		if done {
+			return count, nil
+		}
+	}
+}
+
+// encryptedLogStore seals the data of raft log entries.
+type encryptedLogStore struct {
+	raft.LogStore
+	keys *encryption.Keyring
+}
+
+func (s *encryptedLogStore) GetLog(index uint64, l *raft.Log) error {
+	if err := s.LogStore.GetLog(index, l); err != nil {
+		return err
+	}
+	if len(l.Data) == 0 {
+		return nil
+	}
+	data, err := s.keys.Decrypt(l.Data)
+	if err != nil {
+		return err
+	}
+	l.Data = data
+	return nil
+}
+
+func (s *encryptedLogStore) StoreLog(l *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{l})
+}
+
+func (s *encryptedLogStore) StoreLogs(logs []*raft.Log) error {
+	sealed := make([]*raft.Log, len(logs))
+	for i, l := range logs {
+		// raft keeps using the entries it stores
+		c := *l
+		if len(c.Data) > 0 {
+			data, err := s.keys.Encrypt(c.Data)
+			if err != nil {
+				return err
+			}
+			c.Data = data
+		}
+		sealed[i] = &c
+	}
+	return s.LogStore.StoreLogs(sealed)
+}
+
+// encryptedStableStore seals stable store values, terms are left as they
+// are.
+type encryptedStableStore struct {
+	raft.StableStore
+	keys *encryption.Keyring
+}
+
+func (s *encryptedStableStore) Set(key, val []byte) error {
+	sealed, err := s.keys.Encrypt(val)
+	if err != nil {
+		return err
+	}
+	return s.StableStore.Set(key, sealed)
+}
+
+func (s *encryptedStableStore) Get(key []byte) ([]byte, error) {
+	val, err := s.StableStore.Get(key)
+	if err != nil || len(val) == 0 {
+		return val, err
+	}
+	return s.keys.Decrypt(val)
+}
+
+// setupRaftEncryption verifies the check value in the stable store or
+// writes one before any entry is logged.
+func setupRaftEncryption(logs raft.LogStore, stable raft.StableStore, keys *encryption.Keyring) error {
+	check, err := stable.Get(stableCheckKey)
+	if err != nil && !errors.Is(err, boltdb.ErrKeyNotFound) {
+		return err
+	}
+	if keys == nil {
+		if len(check) > 0 {
+			return ErrEncrypted
+		}
+		return nil
+	}
+	if len(check) > 0 {
+		return keys.Verify(check)
+	}
+	if last, err := logs.LastIndex(); err != nil || last > 0 {
+		if err != nil {
+			return err
+		}
+		return ErrPlaintext
+	}
+	if check, err = keys.Check(); err != nil {
+		return err
+	}
+	return stable.Set(stableCheckKey, check)
+}
+
+// encryptedSnapshotStore seals snapshots as they are written and opens
+// them as they are read, they hold the whole data file so are sealed in
+// chunks rather than whole. Snapshots sealed whole by earlier versions can
+// still be opened.
+type encryptedSnapshotStore struct {
+	raft.SnapshotStore
+	keys *encryption.Keyring
+}
+
+func (s *encryptedSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+	sink, err := s.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.keys.NewWriter(sink)
+	if err != nil {
+		_ = sink.Cancel()
+		return nil, err
+	}
+	return &encryptedSink{SnapshotSink: sink, w: w}, nil
+}
+
+func (s *encryptedSnapshotStore) Open(id string) (*raft.SnapshotMeta, io.ReadCloser, error) {
+	meta, r, err := s.SnapshotStore.Open(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	br := bufio.NewReader(r)
+	if prefix, _ := br.Peek(encryption.MagicSize); encryption.IsEncrypted(prefix) {
+		defer r.Close()
+		return s.openWhole(id, meta, br)
+	}
+	plaintext, err := s.keys.NewReader(br)
+	if err != nil {
+		r.Close()
+		log.Error().Err(err).Str("snapshot", id).Msg("unable to decrypt snapshot")
+		return nil, nil, err
+	}
+	// raft sends Size bytes to followers
+	meta.Size = encryption.StreamSize(meta.Size)
+	return meta, &snapshotReader{Reader: plaintext, Closer: r}, nil
+}
+
+// openWhole opens a snapshot sealed in one piece.
+func (s *encryptedSnapshotStore) openWhole(id string, meta *raft.SnapshotMeta, r io.Reader) (*raft.SnapshotMeta, io.ReadCloser, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := s.keys.Decrypt(b)
+	if err != nil {
+		log.Error().Err(err).Str("snapshot", id).Msg("unable to decrypt snapshot")
+		return nil, nil, err
+	}
+	meta.Size = int64(len(plaintext))
+	return meta, io.NopCloser(bytes.NewReader(plaintext)), nil
+}
+
+type snapshotReader struct {
+	io.Reader
+	io.Closer
+}
+
+type encryptedSink struct {
+	raft.SnapshotSink
+	w io.WriteCloser
+}
+
+func (s *encryptedSink) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+func (s *encryptedSink) Close() error {
+	if err := s.w.Close(); err != nil {
+		_ = s.SnapshotSink.Cancel()
+		return err
+	}
+	return s.SnapshotSink.Close()
+}
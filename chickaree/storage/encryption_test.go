@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	boltdb "github.com/hashicorp/raft-boltdb"
+	"github.com/holmes89/chickaree-db/chickaree/encryption"
+	bolt "go.etcd.io/bbolt"
+)
+
+func keyLine(t *testing.T) string {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// testKeys writes a keyfile with lines, a new key if there are none.
+func testKeys(t *testing.T, lines ...string) *encryption.Keyring {
+	if len(lines) == 0 {
+		lines = []string{keyLine(t)}
+	}
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := encryption.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func rawValue(t *testing.T, path string, key []byte) []byte {
+	return rawBucketValue(t, path, defaultBucket, key)
+}
+
+func rawBucketValue(t *testing.T, path string, bucket, key []byte) []byte {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var v []byte
+	db.View(func(tx *bolt.Tx) error {
+		v = append([]byte{}, tx.Bucket(bucket).Get(key)...)
+		return nil
+	})
+	return v
+}
+
+func TestEncryptedStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.db")
+	keys := testKeys(t)
+	store, err := newStorage(Config{StoragePath: path, keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set([]byte("a"), []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := store.Get([]byte("a")); err != nil || string(v) != "secret" {
+		t.Errorf("expected value to round trip got %q %v", v, err)
+	}
+	if size, err := store.Size([]byte("a")); err != nil || size != int64(len("a")+len("secret")) {
+		t.Errorf("expected size to leave out encryption got %d %v", size, err)
+	}
+	if err := store.PutLock([]byte("l"), []byte("owner")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := store.GetLock([]byte("l")); err != nil || string(v) != "owner" {
+		t.Errorf("expected lock to round trip got %q %v", v, err)
+	}
+	store.Close()
+	if v := rawValue(t, path, []byte("a")); !encryption.IsEncrypted(v) || bytes.Contains(v, []byte("secret")) {
+		t.Errorf("expected value to be encrypted on disk got %q", v)
+	}
+	if v := rawBucketValue(t, path, lockBucket, []byte("l")); !encryption.IsEncrypted(v) || bytes.Contains(v, []byte("owner")) {
+		t.Errorf("expected lock to be encrypted on disk got %q", v)
+	}
+
+	if _, err := newStorage(Config{StoragePath: path, keys: testKeys(t)}); err != encryption.ErrKeyMismatch {
+		t.Errorf("expected another key to be refused got %v", err)
+	}
+	if _, err := newStorage(Config{StoragePath: path}); err != ErrEncrypted {
+		t.Errorf("expected missing key to be refused got %v", err)
+	}
+
+	plain := filepath.Join(dir, "plain.db")
+	store, err = newStorage(Config{StoragePath: plain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set([]byte("a"), []byte("b"))
+	store.Close()
+	if _, err := newStorage(Config{StoragePath: plain, keys: keys}); err != ErrPlaintext {
+		t.Errorf("expected plaintext data to be refused got %v", err)
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.db")
+	oldKey, newKey := keyLine(t), keyLine(t)
+	store, err := newStorage(Config{StoragePath: path, keys: testKeys(t, oldKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < rewriteBatch+10; i++ {
+		if err := store.Set([]byte{byte(i >> 8), byte(i)}, []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.PutLock([]byte("l"), []byte("owner")); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// the new key goes first, the old one is kept to read existing values
+	both := testKeys(t, newKey, oldKey)
+	store, err = newStorage(Config{StoragePath: path, keys: both})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reencrypt(); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = newStorage(Config{StoragePath: path, keys: testKeys(t, newKey)})
+	if err != nil {
+		t.Fatalf("expected only the new key to be needed: %s", err)
+	}
+	defer store.Close()
+	last := rewriteBatch + 9
+	if v, err := store.Get([]byte{byte(last >> 8), byte(last)}); err != nil || string(v) != "v" {
+		t.Errorf("unexpected value %q %v", v, err)
+	}
+	if v, err := store.GetLock([]byte("l")); err != nil || string(v) != "owner" {
+		t.Errorf("unexpected lock %q %v", v, err)
+	}
+}
+
+func TestEncryptedRaftStores(t *testing.T) {
+	dir := t.TempDir()
+	keys := testKeys(t)
+	logStore, err := boltdb.NewBoltStore(filepath.Join(dir, "logs.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logStore.Close()
+	if err := setupRaftEncryption(logStore, logStore, keys); err != nil {
+		t.Fatal(err)
+	}
+	logs := &encryptedLogStore{LogStore: logStore, keys: keys}
+	entry := &raft.Log{Index: 1, Term: 1, Data: []byte("entry")}
+	if err := logs.StoreLog(entry); err != nil {
+		t.Fatal(err)
+	}
+	if string(entry.Data) != "entry" {
+		t.Error("expected stored entry to be left unchanged")
+	}
+	var raw, got raft.Log
+	logStore.GetLog(1, &raw)
+	if !encryption.IsEncrypted(raw.Data) {
+		t.Errorf("expected entry to be encrypted on disk got %q", raw.Data)
+	}
+	if err := logs.GetLog(1, &got); err != nil || string(got.Data) != "entry" {
+		t.Errorf("expected entry to round trip got %q %v", got.Data, err)
+	}
+	if err := setupRaftEncryption(logStore, logStore, testKeys(t)); err != encryption.ErrKeyMismatch {
+		t.Errorf("expected another key to be refused got %v", err)
+	}
+	if err := setupRaftEncryption(logStore, logStore, nil); err != ErrEncrypted {
+		t.Errorf("expected missing key to be refused got %v", err)
+	}
+
+	snapshots, err := raft.NewFileSnapshotStore(dir, 1, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := &encryptedSnapshotStore{SnapshotStore: snapshots, keys: keys}
+	sink, err := encrypted.Create(1, 1, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Write([]byte("snapshot"))
+	sink.Write(bytes.Repeat([]byte("s"), 200<<10))
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, r, err := snapshots.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+	if !encryption.IsStream(b) || bytes.Contains(b, []byte("snapshot")) {
+		t.Errorf("expected snapshot to be encrypted on disk got %q", b)
+	}
+	meta, r, err := encrypted.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if b, _ := io.ReadAll(r); !bytes.HasPrefix(b, []byte("snapshot")) || len(b) != 8+200<<10 || meta.Size != int64(len(b)) {
+		t.Errorf("expected snapshot to round trip got %d bytes size %d", len(b), meta.Size)
+	}
+
+	// snapshots sealed whole before they were streamed
+	legacy, err := snapshots.Create(1, 2, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := keys.Encrypt([]byte("legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.Write(sealed)
+	if err := legacy.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta, lr, err := encrypted.Open(legacy.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lr.Close()
+	if b, _ := io.ReadAll(lr); string(b) != "legacy" || meta.Size != int64(len(b)) {
+		t.Errorf("expected legacy snapshot to be opened got %q size %d", b, meta.Size)
+	}
+}
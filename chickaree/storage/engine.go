@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// An Engine is the ordered key value store a data file is kept in. Keys are
+// held in named buckets which may be nested, sorted sets are a bucket per
+// key. Engines are registered by name so the config can pick one.
+
+const (
+	BoltEngine   = "bolt"
+	MemoryEngine = "memory"
+)
+
+var (
+	ErrTxNotWritable     = errors.New("transaction is read only")
+	ErrIncompatibleValue = errors.New("key holds a bucket, not a value")
+	ErrBucketNotFound    = errors.New("bucket not found")
+	ErrKeyRequired       = errors.New("key required")
+	ErrEngineClosed      = errors.New("engine closed")
+)
+
+type Engine interface {
+	// Snapshot calls fn with a consistent read only view of the engine.
+	Snapshot(fn func(tx Tx) error) error
+	// Batch calls fn in a transaction, its writes are applied together if
+	// fn returns nil and discarded otherwise.
+	Batch(fn func(tx Tx) error) error
+	Close() error
+}
+
+// Tx holds the top level buckets, they only hold other buckets.
+type Tx interface {
+	// Bucket returns nil if the bucket does not exist.
+	Bucket(name []byte) Bucket
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	DeleteBucket(name []byte) error
+	// Iterate calls fn with the name of each bucket from start, values are
+	// always nil.
+	Iterate(start []byte, fn func(key, value []byte) bool) error
+}
+
+// Bucket keys are iterated in byte order. Values are only valid for the
+// life of the transaction and must not be modified, nor may a bucket be
+// changed while it is iterated.
+type Bucket interface {
+	// Get returns nil if key does not exist or holds a bucket.
+	Get(key []byte) []byte
+	// Put stores a value, it must not be changed until the batch ends.
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	// Iterate calls fn for each key from start, or the first key when nil,
+	// until fn returns false. Nested buckets have a nil value.
+	Iterate(start []byte, fn func(key, value []byte) bool) error
+	// Bucket returns nil if the nested bucket does not exist.
+	Bucket(name []byte) Bucket
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	DeleteBucket(name []byte) error
+}
+
+// EngineFactory opens an engine for a data file, engines keeping nothing on
+// disk ignore the path.
+type EngineFactory func(path string) (Engine, error)
+
+var (
+	enginesMu sync.RWMutex
+	engines   = map[string]EngineFactory{
+		BoltEngine:   openBolt,
+		MemoryEngine: openMemory,
+	}
+)
+
+// RegisterEngine makes an engine available to the config by name.
+func RegisterEngine(name string, factory EngineFactory) {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+	engines[name] = factory
+}
+
+// Engines returns the names of the registered engines.
+func Engines() []string {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenEngine opens a data file with a registered engine, bolt when name is
+// empty.
+func OpenEngine(name, path string) (Engine, error) {
+	if name == "" {
+		name = BoltEngine
+	}
+	enginesMu.RLock()
+	factory, ok := engines[name]
+	enginesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage engine %s", name)
+	}
+	return factory(path)
+}
+
+func validEngine(name string) bool {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+	_, ok := engines[name]
+	return ok
+}
+
+// isEmpty reports whether a bucket has no keys.
+func isEmpty(b Bucket) bool {
+	empty := true
+	b.Iterate(nil, func(key, value []byte) bool {
+		empty = false
+		return false
+	})
+	return empty
+}
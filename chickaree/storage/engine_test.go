@@ -0,0 +1,450 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestEngines runs the conformance suite against every registered engine.
+func TestEngines(t *testing.T) {
+	for _, name := range Engines() {
+		t.Run(name, func(t *testing.T) {
+			open := func(t *testing.T) Engine {
+				e, err := OpenEngine(name, filepath.Join(t.TempDir(), "data.db"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return e
+			}
+			for test, fn := range engineTests {
+				t.Run(test, func(t *testing.T) {
+					e := open(t)
+					defer e.Close()
+					fn(t, e)
+				})
+			}
+			t.Run("store", func(t *testing.T) {
+				testEngineStore(t, name)
+			})
+			t.Run("close", func(t *testing.T) {
+				e := open(t)
+				e.Close()
+				if err := e.Snapshot(func(tx Tx) error { return nil }); err != ErrEngineClosed {
+					t.Errorf("expected closed error got %v", err)
+				}
+			})
+		})
+	}
+}
+
+var engineTests = map[string]func(t *testing.T, e Engine){
+	"values":    testEngineValues,
+	"iterate":   testEngineIterate,
+	"buckets":   testEngineBuckets,
+	"top level": testEngineTopLevel,
+	"batch":     testEngineBatch,
+	"snapshot":  testEngineSnapshot,
+	"isolation": testEngineIsolation,
+}
+
+var testBucket = []byte("test")
+
+func mustBatch(t *testing.T, e Engine, fn func(b Bucket) error) {
+	t.Helper()
+	if err := e.Batch(func(tx Tx) error {
+		b, err := tx.CreateBucketIfNotExists(testBucket)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(t *testing.T, e Engine, key string) (value []byte) {
+	t.Helper()
+	if err := e.Snapshot(func(tx Tx) error {
+		if b := tx.Bucket(testBucket); b != nil {
+			if v := b.Get([]byte(key)); v != nil {
+				value = append([]byte{}, v...)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func keys(t *testing.T, e Engine, start []byte) (res []string) {
+	t.Helper()
+	if err := e.Snapshot(func(tx Tx) error {
+		return tx.Bucket(testBucket).Iterate(start, func(k, v []byte) bool {
+			res = append(res, string(k))
+			return true
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func testEngineValues(t *testing.T, e Engine) {
+	value := []byte("value")
+	mustBatch(t, e, func(b Bucket) error {
+		if err := b.Put([]byte("a"), value); err != nil {
+			return err
+		}
+		return b.Put([]byte("b"), []byte("b"))
+	})
+	// callers may reuse their buffers once the batch ends
+	value[0] = 'V'
+	if v := get(t, e, "a"); string(v) != "value" {
+		t.Errorf("should be value not %q", v)
+	}
+	if v := get(t, e, "missing"); v != nil {
+		t.Errorf("expected missing key to be nil got %q", v)
+	}
+	mustBatch(t, e, func(b Bucket) error {
+		if err := b.Put([]byte("a"), []byte("replaced")); err != nil {
+			return err
+		}
+		if err := b.Delete([]byte("missing")); err != nil {
+			return err
+		}
+		return b.Delete([]byte("b"))
+	})
+	if v := get(t, e, "a"); string(v) != "replaced" {
+		t.Errorf("should be replaced not %q", v)
+	}
+	if v := get(t, e, "b"); v != nil {
+		t.Errorf("expected deleted key to be nil got %q", v)
+	}
+	if err := e.Batch(func(tx Tx) error {
+		return tx.Bucket(testBucket).Put(nil, []byte("v"))
+	}); err != ErrKeyRequired {
+		t.Errorf("expected key required got %v", err)
+	}
+}
+
+func testEngineIterate(t *testing.T, e Engine) {
+	mustBatch(t, e, func(b Bucket) error {
+		for _, k := range []string{"d", "b", "a", "c", "ab"} {
+			if err := b.Put([]byte(k), []byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if res := keys(t, e, nil); !reflect.DeepEqual(res, []string{"a", "ab", "b", "c", "d"}) {
+		t.Errorf("unexpected order %v", res)
+	}
+	if res := keys(t, e, []byte("b")); !reflect.DeepEqual(res, []string{"b", "c", "d"}) {
+		t.Errorf("unexpected keys from b %v", res)
+	}
+	if res := keys(t, e, []byte("bb")); !reflect.DeepEqual(res, []string{"c", "d"}) {
+		t.Errorf("unexpected keys from bb %v", res)
+	}
+	if res := keys(t, e, []byte("e")); len(res) != 0 {
+		t.Errorf("expected no keys got %v", res)
+	}
+	var first []string
+	e.Snapshot(func(tx Tx) error {
+		return tx.Bucket(testBucket).Iterate(nil, func(k, v []byte) bool {
+			first = append(first, string(k))
+			return len(first) < 2
+		})
+	})
+	if !reflect.DeepEqual(first, []string{"a", "ab"}) {
+		t.Errorf("expected iterate to stop got %v", first)
+	}
+}
+
+func testEngineBuckets(t *testing.T, e Engine) {
+	mustBatch(t, e, func(b Bucket) error {
+		nested, err := b.CreateBucketIfNotExists([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		if err := nested.Put([]byte("k"), []byte("v")); err != nil {
+			return err
+		}
+		if _, err := b.CreateBucketIfNotExists([]byte("nested")); err != nil {
+			return err
+		}
+		return b.Put([]byte("value"), []byte("v"))
+	})
+	if err := e.Snapshot(func(tx Tx) error {
+		if tx.Bucket([]byte("missing")) != nil {
+			t.Errorf("expected missing bucket to be nil")
+		}
+		b := tx.Bucket(testBucket)
+		if v := b.Get([]byte("nested")); v != nil {
+			t.Errorf("expected bucket to have no value got %q", v)
+		}
+		b.Iterate(nil, func(k, v []byte) bool {
+			if string(k) == "nested" && v != nil {
+				t.Errorf("expected bucket to iterate with nil value got %q", v)
+			}
+			return true
+		})
+		nested := b.Bucket([]byte("nested"))
+		if nested == nil {
+			t.Fatal("expected nested bucket")
+		}
+		if v := nested.Get([]byte("k")); string(v) != "v" {
+			t.Errorf("should be v not %q", v)
+		}
+		if b.Bucket([]byte("value")) != nil {
+			t.Errorf("expected value not to be a bucket")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, fn := range map[string]func(b Bucket) error{
+		"put over bucket":    func(b Bucket) error { return b.Put([]byte("nested"), []byte("v")) },
+		"delete bucket key":  func(b Bucket) error { return b.Delete([]byte("nested")) },
+		"create over value":  func(b Bucket) error { _, err := b.CreateBucketIfNotExists([]byte("value")); return err },
+		"delete value":       func(b Bucket) error { return b.DeleteBucket([]byte("value")) },
+		"delete missing":     func(b Bucket) error { return b.DeleteBucket([]byte("missing")) },
+		"create without key": func(b Bucket) error { _, err := b.CreateBucketIfNotExists(nil); return err },
+	} {
+		err := e.Batch(func(tx Tx) error { return fn(tx.Bucket(testBucket)) })
+		if err != ErrIncompatibleValue && err != ErrBucketNotFound && err != ErrKeyRequired {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+
+	mustBatch(t, e, func(b Bucket) error {
+		return b.DeleteBucket([]byte("nested"))
+	})
+	if res := keys(t, e, nil); !reflect.DeepEqual(res, []string{"value"}) {
+		t.Errorf("expected bucket to be deleted got %v", res)
+	}
+}
+
+func testEngineTopLevel(t *testing.T, e Engine) {
+	if err := e.Batch(func(tx Tx) error {
+		for _, name := range []string{"b", "a", "c"} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return tx.DeleteBucket([]byte("c"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	if err := e.Snapshot(func(tx Tx) error {
+		return tx.Iterate(nil, func(k, v []byte) bool {
+			if v != nil {
+				t.Errorf("expected bucket %s to have no value got %q", k, v)
+			}
+			names = append(names, string(k))
+			return true
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("unexpected buckets %v", names)
+	}
+	if err := e.Batch(func(tx Tx) error { return tx.DeleteBucket([]byte("missing")) }); err != ErrBucketNotFound {
+		t.Errorf("expected bucket not found got %v", err)
+	}
+	if err := e.Snapshot(func(tx Tx) error { return tx.DeleteBucket([]byte("a")) }); err != ErrTxNotWritable {
+		t.Errorf("expected read only error got %v", err)
+	}
+}
+
+func testEngineBatch(t *testing.T, e Engine) {
+	mustBatch(t, e, func(b Bucket) error {
+		return b.Put([]byte("a"), []byte("1"))
+	})
+	failed := errors.New("failed")
+	if err := e.Batch(func(tx Tx) error {
+		b := tx.Bucket(testBucket)
+		if err := b.Put([]byte("a"), []byte("2")); err != nil {
+			return err
+		}
+		if err := b.Put([]byte("b"), []byte("2")); err != nil {
+			return err
+		}
+		nested, err := b.CreateBucketIfNotExists([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		if err := nested.Put([]byte("k"), []byte("v")); err != nil {
+			return err
+		}
+		// writes are visible within the batch
+		if v := b.Get([]byte("a")); string(v) != "2" {
+			t.Errorf("should be 2 not %q", v)
+		}
+		return failed
+	}); err != failed {
+		t.Errorf("expected batch error got %v", err)
+	}
+	if v := get(t, e, "a"); string(v) != "1" {
+		t.Errorf("expected failed batch to be discarded got %q", v)
+	}
+	if res := keys(t, e, nil); !reflect.DeepEqual(res, []string{"a"}) {
+		t.Errorf("expected failed batch to be discarded got %v", res)
+	}
+}
+
+func testEngineSnapshot(t *testing.T, e Engine) {
+	mustBatch(t, e, func(b Bucket) error {
+		_, err := b.CreateBucketIfNotExists([]byte("nested"))
+		return err
+	})
+	for name, fn := range map[string]func(tx Tx) error{
+		"put":           func(tx Tx) error { return tx.Bucket(testBucket).Put([]byte("a"), []byte("1")) },
+		"delete":        func(tx Tx) error { return tx.Bucket(testBucket).Delete([]byte("a")) },
+		"create":        func(tx Tx) error { _, err := tx.CreateBucketIfNotExists([]byte("other")); return err },
+		"create nested": func(tx Tx) error { _, err := tx.Bucket(testBucket).CreateBucketIfNotExists([]byte("n")); return err },
+		"delete bucket": func(tx Tx) error { return tx.Bucket(testBucket).DeleteBucket([]byte("nested")) },
+	} {
+		if err := e.Snapshot(fn); err != ErrTxNotWritable {
+			t.Errorf("%s: expected read only error got %v", name, err)
+		}
+	}
+}
+
+// testEngineIsolation checks snapshots taken while batches are applied
+// never see half a batch.
+func testEngineIsolation(t *testing.T, e Engine) {
+	put := func(b Bucket, i int) error {
+		nested, err := b.CreateBucketIfNotExists([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		v := []byte(fmt.Sprint(i))
+		if err := nested.Put([]byte("k"), v); err != nil {
+			return err
+		}
+		return b.Put([]byte("a"), v)
+	}
+	mustBatch(t, e, func(b Bucket) error { return put(b, 0) })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			mustBatch(t, e, func(b Bucket) error { return put(b, i) })
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		if err := e.Snapshot(func(tx Tx) error {
+			b := tx.Bucket(testBucket)
+			a, k := string(b.Get([]byte("a"))), string(b.Bucket([]byte("nested")).Get([]byte("k")))
+			if a != k {
+				t.Errorf("snapshot saw part of a batch %s != %s", a, k)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v := get(t, e, "a"); string(v) != "100" {
+		t.Errorf("should be 100 not %q", v)
+	}
+}
+
+// testEngineStore checks the data model works the same on every engine.
+func testEngineStore(t *testing.T, engine string) {
+	store, err := newStorage(Config{
+		Engine:      engine,
+		StoragePath: filepath.Join(t.TempDir(), "data.db"),
+		compressor:  flateCompressor(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := store.Set([]byte(fmt.Sprintf("key:%d", i)), []byte(fmt.Sprintf("value:%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, err := store.Get([]byte("key:1")); err != nil || string(v) != "value:1" {
+		t.Errorf("should be value:1 not %q %v", v, err)
+	}
+	members := []ScoredMember{{Member: []byte("b"), Score: 2}, {Member: []byte("a"), Score: 1}, {Member: []byte("c"), Score: -1}}
+	if n, err := store.ZAdd([]byte("zset"), members, ZAddOptions{}); err != nil || n != 3 {
+		t.Errorf("should be 3 not %d %v", n, err)
+	}
+	if _, err := store.ZAdd([]byte("key:0"), members, ZAddOptions{}); err != ErrWrongType {
+		t.Errorf("expected wrong type got %v", err)
+	}
+	var ranged []string
+	if err := store.ZRangeByScore([]byte("zset"), 0, 10, func(m ScoredMember) bool {
+		ranged = append(ranged, string(m.Member))
+		return true
+	}); err != nil || !reflect.DeepEqual(ranged, []string{"a", "b"}) {
+		t.Errorf("unexpected range %v %v", ranged, err)
+	}
+	if ok, err := store.Expire([]byte("zset"), 1000); err != nil || !ok {
+		t.Errorf("expected expiry to be set %v", err)
+	}
+	if at, err := store.ExpiresAt([]byte("zset")); err != nil || at != 1000 {
+		t.Errorf("should be 1000 not %d %v", at, err)
+	}
+	if err := store.Set([]byte("zset"), []byte("string")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := store.ZScore([]byte("zset"), []byte("a")); ok || err != ErrWrongType {
+		t.Errorf("expected set to be replaced by string got %v", err)
+	}
+	if err := store.Delete([]byte("key:2")); err != nil {
+		t.Fatal(err)
+	}
+	var all []string
+	if err := store.Keys(func(key []byte) bool {
+		all = append(all, string(key))
+		return true
+	}); err != nil || !reflect.DeepEqual(all, []string{"key:0", "key:1", "zset"}) {
+		t.Errorf("unexpected keys %v %v", all, err)
+	}
+	if err := store.PutLock([]byte("lock"), []byte("state")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := store.GetLock([]byte("lock")); err != nil || string(v) != "state" {
+		t.Errorf("should be state not %q %v", v, err)
+	}
+}
+
+func TestOpenEngine(t *testing.T) {
+	if _, err := OpenEngine("missing", ""); err == nil {
+		t.Errorf("expected error")
+	}
+	opened := false
+	RegisterEngine("test", func(path string) (Engine, error) {
+		opened = true
+		return openMemory(path)
+	})
+	defer func() {
+		enginesMu.Lock()
+		delete(engines, "test")
+		enginesMu.Unlock()
+	}()
+	e, err := OpenEngine("test", "")
+	if err != nil || !opened {
+		t.Fatalf("expected registered engine to open %v", err)
+	}
+	e.Close()
+	if !validEngine("test") || validEngine("missing") {
+		t.Errorf("unexpected engine validity")
+	}
+}
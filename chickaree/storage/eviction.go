@@ -0,0 +1,405 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Eviction follows the redis maxmemory policies. Each node tracks access
+// statistics for the keys it serves but only the leader decides what to
+// evict, proposing deletes through the log so replicas evict identically.
+
+const (
+	NoEviction     = "noeviction"
+	AllKeysLRU     = "allkeys-lru"
+	AllKeysLFU     = "allkeys-lfu"
+	VolatileTTL    = "volatile-ttl"
+	VolatileLRU    = "volatile-lru"
+	defaultSamples = 5
+
+	lfuInitValue  = 5
+	lfuLogFactor  = 10
+	lfuDecayTime  = time.Minute
+	evictInterval = 100 * time.Millisecond
+	evictBatch    = 16
+)
+
+var ErrOOM = errors.New("OOM command not allowed when used memory > 'maxmemory'.")
+
+// ByteSize reads sizes using redis units such as 100mb or 1gb.
+type ByteSize int64
+
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+		{"g", 1000 * 1000 * 1000}, {"m", 1000 * 1000}, {"k", 1000}, {"b", 1},
+	}
+	multiplier := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSuffix(s, u.suffix)
+			multiplier = u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return ByteSize(n * multiplier), nil
+}
+
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	size, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+func validPolicy(policy string) bool {
+	switch policy {
+	case NoEviction, AllKeysLRU, AllKeysLFU, VolatileTTL, VolatileLRU:
+		return true
+	}
+	return false
+}
+
+type keyStats struct {
+	size       int64
+	lastAccess time.Time
+	lfuCounter uint8
+	lfuDecay   time.Time
+	expiresAt  int64
+}
+
+// trackedStore records the size and access statistics of every key.
+type trackedStore struct {
+	storage
+	// trackedStats are shared with views of a batch.
+	*trackedStats
+}
+
+type trackedStats struct {
+	mu   sync.Mutex
+	used int64
+	keys map[string]*keyStats
+}
+
+func newTrackedStore(store storage) (*trackedStore, error) {
+	s := &trackedStore{
+		storage:      store,
+		trackedStats: &trackedStats{keys: make(map[string]*keyStats)},
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load replaces the statistics with those of the keys in the store.
+func (s *trackedStore) load() error {
+	var keys [][]byte
+	if err := s.storage.Keys(func(key []byte) bool {
+		keys = append(keys, key)
+		return true
+	}); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.used = 0
+	s.keys = make(map[string]*keyStats)
+	s.mu.Unlock()
+	for _, key := range keys {
+		if err := s.resize(key); err != nil {
+			return err
+		}
+		at, err := s.storage.ExpiresAt(key)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.keys[string(key)].expiresAt = at
+		s.mu.Unlock()
+	}
+	log.Info().Int("keys", len(keys)).Int64("used", s.Used()).Msg("loaded key statistics")
+	return nil
+}
+
+func (s *trackedStore) Used() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+func (s *trackedStore) stats(key []byte) *keyStats {
+	stats, ok := s.keys[string(key)]
+	if !ok {
+		now := time.Now()
+		stats = &keyStats{
+			lastAccess: now,
+			lfuCounter: lfuInitValue,
+			lfuDecay:   now,
+		}
+		s.keys[string(key)] = stats
+	}
+	return stats
+}
+
+// touch updates the lru clock and the logarithmic lfu counter as redis does.
+func (s *trackedStore) touch(key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats, ok := s.keys[string(key)]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	stats.lastAccess = now
+	stats.lfuCounter = stats.decayedCounter(now)
+	stats.lfuDecay = now
+	if stats.lfuCounter < math.MaxUint8 {
+		base := float64(int(stats.lfuCounter) - lfuInitValue)
+		if base < 0 {
+			base = 0
+		}
+		if rand.Float64() < 1/(base*lfuLogFactor+1) {
+			stats.lfuCounter++
+		}
+	}
+}
+
+func (k *keyStats) decayedCounter(now time.Time) uint8 {
+	periods := int(now.Sub(k.lfuDecay) / lfuDecayTime)
+	if periods >= int(k.lfuCounter) {
+		return 0
+	}
+	return k.lfuCounter - uint8(periods)
+}
+
+func (s *trackedStore) resize(key []byte) error {
+	size, err := s.storage.Size(key)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats(key)
+	s.used += size - stats.size
+	stats.size = size
+	return nil
+}
+
+func (s *trackedStore) Set(key, value []byte) error {
+	if err := s.storage.Set(key, value); err != nil {
+		return err
+	}
+	if err := s.resize(key); err != nil {
+		return err
+	}
+	s.touch(key)
+	return nil
+}
+
+func (s *trackedStore) Get(key []byte) ([]byte, error) {
+	s.touch(key)
+	return s.storage.Get(key)
+}
+
+func (s *trackedStore) ZAdd(key []byte, members []ScoredMember, opts ZAddOptions) (int64, error) {
+	count, err := s.storage.ZAdd(key, members, opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.resize(key); err != nil {
+		return 0, err
+	}
+	s.touch(key)
+	return count, nil
+}
+
+func (s *trackedStore) ZScore(key, member []byte) (float64, bool, error) {
+	s.touch(key)
+	return s.storage.ZScore(key, member)
+}
+
+func (s *trackedStore) ZRangeByScore(key []byte, min, max float64, fn func(ScoredMember) bool) error {
+	s.touch(key)
+	return s.storage.ZRangeByScore(key, min, max, fn)
+}
+
+func (s *trackedStore) Delete(key []byte) error {
+	if err := s.storage.Delete(key); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stats, ok := s.keys[string(key)]; ok {
+		s.used -= stats.size
+		delete(s.keys, string(key))
+	}
+	return nil
+}
+
+func (s *trackedStore) Expire(key []byte, at int64) (bool, error) {
+	ok, err := s.storage.Expire(key, at)
+	if err != nil || !ok {
+		return ok, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stats, ok := s.keys[string(key)]; ok {
+		stats.expiresAt = at
+	}
+	return true, nil
+}
+
+// expired returns up to limit keys whose expiry has passed.
+func (s *trackedStore) expired(now time.Time, limit int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	ms := now.UnixNano() / int64(time.Millisecond)
+	for key, stats := range s.keys {
+		if stats.expiresAt != 0 && stats.expiresAt <= ms {
+			keys = append(keys, key)
+			if len(keys) >= limit {
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// victims samples keys picking the best candidates for the policy. Map
+// iteration order is random which gives the same approximation as the
+// sampling redis does.
+func (s *trackedStore) victims(policy string, samples, count int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	picked := make(map[string]bool)
+	var res []string
+	for len(res) < count {
+		var best string
+		var bestScore float64
+		sampled := 0
+		for key, stats := range s.keys {
+			if picked[key] {
+				continue
+			}
+			volatile := policy == VolatileTTL || policy == VolatileLRU
+			if volatile && stats.expiresAt == 0 {
+				continue
+			}
+			var score float64
+			switch policy {
+			case AllKeysLRU, VolatileLRU:
+				score = float64(now.Sub(stats.lastAccess))
+			case AllKeysLFU:
+				score = float64(math.MaxUint8 - stats.decayedCounter(now))
+			case VolatileTTL:
+				score = -float64(stats.expiresAt)
+			}
+			if best == "" || score > bestScore {
+				best, bestScore = key, score
+			}
+			sampled++
+			if sampled >= samples {
+				break
+			}
+		}
+		if best == "" {
+			break
+		}
+		picked[best] = true
+		res = append(res, best)
+	}
+	return res
+}
+
+// evict removes expired keys and then, while the dataset is over the limit,
+// the keys picked by the eviction policy. It must only be run on the leader.
+func (s *DistributedStorage) evict() error {
+	s.evictLock.Lock()
+	defer s.evictLock.Unlock()
+	if expired := s.store.expired(time.Now(), evictBatch*8); len(expired) > 0 {
+		if _, err := s.delete(expired); err != nil {
+			return err
+		}
+	}
+	max := int64(s.config.MaxMemory)
+	if max == 0 || s.config.MaxMemoryPolicy == NoEviction {
+		return nil
+	}
+	for s.store.Used() > max {
+		keys := s.store.victims(s.config.MaxMemoryPolicy, s.samples(), evictBatch)
+		if len(keys) == 0 {
+			return nil
+		}
+		log.Info().Strs("keys", keys).Str("policy", s.config.MaxMemoryPolicy).Msg("evicting keys")
+		if _, err := s.delete(keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DistributedStorage) samples() int {
+	if s.config.MaxMemorySamples > 0 {
+		return s.config.MaxMemorySamples
+	}
+	return defaultSamples
+}
+
+// checkMemory is called before proposing writes, evicting if possible and
+// otherwise rejecting the write.
+func (s *DistributedStorage) checkMemory() error {
+	max := int64(s.config.MaxMemory)
+	if max == 0 || s.store.Used() <= max {
+		return nil
+	}
+	if err := s.evict(); err != nil {
+		return err
+	}
+	if s.store.Used() > max {
+		return ErrOOM
+	}
+	return nil
+}
+
+func (s *DistributedStorage) runEvictions() {
+	ticker := time.NewTicker(evictInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			// a secondary deletes keys as the primary does
+			if !s.IsLeader() || s.ReadOnly() {
+				continue
+			}
+			if err := s.evict(); err != nil {
+				log.Error().Err(err).Msg("unable to evict keys")
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]ByteSize{
+		"100":   100,
+		"1k":    1000,
+		"1kb":   1024,
+		"100mb": 100 << 20,
+		"2GB":   2 << 30,
+	}
+	for in, expected := range tests {
+		res, err := ParseByteSize(in)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if res != expected {
+			t.Errorf("%s should be %d not %d", in, expected, res)
+		}
+	}
+	if _, err := ParseByteSize("lots"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func trackedTestStore(t *testing.T) *trackedStore {
+	store, err := newStorage(Config{StoragePath: filepath.Join(t.TempDir(), "evict.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	tracked, err := newTrackedStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tracked
+}
+
+func TestTrackedStoreUsed(t *testing.T) {
+	s := trackedTestStore(t)
+	if err := s.Set([]byte("a"), []byte("1234")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set([]byte("b"), []byte("12")); err != nil {
+		t.Fatal(err)
+	}
+	if used := s.Used(); used != 8 {
+		t.Errorf("should be 8 not %d", used)
+	}
+	if err := s.Set([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if used := s.Used(); used != 2 {
+		t.Errorf("should be 2 not %d", used)
+	}
+
+	// statistics are rebuilt from the store on startup
+	reloaded, err := newTrackedStore(s.storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used := reloaded.Used(); used != 2 {
+		t.Errorf("should be 2 not %d", used)
+	}
+}
+
+func TestVictims(t *testing.T) {
+	s := trackedTestStore(t)
+	for i := 0; i < 10; i++ {
+		if err := s.Set([]byte(fmt.Sprintf("key:%d", i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.keys["key:3"].lastAccess = time.Now().Add(-time.Hour)
+	if res := s.victims(AllKeysLRU, 10, 1); len(res) != 1 || res[0] != "key:3" {
+		t.Errorf("expected least recently used key got %v", res)
+	}
+
+	if res := s.victims(VolatileTTL, 10, 1); len(res) != 0 {
+		t.Errorf("volatile policies should ignore keys without expiry %v", res)
+	}
+	if _, err := s.Expire([]byte("key:5"), 200); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Expire([]byte("key:6"), 100); err != nil {
+		t.Fatal(err)
+	}
+	if res := s.victims(VolatileTTL, 10, 1); len(res) != 1 || res[0] != "key:6" {
+		t.Errorf("expected key closest to expiring got %v", res)
+	}
+	if res := s.expired(time.Now(), 10); len(res) != 2 {
+		t.Errorf("expected expired keys got %v", res)
+	}
+
+	s.keys["key:7"].lfuCounter = 0
+	if res := s.victims(AllKeysLFU, 10, 1); len(res) != 1 || res[0] != "key:7" {
+		t.Errorf("expected least frequently used key got %v", res)
+	}
+}
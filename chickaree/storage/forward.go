@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/raft"
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Only the leader can apply writes so followers and read replicas forward
+// them to the leader's rpc address, which is also its raft address, while
+// serving reads from their own copy. Requests are only forwarded once so a
+// leadership change mid-request surfaces as an error rather than bouncing
+// between nodes.
+
+const forwardedKey = "chickaree-forwarded"
+
+var ErrNoLeader = errors.New("no leader available")
+
+// writeMethods are the ChickareeDB rpcs that go through raft.
+var writeMethods = map[string]bool{
+	"/client.v1.ChickareeDB/Set":         true,
+	"/client.v1.ChickareeDB/SetBit":      true,
+	"/client.v1.ChickareeDB/BitOp":       true,
+	"/client.v1.ChickareeDB/BitField":    true,
+	"/client.v1.ChickareeDB/PFAdd":       true,
+	"/client.v1.ChickareeDB/PFMerge":     true,
+	"/client.v1.ChickareeDB/GeoAdd":      true,
+	"/client.v1.ChickareeDB/Lock":        true,
+	"/client.v1.ChickareeDB/Unlock":      true,
+	"/client.v1.ChickareeDB/Refresh":     true,
+	"/client.v1.ChickareeDB/Expire":      true,
+	"/client.v1.ChickareeDB/SetUser":     true,
+	"/client.v1.ChickareeDB/DeleteUsers": true,
+}
+
+// isWrite reports whether a request goes through raft, read only BITFIELD
+// calls are served like any other read.
+func isWrite(method string, req interface{}) bool {
+	if r, ok := req.(*api.BitFieldRequest); ok && r.ReadOnly {
+		return false
+	}
+	return writeMethods[method]
+}
+
+// connPool keeps a connection to each leader, with several raft groups
+// there can be a different leader for every group.
+type connPool struct {
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+	opts  []grpc.DialOption
+}
+
+func (p *connPool) get(addr string) (*grpc.ClientConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if conn, ok := p.conns[addr]; ok {
+		return conn, nil
+	}
+	opts := p.opts
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		log.Error().Err(err).Str("leader", addr).Msg("unable to dial leader")
+		return nil, errors.New("unable to forward to leader")
+	}
+	if p.conns == nil {
+		p.conns = make(map[string]*grpc.ClientConn)
+	}
+	p.conns[addr] = conn
+	return conn, nil
+}
+
+func (p *connPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	for addr, conn := range p.conns {
+		if cerr := conn.Close(); cerr != nil {
+			err = cerr
+		}
+		delete(p.conns, addr)
+	}
+	return err
+}
+
+// leader returns a connection to the leader of the group and the context to
+// call it with, or nil if this node is the leader.
+func (s *Server) leader(ctx context.Context, store *DistributedStorage) (*grpc.ClientConn, context.Context, error) {
+	if store.IsLeader() {
+		return nil, ctx, nil
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(forwardedKey)) > 0 {
+		return nil, ctx, raft.ErrNotLeader
+	}
+	addr := store.Leader()
+	if addr == "" {
+		return nil, ctx, ErrNoLeader
+	}
+	conn, err := s.leaderConns.get(addr)
+	if err != nil {
+		return nil, ctx, err
+	}
+	log.Debug().Str("leader", addr).Msg("forwarding request to leader")
+	return conn, metadata.AppendToOutgoingContext(forwardCaller(ctx), forwardedKey, "true"), nil
+}
+
+// ForwardWrites is a unary interceptor sending writes made to a follower
+// to the leader of the key's group.
+func (s *Server) ForwardWrites(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !isWrite(info.FullMethod, req) {
+		return handler(ctx, req)
+	}
+	// the slot only accepts writes from the target once it has flipped
+	if asking(ctx) && s.slots.migrating(requestKeys(req)) {
+		return nil, ErrTryAgain
+	}
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	conn, ctx, err := s.leader(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	if conn == nil {
+		return handler(ctx, req)
+	}
+	reply, err := newReply(info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Invoke(ctx, info.FullMethod, req, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func asking(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(api.AskingKey)) > 0
+}
+
+// newReply creates an empty response for a method such as
+// /client.v1.ChickareeDB/Set.
+func newReply(method string) (proto.Message, error) {
+	parts := strings.Split(strings.TrimPrefix(method, "/"), "/")
+	if len(parts) != 2 {
+		return nil, errors.New("invalid method")
+	}
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(parts[0]))
+	if err != nil {
+		return nil, err
+	}
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, errors.New("invalid method")
+	}
+	m := service.Methods().ByName(protoreflect.Name(parts[1]))
+	if m == nil {
+		return nil, errors.New("invalid method")
+	}
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(m.Output().FullName())
+	if err != nil {
+		return nil, err
+	}
+	return mt.New().Interface(), nil
+}
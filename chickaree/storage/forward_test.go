@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"testing"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+)
+
+func TestNewReply(t *testing.T) {
+	for method := range writeMethods {
+		if _, err := newReply(method); err != nil {
+			t.Errorf("%s: %s", method, err)
+		}
+	}
+	reply, err := newReply("/client.v1.ChickareeDB/Lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reply.(*api.LockResponse); !ok {
+		t.Errorf("expected lock response got %T", reply)
+	}
+	if _, err := newReply("/client.v1.ChickareeDB/Missing"); err == nil {
+		t.Errorf("expected error for unknown method")
+	}
+}
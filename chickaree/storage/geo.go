@@ -0,0 +1,330 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Geo values are stored in sorted sets using the same 52 bit interleaved
+// geohash scores as redis so coordinates round trip identically.
+
+const (
+	geoStepMax     = 26
+	geoLatMin      = -85.05112878
+	geoLatMax      = 85.05112878
+	geoLongMin     = -180.0
+	geoLongMax     = 180.0
+	earthRadius    = 6372797.560856
+	mercatorMax    = 20037726.37
+	geoAlphabet    = "0123456789bcdefghjkmnpqrstuvwxyz"
+	geoHashLength  = 11
+	geoMaxSearches = 16
+)
+
+var (
+	ErrGeoMember = errors.New("could not decode requested zset member")
+	ErrGeoUnit   = errors.New("unsupported unit provided. please use M, KM, FT, MI")
+)
+
+func ErrGeoCoordinates(long, lat float64) error {
+	return fmt.Errorf("invalid longitude,latitude pair %f,%f", long, lat)
+}
+
+func validCoordinates(long, lat float64) bool {
+	return long >= geoLongMin && long <= geoLongMax && lat >= geoLatMin && lat <= geoLatMax
+}
+
+// geoUnit returns the number of meters in the unit.
+func geoUnit(unit string) (float64, error) {
+	switch strings.ToLower(unit) {
+	case "", "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, ErrGeoUnit
+}
+
+// geoEncode returns the cell index of each coordinate for the step.
+func geoEncode(long, lat float64, step uint) (uint64, uint64) {
+	latOffset := (lat - geoLatMin) / (geoLatMax - geoLatMin)
+	longOffset := (long - geoLongMin) / (geoLongMax - geoLongMin)
+	latOffset *= float64(uint64(1) << step)
+	longOffset *= float64(uint64(1) << step)
+	return uint64(latOffset), uint64(longOffset)
+}
+
+func geoHashScore(long, lat float64) uint64 {
+	return interleave(geoEncode(long, lat, geoStepMax))
+}
+
+// geoDecode returns the center of the cell for a score.
+func geoDecode(score uint64) (float64, float64) {
+	latIdx, longIdx := deinterleave(score)
+	cells := float64(uint64(1) << geoStepMax)
+	latScale := geoLatMax - geoLatMin
+	longScale := geoLongMax - geoLongMin
+	latMin := geoLatMin + float64(latIdx)/cells*latScale
+	latMax := geoLatMin + float64(latIdx+1)/cells*latScale
+	longMin := geoLongMin + float64(longIdx)/cells*longScale
+	longMax := geoLongMin + float64(longIdx+1)/cells*longScale
+	long := math.Max(geoLongMin, math.Min(geoLongMax, (longMin+longMax)/2))
+	lat := math.Max(geoLatMin, math.Min(geoLatMax, (latMin+latMax)/2))
+	return long, lat
+}
+
+// interleave places x bits in even positions and y bits in odd positions.
+func interleave(x, y uint64) uint64 {
+	return spread(x) | spread(y)<<1
+}
+
+func deinterleave(v uint64) (uint64, uint64) {
+	return squash(v), squash(v >> 1)
+}
+
+func spread(v uint64) uint64 {
+	v &= 0xffffffff
+	v = (v | v<<16) & 0x0000ffff0000ffff
+	v = (v | v<<8) & 0x00ff00ff00ff00ff
+	v = (v | v<<4) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v<<2) & 0x3333333333333333
+	v = (v | v<<1) & 0x5555555555555555
+	return v
+}
+
+func squash(v uint64) uint64 {
+	v &= 0x5555555555555555
+	v = (v | v>>1) & 0x3333333333333333
+	v = (v | v>>2) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v>>4) & 0x00ff00ff00ff00ff
+	v = (v | v>>8) & 0x0000ffff0000ffff
+	v = (v | v>>16) & 0x00000000ffffffff
+	return v
+}
+
+// geoHashString returns the standard base32 geohash, which unlike the score
+// uses the full -90,90 latitude range.
+func geoHashString(score uint64) string {
+	long, lat := geoDecode(score)
+	latOffset := (lat + 90) / 180
+	longOffset := (long + 180) / 360
+	hash := interleave(
+		uint64(latOffset*float64(uint64(1)<<geoStepMax)),
+		uint64(longOffset*float64(uint64(1)<<geoStepMax)),
+	)
+	var buf [geoHashLength]byte
+	for i := range buf {
+		var idx uint64
+		if i == geoHashLength-1 {
+			// only 52 bits are available so the last character is padded
+			idx = 0
+		} else {
+			idx = (hash >> (52 - uint((i+1)*5))) & 0x1f
+		}
+		buf[i] = geoAlphabet[idx]
+	}
+	return string(buf[:])
+}
+
+func degRad(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func geoLatDistance(lat1, lat2 float64) float64 {
+	return earthRadius * math.Abs(degRad(lat2)-degRad(lat1))
+}
+
+// geoDistance is the haversine distance in meters.
+func geoDistance(long1, lat1, long2, lat2 float64) float64 {
+	v := math.Sin((degRad(long2) - degRad(long1)) / 2)
+	if v == 0 {
+		return geoLatDistance(lat1, lat2)
+	}
+	u := math.Sin((degRad(lat2) - degRad(lat1)) / 2)
+	a := u*u + math.Cos(degRad(lat1))*math.Cos(degRad(lat2))*v*v
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+type geoShape struct {
+	long, lat     float64
+	byBox         bool
+	radius        float64
+	width, height float64
+}
+
+// distance returns the distance from the center of the shape if the point is
+// within it.
+func (s geoShape) distance(long, lat float64) (float64, bool) {
+	if !s.byBox {
+		d := geoDistance(s.long, s.lat, long, lat)
+		return d, d <= s.radius
+	}
+	if geoLatDistance(lat, s.lat) > s.height/2 {
+		return 0, false
+	}
+	if geoDistance(long, lat, s.long, lat) > s.width/2 {
+		return 0, false
+	}
+	return geoDistance(s.long, s.lat, long, lat), true
+}
+
+// bounds returns the latitude and longitude bounding box of the shape.
+func (s geoShape) bounds() (float64, float64, float64, float64) {
+	height, width := s.radius, s.radius
+	if s.byBox {
+		height, width = s.height/2, s.width/2
+	}
+	latDelta := height / earthRadius * 180 / math.Pi
+	minLat, maxLat := s.lat-latDelta, s.lat+latDelta
+	// longitude degrees shrink towards the poles, use the widest latitude
+	widest := math.Max(math.Abs(minLat), math.Abs(maxLat))
+	if widest > 90 {
+		widest = 90
+	}
+	longDelta := width / earthRadius / math.Cos(degRad(widest)) * 180 / math.Pi
+	if math.IsInf(longDelta, 0) || longDelta > 180 {
+		longDelta = 180
+	}
+	return s.long - longDelta, minLat, s.long + longDelta, maxLat
+}
+
+// searchRanges returns the score ranges [min, max) of the geohash cells that
+// cover the shape, similar to the nine neighbouring cells redis searches.
+func (s geoShape) searchRanges() [][2]uint64 {
+	minLong, minLat, maxLong, maxLat := s.bounds()
+	minLat, maxLat = math.Max(minLat, geoLatMin), math.Min(maxLat, geoLatMax)
+
+	var longRanges [][2]float64
+	switch {
+	case maxLong-minLong >= 360:
+		longRanges = [][2]float64{{geoLongMin, geoLongMax}}
+	case minLong < geoLongMin:
+		longRanges = [][2]float64{{minLong + 360, geoLongMax}, {geoLongMin, maxLong}}
+	case maxLong > geoLongMax:
+		longRanges = [][2]float64{{minLong, geoLongMax}, {geoLongMin, maxLong - 360}}
+	default:
+		longRanges = [][2]float64{{minLong, maxLong}}
+	}
+
+	for step := uint(s.estimateStep()); ; step-- {
+		var ranges [][2]uint64
+		maxIdx := uint64(1)<<step - 1
+		latLow, _ := geoEncode(0, minLat, step)
+		latHigh, _ := geoEncode(0, maxLat, step)
+		latHigh = minUint64(latHigh, maxIdx)
+		for _, lr := range longRanges {
+			_, longLow := geoEncode(lr[0], 0, step)
+			_, longHigh := geoEncode(lr[1], 0, step)
+			longHigh = minUint64(longHigh, maxIdx)
+			for latIdx := latLow; latIdx <= latHigh; latIdx++ {
+				for longIdx := longLow; longIdx <= longHigh; longIdx++ {
+					shift := 2 * (geoStepMax - step)
+					hash := interleave(latIdx, longIdx)
+					ranges = append(ranges, [2]uint64{hash << shift, (hash + 1) << shift})
+				}
+			}
+		}
+		if len(ranges) <= geoMaxSearches || step == 1 {
+			return ranges
+		}
+	}
+}
+
+func (s geoShape) estimateStep() int {
+	r := s.radius
+	if s.byBox {
+		r = math.Sqrt(s.width*s.width/4 + s.height*s.height/4)
+	}
+	if r == 0 {
+		return geoStepMax
+	}
+	step := 1
+	for r < mercatorMax {
+		r *= 2
+		step++
+	}
+	step -= 2
+	if s.lat > 66 || s.lat < -66 {
+		step--
+		if s.lat > 80 || s.lat < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > geoStepMax {
+		step = geoStepMax
+	}
+	return step
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+type geoResult struct {
+	member    string
+	distance  float64
+	hash      uint64
+	long, lat float64
+}
+
+// geoSearch scans the cells covering the shape returning the members within
+// it. When sort is empty and count is set with any the search stops as soon
+// as enough members are found.
+func geoSearch(store storage, key []byte, shape geoShape, sortOrder string, count int64, any bool) ([]geoResult, error) {
+	if count > 0 && sortOrder == "" && !any {
+		sortOrder = "asc"
+	}
+	var results []geoResult
+	seen := make(map[string]bool)
+	for _, r := range shape.searchRanges() {
+		err := store.ZRangeByScore(key, float64(r[0]), float64(r[1]-1), func(m ScoredMember) bool {
+			if seen[string(m.Member)] {
+				return true
+			}
+			hash := uint64(m.Score)
+			long, lat := geoDecode(hash)
+			d, ok := shape.distance(long, lat)
+			if !ok {
+				return true
+			}
+			seen[string(m.Member)] = true
+			results = append(results, geoResult{
+				member:   string(m.Member),
+				distance: d,
+				hash:     hash,
+				long:     long,
+				lat:      lat,
+			})
+			return !any || count == 0 || int64(len(results)) < count
+		})
+		if err != nil {
+			return nil, err
+		}
+		if any && count > 0 && int64(len(results)) >= count {
+			break
+		}
+	}
+	switch strings.ToLower(sortOrder) {
+	case "asc":
+		sort.SliceStable(results, func(i, j int) bool { return results[i].distance < results[j].distance })
+	case "desc":
+		sort.SliceStable(results, func(i, j int) bool { return results[i].distance > results[j].distance })
+	}
+	if count > 0 && int64(len(results)) > count {
+		results = results[:count]
+	}
+	return results, nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func sicily(t *testing.T) storage {
+	store, err := newStorage(Config{StoragePath: filepath.Join(t.TempDir(), "geo.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	var members []ScoredMember
+	for _, p := range []struct {
+		member    string
+		long, lat float64
+	}{
+		{"Palermo", 13.361389, 38.115556},
+		{"Catania", 15.087269, 37.502669},
+		{"edge1", 12.758489, 38.788135},
+		{"edge2", 17.241510, 38.788135},
+	} {
+		members = append(members, ScoredMember{
+			Member: []byte(p.member),
+			Score:  float64(geoHashScore(p.long, p.lat)),
+		})
+	}
+	if _, err := store.ZAdd([]byte("Sicily"), members, ZAddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestGeoPosition(t *testing.T) {
+	long, lat := geoDecode(geoHashScore(13.361389, 38.115556))
+	if res := fmt.Sprintf("%.17f %.17f", long, lat); res != "13.36138933897018433 38.11555639549629859" {
+		t.Errorf("unexpected position %s", res)
+	}
+	if res := geoHashString(geoHashScore(13.361389, 38.115556)); res != "sqc8b49rny0" {
+		t.Errorf("unexpected hash %s", res)
+	}
+	if res := geoHashString(geoHashScore(15.087269, 37.502669)); res != "sqdtr74hyu0" {
+		t.Errorf("unexpected hash %s", res)
+	}
+}
+
+func TestGeoDistance(t *testing.T) {
+	long1, lat1 := geoDecode(geoHashScore(13.361389, 38.115556))
+	long2, lat2 := geoDecode(geoHashScore(15.087269, 37.502669))
+	if res := fmt.Sprintf("%.4f", geoDistance(long1, lat1, long2, lat2)); res != "166274.1516" {
+		t.Errorf("unexpected distance %s", res)
+	}
+}
+
+func TestGeoSearch(t *testing.T) {
+	store := sicily(t)
+
+	results, err := geoSearch(store, []byte("Sicily"), geoShape{long: 15, lat: 37, radius: 200000}, "asc", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Catania 56.4413", "Palermo 190.4424"}
+	if len(results) != len(expected) {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	for i, r := range results {
+		if res := fmt.Sprintf("%s %.4f", r.member, r.distance/1000); res != expected[i] {
+			t.Errorf("expected %s got %s", expected[i], res)
+		}
+	}
+
+	results, err = geoSearch(store, []byte("Sicily"), geoShape{long: 15, lat: 37, byBox: true, width: 400000, height: 400000}, "asc", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"Catania 56.4413", "Palermo 190.4424", "edge2 279.7403", "edge1 279.7405"}
+	if len(results) != len(expected) {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	for i, r := range results {
+		if res := fmt.Sprintf("%s %.4f", r.member, r.distance/1000); res != expected[i] {
+			t.Errorf("expected %s got %s", expected[i], res)
+		}
+	}
+
+	results, err = geoSearch(store, []byte("Sicily"), geoShape{long: 15, lat: 37, byBox: true, width: 400000, height: 400000}, "", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].member != "Catania" {
+		t.Errorf("count should default to ascending order %+v", results)
+	}
+}
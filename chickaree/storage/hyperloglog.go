@@ -0,0 +1,342 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// HyperLogLog values use the same layout as redis so that data can be moved
+// between the two without conversion. A 16 byte header ("HYLL", encoding,
+// three unused bytes and a little endian cached cardinality) is followed by
+// either dense 6 bit registers or the sparse opcode encoding.
+
+const (
+	hllP              = 14
+	hllQ              = 64 - hllP
+	hllRegisters      = 1 << hllP
+	hllPMask          = hllRegisters - 1
+	hllBits           = 6
+	hllRegisterMax    = 1<<hllBits - 1
+	hllHeaderSize     = 16
+	hllDenseSize      = hllHeaderSize + (hllRegisters*hllBits+7)/8
+	hllDense          = 0
+	hllSparse         = 1
+	hllSparseMaxBytes = 3000
+
+	hllSparseValMaxValue = 32
+	hllSparseValMaxLen   = 4
+	hllSparseZeroMaxLen  = 64
+	hllSparseXZeroMaxLen = 16384
+
+	hllAlphaInf = 0.721347520444481703680
+)
+
+var (
+	hllMagic = []byte("HYLL")
+
+	ErrHLLWrongType = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	ErrHLLCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+type hyperLogLog struct {
+	registers [hllRegisters]uint8
+	sparse    bool
+	card      [8]byte
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{sparse: true}
+}
+
+// parseHyperLogLog decodes a stored value, a nil value is treated as an empty
+// HyperLogLog.
+func parseHyperLogLog(v []byte) (*hyperLogLog, error) {
+	if v == nil {
+		return newHyperLogLog(), nil
+	}
+	if len(v) < hllHeaderSize || !bytes.Equal(v[:4], hllMagic) {
+		return nil, ErrHLLWrongType
+	}
+	h := &hyperLogLog{}
+	copy(h.card[:], v[8:16])
+	switch v[4] {
+	case hllDense:
+		if len(v) != hllDenseSize {
+			return nil, ErrHLLWrongType
+		}
+		regs := v[hllHeaderSize:]
+		for i := range h.registers {
+			h.registers[i] = denseRegister(regs, i)
+			// registers are 6 bits but ranks never exceed hllQ+1
+			if h.registers[i] > hllQ+1 {
+				return nil, ErrHLLCorrupted
+			}
+		}
+	case hllSparse:
+		h.sparse = true
+		if err := h.decodeSparse(v[hllHeaderSize:]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrHLLWrongType
+	}
+	return h, nil
+}
+
+func denseRegister(regs []byte, i int) uint8 {
+	byteIdx := i * hllBits / 8
+	fb := uint(i * hllBits & 7)
+	b0 := uint(regs[byteIdx])
+	var b1 uint
+	if byteIdx+1 < len(regs) {
+		b1 = uint(regs[byteIdx+1])
+	}
+	return uint8((b0>>fb | b1<<(8-fb)) & hllRegisterMax)
+}
+
+func setDenseRegister(regs []byte, i int, val uint8) {
+	byteIdx := i * hllBits / 8
+	fb := uint(i * hllBits & 7)
+	v := uint(val)
+	regs[byteIdx] &^= byte(hllRegisterMax << fb)
+	regs[byteIdx] |= byte(v << fb)
+	if byteIdx+1 < len(regs) {
+		regs[byteIdx+1] &^= byte(hllRegisterMax >> (8 - fb))
+		regs[byteIdx+1] |= byte(v >> (8 - fb))
+	}
+}
+
+func (h *hyperLogLog) decodeSparse(b []byte) error {
+	idx := 0
+	for i := 0; i < len(b); i++ {
+		op := b[i]
+		switch {
+		case op&0xc0 == 0x00: // ZERO 00xxxxxx
+			idx += int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO 01xxxxxx yyyyyyyy
+			if i+1 >= len(b) {
+				return ErrHLLCorrupted
+			}
+			idx += (int(op&0x3f)<<8 | int(b[i+1])) + 1
+			i++
+		default: // VAL 1vvvvvxx
+			val := (op>>2)&0x1f + 1
+			runLen := int(op&0x3) + 1
+			if idx+runLen > hllRegisters {
+				return ErrHLLCorrupted
+			}
+			for j := 0; j < runLen; j++ {
+				h.registers[idx+j] = val
+			}
+			idx += runLen
+		}
+		if idx > hllRegisters {
+			return ErrHLLCorrupted
+		}
+	}
+	if idx != hllRegisters {
+		return ErrHLLCorrupted
+	}
+	return nil
+}
+
+func (h *hyperLogLog) encodeSparse() ([]byte, bool) {
+	var buf []byte
+	for i := 0; i < hllRegisters; {
+		val := h.registers[i]
+		runLen := 1
+		for i+runLen < hllRegisters && h.registers[i+runLen] == val {
+			runLen++
+		}
+		i += runLen
+		if val == 0 {
+			for runLen > 0 {
+				if runLen > hllSparseZeroMaxLen {
+					n := runLen
+					if n > hllSparseXZeroMaxLen {
+						n = hllSparseXZeroMaxLen
+					}
+					buf = append(buf, byte(0x40|(n-1)>>8), byte((n-1)&0xff))
+					runLen -= n
+					continue
+				}
+				buf = append(buf, byte(runLen-1))
+				runLen = 0
+			}
+			continue
+		}
+		if val > hllSparseValMaxValue {
+			return nil, false
+		}
+		for runLen > 0 {
+			n := runLen
+			if n > hllSparseValMaxLen {
+				n = hllSparseValMaxLen
+			}
+			buf = append(buf, 0x80|(val-1)<<2|byte(n-1))
+			runLen -= n
+		}
+	}
+	if hllHeaderSize+len(buf) > hllSparseMaxBytes {
+		return nil, false
+	}
+	return buf, true
+}
+
+// Encode returns the redis compatible representation, keeping the sparse
+// encoding until it is no longer possible or efficient.
+func (h *hyperLogLog) Encode() []byte {
+	res := make([]byte, hllHeaderSize, hllDenseSize)
+	copy(res, hllMagic)
+	copy(res[8:], h.card[:])
+	if h.sparse {
+		if regs, ok := h.encodeSparse(); ok {
+			res[4] = hllSparse
+			return append(res, regs...)
+		}
+		h.sparse = false
+	}
+	res[4] = hllDense
+	res = res[:hllDenseSize]
+	regs := res[hllHeaderSize:]
+	for i, val := range h.registers {
+		setDenseRegister(regs, i, val)
+	}
+	return res
+}
+
+// Add returns true if any register was updated.
+func (h *hyperLogLog) Add(elem []byte) bool {
+	index, count := hllPatLen(elem)
+	if h.registers[index] >= count {
+		return false
+	}
+	h.registers[index] = count
+	h.invalidate()
+	return true
+}
+
+// Merge takes the maximum value of each register.
+func (h *hyperLogLog) Merge(o *hyperLogLog) {
+	for i, val := range o.registers {
+		if val > h.registers[i] {
+			h.registers[i] = val
+		}
+	}
+	h.invalidate()
+}
+
+func (h *hyperLogLog) invalidate() {
+	h.card[7] |= 1 << 7
+}
+
+func (h *hyperLogLog) cachedCount() (uint64, bool) {
+	if h.card[7]&(1<<7) != 0 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(h.card[:]), true
+}
+
+// Count returns the cached cardinality if valid otherwise estimates it.
+func (h *hyperLogLog) Count() uint64 {
+	if c, ok := h.cachedCount(); ok {
+		return c
+	}
+	c := h.estimate()
+	binary.LittleEndian.PutUint64(h.card[:], c)
+	return c
+}
+
+// estimate uses the improved estimator from Otmar Ertl as redis does.
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(hllRegisters)
+	var histo [hllQ + 2]int
+	for _, val := range h.registers {
+		histo[val]++
+	}
+	z := m * hllTau((m-float64(histo[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histo[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histo[0])/m)
+	return uint64(math.Round(hllAlphaInf * m * m / z))
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+// hllPatLen returns the register index for the element along with the
+// length of the 000..1 pattern that follows it.
+func hllPatLen(elem []byte) (int, uint8) {
+	hash := murmurHash64A(elem, 0xadc83b19)
+	index := int(hash & hllPMask)
+	hash >>= hllP
+	hash |= 1 << hllQ
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const (
+		m = 0xc6a4a7935bd1e995
+		r = 47
+	)
+	h := seed ^ (uint64(len(key)) * m)
+	data := key
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
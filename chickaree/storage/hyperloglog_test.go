@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHyperLogLogEmpty(t *testing.T) {
+	h, err := parseHyperLogLog(nil)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	h.invalidate()
+	expected := "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\x7f\xff"
+	if res := string(h.Encode()); res != expected {
+		t.Errorf("unexpected encoding %q", res)
+	}
+	if res := h.Count(); res != 0 {
+		t.Errorf("should be 0 not %d", res)
+	}
+}
+
+func TestHyperLogLogCount(t *testing.T) {
+	h := newHyperLogLog()
+	for _, e := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		h.Add([]byte(e))
+	}
+	if res := h.Count(); res != 7 {
+		t.Errorf("should be 7 not %d", res)
+	}
+	if h.Add([]byte("a")) {
+		t.Errorf("adding an existing element should not update registers")
+	}
+
+	for _, n := range []int{1000, 100000} {
+		h := newHyperLogLog()
+		for i := 0; i < n; i++ {
+			h.Add([]byte(fmt.Sprintf("element:%d", i)))
+		}
+		res := float64(h.Count())
+		if diff := (res - float64(n)) / float64(n); diff > 0.02 || diff < -0.02 {
+			t.Errorf("estimate %f too far from %d", res, n)
+		}
+	}
+}
+
+func TestHyperLogLogEncoding(t *testing.T) {
+	h := newHyperLogLog()
+	for i := 0; i < 100; i++ {
+		h.Add([]byte(fmt.Sprintf("element:%d", i)))
+	}
+	v := h.Encode()
+	if v[4] != hllSparse {
+		t.Errorf("small sets should be sparse")
+	}
+	parsed, err := parseHyperLogLog(v)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if parsed.registers != h.registers {
+		t.Errorf("sparse registers do not match")
+	}
+
+	for i := 100; i < 10000; i++ {
+		h.Add([]byte(fmt.Sprintf("element:%d", i)))
+	}
+	v = h.Encode()
+	if v[4] != hllDense || len(v) != hllDenseSize {
+		t.Errorf("large sets should be dense")
+	}
+	parsed, err = parseHyperLogLog(v)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if parsed.registers != h.registers {
+		t.Errorf("dense registers do not match")
+	}
+
+	if _, err := parseHyperLogLog([]byte("not a hll")); err != ErrHLLWrongType {
+		t.Errorf("expected wrong type error got %v", err)
+	}
+	corrupt := append([]byte{}, v[:hllHeaderSize]...)
+	corrupt[4] = hllSparse
+	if _, err := parseHyperLogLog(append(corrupt, 0x7f)); err != ErrHLLCorrupted {
+		t.Errorf("expected corrupted error got %v", err)
+	}
+	dense := append([]byte{}, v...)
+	setDenseRegister(dense[hllHeaderSize:], 0, hllRegisterMax)
+	if _, err := parseHyperLogLog(dense); err != ErrHLLCorrupted {
+		t.Errorf("expected corrupted dense register error got %v", err)
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a, b := newHyperLogLog(), newHyperLogLog()
+	for i := 0; i < 1000; i++ {
+		a.Add([]byte(fmt.Sprintf("a:%d", i)))
+		b.Add([]byte(fmt.Sprintf("b:%d", i)))
+	}
+	a.Merge(b)
+	res := float64(a.Count())
+	if diff := (res - 2000) / 2000; diff > 0.02 || diff < -0.02 {
+		t.Errorf("estimate %f too far from 2000", res)
+	}
+}
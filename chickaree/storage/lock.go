@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/encryption"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// Locks are leases held by an owner until they expire. Every acquisition is
+// stamped with the raft index it was applied at which gives a fencing token
+// that always increases as the lock changes hands. A released lock keeps
+// its last token and a new holder is never given a lower one, so tokens
+// keep increasing when the lock moves to a group or cluster whose log is
+// behind. Expiry is decided using the time the leader wrote into the log
+// entry so every replica agrees on who holds a lock, this does rely on
+// leader clocks being roughly in sync across elections.
+
+var (
+	lockBucket = []byte{0x2}
+
+	ErrLocksUnsupported = errors.New("storage does not support locks")
+	ErrLockTTL          = errors.New("lock ttl must be positive")
+)
+
+// lockStore persists lock state outside of the keyspace.
+type lockStore interface {
+	GetLock(name []byte) ([]byte, error)
+	PutLock(name, state []byte) error
+	DeleteLock(name []byte) error
+	// LockNames calls fn for every lock until fn returns false.
+	LockNames(fn func(name []byte) bool) error
+}
+
+func (s *store) GetLock(name []byte) (res []byte, err error) {
+	err = s.db.Snapshot(func(tx Tx) error {
+		b := tx.Bucket(lockBucket)
+		if b == nil {
+			return nil
+		}
+		if v := b.Get(name); v != nil {
+			res, err = s.openLock(v)
+			return err
+		}
+		return nil
+	})
+	return res, err
+}
+
+// openLock decrypts a lock record, records written before locks were
+// encrypted are read as they are until the key is rotated.
+func (s *store) openLock(v []byte) ([]byte, error) {
+	if s.keys == nil || !encryption.IsEncrypted(v) {
+		return append([]byte{}, v...), nil
+	}
+	return s.keys.Decrypt(v)
+}
+
+func (s *store) PutLock(name, state []byte) error {
+	state, err := s.encrypt(state)
+	if err != nil {
+		return err
+	}
+	return s.db.Batch(func(tx Tx) error {
+		b, err := tx.CreateBucketIfNotExists(lockBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put(name, state)
+	})
+}
+
+func (s *store) DeleteLock(name []byte) error {
+	return s.db.Batch(func(tx Tx) error {
+		b := tx.Bucket(lockBucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete(name)
+	})
+}
+
+func (s *store) LockNames(fn func(name []byte) bool) error {
+	return s.db.Snapshot(func(tx Tx) error {
+		b := tx.Bucket(lockBucket)
+		if b == nil {
+			return nil
+		}
+		return b.Iterate(nil, func(k, _ []byte) bool {
+			return fn(append([]byte{}, k...))
+		})
+	})
+}
+
+func (s *DistributedStorage) Lock(req *api.LockRequest) (*api.LockResponse, error) {
+	if req.TtlMs <= 0 {
+		return nil, ErrLockTTL
+	}
+	req.Now = time.Now().UnixNano()
+	res, err := s.apply(LockRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.LockResponse), nil
+}
+
+func (s *DistributedStorage) Unlock(req *api.UnlockRequest) (*api.UnlockResponse, error) {
+	res, err := s.apply(UnlockRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.UnlockResponse), nil
+}
+
+func (s *DistributedStorage) Refresh(req *api.RefreshRequest) (*api.RefreshResponse, error) {
+	if req.TtlMs <= 0 {
+		return nil, ErrLockTTL
+	}
+	req.Now = time.Now().UnixNano()
+	res, err := s.apply(RefreshRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.RefreshResponse), nil
+}
+
+func (s *fsm) lockState(name string) (*api.LockState, error) {
+	if s.locks == nil {
+		return nil, ErrLocksUnsupported
+	}
+	b, err := s.locks.GetLock([]byte(name))
+	if err != nil || b == nil {
+		return nil, err
+	}
+	var state api.LockState
+	if err := proto.Unmarshal(b, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *fsm) putLockState(name string, state *api.LockState) error {
+	b, err := proto.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.locks.PutLock([]byte(name), b)
+}
+
+// nextToken is the raft index unless a token at least as high was already
+// issued for the lock.
+func nextToken(prev *api.LockState, index uint64) uint64 {
+	if prev != nil && prev.Token >= index {
+		return prev.Token + 1
+	}
+	return index
+}
+
+// restoreLock replaces the state of a lock moved from another group,
+// keeping the higher token of the two. A holder whose token is below one
+// already issued here loses the lock.
+func (s *fsm) restoreLock(name string, b []byte) error {
+	existing, err := s.lockState(name)
+	if err != nil {
+		return err
+	}
+	var incoming api.LockState
+	if err := proto.Unmarshal(b, &incoming); err != nil {
+		return err
+	}
+	if existing == nil && len(b) == 0 {
+		return nil
+	}
+	if existing != nil && existing.Token > incoming.Token {
+		incoming = api.LockState{Token: existing.Token}
+	}
+	return s.putLockState(name, &incoming)
+}
+
+func expiresAt(now, ttlMs int64) int64 {
+	return now + ttlMs*int64(time.Millisecond)
+}
+
+func (s *fsm) applyLock(index uint64, b []byte) interface{} {
+	var req api.LockRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	state, err := s.lockState(req.Name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case state == nil || state.Owner == "" || state.ExpiresAt <= req.Now:
+		state = &api.LockState{
+			Owner: req.Owner,
+			Token: nextToken(state, index),
+		}
+	case state.Owner == req.Owner:
+		// acquiring a held lock again extends it, which makes retries safe
+	default:
+		return &api.LockResponse{
+			Token:     state.Token,
+			ExpiresAt: state.ExpiresAt,
+			Holder:    state.Owner,
+		}
+	}
+	state.ExpiresAt = expiresAt(req.Now, req.TtlMs)
+	if err := s.putLockState(req.Name, state); err != nil {
+		return err
+	}
+	log.Info().Str("name", req.Name).Str("owner", req.Owner).Uint64("token", state.Token).Msg("lock acquired")
+	return &api.LockResponse{
+		Acquired:  true,
+		Token:     state.Token,
+		ExpiresAt: state.ExpiresAt,
+		Holder:    state.Owner,
+	}
+}
+
+func (s *fsm) applyUnlock(b []byte) interface{} {
+	var req api.UnlockRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	state, err := s.lockState(req.Name)
+	if err != nil {
+		return err
+	}
+	if state == nil || state.Owner == "" || state.Owner != req.Owner || state.Token != req.Token {
+		return &api.UnlockResponse{}
+	}
+	if err := s.putLockState(req.Name, &api.LockState{Token: state.Token}); err != nil {
+		return err
+	}
+	log.Info().Str("name", req.Name).Str("owner", req.Owner).Uint64("token", state.Token).Msg("lock released")
+	return &api.UnlockResponse{Released: true}
+}
+
+func (s *fsm) applyRefresh(b []byte) interface{} {
+	var req api.RefreshRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	state, err := s.lockState(req.Name)
+	if err != nil {
+		return err
+	}
+	if state == nil || state.Owner != req.Owner || state.Token != req.Token || state.ExpiresAt <= req.Now {
+		return &api.RefreshResponse{}
+	}
+	state.ExpiresAt = expiresAt(req.Now, req.TtlMs)
+	if err := s.putLockState(req.Name, state); err != nil {
+		return err
+	}
+	return &api.RefreshResponse{
+		Refreshed: true,
+		ExpiresAt: state.ExpiresAt,
+	}
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"google.golang.org/protobuf/proto"
+)
+
+func applyRequest(t *testing.T, f *fsm, index uint64, reqType RequestType, req proto.Message) interface{} {
+	b, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := f.apply(index, append([]byte{byte(reqType)}, b...))
+	if err, ok := res.(error); ok {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestLockFencing(t *testing.T) {
+	store, err := newStorage(Config{StoragePath: filepath.Join(t.TempDir(), "lock.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	f := &fsm{store: store, locks: store}
+	now := time.Now().UnixNano()
+	second := int64(time.Second)
+
+	res := applyRequest(t, f, 10, LockRequestType, &api.LockRequest{Name: "l", Owner: "a", TtlMs: 1000, Now: now}).(*api.LockResponse)
+	if !res.Acquired || res.Token != 10 {
+		t.Errorf("expected lock to be acquired with token 10 %+v", res)
+	}
+	res = applyRequest(t, f, 11, LockRequestType, &api.LockRequest{Name: "l", Owner: "b", TtlMs: 1000, Now: now}).(*api.LockResponse)
+	if res.Acquired || res.Holder != "a" {
+		t.Errorf("expected lock to be held by a %+v", res)
+	}
+	refresh := applyRequest(t, f, 12, RefreshRequestType, &api.RefreshRequest{Name: "l", Owner: "a", Token: 10, TtlMs: 1000, Now: now + second/2}).(*api.RefreshResponse)
+	if !refresh.Refreshed {
+		t.Errorf("expected lock to be refreshed")
+	}
+
+	// once the lease is over another owner takes the lock with a higher token
+	res = applyRequest(t, f, 13, LockRequestType, &api.LockRequest{Name: "l", Owner: "b", TtlMs: 1000, Now: now + 2*second}).(*api.LockResponse)
+	if !res.Acquired || res.Token != 13 {
+		t.Errorf("expected lock to be acquired with token 13 %+v", res)
+	}
+	unlock := applyRequest(t, f, 14, UnlockRequestType, &api.UnlockRequest{Name: "l", Owner: "a", Token: 10}).(*api.UnlockResponse)
+	if unlock.Released {
+		t.Errorf("stale holder should not release the lock")
+	}
+	unlock = applyRequest(t, f, 15, UnlockRequestType, &api.UnlockRequest{Name: "l", Owner: "b", Token: 13}).(*api.UnlockResponse)
+	if !unlock.Released {
+		t.Errorf("expected lock to be released")
+	}
+	if refresh := applyRequest(t, f, 16, RefreshRequestType, &api.RefreshRequest{Name: "l", Owner: "b", Token: 13, TtlMs: 1000, Now: now}).(*api.RefreshResponse); refresh.Refreshed {
+		t.Errorf("released lock should not be refreshed")
+	}
+	// tokens never go below one already issued for the lock
+	res = applyRequest(t, f, 5, LockRequestType, &api.LockRequest{Name: "l", Owner: "c", TtlMs: 1000, Now: now}).(*api.LockResponse)
+	if !res.Acquired || res.Token != 14 {
+		t.Errorf("expected lock to be acquired with token 14 %+v", res)
+	}
+}
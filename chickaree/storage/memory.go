@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/google/btree"
+)
+
+// memoryEngine keeps a data file in memory for cache only deployments and
+// tests, nothing survives a restart but raft restores its latest snapshot
+// and replays the log after it. Each
+// bucket is a copy on write B-tree so snapshots are a cheap clone of the
+// root and a batch works on its own clone until it is committed.
+
+const memoryDegree = 32
+
+type memoryEngine struct {
+	// batches are applied one at a time
+	batch sync.Mutex
+	mu    sync.Mutex
+	root  *btree.BTree
+}
+
+type memoryItem struct {
+	key   []byte
+	value []byte
+	// bucket is set for nested buckets
+	bucket *btree.BTree
+}
+
+func (i *memoryItem) Less(than btree.Item) bool {
+	return bytes.Compare(i.key, than.(*memoryItem).key) < 0
+}
+
+func openMemory(path string) (Engine, error) {
+	return &memoryEngine{root: btree.New(memoryDegree)}, nil
+}
+
+// clone returns a copy of the committed root, clones must not be made
+// concurrently.
+func (e *memoryEngine) clone() (*btree.BTree, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.root == nil {
+		return nil, ErrEngineClosed
+	}
+	return e.root.Clone(), nil
+}
+
+func (e *memoryEngine) Snapshot(fn func(tx Tx) error) error {
+	root, err := e.clone()
+	if err != nil {
+		return err
+	}
+	return fn(&memoryBucket{tx: &memoryTx{}, tree: root})
+}
+
+func (e *memoryEngine) Batch(fn func(tx Tx) error) error {
+	e.batch.Lock()
+	defer e.batch.Unlock()
+	root, err := e.clone()
+	if err != nil {
+		return err
+	}
+	tx := &memoryTx{writable: true, owned: map[*btree.BTree]bool{root: true}}
+	if err := fn(&memoryBucket{tx: tx, tree: root}); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.root == nil {
+		return ErrEngineClosed
+	}
+	e.root = root
+	return nil
+}
+
+func (e *memoryEngine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.root = nil
+	return nil
+}
+
+type memoryTx struct {
+	writable bool
+	// owned are the trees cloned or created by this batch, any other tree
+	// is shared with the committed root and must be cloned before writing.
+	owned map[*btree.BTree]bool
+}
+
+type memoryBucket struct {
+	tx   *memoryTx
+	tree *btree.BTree
+}
+
+func (b *memoryBucket) get(key []byte) *memoryItem {
+	item := b.tree.Get(&memoryItem{key: key})
+	if item == nil {
+		return nil
+	}
+	return item.(*memoryItem)
+}
+
+func (b *memoryBucket) Get(key []byte) []byte {
+	if item := b.get(key); item != nil && item.bucket == nil {
+		return item.value
+	}
+	return nil
+}
+
+func (b *memoryBucket) Put(key, value []byte) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+	if len(key) == 0 {
+		return ErrKeyRequired
+	}
+	if item := b.get(key); item != nil && item.bucket != nil {
+		return ErrIncompatibleValue
+	}
+	b.tree.ReplaceOrInsert(&memoryItem{
+		key:   append([]byte{}, key...),
+		value: append([]byte{}, value...),
+	})
+	return nil
+}
+
+func (b *memoryBucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+	if item := b.get(key); item != nil && item.bucket != nil {
+		return ErrIncompatibleValue
+	}
+	b.tree.Delete(&memoryItem{key: key})
+	return nil
+}
+
+func (b *memoryBucket) Iterate(start []byte, fn func(key, value []byte) bool) error {
+	iterator := func(i btree.Item) bool {
+		item := i.(*memoryItem)
+		return fn(item.key, item.value)
+	}
+	if start == nil {
+		b.tree.Ascend(iterator)
+		return nil
+	}
+	b.tree.AscendGreaterOrEqual(&memoryItem{key: start}, iterator)
+	return nil
+}
+
+func (b *memoryBucket) Bucket(name []byte) Bucket {
+	item := b.get(name)
+	if item == nil || item.bucket == nil {
+		return nil
+	}
+	tree := item.bucket
+	if b.tx.writable && !b.tx.owned[tree] {
+		tree = tree.Clone()
+		b.tx.owned[tree] = true
+		b.tree.ReplaceOrInsert(&memoryItem{key: item.key, bucket: tree})
+	}
+	return &memoryBucket{tx: b.tx, tree: tree}
+}
+
+func (b *memoryBucket) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if !b.tx.writable {
+		return nil, ErrTxNotWritable
+	}
+	if len(name) == 0 {
+		return nil, ErrKeyRequired
+	}
+	if item := b.get(name); item != nil {
+		if item.bucket == nil {
+			return nil, ErrIncompatibleValue
+		}
+		return b.Bucket(name), nil
+	}
+	tree := btree.New(memoryDegree)
+	b.tx.owned[tree] = true
+	b.tree.ReplaceOrInsert(&memoryItem{key: append([]byte{}, name...), bucket: tree})
+	return &memoryBucket{tx: b.tx, tree: tree}, nil
+}
+
+func (b *memoryBucket) DeleteBucket(name []byte) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+	item := b.get(name)
+	if item == nil {
+		return ErrBucketNotFound
+	}
+	if item.bucket == nil {
+		return ErrIncompatibleValue
+	}
+	b.tree.Delete(item)
+	return nil
+}
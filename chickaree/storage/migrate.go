@@ -0,0 +1,386 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/raft"
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"google.golang.org/protobuf/proto"
+)
+
+// A slot is migrated by copying a snapshot of its keys to the target group
+// while the source records every key written since, those changes are
+// copied until few remain. The source then fences the slot, answering
+// writes with ASK, the last changes are copied and ownership flips to the
+// target before the source purges its copy.
+
+const defaultDumpLimit = 500
+
+// writeRequests creates the request of each write so its keys can be
+// checked against migrating slots.
+var writeRequests = map[RequestType]func() proto.Message{
+	SetRequestType:      func() proto.Message { return &api.SetRequest{} },
+	SetBitRequestType:   func() proto.Message { return &api.SetBitRequest{} },
+	BitOpRequestType:    func() proto.Message { return &api.BitOpRequest{} },
+	BitFieldRequestType: func() proto.Message { return &api.BitFieldRequest{} },
+	PFAddRequestType:    func() proto.Message { return &api.PFAddRequest{} },
+	PFMergeRequestType:  func() proto.Message { return &api.PFMergeRequest{} },
+	ZAddRequestType:     func() proto.Message { return &api.ZAddRequest{} },
+	LockRequestType:     func() proto.Message { return &api.LockRequest{} },
+	UnlockRequestType:   func() proto.Message { return &api.UnlockRequest{} },
+	RefreshRequestType:  func() proto.Message { return &api.RefreshRequest{} },
+	DeleteRequestType:   func() proto.Message { return &api.DeleteRequest{} },
+	ExpireRequestType:   func() proto.Message { return &api.ExpireRequest{} },
+}
+
+// slotStates holds the slots a group is migrating away. States change
+// through the log so every replica fences the same writes, changed keys are
+// only taken by the leader so a new leader may copy some keys again which
+// is harmless.
+type slotStates struct {
+	mu     sync.Mutex
+	states map[uint16]*api.SlotStateRequest
+	dirty  map[uint16]map[string]bool
+}
+
+func newSlotStates() *slotStates {
+	return &slotStates{
+		states: make(map[uint16]*api.SlotStateRequest),
+		dirty:  make(map[uint16]map[string]bool),
+	}
+}
+
+func (s *slotStates) set(req *api.SlotStateRequest) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	slot := uint16(req.Slot)
+	if req.Purge || (!req.Track && !req.Fence) {
+		delete(s.states, slot)
+		delete(s.dirty, slot)
+		return
+	}
+	s.states[slot] = req
+	if s.dirty[slot] == nil {
+		s.dirty[slot] = make(map[string]bool)
+	}
+}
+
+// check returns the keys of a write in tracked slots or an ASK error if any
+// is in a fenced slot.
+func (s *slotStates) check(reqType RequestType, b []byte) ([]string, error) {
+	if s == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	newReq, ok := writeRequests[reqType]
+	if len(s.states) == 0 || !ok {
+		return nil, nil
+	}
+	req := newReq()
+	if err := proto.Unmarshal(b, req); err != nil {
+		// the write reports the error itself
+		return nil, nil
+	}
+	var keys []string
+	for _, key := range requestKeys(req) {
+		slot := api.KeySlot(key)
+		state, ok := s.states[slot]
+		if !ok {
+			continue
+		}
+		if state.Fence {
+			return nil, askError{slot: slot, target: state.Target}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// askError sends a write to the group a fenced slot is moving to.
+type askError struct {
+	slot   uint16
+	target uint32
+}
+
+func (e askError) Error() string {
+	return fmt.Sprintf("ASK %d %d", e.slot, e.target)
+}
+
+func (s *slotStates) changed(keys []string) {
+	if s == nil || len(keys) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if dirty, ok := s.dirty[api.KeySlot(key)]; ok {
+			dirty[key] = true
+		}
+	}
+}
+
+// take removes and returns up to limit changed keys of a slot.
+func (s *slotStates) take(slot uint16, limit int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.dirty[slot] {
+		if len(keys) == limit {
+			break
+		}
+		keys = append(keys, key)
+		delete(s.dirty[slot], key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// copy returns the states and changed keys for a snapshot.
+func (s *slotStates) copy() ([]*api.SlotStateRequest, []string) {
+	if s == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var states []*api.SlotStateRequest
+	var keys []string
+	for slot, state := range s.states {
+		states = append(states, proto.Clone(state).(*api.SlotStateRequest))
+		for key := range s.dirty[slot] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Slot < states[j].Slot })
+	sort.Strings(keys)
+	return states, keys
+}
+
+// clear forgets every slot before a snapshot is restored.
+func (s *slotStates) clear() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states = make(map[uint16]*api.SlotStateRequest)
+	s.dirty = make(map[uint16]map[string]bool)
+}
+
+func (s *slotStates) reset(slot uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.dirty[slot]; ok {
+		s.dirty[slot] = make(map[string]bool)
+	}
+}
+
+// slotKeys returns the sorted keys and locks in a slot.
+func slotKeys(store storage, locks lockStore, slot uint16) ([]string, error) {
+	seen := make(map[string]bool)
+	add := func(key []byte) bool {
+		if api.KeySlot(string(key)) == slot {
+			seen[string(key)] = true
+		}
+		return true
+	}
+	if err := store.Keys(add); err != nil {
+		return nil, err
+	}
+	if locks != nil {
+		if err := locks.LockNames(add); err != nil {
+			return nil, err
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// DumpSlot pages through a slot's keys, starting a new snapshot clears the
+// changes recorded so far. It must be called on the leader.
+func (s *DistributedStorage) DumpSlot(req *api.DumpSlotRequest) (*api.DumpSlotResponse, error) {
+	if !s.IsLeader() {
+		return nil, raft.ErrNotLeader
+	}
+	if req.Slot >= api.SlotCount {
+		return nil, fmt.Errorf("invalid slot %d", req.Slot)
+	}
+	slot := uint16(req.Slot)
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultDumpLimit
+	}
+	resp := &api.DumpSlotResponse{}
+	var keys []string
+	if req.Changes {
+		keys = s.fsm.migrations.take(slot, limit)
+	} else {
+		if req.After == "" && !req.KeepChanges {
+			s.fsm.migrations.reset(slot)
+		}
+		all, err := slotKeys(s.store, s.locks, slot)
+		if err != nil {
+			return nil, err
+		}
+		i := sort.SearchStrings(all, req.After)
+		if i < len(all) && all[i] == req.After && req.After != "" {
+			i++
+		}
+		keys = all[i:]
+		if len(keys) > limit {
+			keys = keys[:limit]
+			resp.Next = keys[limit-1]
+		}
+	}
+	for _, key := range keys {
+		entry, err := s.dumpKey(key)
+		if err != nil {
+			return nil, err
+		}
+		resp.Entries = append(resp.Entries, entry)
+	}
+	return resp, nil
+}
+
+func (s *DistributedStorage) dumpKey(key string) (*api.KeyDump, error) {
+	k := []byte(key)
+	entry := &api.KeyDump{Key: key}
+	value, err := s.store.Get(k)
+	switch {
+	case errors.Is(err, ErrWrongType):
+		entry.Exists, entry.SortedSet = true, true
+		err = s.store.ZRangeByScore(k, math.Inf(-1), math.Inf(1), func(m ScoredMember) bool {
+			entry.Members = append(entry.Members, &api.ZMember{Member: m.Member, Score: m.Score})
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case value != nil:
+		entry.Exists, entry.Value = true, value
+	}
+	if entry.ExpiresAt, err = s.store.ExpiresAt(k); err != nil {
+		return nil, err
+	}
+	if s.locks != nil {
+		if entry.Lock, err = s.locks.GetLock(k); err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// RestoreKeys replaces keys with their dumped state.
+func (s *DistributedStorage) RestoreKeys(entries []*api.KeyDump) error {
+	_, err := s.apply(RestoreKeysRequestType, &api.RestoreKeysRequest{Entries: entries})
+	return err
+}
+
+// SetSlotState tracks, fences or purges a slot being migrated away.
+func (s *DistributedStorage) SetSlotState(req *api.SlotStateRequest) error {
+	_, err := s.apply(SlotStateRequestType, req)
+	return err
+}
+
+// UpdateSlots replicates a new slot assignment, only group 0 keeps it.
+func (s *DistributedStorage) UpdateSlots(config *api.SlotConfig) error {
+	_, err := s.apply(UpdateSlotsRequestType, config)
+	return err
+}
+
+func (s *fsm) applyUpdateSlots(b []byte) interface{} {
+	var config api.SlotConfig
+	if err := proto.Unmarshal(b, &config); err != nil {
+		return err
+	}
+	if s.slots == nil {
+		return errors.New("slot configuration is kept by group 0")
+	}
+	if err := s.slots.update(&config); err != nil {
+		return err
+	}
+	return &config
+}
+
+func (s *fsm) applySlotState(b []byte) interface{} {
+	var req api.SlotStateRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	if req.Purge {
+		keys, err := slotKeys(s.store, s.locks, uint16(req.Slot))
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := s.store.Delete([]byte(key)); err != nil {
+				return err
+			}
+			if s.locks != nil {
+				if err := s.locks.DeleteLock([]byte(key)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	s.migrations.set(&req)
+	return &api.SlotStateResponse{}
+}
+
+func (s *fsm) applyRestoreKeys(b []byte) interface{} {
+	var req api.RestoreKeysRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	for _, entry := range req.Entries {
+		key := []byte(entry.Key)
+		if err := s.store.Delete(key); err != nil {
+			return err
+		}
+		if entry.Exists {
+			if err := s.restore(key, entry); err != nil {
+				return err
+			}
+		}
+		if s.locks == nil {
+			continue
+		}
+		if err := s.restoreLock(entry.Key, entry.Lock); err != nil {
+			return err
+		}
+	}
+	return &api.RestoreKeysResponse{}
+}
+
+func (s *fsm) restore(key []byte, entry *api.KeyDump) error {
+	if entry.SortedSet {
+		members := make([]ScoredMember, 0, len(entry.Members))
+		for _, m := range entry.Members {
+			members = append(members, ScoredMember{Member: m.Member, Score: m.Score})
+		}
+		if _, err := s.store.ZAdd(key, members, ZAddOptions{}); err != nil {
+			return err
+		}
+	} else if err := s.store.Set(key, entry.Value); err != nil {
+		return err
+	}
+	if entry.ExpiresAt != 0 {
+		if _, err := s.store.Expire(key, entry.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
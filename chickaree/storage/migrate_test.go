@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestFSM(t *testing.T, name string) (*fsm, *DistributedStorage) {
+	store, err := newStorage(Config{StoragePath: filepath.Join(t.TempDir(), name)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	tracked, err := newTrackedStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fsm{store: tracked, locks: store, migrations: newSlotStates()}
+	return f, &DistributedStorage{store: tracked, locks: store, fsm: f}
+}
+
+func TestSlotStates(t *testing.T) {
+	f, _ := newTestFSM(t, "states.db")
+	slot := api.KeySlot("a")
+	applyRequest(t, f, 1, SlotStateRequestType, &api.SlotStateRequest{Slot: uint32(slot), Track: true})
+	applyRequest(t, f, 2, SetRequestType, &api.SetRequest{Key: "a", Value: []byte("1")})
+	applyRequest(t, f, 3, SetRequestType, &api.SetRequest{Key: "b", Value: []byte("1")})
+	if keys := f.migrations.take(slot, 10); len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("expected a to be recorded as changed got %v", keys)
+	}
+	if keys := f.migrations.take(slot, 10); len(keys) != 0 {
+		t.Errorf("expected changes to be taken once got %v", keys)
+	}
+
+	applyRequest(t, f, 4, SlotStateRequestType, &api.SlotStateRequest{Slot: uint32(slot), Track: true, Fence: true, Target: 2})
+	b, err := proto.Marshal(&api.SetRequest{Key: "a", Value: []byte("2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := f.apply(5, append([]byte{byte(SetRequestType)}, b...))
+	err, ok := res.(error)
+	if !ok || !strings.HasPrefix(err.Error(), "ASK ") || !strings.HasSuffix(err.Error(), " 2") {
+		t.Errorf("expected an ASK to group 2 got %v", res)
+	}
+	// other slots are unaffected
+	applyRequest(t, f, 6, SetRequestType, &api.SetRequest{Key: "b", Value: []byte("2")})
+
+	applyRequest(t, f, 7, SlotStateRequestType, &api.SlotStateRequest{Slot: uint32(slot), Purge: true})
+	if v, _ := f.store.Get([]byte("a")); v != nil {
+		t.Errorf("expected purge to delete the slot's keys")
+	}
+	if v, _ := f.store.Get([]byte("b")); v == nil {
+		t.Errorf("expected purge to keep other slots")
+	}
+	applyRequest(t, f, 8, SetRequestType, &api.SetRequest{Key: "a", Value: []byte("3")})
+}
+
+func TestDumpAndRestore(t *testing.T) {
+	source, src := newTestFSM(t, "source.db")
+	target, _ := newTestFSM(t, "target.db")
+	applyRequest(t, source, 1, SetRequestType, &api.SetRequest{Key: "{s}.string", Value: []byte("v")})
+	applyRequest(t, source, 2, ExpireRequestType, &api.ExpireRequest{Key: "{s}.string", ExpiresAt: 4102444800000})
+	applyRequest(t, source, 3, ZAddRequestType, &api.ZAddRequest{Key: "{s}.zset", Members: []*api.ZMember{
+		{Member: []byte("m"), Score: 1.5},
+	}})
+	applyRequest(t, source, 4, LockRequestType, &api.LockRequest{Name: "{s}.lock", Owner: "o", TtlMs: 1000, Now: 1})
+
+	slot := api.KeySlot("s")
+	keys, err := slotKeys(src.store, src.locks, slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 keys got %v", keys)
+	}
+	var entries []*api.KeyDump
+	for _, key := range append(keys, "{s}.missing") {
+		entry, err := src.dumpKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	applyRequest(t, target, 1, SetRequestType, &api.SetRequest{Key: "{s}.missing", Value: []byte("stale")})
+	applyRequest(t, target, 2, RestoreKeysRequestType, &api.RestoreKeysRequest{Entries: entries})
+
+	if v, _ := target.store.Get([]byte("{s}.string")); !bytes.Equal(v, []byte("v")) {
+		t.Errorf("expected string to be restored got %q", v)
+	}
+	if at, _ := target.store.ExpiresAt([]byte("{s}.string")); at != 4102444800000 {
+		t.Errorf("expected expiry to be restored got %d", at)
+	}
+	if score, ok, _ := target.store.ZScore([]byte("{s}.zset"), []byte("m")); !ok || score != 1.5 {
+		t.Errorf("expected sorted set to be restored got %v %v", score, ok)
+	}
+	if lock, _ := target.locks.GetLock([]byte("{s}.lock")); lock == nil {
+		t.Errorf("expected lock to be restored")
+	}
+	if v, _ := target.store.Get([]byte("{s}.missing")); v != nil {
+		t.Errorf("expected deleted key to be removed got %q", v)
+	}
+}
+
+func TestMigrateLockTokens(t *testing.T) {
+	source, src := newTestFSM(t, "source.db")
+	target, dst := newTestFSM(t, "target.db")
+	migrate := func(index uint64, from *DistributedStorage, to *fsm, name string) {
+		entry, err := from.dumpKey(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		applyRequest(t, to, index, RestoreKeysRequestType, &api.RestoreKeysRequest{Entries: []*api.KeyDump{entry}})
+	}
+	lock := func(f *fsm, index uint64, owner string) *api.LockResponse {
+		return applyRequest(t, f, index, LockRequestType, &api.LockRequest{Name: "{s}.lock", Owner: owner, TtlMs: 1000, Now: 1}).(*api.LockResponse)
+	}
+
+	// a released lock moves to a group whose log is far behind
+	if res := lock(source, 100, "a"); res.Token != 100 {
+		t.Fatalf("expected token 100 got %+v", res)
+	}
+	applyRequest(t, source, 101, UnlockRequestType, &api.UnlockRequest{Name: "{s}.lock", Owner: "a", Token: 100})
+	migrate(2, src, target, "{s}.lock")
+	res := lock(target, 3, "b")
+	if !res.Acquired || res.Token <= 100 {
+		t.Errorf("expected a token above 100 got %+v", res)
+	}
+
+	// a held lock moves back and is released by its holder
+	held := res.Token
+	migrate(200, dst, source, "{s}.lock")
+	unlock := applyRequest(t, source, 201, UnlockRequestType, &api.UnlockRequest{Name: "{s}.lock", Owner: "b", Token: held}).(*api.UnlockResponse)
+	if !unlock.Released {
+		t.Errorf("expected the holder to release the migrated lock")
+	}
+	if res := lock(source, 202, "c"); res.Token <= held {
+		t.Errorf("expected a token above %d got %+v", held, res)
+	}
+
+	// restoring an older state does not lower the token
+	applyRequest(t, target, 4, RestoreKeysRequestType, &api.RestoreKeysRequest{Entries: []*api.KeyDump{{Key: "{s}.lock"}}})
+	if res := lock(target, 5, "d"); res.Token <= held {
+		t.Errorf("expected a token above %d got %+v", held, res)
+	}
+}
@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+	"github.com/rs/zerolog/log"
+)
+
+// The migration coordinator runs on every node but only acts while the node
+// leads group 0. Queued migrations are part of the slot configuration so a
+// new leader carries on with them, restarting the slot that was in flight.
+
+var errMigrationMoved = errors.New("migration was taken over or cancelled")
+
+const (
+	migrateInterval = time.Second
+	// changeRounds bounds how long changes are copied before fencing.
+	changeRounds = 10
+	slotRetries  = 5
+)
+
+type migrator struct {
+	server *Server
+	admin  chickaree.AdminServer
+	limit  uint32
+}
+
+func (s *Server) setupMigrator() error {
+	m := &migrator{server: s, admin: s.Admin(), limit: defaultDumpLimit}
+	go m.run(s.shutdowns)
+	return nil
+}
+
+func (m *migrator) run(done <-chan struct{}) {
+	ticker := time.NewTicker(migrateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			for m.server.groups[0].store.IsLeader() {
+				more, err := m.step(context.Background())
+				if err != nil {
+					log.Error().Err(err).Msg("unable to migrate slot")
+				}
+				if err != nil || !more {
+					break
+				}
+			}
+		}
+	}
+}
+
+// step persists the initial assignment or migrates the next queued slot,
+// it returns true if there are more slots to migrate.
+func (m *migrator) step(ctx context.Context) (bool, error) {
+	config := m.server.slots.Config()
+	if config.Version == 0 {
+		_, err := m.server.updateSlots(func(*chickaree.SlotConfig) error { return nil })
+		return false, err
+	}
+	if len(config.Migrations) == 0 {
+		return false, nil
+	}
+	if err := m.migrate(ctx, config.Migrations[0]); err != nil {
+		return false, err
+	}
+	return len(config.Migrations) > 1, nil
+}
+
+func findMigration(config *chickaree.SlotConfig, slot uint32) (int, *chickaree.SlotMigration) {
+	for i, mig := range config.Migrations {
+		if mig.Slot == slot {
+			return i, mig
+		}
+	}
+	return -1, nil
+}
+
+func (m *migrator) migrate(ctx context.Context, mig *chickaree.SlotMigration) error {
+	// a new attempt stops a previous coordinator from flipping the slot
+	var attempt uint32
+	if _, err := m.server.updateSlots(func(config *chickaree.SlotConfig) error {
+		_, cur := findMigration(config, mig.Slot)
+		if cur == nil {
+			return errMigrationMoved
+		}
+		cur.State = chickaree.MigrationState_MIGRATION_MIGRATING
+		cur.Attempt++
+		attempt = cur.Attempt
+		return nil
+	}); err != nil {
+		return err
+	}
+	logger := log.With().Uint32("slot", mig.Slot).Uint32("source", mig.Source).Uint32("target", mig.Target).Logger()
+	logger.Info().Uint32("attempt", attempt).Msg("migrating slot")
+
+	if _, err := m.admin.SetSlotState(ctx, &chickaree.SlotStateRequest{
+		Group: mig.Source,
+		Slot:  mig.Slot,
+		Track: true,
+	}); err != nil {
+		return err
+	}
+	if err := m.copySnapshot(ctx, mig); err != nil {
+		return err
+	}
+	for i := 0; i < changeRounds; i++ {
+		n, err := m.copyChanges(ctx, mig)
+		if err != nil {
+			return err
+		}
+		if n < int(m.limit) {
+			break
+		}
+	}
+	if _, err := m.admin.SetSlotState(ctx, &chickaree.SlotStateRequest{
+		Group:  mig.Source,
+		Slot:   mig.Slot,
+		Track:  true,
+		Fence:  true,
+		Target: mig.Target,
+	}); err != nil {
+		return err
+	}
+	for {
+		n, err := m.copyChanges(ctx, mig)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+	}
+	if _, err := m.server.updateSlots(func(config *chickaree.SlotConfig) error {
+		i, cur := findMigration(config, mig.Slot)
+		if cur == nil || cur.Attempt != attempt {
+			return errMigrationMoved
+		}
+		config.Owners[mig.Slot] = mig.Target
+		config.Migrations = append(config.Migrations[:i], config.Migrations[i+1:]...)
+		return nil
+	}); err != nil {
+		return err
+	}
+	logger.Info().Msg("slot migrated")
+	if _, err := m.admin.SetSlotState(ctx, &chickaree.SlotStateRequest{
+		Group: mig.Source,
+		Slot:  mig.Slot,
+		Purge: true,
+	}); err != nil {
+		logger.Warn().Err(err).Msg("unable to purge migrated slot")
+	}
+	return nil
+}
+
+func (m *migrator) copySnapshot(ctx context.Context, mig *chickaree.SlotMigration) error {
+	after := ""
+	for {
+		resp, err := m.admin.DumpSlot(ctx, &chickaree.DumpSlotRequest{
+			Group: mig.Source,
+			Slot:  mig.Slot,
+			After: after,
+			Limit: m.limit,
+		})
+		if err != nil {
+			return err
+		}
+		if err := m.restore(ctx, mig, resp.Entries); err != nil {
+			return err
+		}
+		if resp.Next == "" {
+			return nil
+		}
+		after = resp.Next
+	}
+}
+
+func (m *migrator) copyChanges(ctx context.Context, mig *chickaree.SlotMigration) (int, error) {
+	resp, err := m.admin.DumpSlot(ctx, &chickaree.DumpSlotRequest{
+		Group:   mig.Source,
+		Slot:    mig.Slot,
+		Changes: true,
+		Limit:   m.limit,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(resp.Entries), m.restore(ctx, mig, resp.Entries)
+}
+
+func (m *migrator) restore(ctx context.Context, mig *chickaree.SlotMigration, entries []*chickaree.KeyDump) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	_, err := m.admin.RestoreKeys(ctx, &chickaree.RestoreKeysRequest{
+		Group:   mig.Target,
+		Entries: entries,
+	})
+	return err
+}
+
+// updateSlots applies fn to the current assignment and replicates it, fn is
+// retried if the assignment changes underneath it. It must be called on the
+// leader of group 0.
+func (s *Server) updateSlots(fn func(config *chickaree.SlotConfig) error) (*chickaree.SlotConfig, error) {
+	var err error
+	for i := 0; i < slotRetries; i++ {
+		config := s.slots.Config()
+		if err := fn(config); err != nil {
+			return nil, err
+		}
+		config.Version++
+		err = s.groups[0].store.UpdateSlots(config)
+		if !errors.Is(err, ErrSlotConfigChanged) {
+			return config, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil, err
+}
+
+// queueMigrations adds migrations for slots that are not already moving.
+func queueMigrations(config *chickaree.SlotConfig, migrations []*chickaree.SlotMigration) []*chickaree.SlotMigration {
+	var queued []*chickaree.SlotMigration
+	for _, mig := range migrations {
+		if _, cur := findMigration(config, mig.Slot); cur != nil || config.Owners[mig.Slot] == mig.Target {
+			continue
+		}
+		mig.Source = config.Owners[mig.Slot]
+		mig.State = chickaree.MigrationState_MIGRATION_PENDING
+		config.Migrations = append(config.Migrations, mig)
+		queued = append(queued, mig)
+	}
+	return queued
+}
+
+// planRebalance moves the highest slots of groups owning more than their
+// share to groups owning less. Queued migrations count for their target.
+func planRebalance(config *chickaree.SlotConfig, groups int) []*chickaree.SlotMigration {
+	owners := append([]uint32{}, config.Owners...)
+	moving := make(map[uint32]bool)
+	for _, mig := range config.Migrations {
+		owners[mig.Slot] = mig.Target
+		moving[mig.Slot] = true
+	}
+	counts := make([]int, groups)
+	for _, g := range owners {
+		counts[g]++
+	}
+	share := func(g int) int {
+		n := chickaree.SlotCount / groups
+		if g < chickaree.SlotCount%groups {
+			n++
+		}
+		return n
+	}
+	var moves []*chickaree.SlotMigration
+	for slot := chickaree.SlotCount - 1; slot >= 0; slot-- {
+		g := int(owners[slot])
+		if moving[uint32(slot)] || counts[g] <= share(g) {
+			continue
+		}
+		target := -1
+		for t := range counts {
+			if counts[t] < share(t) {
+				target = t
+				break
+			}
+		}
+		if target < 0 {
+			break
+		}
+		moves = append(moves, &chickaree.SlotMigration{
+			Slot:   uint32(slot),
+			Source: config.Owners[slot],
+			Target: uint32(target),
+		})
+		counts[g]--
+		counts[target]++
+	}
+	return moves
+}
+
+func validMigrations(req *chickaree.MigrateSlotsRequest, groups int) error {
+	if int(req.Target) >= groups {
+		return fmt.Errorf("unknown raft group %d", req.Target)
+	}
+	for _, slot := range req.Slots {
+		if slot >= chickaree.SlotCount {
+			return fmt.Errorf("invalid slot %d", slot)
+		}
+	}
+	return nil
+}
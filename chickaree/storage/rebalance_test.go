@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+)
+
+func TestPlanRebalance(t *testing.T) {
+	config := defaultSlotConfig(2)
+	moves := planRebalance(config, 4)
+	if queued := queueMigrations(config, moves); len(queued) != len(moves) {
+		t.Fatalf("expected all %d moves to be queued got %d", len(moves), len(queued))
+	}
+	counts := make([]int, 4)
+	for _, owner := range config.Owners {
+		counts[owner]++
+	}
+	for _, mig := range config.Migrations {
+		counts[mig.Source]--
+		counts[mig.Target]++
+	}
+	for g, n := range counts {
+		if n != chickaree.SlotCount/4 {
+			t.Errorf("expected group %d to own %d slots got %d", g, chickaree.SlotCount/4, n)
+		}
+	}
+	if again := planRebalance(config, 4); len(again) != 0 {
+		t.Errorf("expected queued migrations to be counted got %d more moves", len(again))
+	}
+}
+
+func TestQueueMigrations(t *testing.T) {
+	config := defaultSlotConfig(2)
+	queued := queueMigrations(config, []*chickaree.SlotMigration{
+		{Slot: 0, Target: 1},
+		{Slot: 0, Target: 1},
+		{Slot: 1, Target: 0},
+	})
+	if len(queued) != 1 || queued[0].Source != 0 || queued[0].State != chickaree.MigrationState_MIGRATION_PENDING {
+		t.Errorf("expected only the first migration to be queued got %v", queued)
+	}
+	if len(config.Migrations) != 1 {
+		t.Errorf("unexpected migrations %v", config.Migrations)
+	}
+}
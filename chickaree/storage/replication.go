@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// A cluster is mirrored by reading the writes each raft group of the
+// primary has applied and replaying them through the leaders of a read only
+// secondary. Writes are replayed at least once, the commands are
+// idempotent apart from locks. Lock commands are replayed at the primary's
+// index so holders keep their fencing tokens, and as a lock is never given
+// a token below one it has held tokens keep increasing after failing over.
+// Locks acquired on the primary but not yet replicated are lost.
+
+const defaultReadLogLimit = 500
+
+var (
+	ErrReadOnly   = errors.New("READONLY You can't write against a read only replica.")
+	ErrNotReplica = errors.New("unable to replicate to a writable cluster")
+)
+
+// replicated reports whether a command is copied to a secondary, slot
+// assignments are left to each cluster.
+func replicated(reqType RequestType) bool {
+	_, ok := writeRequests[reqType]
+	return ok || reqType == RestoreKeysRequestType
+}
+
+// ReadLog returns the writes applied after req.After. Only entries still in
+// the log can be read, FirstIndex tells the caller when it needs to copy
+// the keys instead.
+func (s *DistributedStorage) ReadLog(req *api.ReadLogRequest) (*api.ReadLogResponse, error) {
+	return readLog(s.logs, req, s.raft.AppliedIndex())
+}
+
+func readLog(logs raft.LogStore, req *api.ReadLogRequest, applied uint64) (*api.ReadLogResponse, error) {
+	first, err := logs.FirstIndex()
+	if err != nil {
+		log.Error().Err(err).Msg("unable to read first log index")
+		return nil, errors.New("unable to read log")
+	}
+	resp := &api.ReadLogResponse{
+		Last:         req.After,
+		AppliedIndex: applied,
+		FirstIndex:   first,
+	}
+	if req.After+1 < first {
+		return resp, nil
+	}
+	limit := uint64(req.Limit)
+	if limit == 0 {
+		limit = defaultReadLogLimit
+	}
+	for i := req.After + 1; i <= applied && i <= req.After+limit; i++ {
+		var entry raft.Log
+		if err := logs.GetLog(i, &entry); err != nil {
+			if errors.Is(err, raft.ErrLogNotFound) {
+				// compacted while reading
+				resp.FirstIndex = i + 1
+				break
+			}
+			log.Error().Err(err).Uint64("index", i).Msg("unable to read log entry")
+			return nil, errors.New("unable to read log")
+		}
+		resp.Last = i
+		if entry.Type != raft.LogCommand || len(entry.Data) == 0 || !replicated(RequestType(entry.Data[0])) {
+			continue
+		}
+		e := &api.LogEntry{Index: i, Data: entry.Data}
+		if !entry.AppendedAt.IsZero() {
+			e.AppendedAt = entry.AppendedAt.UnixNano() / int64(time.Millisecond)
+		}
+		resp.Entries = append(resp.Entries, e)
+	}
+	return resp, nil
+}
+
+// entryGroup finds the group owning the keys of a replicated write.
+// Entries that are not replicated are skipped by whichever group gets them.
+func (s *Server) entryGroup(entry *api.LogEntry) (*group, error) {
+	if len(entry.Data) == 0 {
+		return s.groups[0], nil
+	}
+	var req proto.Message
+	reqType := RequestType(entry.Data[0])
+	if newReq, ok := writeRequests[reqType]; ok {
+		req = newReq()
+	} else if reqType == RestoreKeysRequestType {
+		req = &api.RestoreKeysRequest{}
+	} else {
+		return s.groups[0], nil
+	}
+	if err := proto.Unmarshal(entry.Data[1:], req); err != nil {
+		log.Error().Err(err).Uint64("index", entry.Index).Msg("unable to decode replicated entry")
+		return nil, errors.New("unable to replicate entry")
+	}
+	return s.groupFor(req)
+}
+
+// Replicate applies writes read from a primary, it fails unless the group
+// is read only.
+func (s *DistributedStorage) Replicate(entries []*api.LogEntry) error {
+	_, err := s.apply(ReplicateRequestType, &api.ReplicateRequest{Entries: entries})
+	return err
+}
+
+func (s *DistributedStorage) SetReadOnly(readOnly bool) error {
+	_, err := s.apply(ReadOnlyRequestType, &api.ReadOnlyRequest{ReadOnly: readOnly})
+	return err
+}
+
+// ReadOnly reports whether the group only accepts replicated writes.
+func (s *DistributedStorage) ReadOnly() bool {
+	return s.fsm.isReadOnly()
+}
+
+func (s *fsm) isReadOnly() bool {
+	return atomic.LoadInt32(&s.readOnly) == 1
+}
+
+func (s *fsm) applyReadOnly(b []byte) interface{} {
+	var req api.ReadOnlyRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	var v int32
+	if req.ReadOnly {
+		v = 1
+	}
+	atomic.StoreInt32(&s.readOnly, v)
+	return &api.ReadOnlyResponse{ReadOnly: req.ReadOnly}
+}
+
+// applyReplicate stops at the first write to a slot this group is
+// migrating away, the caller retries the remaining entries.
+func (s *fsm) applyReplicate(index uint64, b []byte) interface{} {
+	var req api.ReplicateRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	if !s.isReadOnly() {
+		return ErrNotReplica
+	}
+	for _, entry := range req.Entries {
+		if len(entry.Data) == 0 || !replicated(RequestType(entry.Data[0])) {
+			continue
+		}
+		at := entry.Index
+		if at == 0 {
+			at = index
+		}
+		res := s.applyWrite(at, entry.Data)
+		err, ok := res.(error)
+		if !ok {
+			continue
+		}
+		if _, migrating := err.(askError); migrating {
+			return ErrTryAgain
+		}
+		// the primary applied the same command so it failed there too
+		log.Debug().Err(err).Uint64("index", entry.Index).Msg("replicated write failed")
+	}
+	return &api.ReplicateResponse{}
+}
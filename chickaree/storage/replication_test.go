@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/hashicorp/raft"
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"google.golang.org/protobuf/proto"
+)
+
+func command(t *testing.T, reqType RequestType, req proto.Message) []byte {
+	b, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte{byte(reqType)}, b...)
+}
+
+func TestReadOnly(t *testing.T) {
+	f, _ := newTestFSM(t, "replica.db")
+	set := &api.SetRequest{Key: "a", Value: []byte("1")}
+	res := f.apply(1, command(t, ReplicateRequestType, &api.ReplicateRequest{Entries: []*api.LogEntry{
+		{Data: command(t, SetRequestType, set)},
+	}}))
+	if res != ErrNotReplica {
+		t.Errorf("expected a writable group to reject replication got %v", res)
+	}
+
+	applyRequest(t, f, 2, ReadOnlyRequestType, &api.ReadOnlyRequest{ReadOnly: true})
+	if res := f.apply(3, command(t, SetRequestType, set)); res != ErrReadOnly {
+		t.Errorf("expected writes to be rejected got %v", res)
+	}
+	applyRequest(t, f, 4, ReplicateRequestType, &api.ReplicateRequest{Entries: []*api.LogEntry{
+		{Index: 10, Data: command(t, SetRequestType, set)},
+		// failed on the primary as well
+		{Index: 11, Data: command(t, ZAddRequestType, &api.ZAddRequest{Key: "a", Members: []*api.ZMember{{Member: []byte("m")}}})},
+		{Index: 12, Data: command(t, UpdateSlotsRequestType, &api.SlotConfig{})},
+		{Index: 13, Data: command(t, SetRequestType, &api.SetRequest{Key: "b", Value: []byte("2")})},
+	}})
+	for _, key := range []string{"a", "b"} {
+		if v, _ := f.store.Get([]byte(key)); v == nil {
+			t.Errorf("expected %s to be replicated", key)
+		}
+	}
+
+	slot := api.KeySlot("c")
+	applyRequest(t, f, 5, SlotStateRequestType, &api.SlotStateRequest{Slot: uint32(slot), Fence: true, Target: 1})
+	res = f.apply(6, command(t, ReplicateRequestType, &api.ReplicateRequest{Entries: []*api.LogEntry{
+		{Data: command(t, SetRequestType, &api.SetRequest{Key: "c", Value: []byte("3")})},
+	}}))
+	if res != ErrTryAgain {
+		t.Errorf("expected a fenced slot to be retried got %v", res)
+	}
+
+	applyRequest(t, f, 7, ReadOnlyRequestType, &api.ReadOnlyRequest{})
+	applyRequest(t, f, 8, SetRequestType, set)
+}
+
+func TestReplicateLockTokens(t *testing.T) {
+	f, _ := newTestFSM(t, "replica.db")
+	applyRequest(t, f, 1, ReadOnlyRequestType, &api.ReadOnlyRequest{ReadOnly: true})
+	applyRequest(t, f, 2, ReplicateRequestType, &api.ReplicateRequest{Entries: []*api.LogEntry{
+		{Index: 500, Data: command(t, LockRequestType, &api.LockRequest{Name: "a", Owner: "o", TtlMs: 1000, Now: 1})},
+		{Index: 600, Data: command(t, LockRequestType, &api.LockRequest{Name: "b", Owner: "o", TtlMs: 1000, Now: 1})},
+		{Index: 601, Data: command(t, UnlockRequestType, &api.UnlockRequest{Name: "b", Owner: "o", Token: 600})},
+	}})
+	if state, _ := f.lockState("a"); state == nil || state.Token != 500 {
+		t.Errorf("expected the primary's token got %v", state)
+	}
+
+	// after failing over the secondary's log is behind the primary's tokens
+	applyRequest(t, f, 3, ReadOnlyRequestType, &api.ReadOnlyRequest{})
+	unlock := applyRequest(t, f, 4, UnlockRequestType, &api.UnlockRequest{Name: "a", Owner: "o", Token: 500}).(*api.UnlockResponse)
+	if !unlock.Released {
+		t.Errorf("expected the holder to release with its token")
+	}
+	for name, token := range map[string]uint64{"a": 500, "b": 600} {
+		res := applyRequest(t, f, 5, LockRequestType, &api.LockRequest{Name: name, Owner: "p", TtlMs: 1000, Now: 1}).(*api.LockResponse)
+		if !res.Acquired || res.Token <= token {
+			t.Errorf("expected a token above %d for %s got %+v", token, name, res)
+		}
+	}
+}
+
+func TestReadLog(t *testing.T) {
+	logs := raft.NewInmemStore()
+	var entries []*raft.Log
+	for i, data := range [][]byte{
+		command(t, SetRequestType, &api.SetRequest{Key: "a"}),
+		command(t, UpdateSlotsRequestType, &api.SlotConfig{}),
+		nil,
+		command(t, DeleteRequestType, &api.DeleteRequest{Keys: []string{"a"}}),
+		command(t, SetRequestType, &api.SetRequest{Key: "b"}),
+	} {
+		entries = append(entries, &raft.Log{Index: uint64(i + 1), Type: raft.LogCommand, Data: data})
+	}
+	entries[2].Type = raft.LogNoop
+	if err := logs.StoreLogs(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := readLog(logs, &api.ReadLogRequest{Limit: 4}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Last != 4 || len(resp.Entries) != 2 || resp.Entries[1].Index != 4 {
+		t.Errorf("expected the writes up to 4 got %d %v", resp.Last, resp.Entries)
+	}
+	resp, err = readLog(logs, &api.ReadLogRequest{After: 4}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Last != 4 || len(resp.Entries) != 0 {
+		t.Errorf("expected unapplied entries to be skipped got %v", resp.Entries)
+	}
+
+	if err := logs.DeleteRange(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = readLog(logs, &api.ReadLogRequest{}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.FirstIndex != 3 || len(resp.Entries) != 0 {
+		t.Errorf("expected compaction to be reported got %d %v", resp.FirstIndex, resp.Entries)
+	}
+}
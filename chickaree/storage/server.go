@@ -7,28 +7,43 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/hashicorp/raft"
 	"github.com/holmes89/chickaree-db/chickaree"
 	"github.com/holmes89/chickaree-db/chickaree/discovery"
+	"github.com/holmes89/chickaree-db/chickaree/encryption"
+	"github.com/holmes89/chickaree-db/chickaree/tlsconfig"
 	"github.com/rs/zerolog/log"
 	"github.com/soheilhy/cmux"
+	"google.golang.org/grpc"
 )
 
 type Server struct {
 	chickaree.UnimplementedChickareeDBServer
 	ServerConfig
-	store      *DistributedStorage
-	membership *discovery.Membership
-	mux        cmux.CMux
+	groups      []*group
+	slots       *slotMap
+	acls        *aclMap
+	membership  *discovery.Membership
+	leaderConns connPool
+	mux         cmux.CMux
 
 	shutdown     bool
 	shutdowns    chan struct{}
 	shutdownLock sync.Mutex
 }
 
+// group is one raft group owning a range of hash slots.
+type group struct {
+	id        int
+	store     *DistributedStorage
+	autopilot *autopilot
+}
+
 func NewServer(config ServerConfig) (*Server, error) {
 
 	s := &Server{
@@ -37,9 +52,12 @@ func NewServer(config ServerConfig) (*Server, error) {
 	}
 
 	setup := []func() error{
+		s.setupTLS,
 		s.setupMux,
 		s.setupStorage,
 		s.setupMembership,
+		s.setupBootstrap,
+		s.setupMigrator,
 	}
 	for _, fn := range setup {
 		if err := fn(); err != nil {
@@ -65,7 +83,10 @@ func (s *Server) Close() error {
 	close(s.shutdowns)
 	shutdown := []func() error{
 		s.membership.Leave,
-		s.store.Close,
+		s.leaderConns.Close,
+	}
+	for _, g := range s.groups {
+		shutdown = append(shutdown, g.store.Close)
 	}
 
 	for _, fn := range shutdown {
@@ -85,29 +106,62 @@ func (s *Server) setupMembership() (err error) {
 		log.Error().Err(err).Msg("unable to resolve rpc")
 		return errors.New("unable to setup membership")
 	}
-	s.membership, err = discovery.New(s.store, discovery.Config{
-		NodeName: s.ServerConfig.NodeName,
-		BindAddr: s.ServerConfig.BindAddr,
-		Tags: map[string]string{
-			"rpc_addr": rpcAddr,
-		},
-		StartJoinAddrs: s.ServerConfig.StartJoinAddrs,
-	})
+	handlers := make([]discovery.Handler, len(s.groups))
+	for i, g := range s.groups {
+		handlers[i] = g.store
+	}
+	tags := map[string]string{
+		discovery.RPCAddrTag: rpcAddr,
+		discovery.RoleTag:    s.ServerConfig.Role,
+	}
+	if s.ServerConfig.BootstrapExpect > 0 {
+		tags[discovery.ExpectTag] = strconv.Itoa(s.ServerConfig.BootstrapExpect)
+	}
+	s.membership, err = discovery.New(discovery.Config{
+		NodeName:          s.ServerConfig.NodeName,
+		BindAddr:          s.ServerConfig.BindAddr,
+		Tags:              tags,
+		StartJoinAddrs:    s.ServerConfig.StartJoinAddrs,
+		RetryJoinInterval: s.ServerConfig.RetryJoinInterval,
+		RetryJoinMax:      s.ServerConfig.RetryJoinMax,
+		EncryptKey:        s.ServerConfig.Encrypt,
+		KeyringFile:       s.ServerConfig.KeyringFile,
+	}, handlers...)
 	if err != nil {
 		log.Error().Err(err).Msg("unable to setup membership")
 		return errors.New("unable to setup membership")
 	}
 	log.Info().Msg("membership established.")
 
+	for _, g := range s.groups {
+		go s.watchLeadership(g)
+		g.autopilot = newAutopilot(s.ServerConfig.Config.Autopilot, g.store, s.membership.Members)
+		g.autopilot.group = uint32(g.id)
+		g.autopilot.opts = s.leaderConns.opts
+		go g.autopilot.run(s.shutdowns)
+	}
+
 	return nil
 }
 
-func (s *Server) setupStorage() error {
-	store, err := newStorage(s.ServerConfig.StoragePath)
-	if err != nil {
-		log.Error().Err(err).Msg("unable to create storage")
-		return errors.New("unable to setup storage")
+// watchLeadership reconciles membership as soon as this node becomes leader
+// of a group to pick up any events missed while it was a follower.
+func (s *Server) watchLeadership(g *group) {
+	leaderCh := g.store.LeaderCh()
+	for {
+		select {
+		case <-s.shutdowns:
+			return
+		case isLeader := <-leaderCh:
+			if isLeader {
+				log.Info().Int("group", g.id).Msg("gained leadership, reconciling members")
+				s.membership.Reconcile()
+			}
+		}
 	}
+}
+
+func (s *Server) setupStorage() error {
 	raftLn := s.mux.Match(func(reader io.Reader) bool {
 		b := make([]byte, 1)
 		if _, err := reader.Read(b); err != nil {
@@ -115,37 +169,153 @@ func (s *Server) setupStorage() error {
 		}
 		return bytes.Compare(b, []byte{byte(RaftRPC)}) == 0
 	})
-	config := s.ServerConfig.Config
-	config.Raft.StreamLayer = NewStreamLayer(
-		raftLn,
-		s.ServerConfig.ServerTLSConfig,
-		s.ServerConfig.PeerTLSConfig,
-	)
+	raftMux := newRaftMux(raftLn)
 	rpcAddr, err := s.ServerConfig.RPCAddr()
 	if err != nil {
 		log.Error().Err(err).Msg("unable to get rpc addr")
 		return errors.New("unable to setup storage")
 	}
-	config.Raft.BindAddr = rpcAddr
-	config.Raft.LocalID = raft.ServerID(s.ServerConfig.NodeName)
-	config.Raft.Bootstrap = s.ServerConfig.Bootstrap
-	s.store, err = NewDistributedStorage(
-		store,
-		config,
-	)
+	groups := s.ServerConfig.RaftGroups
+	if groups < 1 {
+		groups = 1
+	}
+	slotsDir := groupConfig(s.ServerConfig.Config, 0, groups).RaftDir
+	s.slots, err = newSlotMap(filepath.Join(slotsDir, slotsFile), groups)
 	if err != nil {
-		log.Error().Err(err).Msg("unable to create distributed storage")
+		log.Error().Err(err).Msg("unable to load slot configuration")
 		return errors.New("unable to setup storage")
 	}
-	if s.ServerConfig.Bootstrap {
-		if err := s.store.WaitForLeader(3 * time.Second); err != nil {
-			log.Error().Err(err).Msg("unable to wait for leader")
+	s.acls, err = newACLMap(filepath.Join(slotsDir, aclFile))
+	if err != nil {
+		log.Error().Err(err).Msg("unable to load acl")
+		return errors.New("unable to setup storage")
+	}
+	keys, err := s.setupEncryption()
+	if err != nil {
+		return err
+	}
+	var stores []*store
+	for i := 0; i < groups; i++ {
+		config := groupConfig(s.ServerConfig.Config, i, groups)
+		if i == 0 {
+			config.slots = s.slots
+			config.acls = s.acls
+		}
+		config.keys = keys
+		config.compressor = newCompressor(config.Compression)
+		store, err := newStorage(config)
+		if err != nil {
+			log.Error().Err(err).Int("group", i).Msg("unable to create storage")
+			return errors.New("unable to setup storage")
+		}
+		stores = append(stores, store)
+		config.Raft.StreamLayer = NewStreamLayer(
+			raftMux.Listener(uint8(i)),
+			uint8(i),
+			s.ServerConfig.ServerTLSConfig,
+			s.ServerConfig.PeerTLSConfig,
+		)
+		config.Raft.BindAddr = rpcAddr
+		config.Raft.LocalID = raft.ServerID(s.ServerConfig.NodeName)
+		config.Raft.Bootstrap = s.ServerConfig.Bootstrap
+		ds, err := NewDistributedStorage(
+			store,
+			config,
+		)
+		if err != nil {
+			log.Error().Err(err).Int("group", i).Msg("unable to create distributed storage")
 			return errors.New("unable to setup storage")
 		}
+		s.groups = append(s.groups, &group{id: i, store: ds})
+	}
+	if keys != nil {
+		// values left on an old key by a restart during rotation
+		go reencrypt(stores)
+		go keys.Watch(encryption.DefaultReloadInterval, s.shutdowns, func() { reencrypt(stores) })
+	}
+	if s.ServerConfig.Bootstrap {
+		for _, g := range s.groups {
+			if err := g.store.WaitForLeader(3 * time.Second); err != nil {
+				log.Error().Err(err).Int("group", g.id).Msg("unable to wait for leader")
+				return errors.New("unable to setup storage")
+			}
+		}
 	}
 	return nil
 }
 
+// setupEncryption loads the keyfile when encryption at rest is enabled.
+func (s *Server) setupEncryption() (*encryption.Keyring, error) {
+	if s.ServerConfig.EncryptionKeyFile == "" {
+		return nil, nil
+	}
+	keys, err := encryption.Load(s.ServerConfig.EncryptionKeyFile)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to load encryption keys")
+		return nil, errors.New("unable to setup storage")
+	}
+	log.Info().Str("keyfile", s.ServerConfig.EncryptionKeyFile).Msg("encryption at rest enabled")
+	return keys, nil
+}
+
+func reencrypt(stores []*store) {
+	for _, store := range stores {
+		if err := store.Reencrypt(); err != nil {
+			log.Error().Err(err).Str("path", store.path).Msg("unable to rotate encryption key")
+		}
+	}
+}
+
+// group returns a raft group by id.
+func (s *Server) group(id uint32) (*group, error) {
+	if int(id) >= len(s.groups) {
+		return nil, fmt.Errorf("unknown raft group %d", id)
+	}
+	return s.groups[id], nil
+}
+
+// storeFor returns the group storing the keys of a request, all keys must
+// belong to the same group.
+func (s *Server) storeFor(req interface{}) (*DistributedStorage, error) {
+	g, err := s.groupFor(req)
+	if err != nil {
+		return nil, err
+	}
+	return g.store, nil
+}
+
+func (s *Server) groupFor(req interface{}) (*group, error) {
+	id := -1
+	for _, key := range requestKeys(req) {
+		g, _ := s.slots.owner(chickaree.KeySlot(key))
+		if id >= 0 && g != id {
+			return nil, ErrCrossGroup
+		}
+		id = g
+	}
+	if id < 0 {
+		id = 0
+	}
+	return s.groups[id], nil
+}
+
+// setupTLS loads the certificates and keeps reloading them until shutdown.
+func (s *Server) setupTLS() error {
+	if s.ServerConfig.TLS.Enabled() && s.ServerConfig.ServerTLSConfig == nil {
+		certs, err := tlsconfig.New(s.ServerConfig.TLS)
+		if err != nil {
+			log.Error().Err(err).Msg("unable to load certificates")
+			return errors.New("unable to setup tls")
+		}
+		go certs.Watch(tlsconfig.DefaultReloadInterval, s.shutdowns)
+		s.ServerConfig.ServerTLSConfig = certs.ServerConfig()
+		s.ServerConfig.PeerTLSConfig = certs.ClientConfig()
+		log.Info().Str("cert", s.ServerConfig.TLS.CertFile).Msg("tls enabled")
+	}
+	s.leaderConns.opts = append([]grpc.DialOption{tlsconfig.DialOption(s.ServerConfig.PeerTLSConfig)}, chickaree.WithToken(s.ServerConfig.Auth.Token)...)
+	return nil
+}
+
 func (s *Server) setupMux() error {
 	log.Info().Str("bind-addr", s.ServerConfig.BindAddr).Msg("creating mux...")
 	addr, err := net.ResolveTCPAddr("tcp", s.ServerConfig.BindAddr)
@@ -169,7 +339,11 @@ func (s *Server) setupMux() error {
 }
 
 func (s *Server) Get(ctx context.Context, req *chickaree.GetRequest) (*chickaree.GetResponse, error) {
-	v, err := s.store.Get([]byte(req.Key))
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	v, err := store.Get([]byte(req.Key))
 
 	if err != nil {
 		return nil, err
@@ -182,25 +356,389 @@ func (s *Server) Get(ctx context.Context, req *chickaree.GetRequest) (*chickaree
 }
 
 func (s *Server) Set(ctx context.Context, req *chickaree.SetRequest) (*chickaree.SetResponse, error) {
-	err := s.store.Set([]byte(req.Key), req.Value)
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	err = store.Set([]byte(req.Key), req.Value)
 	return &chickaree.SetResponse{}, err
 }
 
+func (s *Server) SetBit(ctx context.Context, req *chickaree.SetBitRequest) (*chickaree.SetBitResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	return store.SetBit(req)
+}
+
+func (s *Server) GetBit(ctx context.Context, req *chickaree.GetBitRequest) (*chickaree.GetBitResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	v, err := store.Get([]byte(req.Key))
+	if err != nil {
+		return nil, err
+	}
+	return &chickaree.GetBitResponse{Value: getBit(v, req.Offset)}, nil
+}
+
+func (s *Server) BitCount(ctx context.Context, req *chickaree.BitCountRequest) (*chickaree.BitCountResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	v, err := store.Get([]byte(req.Key))
+	if err != nil {
+		return nil, err
+	}
+	count := bitCount(v, bitRangeRequest{
+		hasRange: req.HasRange,
+		start:    req.Start,
+		end:      req.End,
+		bitUnit:  req.BitUnit,
+	})
+	return &chickaree.BitCountResponse{Count: count}, nil
+}
+
+func (s *Server) BitPos(ctx context.Context, req *chickaree.BitPosRequest) (*chickaree.BitPosResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	v, err := store.Get([]byte(req.Key))
+	if err != nil {
+		return nil, err
+	}
+	pos := bitPos(v, req.Bit, bitRangeRequest{
+		hasStart: req.HasStart,
+		hasEnd:   req.HasEnd,
+		start:    req.Start,
+		end:      req.End,
+		bitUnit:  req.BitUnit,
+	})
+	return &chickaree.BitPosResponse{Position: pos}, nil
+}
+
+func (s *Server) BitOp(ctx context.Context, req *chickaree.BitOpRequest) (*chickaree.BitOpResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	return store.BitOp(req)
+}
+
+func (s *Server) BitField(ctx context.Context, req *chickaree.BitFieldRequest) (*chickaree.BitFieldResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	if !req.ReadOnly {
+		return store.BitField(req)
+	}
+	v, err := store.Get([]byte(req.Key))
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := applyBitFieldRequest(v, req)
+	return resp, err
+}
+
+func (s *Server) PFAdd(ctx context.Context, req *chickaree.PFAddRequest) (*chickaree.PFAddResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	return store.PFAdd(req)
+}
+
+func (s *Server) PFCount(ctx context.Context, req *chickaree.PFCountRequest) (*chickaree.PFCountResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	res := newHyperLogLog()
+	for _, key := range req.Keys {
+		v, err := store.Get([]byte(key))
+		if err != nil {
+			return nil, err
+		}
+		h, err := parseHyperLogLog(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(req.Keys) == 1 {
+			return &chickaree.PFCountResponse{Count: int64(h.Count())}, nil
+		}
+		res.Merge(h)
+	}
+	return &chickaree.PFCountResponse{Count: int64(res.estimate())}, nil
+}
+
+func (s *Server) PFMerge(ctx context.Context, req *chickaree.PFMergeRequest) (*chickaree.PFMergeResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	return store.PFMerge(req)
+}
+
+func (s *Server) GeoAdd(ctx context.Context, req *chickaree.GeoAddRequest) (*chickaree.GeoAddResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]ScoredMember, len(req.Points))
+	for i, p := range req.Points {
+		if !validCoordinates(p.Longitude, p.Latitude) {
+			return nil, ErrGeoCoordinates(p.Longitude, p.Latitude)
+		}
+		members[i] = ScoredMember{
+			Member: []byte(p.Member),
+			Score:  float64(geoHashScore(p.Longitude, p.Latitude)),
+		}
+	}
+	count, err := store.ZAdd([]byte(req.Key), members, ZAddOptions{
+		NX: req.Nx,
+		XX: req.Xx,
+		CH: req.Ch,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &chickaree.GeoAddResponse{Count: count}, nil
+}
+
+func (s *Server) GeoPos(ctx context.Context, req *chickaree.GeoPosRequest) (*chickaree.GeoPosResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	resp := &chickaree.GeoPosResponse{}
+	for _, member := range req.Members {
+		score, ok, err := store.ZScore([]byte(req.Key), []byte(member))
+		if err != nil {
+			return nil, err
+		}
+		pos := &chickaree.GeoPosition{Exists: ok}
+		if ok {
+			pos.Longitude, pos.Latitude = geoDecode(uint64(score))
+		}
+		resp.Positions = append(resp.Positions, pos)
+	}
+	return resp, nil
+}
+
+func (s *Server) GeoDist(ctx context.Context, req *chickaree.GeoDistRequest) (*chickaree.GeoDistResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	unit, err := geoUnit(req.Unit)
+	if err != nil {
+		return nil, err
+	}
+	var coords [2][2]float64
+	for i, member := range []string{req.Member1, req.Member2} {
+		score, ok, err := store.ZScore([]byte(req.Key), []byte(member))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return &chickaree.GeoDistResponse{}, nil
+		}
+		coords[i][0], coords[i][1] = geoDecode(uint64(score))
+	}
+	d := geoDistance(coords[0][0], coords[0][1], coords[1][0], coords[1][1])
+	return &chickaree.GeoDistResponse{Exists: true, Distance: d / unit}, nil
+}
+
+func (s *Server) GeoHash(ctx context.Context, req *chickaree.GeoHashRequest) (*chickaree.GeoHashResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	resp := &chickaree.GeoHashResponse{}
+	for _, member := range req.Members {
+		score, ok, err := store.ZScore([]byte(req.Key), []byte(member))
+		if err != nil {
+			return nil, err
+		}
+		res := &chickaree.GeoHashResult{Exists: ok}
+		if ok {
+			res.Hash = geoHashString(uint64(score))
+		}
+		resp.Hashes = append(resp.Hashes, res)
+	}
+	return resp, nil
+}
+
+func (s *Server) GeoSearch(ctx context.Context, req *chickaree.GeoSearchRequest) (*chickaree.GeoSearchResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	unit, err := geoUnit(req.Unit)
+	if err != nil {
+		return nil, err
+	}
+	shape := geoShape{
+		long:   req.Longitude,
+		lat:    req.Latitude,
+		byBox:  req.ByBox,
+		radius: req.Radius * unit,
+		width:  req.Width * unit,
+		height: req.Height * unit,
+	}
+	if !req.FromLonLat {
+		score, ok, err := store.ZScore([]byte(req.Key), []byte(req.FromMember))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrGeoMember
+		}
+		shape.long, shape.lat = geoDecode(uint64(score))
+	} else if !validCoordinates(shape.long, shape.lat) {
+		return nil, ErrGeoCoordinates(shape.long, shape.lat)
+	}
+	results, err := geoSearch(store, []byte(req.Key), shape, req.Sort, req.Count, req.Any)
+	if err != nil {
+		return nil, err
+	}
+	resp := &chickaree.GeoSearchResponse{}
+	for _, r := range results {
+		resp.Results = append(resp.Results, &chickaree.GeoSearchResult{
+			Member:    r.member,
+			Distance:  r.distance / unit,
+			Hash:      r.hash,
+			Longitude: r.long,
+			Latitude:  r.lat,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) Lock(ctx context.Context, req *chickaree.LockRequest) (*chickaree.LockResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	return store.Lock(req)
+}
+
+func (s *Server) Unlock(ctx context.Context, req *chickaree.UnlockRequest) (*chickaree.UnlockResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	return store.Unlock(req)
+}
+
+func (s *Server) Refresh(ctx context.Context, req *chickaree.RefreshRequest) (*chickaree.RefreshResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	return store.Refresh(req)
+}
+
+func (s *Server) Expire(ctx context.Context, req *chickaree.ExpireRequest) (*chickaree.ExpireResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	var at int64
+	if !req.Persist {
+		// expiry is decided once here so every replica agrees on it
+		at = time.Now().Add(time.Duration(req.TtlMs)*time.Millisecond).UnixNano() / int64(time.Millisecond)
+	}
+	ok, err := store.Expire([]byte(req.Key), at)
+	if err != nil {
+		return nil, err
+	}
+	return &chickaree.ExpireResponse{Updated: ok}, nil
+}
+
+func (s *Server) TTL(ctx context.Context, req *chickaree.TTLRequest) (*chickaree.TTLResponse, error) {
+	store, err := s.storeFor(req)
+	if err != nil {
+		return nil, err
+	}
+	key := []byte(req.Key)
+	size, err := store.Size(key)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 || store.isExpired(key) {
+		return &chickaree.TTLResponse{TtlMs: -2}, nil
+	}
+	at, err := store.ExpiresAt(key)
+	if err != nil {
+		return nil, err
+	}
+	if at == 0 {
+		return &chickaree.TTLResponse{TtlMs: -1}, nil
+	}
+	return &chickaree.TTLResponse{TtlMs: at - time.Now().UnixNano()/int64(time.Millisecond)}, nil
+}
+
+// GetServers is answered by the group's leader when there is one as only it
+// knows the progress of every server, otherwise the local view is returned.
 func (s *Server) GetServers(
 	ctx context.Context, req *chickaree.GetServersRequest,
 ) (
 	*chickaree.GetServersResponse, error) {
-	log.Info().Msg("get servers request...")
-	nameIP := make(map[string]string)
-	for _, m := range s.membership.Members() {
-		rpc := m.Tags["rpc_addr"]
-		addr := fmt.Sprintf("%s:8400", m.Addr.String())
-		log.Info().Str("ip", addr).Str("rpc", rpc).Msg("server member search")
-		nameIP[rpc] = addr
+	g, err := s.group(req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if conn, ctx, err := s.leader(ctx, g.store); err == nil && conn != nil {
+		resp, err := chickaree.NewChickareeDBClient(conn).GetServers(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+		log.Warn().Err(err).Msg("unable to get servers from leader, using local view")
 	}
-	servers, err := s.store.GetServers(nameIP)
+	servers, err := g.store.GetServers()
 	if err != nil {
 		return nil, err
 	}
+	status := make(map[string]string)
+	for _, m := range s.membership.Members() {
+		status[m.Name] = m.Status.String()
+	}
+	health := g.autopilot.serverHealth()
+	local := g.store.Stats()
+	for _, srv := range servers {
+		srv.SerfStatus = status[srv.Id]
+		if srv.Id == local.Id {
+			srv.LastContactMs = local.LastContactMs
+			srv.AppliedIndex = local.AppliedIndex
+		} else if h, ok := health[srv.Id]; ok {
+			srv.LastContactMs = h.lastContact
+			srv.AppliedIndex = h.appliedIndex
+		}
+	}
 	return &chickaree.GetServersResponse{Servers: servers}, nil
 }
+
+// GetShards returns the slots and servers of every group from this node's
+// view so proxies can send writes straight to each group's leader.
+func (s *Server) GetShards(ctx context.Context, req *chickaree.GetShardsRequest) (*chickaree.GetShardsResponse, error) {
+	resp := &chickaree.GetShardsResponse{}
+	for _, g := range s.groups {
+		servers, err := g.store.GetServers()
+		if err != nil {
+			return nil, err
+		}
+		resp.Shards = append(resp.Shards, &chickaree.Shard{
+			Group:   uint32(g.id),
+			Slots:   s.slots.ranges(g.id),
+			Servers: servers,
+		})
+	}
+	resp.Migrations = s.slots.Config().Migrations
+	return resp, nil
+}
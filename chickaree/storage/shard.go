@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"github.com/rs/zerolog/log"
+)
+
+// Keys are spread across raft groups by hash slot so writes to different
+// groups are committed by different leaders. Every node runs a replica of
+// every group so every node in the cluster must be started with the same
+// number of groups.
+
+var ErrCrossGroup = errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+
+// slotGroup returns the group owning a slot.
+func slotGroup(slot uint16, groups int) int {
+	return int(slot) * groups / api.SlotCount
+}
+
+// groupConfig returns the configuration of a group. Group 0 keeps the paths
+// of a single group deployment, others use their own files alongside it.
+// Each group is its own database so may compress differently.
+func groupConfig(config Config, group, groups int) Config {
+	if groups > 1 && config.MaxMemory > 0 {
+		config.MaxMemory /= ByteSize(groups)
+	}
+	if c, ok := config.GroupCompression[group]; ok {
+		if c.Algorithm != "" {
+			config.Compression.Algorithm = c.Algorithm
+		}
+		if c.Threshold != 0 {
+			config.Compression.Threshold = c.Threshold
+		}
+	}
+	if group == 0 {
+		return config
+	}
+	ext := filepath.Ext(config.StoragePath)
+	config.StoragePath = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(config.StoragePath, ext), group, ext)
+	config.RaftDir = filepath.Join(config.RaftDir, fmt.Sprintf("group-%d", group))
+	return config
+}
+
+// requestKeys returns the keys a request reads or writes.
+func requestKeys(req interface{}) []string {
+	switch r := req.(type) {
+	case *api.BitOpRequest:
+		return append([]string{r.Destination}, r.Keys...)
+	case *api.PFCountRequest:
+		return r.Keys
+	case *api.PFMergeRequest:
+		return append([]string{r.Destination}, r.Keys...)
+	case *api.DeleteRequest:
+		return r.Keys
+	case *api.RestoreKeysRequest:
+		keys := make([]string, len(r.Entries))
+		for i, entry := range r.Entries {
+			keys[i] = entry.Key
+		}
+		return keys
+	case *api.SetUserRequest:
+		// users are kept by group 0 whatever their name hashes to
+		return nil
+	case interface{ GetName() string }:
+		return []string{r.GetName()}
+	case interface{ GetKey() string }:
+		return []string{r.GetKey()}
+	}
+	return nil
+}
+
+// raftMux shares the raft listener between groups. Each connection starts
+// with the raft rpc byte followed by the group it is for.
+type raftMux struct {
+	ln net.Listener
+
+	mu     sync.Mutex
+	groups map[uint8]*groupListener
+}
+
+func newRaftMux(ln net.Listener) *raftMux {
+	m := &raftMux{
+		ln:     ln,
+		groups: make(map[uint8]*groupListener),
+	}
+	go m.serve()
+	return m
+}
+
+func (m *raftMux) Listener(group uint8) net.Listener {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.groups[group]
+	if !ok {
+		l = &groupListener{
+			addr:   m.ln.Addr(),
+			conns:  make(chan net.Conn),
+			closed: make(chan struct{}),
+		}
+		m.groups[group] = l
+	}
+	return l
+}
+
+func (m *raftMux) serve() {
+	for {
+		conn, err := m.ln.Accept()
+		if err != nil {
+			log.Info().Err(err).Msg("raft listener closed")
+			m.mu.Lock()
+			for _, l := range m.groups {
+				l.Close()
+			}
+			m.mu.Unlock()
+			return
+		}
+		go m.route(conn)
+	}
+}
+
+func (m *raftMux) route(conn net.Conn) {
+	header := make([]byte, 2)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Read(header[:1]); err != nil {
+		conn.Close()
+		return
+	}
+	if _, err := conn.Read(header[1:]); err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	if header[0] != byte(RaftRPC) {
+		log.Error().Msg("not a raft rpc")
+		conn.Close()
+		return
+	}
+	m.mu.Lock()
+	l, ok := m.groups[header[1]]
+	m.mu.Unlock()
+	if !ok {
+		log.Error().Uint8("group", header[1]).Msg("raft rpc for unknown group")
+		conn.Close()
+		return
+	}
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+type groupListener struct {
+	addr      net.Addr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *groupListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *groupListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *groupListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	api "github.com/holmes89/chickaree-db/chickaree"
+)
+
+func TestSlotGroup(t *testing.T) {
+	for _, groups := range []int{1, 2, 3, 7, 256} {
+		prev := 0
+		for slot := 0; slot < api.SlotCount; slot++ {
+			g := slotGroup(uint16(slot), groups)
+			if g != prev && g != prev+1 {
+				t.Fatalf("%d groups: slot %d jumps from group %d to %d", groups, slot, prev, g)
+			}
+			prev = g
+		}
+		if prev != groups-1 {
+			t.Errorf("%d groups: last slot should belong to group %d not %d", groups, groups-1, prev)
+		}
+	}
+}
+
+func TestGroupConfig(t *testing.T) {
+	config := Config{StoragePath: "data/chickaree.db", RaftDir: "/tmp/raft", MaxMemory: 300}
+	first := groupConfig(config, 0, 3)
+	if first.StoragePath != config.StoragePath || first.RaftDir != config.RaftDir {
+		t.Errorf("group 0 should keep its paths got %s %s", first.StoragePath, first.RaftDir)
+	}
+	if first.MaxMemory != 100 {
+		t.Errorf("expected memory to be split between groups got %d", first.MaxMemory)
+	}
+	second := groupConfig(config, 2, 3)
+	if second.StoragePath != "data/chickaree-2.db" {
+		t.Errorf("unexpected storage path %s", second.StoragePath)
+	}
+	if second.RaftDir != "/tmp/raft/group-2" {
+		t.Errorf("unexpected raft dir %s", second.RaftDir)
+	}
+
+	config.Compression = CompressionConfig{Algorithm: CompressionFlate, Threshold: 1024}
+	config.GroupCompression = map[int]CompressionConfig{1: {Algorithm: CompressionSnappy}}
+	if c := groupConfig(config, 0, 3).Compression; c.Algorithm != CompressionFlate {
+		t.Errorf("expected group 0 to keep the default compression got %s", c.Algorithm)
+	}
+	if c := groupConfig(config, 1, 3).Compression; c.Algorithm != CompressionSnappy || c.Threshold != 1024 {
+		t.Errorf("expected group 1 to be overridden got %+v", c)
+	}
+}
+
+func TestRequestKeys(t *testing.T) {
+	tests := []struct {
+		req  interface{}
+		keys []string
+	}{
+		{&api.GetRequest{Key: "a"}, []string{"a"}},
+		{&api.LockRequest{Name: "l"}, []string{"l"}},
+		{&api.BitOpRequest{Destination: "d", Keys: []string{"a", "b"}}, []string{"d", "a", "b"}},
+		{&api.PFCountRequest{Keys: []string{"a", "b"}}, []string{"a", "b"}},
+		{&api.SetUserRequest{Name: "alice"}, nil},
+		{&api.GetServersRequest{}, nil},
+	}
+	for _, test := range tests {
+		keys := requestKeys(test.req)
+		if len(keys) != len(test.keys) {
+			t.Errorf("%T: expected %v got %v", test.req, test.keys, keys)
+			continue
+		}
+		for i := range keys {
+			if keys[i] != test.keys[i] {
+				t.Errorf("%T: expected %v got %v", test.req, test.keys, keys)
+			}
+		}
+	}
+}
+
+func TestACLGroup(t *testing.T) {
+	slots, err := newSlotMap(filepath.Join(t.TempDir(), slotsFile), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{slots: slots, groups: []*group{{id: 0}, {id: 1}}}
+	name := "a"
+	for slotGroup(api.KeySlot(name), 2) != 1 {
+		name += "a"
+	}
+	if g, err := s.groupFor(&api.GetRequest{Key: name}); err != nil || g.id != 1 {
+		t.Fatalf("expected %s to belong to group 1 got %v %v", name, g, err)
+	}
+	for _, req := range []interface{}{
+		&api.SetUserRequest{Name: name},
+		&api.DeleteUsersRequest{Names: []string{name}},
+	} {
+		if g, err := s.groupFor(req); err != nil || g.id != 0 {
+			t.Errorf("%T: expected group 0 got %v %v", req, g, err)
+		}
+	}
+}
+
+func TestRaftMux(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := newRaftMux(ln)
+	defer ln.Close()
+	groups := []*StreamLayer{
+		NewStreamLayer(mux.Listener(0), 0, nil, nil),
+		NewStreamLayer(mux.Listener(1), 1, nil, nil),
+	}
+
+	for i, layer := range groups {
+		conn, err := layer.Dial(raft.ServerAddress(ln.Addr().String()), time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		accepted, err := layer.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 1)
+		if _, err := accepted.Read(b); err != nil {
+			t.Fatal(err)
+		}
+		if b[0] != byte(i) {
+			t.Errorf("group %d received data for group %d", i, b[0])
+		}
+		conn.Close()
+		accepted.Close()
+	}
+}
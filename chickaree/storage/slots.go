@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// Slots start evenly split between groups and are moved between them by
+// migrations. The assignment is replicated through group 0 so every node
+// routes keys the same way, each node persists its copy beside group 0's
+// raft data so replaying older entries on restart is rejected by version.
+
+const slotsFile = "slots.dat"
+
+var (
+	ErrSlotConfigChanged = errors.New("slot configuration changed")
+	ErrTryAgain          = errors.New("TRYAGAIN Slot is being migrated")
+)
+
+type slotMap struct {
+	mu         sync.RWMutex
+	path       string
+	groups     int
+	config     *api.SlotConfig
+	migrations map[uint32]*api.SlotMigration
+}
+
+func newSlotMap(path string, groups int) (*slotMap, error) {
+	m := &slotMap{path: path, groups: groups}
+	m.set(defaultSlotConfig(groups))
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		log.Error().Err(err).Str("path", path).Msg("unable to read slot configuration")
+		return nil, errors.New("unable to load slots")
+	}
+	var config api.SlotConfig
+	if err := proto.Unmarshal(b, &config); err != nil {
+		log.Error().Err(err).Str("path", path).Msg("unable to parse slot configuration")
+		return nil, errors.New("unable to load slots")
+	}
+	if err := validSlotConfig(&config, groups); err != nil {
+		log.Error().Err(err).Str("path", path).Msg("invalid slot configuration")
+		return nil, err
+	}
+	m.set(&config)
+	return m, nil
+}
+
+// defaultSlotConfig splits the slots evenly, it has version 0 until the
+// first leader of group 0 replicates it.
+func defaultSlotConfig(groups int) *api.SlotConfig {
+	config := &api.SlotConfig{Owners: make([]uint32, api.SlotCount)}
+	for slot := range config.Owners {
+		config.Owners[slot] = uint32(slotGroup(uint16(slot), groups))
+	}
+	return config
+}
+
+func validSlotConfig(config *api.SlotConfig, groups int) error {
+	if len(config.Owners) != api.SlotCount {
+		return errors.New("slot configuration must assign every slot")
+	}
+	for slot, g := range config.Owners {
+		if int(g) >= groups {
+			return fmt.Errorf("slot %d is owned by unknown group %d", slot, g)
+		}
+	}
+	seen := make(map[uint32]bool)
+	for _, m := range config.Migrations {
+		switch {
+		case m.Slot >= api.SlotCount:
+			return fmt.Errorf("invalid slot %d", m.Slot)
+		case seen[m.Slot]:
+			return fmt.Errorf("slot %d is already migrating", m.Slot)
+		case m.Source != config.Owners[m.Slot]:
+			return fmt.Errorf("slot %d is not owned by group %d", m.Slot, m.Source)
+		case int(m.Target) >= groups || m.Target == m.Source:
+			return fmt.Errorf("invalid target group %d for slot %d", m.Target, m.Slot)
+		}
+		seen[m.Slot] = true
+	}
+	return nil
+}
+
+func (m *slotMap) set(config *api.SlotConfig) {
+	m.config = config
+	m.migrations = make(map[uint32]*api.SlotMigration, len(config.Migrations))
+	for _, mig := range config.Migrations {
+		m.migrations[mig.Slot] = mig
+	}
+}
+
+// Config returns a copy of the current assignment.
+func (m *slotMap) Config() *api.SlotConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return proto.Clone(m.config).(*api.SlotConfig)
+}
+
+// owner returns the group serving a slot and its migration if it is moving.
+func (m *slotMap) owner(slot uint16) (int, *api.SlotMigration) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return int(m.config.Owners[slot]), m.migrations[uint32(slot)]
+}
+
+// migrating reports if any of the keys is in a slot being copied.
+func (m *slotMap) migrating(keys []string) bool {
+	for _, key := range keys {
+		if _, mig := m.owner(api.KeySlot(key)); mig != nil && mig.State == api.MigrationState_MIGRATION_MIGRATING {
+			return true
+		}
+	}
+	return false
+}
+
+// ranges returns the runs of slots owned by a group.
+func (m *slotMap) ranges(group int) []*api.SlotRange {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var ranges []*api.SlotRange
+	for slot, g := range m.config.Owners {
+		if int(g) != group {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].End == uint32(slot-1) {
+			ranges[n-1].End = uint32(slot)
+			continue
+		}
+		ranges = append(ranges, &api.SlotRange{Start: uint32(slot), End: uint32(slot)})
+	}
+	return ranges
+}
+
+// update replaces the assignment if config is the next version.
+func (m *slotMap) update(config *api.SlotConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if config.Version != m.config.Version+1 {
+		return ErrSlotConfigChanged
+	}
+	if err := validSlotConfig(config, m.groups); err != nil {
+		return err
+	}
+	b, err := proto.Marshal(config)
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		log.Error().Err(err).Str("path", tmp).Msg("unable to write slot configuration")
+		return errors.New("unable to save slots")
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		log.Error().Err(err).Str("path", m.path).Msg("unable to replace slot configuration")
+		return errors.New("unable to save slots")
+	}
+	m.set(proto.Clone(config).(*api.SlotConfig))
+	return nil
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+)
+
+func TestSlotMapDefault(t *testing.T) {
+	m, err := newSlotMap(filepath.Join(t.TempDir(), slotsFile), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := uint32(0)
+	for g := 0; g < 3; g++ {
+		ranges := m.ranges(g)
+		if len(ranges) != 1 || ranges[0].Start != next {
+			t.Fatalf("group %d should own one range from %d got %v", g, next, ranges)
+		}
+		next = ranges[0].End + 1
+	}
+	if next != api.SlotCount {
+		t.Errorf("slots should end at %d not %d", api.SlotCount, next)
+	}
+}
+
+func TestSlotMapUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), slotsFile)
+	m, err := newSlotMap(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := m.Config()
+	config.Version = 1
+	config.Owners[0] = 1
+	config.Migrations = []*api.SlotMigration{{Slot: 1, Source: 0, Target: 1}}
+	if err := m.update(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.update(config); !errors.Is(err, ErrSlotConfigChanged) {
+		t.Errorf("expected an old version to be rejected got %v", err)
+	}
+
+	reloaded, err := newSlotMap(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, mig := reloaded.owner(0)
+	if g != 1 || mig != nil {
+		t.Errorf("expected slot 0 to be owned by group 1 got %d %v", g, mig)
+	}
+	if _, mig := reloaded.owner(1); mig == nil || mig.Target != 1 {
+		t.Errorf("expected slot 1 to be migrating got %v", mig)
+	}
+	ranges := reloaded.ranges(1)
+	if ranges[0].Start != 0 || ranges[0].End != 0 {
+		t.Errorf("unexpected ranges %v", ranges)
+	}
+}
+
+func TestValidSlotConfig(t *testing.T) {
+	valid := defaultSlotConfig(2)
+	if err := validSlotConfig(valid, 2); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]func(*api.SlotConfig){
+		"missing slots": func(c *api.SlotConfig) { c.Owners = c.Owners[1:] },
+		"unknown group": func(c *api.SlotConfig) { c.Owners[0] = 2 },
+		"wrong source": func(c *api.SlotConfig) {
+			c.Migrations = []*api.SlotMigration{{Slot: 0, Source: 1, Target: 0}}
+		},
+		"same target": func(c *api.SlotConfig) {
+			c.Migrations = []*api.SlotMigration{{Slot: 0, Source: 0, Target: 0}}
+		},
+		"duplicate": func(c *api.SlotConfig) {
+			c.Migrations = []*api.SlotMigration{{Slot: 0, Source: 0, Target: 1}, {Slot: 0, Source: 0, Target: 1}}
+		},
+	}
+	for name, change := range tests {
+		config := defaultSlotConfig(2)
+		change(config)
+		if err := validSlotConfig(config, 2); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// Raft snapshots hold a copy of every bucket of the data file so a node
+// can be rebuilt once the log is compacted, whatever engine it keeps its
+// data in. After a header the state the fsm keeps outside the data file is
+// written as the commands that rebuild it, then the buckets are written
+// depth first. Each record is a kind byte followed by length prefixed
+// fields:
+//
+//	command entry  a log entry applied again on restore
+//	dirty key      a key changed in a slot being migrated
+//	bucket name    opens a nested bucket
+//	value  key v   a value of the open bucket
+//	end            closes the state or the open bucket
+//
+// Values are copied as stored so they stay encrypted and compressed.
+
+const (
+	snapshotBucket byte = iota
+	snapshotValue
+	snapshotEnd
+	snapshotCommand
+	snapshotDirty
+)
+
+// snapshotHeader starts engine snapshots, older snapshots are a copy of
+// events.log or start with snapshotHeaderV1 and only hold the buckets.
+var (
+	snapshotHeader   = []byte("chickaree-snapshot/2\n")
+	snapshotHeaderV1 = []byte("chickaree-snapshot/1\n")
+)
+
+var ErrSnapshotCorrupted = errors.New("snapshot corrupted")
+
+// snapshotStore copies the buckets of the data file in and out of raft
+// snapshots.
+type snapshotStore interface {
+	// Snapshot holds a consistent view of the data file until it is
+	// released.
+	Snapshot() (*storeSnapshot, error)
+	// Load replaces the data file with the buckets written by a snapshot.
+	Load(r io.Reader) error
+}
+
+var (
+	_ snapshotStore = (*store)(nil)
+	_ snapshotStore = (*trackedStore)(nil)
+)
+
+// buckets are read the same way at the top level and nested.
+type buckets interface {
+	Bucket(name []byte) Bucket
+	Iterate(start []byte, fn func(key, value []byte) bool) error
+}
+
+// storeSnapshot keeps a read transaction open on its own goroutine, raft
+// takes snapshots on the fsm goroutine but persists them on another so the
+// copy is written while entries are applied. Bolt can not grow its file
+// while the transaction is open, a write needing more room waits until the
+// snapshot is released.
+type storeSnapshot struct {
+	path    string
+	writers chan io.Writer
+	errs    chan error
+	done    chan struct{}
+	release sync.Once
+}
+
+func (s *store) Snapshot() (*storeSnapshot, error) {
+	ss := &storeSnapshot{
+		path:    s.path,
+		writers: make(chan io.Writer),
+		errs:    make(chan error),
+		done:    make(chan struct{}),
+	}
+	opened := make(chan struct{})
+	var err error
+	go func() {
+		defer close(ss.done)
+		err = s.db.Snapshot(func(tx Tx) error {
+			close(opened)
+			for w := range ss.writers {
+				ss.errs <- ss.dump(w, tx)
+			}
+			return nil
+		})
+	}()
+	select {
+	case <-opened:
+		return ss, nil
+	case <-ss.done:
+		log.Error().Err(err).Str("path", s.path).Msg("unable to open data file snapshot")
+		return nil, errors.New("unable to open data file snapshot")
+	}
+}
+
+// Dump writes the buckets of the data file as they were when the snapshot
+// was taken.
+func (ss *storeSnapshot) Dump(w io.Writer) error {
+	ss.writers <- w
+	return <-ss.errs
+}
+
+// Release ends the read transaction, the snapshot can not be dumped after.
+func (ss *storeSnapshot) Release() {
+	ss.release.Do(func() { close(ss.writers) })
+	<-ss.done
+}
+
+func (ss *storeSnapshot) dump(w io.Writer, tx Tx) error {
+	bw := bufio.NewWriter(w)
+	if err := dumpBuckets(bw, tx); err != nil {
+		log.Error().Err(err).Str("path", ss.path).Msg("unable to dump data file")
+		return errors.New("unable to dump data file")
+	}
+	return bw.Flush()
+}
+
+func dumpBuckets(w *bufio.Writer, b buckets) error {
+	var err error
+	if iterErr := b.Iterate(nil, func(k, v []byte) bool {
+		var nested Bucket
+		if v == nil {
+			nested = b.Bucket(k)
+		}
+		if nested == nil {
+			err = writeRecord(w, snapshotValue, k, v)
+			return err == nil
+		}
+		if err = writeRecord(w, snapshotBucket, k); err != nil {
+			return false
+		}
+		if err = dumpBuckets(w, nested); err != nil {
+			return false
+		}
+		err = writeRecord(w, snapshotEnd)
+		return err == nil
+	}); iterErr != nil {
+		return iterErr
+	}
+	return err
+}
+
+func writeRecord(w *bufio.Writer, kind byte, fields ...[]byte) error {
+	if err := w.WriteByte(kind); err != nil {
+		return err
+	}
+	var n [binary.MaxVarintLen64]byte
+	for _, f := range fields {
+		if _, err := w.Write(n[:binary.PutUvarint(n[:], uint64(len(f)))]); err != nil {
+			return err
+		}
+		if _, err := w.Write(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) Load(r io.Reader) error {
+	br := bufio.NewReader(r)
+	if err := s.db.Batch(func(tx Tx) error {
+		var names [][]byte
+		if err := tx.Iterate(nil, func(k, v []byte) bool {
+			names = append(names, append([]byte{}, k...))
+			return true
+		}); err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return loadBuckets(br, tx)
+	}); err != nil {
+		log.Error().Err(err).Str("path", s.path).Msg("unable to load data file")
+		return err
+	}
+	return nil
+}
+
+// loadBuckets reads records into the top level buckets until the snapshot
+// ends.
+func loadBuckets(r *bufio.Reader, tx Tx) error {
+	for {
+		kind, err := r.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if kind != snapshotBucket {
+			return ErrSnapshotCorrupted
+		}
+		name, err := readField(r)
+		if err != nil {
+			return err
+		}
+		b, err := tx.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+		if err := loadBucket(r, b); err != nil {
+			return err
+		}
+	}
+}
+
+// loadBucket reads records into b until it is closed.
+func loadBucket(r *bufio.Reader, b Bucket) error {
+	for {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return ErrSnapshotCorrupted
+		}
+		switch kind {
+		case snapshotEnd:
+			return nil
+		case snapshotValue:
+			k, err := readField(r)
+			if err != nil {
+				return err
+			}
+			v, err := readField(r)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(k, v); err != nil {
+				return err
+			}
+		case snapshotBucket:
+			name, err := readField(r)
+			if err != nil {
+				return err
+			}
+			nested, err := b.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			if err := loadBucket(r, nested); err != nil {
+				return err
+			}
+		default:
+			return ErrSnapshotCorrupted
+		}
+	}
+}
+
+func readField(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrSnapshotCorrupted
+	}
+	f := make([]byte, n)
+	if _, err := io.ReadFull(r, f); err != nil {
+		return nil, ErrSnapshotCorrupted
+	}
+	return f, nil
+}
+
+func (s *trackedStore) Snapshot() (*storeSnapshot, error) {
+	st, ok := s.storage.(snapshotStore)
+	if !ok {
+		return nil, errors.New("storage does not support snapshots")
+	}
+	return st.Snapshot()
+}
+
+// Load replaces the data file and reloads the statistics of its keys.
+func (s *trackedStore) Load(r io.Reader) error {
+	st, ok := s.storage.(snapshotStore)
+	if !ok {
+		return errors.New("storage does not support snapshots")
+	}
+	if err := st.Load(r); err != nil {
+		return err
+	}
+	return s.load()
+}
+
+// fsmState is what the fsm keeps outside the data file.
+type fsmState struct {
+	readOnly bool
+	slots    []*api.SlotStateRequest
+	dirty    []string
+}
+
+func (f *fsm) state() fsmState {
+	st := fsmState{readOnly: f.isReadOnly()}
+	st.slots, st.dirty = f.migrations.copy()
+	return st
+}
+
+func (st fsmState) write(w *bufio.Writer) error {
+	if err := writeCommand(w, ReadOnlyRequestType, &api.ReadOnlyRequest{ReadOnly: st.readOnly}); err != nil {
+		return err
+	}
+	for _, slot := range st.slots {
+		if err := writeCommand(w, SlotStateRequestType, slot); err != nil {
+			return err
+		}
+	}
+	// changed keys follow the states tracking their slots
+	for _, key := range st.dirty {
+		if err := writeRecord(w, snapshotDirty, []byte(key)); err != nil {
+			return err
+		}
+	}
+	return writeRecord(w, snapshotEnd)
+}
+
+func writeCommand(w *bufio.Writer, reqType RequestType, req proto.Message) error {
+	b, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return writeRecord(w, snapshotCommand, append([]byte{byte(reqType)}, b...))
+}
+
+// restoreState replaces the fsm's state with the commands of a snapshot,
+// snapshots without them leave it as a new fsm has it.
+func (f *fsm) restoreState(r *bufio.Reader, header []byte) error {
+	atomic.StoreInt32(&f.readOnly, 0)
+	f.migrations.clear()
+	if bytes.Equal(header, snapshotHeaderV1) {
+		return nil
+	}
+	for {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return ErrSnapshotCorrupted
+		}
+		switch kind {
+		case snapshotEnd:
+			return nil
+		case snapshotCommand:
+			entry, err := readField(r)
+			if err != nil {
+				return err
+			}
+			if len(entry) == 0 {
+				return ErrSnapshotCorrupted
+			}
+			var res interface{}
+			switch RequestType(entry[0]) {
+			case ReadOnlyRequestType:
+				res = f.applyReadOnly(entry[1:])
+			case SlotStateRequestType:
+				res = f.applySlotState(entry[1:])
+			default:
+				return ErrSnapshotCorrupted
+			}
+			if err, ok := res.(error); ok {
+				return err
+			}
+		case snapshotDirty:
+			key, err := readField(r)
+			if err != nil {
+				return err
+			}
+			f.migrations.changed([]string{string(key)})
+		default:
+			return ErrSnapshotCorrupted
+		}
+	}
+}
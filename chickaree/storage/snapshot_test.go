@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	api "github.com/holmes89/chickaree-db/chickaree"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ raft.SnapshotSink = (*bufferSink)(nil)
+
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (s *bufferSink) ID() string    { return "buffer" }
+func (s *bufferSink) Cancel() error { return nil }
+func (s *bufferSink) Close() error  { return nil }
+
+func newSnapshotFSM(t *testing.T, engine string) (*fsm, *trackedStore) {
+	store, err := newStorage(Config{Engine: engine, StoragePath: filepath.Join(t.TempDir(), "data.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	tracked, err := newTrackedStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fsm{store: tracked, locks: store, migrations: newSlotStates()}, tracked
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	for _, engine := range Engines() {
+		t.Run(engine, func(t *testing.T) {
+			source, sourceStore := newSnapshotFSM(t, engine)
+			applyRequest(t, source, 1, SetRequestType, &api.SetRequest{Key: "a", Value: []byte("1")})
+			applyRequest(t, source, 2, SetRequestType, &api.SetRequest{Key: "big", Value: []byte(strings.Repeat("v", 2048))})
+			applyRequest(t, source, 3, ZAddRequestType, &api.ZAddRequest{Key: "z", Members: []*api.ZMember{{Member: []byte("m"), Score: 2}}})
+			applyRequest(t, source, 4, ExpireRequestType, &api.ExpireRequest{Key: "a", ExpiresAt: 4102444800000})
+			applyRequest(t, source, 5, LockRequestType, &api.LockRequest{Name: "lock", Owner: "o", TtlMs: 1000, Now: 1})
+
+			snap, err := source.Snapshot()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sink bufferSink
+			persisted := make(chan error)
+			go func() { persisted <- snap.Persist(&sink) }()
+			// writes while the snapshot is persisted are not part of it
+			applyRequest(t, source, 6, SetRequestType, &api.SetRequest{Key: "later", Value: []byte("1")})
+			if err := <-persisted; err != nil {
+				t.Fatal(err)
+			}
+			snap.Release()
+
+			target, targetStore := newSnapshotFSM(t, engine)
+			applyRequest(t, target, 1, SetRequestType, &api.SetRequest{Key: "stale", Value: []byte("1")})
+			if err := target.Restore(io.NopCloser(&sink)); err != nil {
+				t.Fatal(err)
+			}
+			if v, err := targetStore.Get([]byte("a")); err != nil || string(v) != "1" {
+				t.Errorf("should be 1 not %q %v", v, err)
+			}
+			if v, _ := targetStore.Get([]byte("big")); len(v) != 2048 {
+				t.Errorf("expected big value to be restored got %d bytes", len(v))
+			}
+			if score, ok, err := targetStore.ZScore([]byte("z"), []byte("m")); err != nil || !ok || score != 2 {
+				t.Errorf("expected member to be restored got %v %v %v", score, ok, err)
+			}
+			if at, _ := targetStore.ExpiresAt([]byte("a")); at != 4102444800000 {
+				t.Errorf("expected expiry to be restored got %d", at)
+			}
+			if state, _ := target.lockState("lock"); state == nil || state.Token != 5 {
+				t.Errorf("expected lock to be restored got %v", state)
+			}
+			for _, key := range []string{"stale", "later"} {
+				if v, _ := targetStore.Get([]byte(key)); v != nil {
+					t.Errorf("expected %s to be missing got %q", key, v)
+				}
+			}
+			sourceUsed := sourceStore.Used()
+			if size, _ := sourceStore.Size([]byte("later")); targetStore.Used() != sourceUsed-size {
+				t.Errorf("expected key statistics to be reloaded got %d", targetStore.Used())
+			}
+
+			if err := target.Restore(io.NopCloser(strings.NewReader(string(snapshotHeader) + "\x01"))); err == nil {
+				t.Errorf("expected corrupted snapshot to fail")
+			}
+		})
+	}
+}
+
+func TestRestoreAfterCompaction(t *testing.T) {
+	dir := t.TempDir()
+	var config Config
+	config.Engine = MemoryEngine
+	config.StoragePath = filepath.Join(dir, "data.db")
+	config.RaftDir = dir
+	config.Raft.TrailingLogs = 1
+	ds := startNode(t, config, "")
+	for _, key := range []string{"a", "b", "c"} {
+		if err := ds.Set([]byte(key), []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ds.raft.Snapshot().Error(); err != nil {
+		t.Fatal(err)
+	}
+	first, err := ds.logs.FirstIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := ds.raft.LastIndex(); first+1 < last {
+		t.Fatalf("expected the log to be compacted got %d to %d", first, last)
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is left in the log to replay the first writes from
+	restarted := startNode(t, config, ds.config.Raft.BindAddr)
+	defer restarted.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		if v, err := restarted.Get([]byte(key)); err != nil || string(v) != key {
+			t.Errorf("should be %s not %q %v", key, v, err)
+		}
+	}
+}
+
+func TestSnapshotReadOnly(t *testing.T) {
+	source, _ := newSnapshotFSM(t, MemoryEngine)
+	applyRequest(t, source, 1, ReadOnlyRequestType, &api.ReadOnlyRequest{ReadOnly: true})
+	snap, err := source.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+	var sink bufferSink
+	if err := snap.Persist(&sink); err != nil {
+		t.Fatal(err)
+	}
+
+	target, targetStore := newSnapshotFSM(t, MemoryEngine)
+	// snapshots taken before the state was kept only hold the buckets
+	v1 := bytes.NewBuffer(append([]byte{}, snapshotHeaderV1...))
+	ss, err := targetStore.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.Dump(v1); err != nil {
+		t.Fatal(err)
+	}
+	ss.Release()
+
+	if err := target.Restore(io.NopCloser(&sink)); err != nil {
+		t.Fatal(err)
+	}
+	if !target.isReadOnly() {
+		t.Errorf("expected secondary to stay read only")
+	}
+	b, _ := proto.Marshal(&api.SetRequest{Key: "a", Value: []byte("1")})
+	if res := target.apply(2, append([]byte{byte(SetRequestType)}, b...)); res != ErrReadOnly {
+		t.Errorf("expected write to be refused got %v", res)
+	}
+
+	if err := target.Restore(io.NopCloser(v1)); err != nil {
+		t.Fatal(err)
+	}
+	if target.isReadOnly() {
+		t.Errorf("expected read only to be reset")
+	}
+}
+
+func TestSnapshotSlotStates(t *testing.T) {
+	source, _ := newSnapshotFSM(t, MemoryEngine)
+	tracked, fenced := api.KeySlot("a"), api.KeySlot("b")
+	applyRequest(t, source, 1, SlotStateRequestType, &api.SlotStateRequest{Slot: uint32(tracked), Track: true, Target: 1})
+	applyRequest(t, source, 2, SlotStateRequestType, &api.SlotStateRequest{Slot: uint32(fenced), Track: true, Fence: true, Target: 1})
+	applyRequest(t, source, 3, SetRequestType, &api.SetRequest{Key: "a", Value: []byte("1")})
+	snap, err := source.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+	var sink bufferSink
+	if err := snap.Persist(&sink); err != nil {
+		t.Fatal(err)
+	}
+
+	target, _ := newSnapshotFSM(t, MemoryEngine)
+	applyRequest(t, target, 1, SlotStateRequestType, &api.SlotStateRequest{Slot: uint32(api.KeySlot("c")), Track: true})
+	if err := target.Restore(io.NopCloser(&sink)); err != nil {
+		t.Fatal(err)
+	}
+	if keys := target.migrations.take(tracked, 10); len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("expected changed keys to be restored got %v", keys)
+	}
+	b, _ := proto.Marshal(&api.SetRequest{Key: "b", Value: []byte("1")})
+	if res := target.apply(4, append([]byte{byte(SetRequestType)}, b...)); res == nil || !strings.HasPrefix(res.(error).Error(), "ASK") {
+		t.Errorf("expected fenced slot to answer ASK got %v", res)
+	}
+	if _, ok := target.migrations.states[api.KeySlot("c")]; ok {
+		t.Errorf("expected slots missing from the snapshot to be forgotten")
+	}
+}
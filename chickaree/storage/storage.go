@@ -1,40 +1,98 @@
 package storage
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/holmes89/chickaree-db/chickaree/encryption"
 	"github.com/rs/zerolog/log"
-	bolt "go.etcd.io/bbolt"
 )
 
 type storage interface {
 	Set(key, value []byte) error
 	Get(key []byte) ([]byte, error)
+	ZAdd(key []byte, members []ScoredMember, opts ZAddOptions) (int64, error)
+	ZScore(key, member []byte) (float64, bool, error)
+	ZRangeByScore(key []byte, min, max float64, fn func(ScoredMember) bool) error
+	Delete(key []byte) error
+	Keys(fn func(key []byte) bool) error
+	Size(key []byte) (int64, error)
+	// Expire sets when a key expires in unix milliseconds, 0 removes the
+	// expiry. It returns false if the key or expiry did not exist.
+	Expire(key []byte, at int64) (bool, error)
+	ExpiresAt(key []byte) (int64, error)
 	Close() error
 }
 
-var defaultBucket = []byte{0x0}
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+var (
+	defaultBucket   = []byte{0x0}
+	sortedSetBucket = []byte{0x1}
+	expiresBucket   = []byte{0x3}
+
+	// each sorted set is a bucket holding member to score and score to
+	// member indexes.
+	membersBucket = []byte("m")
+	scoresBucket  = []byte("s")
+)
+
+type ScoredMember struct {
+	Member []byte
+	Score  float64
+}
+
+type ZAddOptions struct {
+	// NX only adds new members.
+	NX bool
+	// XX only updates existing members.
+	XX bool
+	// CH counts changed members as well as added.
+	CH bool
+}
 
 type store struct {
-	db   *bolt.DB
+	db   Engine
 	path string
+	// keys encrypts values when set.
+	keys          *encryption.Keyring
+	reencryptLock sync.Mutex
+	// compressor compresses large values, values are only framed when nil.
+	compressor *compressor
 }
 
-func newStorage(path string) (storage, error) {
-	db, err := bolt.Open(path, 0666, nil)
+// newStorage opens the data file of a group with its configured engine.
+func newStorage(config Config) (*store, error) {
+	db, err := OpenEngine(config.Engine, config.StoragePath)
 	if err != nil {
 		return nil, err
 	}
+	s := &store{
+		path:       config.StoragePath,
+		db:         db,
+		keys:       config.keys,
+		compressor: config.compressor,
+	}
 
-	if err := db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(defaultBucket)
-		return err
+	if err := db.Batch(func(tx Tx) error {
+		for _, b := range [][]byte{defaultBucket, sortedSetBucket, expiresBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return s.setupEncryption(tx)
 	}); err != nil {
+		db.Close()
 		return nil, err
 	}
-
-	return &store{
-		path: path,
-		db:   db,
-	}, nil
+	if err := s.frameValues(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
 }
 
 func (s *store) Close() error {
@@ -43,15 +101,255 @@ func (s *store) Close() error {
 
 func (s *store) Set(key, value []byte) error {
 	log.Info().Str("key", string(key)).Msg("set request")
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.db.Batch(func(tx Tx) error {
+		// setting a string replaces a value of any other type
+		if tx.Bucket(sortedSetBucket).Bucket(key) != nil {
+			if err := tx.Bucket(sortedSetBucket).DeleteBucket(key); err != nil {
+				return err
+			}
+		}
+		value, err := s.encrypt(s.compressor.frame(value))
+		if err != nil {
+			return err
+		}
 		return tx.Bucket(defaultBucket).Put(key, value)
 	})
 }
 func (s *store) Get(key []byte) (res []byte, err error) {
 	log.Info().Str("key", string(key)).Msg("get request")
-	s.db.View(func(tx *bolt.Tx) error {
-		res = tx.Bucket(defaultBucket).Get(key)
+	err = s.db.Snapshot(func(tx Tx) error {
+		if tx.Bucket(sortedSetBucket).Bucket(key) != nil {
+			return ErrWrongType
+		}
+		// values are only valid for the life of the transaction
+		if v := tx.Bucket(defaultBucket).Get(key); v != nil {
+			var err error
+			if res, err = s.decrypt(v); err != nil {
+				return err
+			}
+			if res, err = unframe(res); err != nil {
+				return err
+			}
+			res = append([]byte{}, res...)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (s *store) ZAdd(key []byte, members []ScoredMember, opts ZAddOptions) (count int64, err error) {
+	log.Info().Str("key", string(key)).Int("members", len(members)).Msg("zadd request")
+	err = s.db.Batch(func(tx Tx) error {
+		if tx.Bucket(defaultBucket).Get(key) != nil {
+			return ErrWrongType
+		}
+		set, err := tx.Bucket(sortedSetBucket).CreateBucketIfNotExists(key)
+		if err != nil {
+			return err
+		}
+		mb, err := set.CreateBucketIfNotExists(membersBucket)
+		if err != nil {
+			return err
+		}
+		sb, err := set.CreateBucketIfNotExists(scoresBucket)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			prev := mb.Get(m.Member)
+			if (prev != nil && opts.NX) || (prev == nil && opts.XX) {
+				continue
+			}
+			if prev != nil {
+				if decodeScore(prev) == m.Score {
+					continue
+				}
+				if err := sb.Delete(scoreKey(decodeScore(prev), m.Member)); err != nil {
+					return err
+				}
+				if opts.CH {
+					count++
+				}
+			} else {
+				count++
+			}
+			if err := mb.Put(m.Member, encodeScore(m.Score)); err != nil {
+				return err
+			}
+			if err := sb.Put(scoreKey(m.Score, m.Member), nil); err != nil {
+				return err
+			}
+		}
+		if isEmpty(mb) {
+			// NX/XX may leave a newly created set empty
+			return tx.Bucket(sortedSetBucket).DeleteBucket(key)
+		}
 		return nil
 	})
-	return res, nil
+	return count, err
+}
+
+func (s *store) ZScore(key, member []byte) (score float64, ok bool, err error) {
+	err = s.db.Snapshot(func(tx Tx) error {
+		set, err := sortedSet(tx, key)
+		if set == nil || err != nil {
+			return err
+		}
+		if v := set.Bucket(membersBucket).Get(member); v != nil {
+			score, ok = decodeScore(v), true
+		}
+		return nil
+	})
+	return score, ok, err
+}
+
+// ZRangeByScore calls fn for each member with min <= score <= max in score
+// order until fn returns false.
+func (s *store) ZRangeByScore(key []byte, min, max float64, fn func(ScoredMember) bool) error {
+	return s.db.Snapshot(func(tx Tx) error {
+		set, err := sortedSet(tx, key)
+		if set == nil || err != nil {
+			return err
+		}
+		return set.Bucket(scoresBucket).Iterate(sortableScore(min), func(k, _ []byte) bool {
+			score := fromSortableScore(k[:8])
+			if score > max {
+				return false
+			}
+			return fn(ScoredMember{Member: append([]byte{}, k[8:]...), Score: score})
+		})
+	})
+}
+
+func (s *store) Delete(key []byte) error {
+	log.Info().Str("key", string(key)).Msg("delete request")
+	return s.db.Batch(func(tx Tx) error {
+		if tx.Bucket(sortedSetBucket).Bucket(key) != nil {
+			if err := tx.Bucket(sortedSetBucket).DeleteBucket(key); err != nil {
+				return err
+			}
+		}
+		if err := tx.Bucket(expiresBucket).Delete(key); err != nil {
+			return err
+		}
+		return tx.Bucket(defaultBucket).Delete(key)
+	})
+}
+
+// Keys calls fn for every key of any type until fn returns false.
+func (s *store) Keys(fn func(key []byte) bool) error {
+	return s.db.Snapshot(func(tx Tx) error {
+		stopped := false
+		for _, name := range [][]byte{defaultBucket, sortedSetBucket} {
+			if err := tx.Bucket(name).Iterate(nil, func(k, _ []byte) bool {
+				stopped = !fn(append([]byte{}, k...))
+				return !stopped
+			}); err != nil || stopped {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Size estimates the bytes used by a key and its value.
+func (s *store) Size(key []byte) (size int64, err error) {
+	err = s.db.Snapshot(func(tx Tx) error {
+		if v := tx.Bucket(defaultBucket).Get(key); v != nil {
+			// compressed values count as their compressed size, the
+			// header byte and encryption are left out
+			framed, err := s.decrypt(v)
+			if err != nil {
+				return err
+			}
+			size = int64(len(key) + len(framed) - 1)
+			return nil
+		}
+		set := tx.Bucket(sortedSetBucket).Bucket(key)
+		if set == nil {
+			return nil
+		}
+		size = int64(len(key))
+		// members are stored in both indexes along with their score
+		return set.Bucket(membersBucket).Iterate(nil, func(k, v []byte) bool {
+			size += 2 * int64(len(k)+len(v))
+			return true
+		})
+	})
+	return size, err
+}
+
+func (s *store) Expire(key []byte, at int64) (ok bool, err error) {
+	err = s.db.Batch(func(tx Tx) error {
+		b := tx.Bucket(expiresBucket)
+		if at == 0 {
+			ok = b.Get(key) != nil
+			return b.Delete(key)
+		}
+		if tx.Bucket(defaultBucket).Get(key) == nil && tx.Bucket(sortedSetBucket).Bucket(key) == nil {
+			return nil
+		}
+		ok = true
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, uint64(at))
+		return b.Put(key, v)
+	})
+	return ok, err
+}
+
+func (s *store) ExpiresAt(key []byte) (at int64, err error) {
+	err = s.db.Snapshot(func(tx Tx) error {
+		if v := tx.Bucket(expiresBucket).Get(key); v != nil {
+			at = int64(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	return at, err
+}
+
+func sortedSet(tx Tx, key []byte) (Bucket, error) {
+	if tx.Bucket(defaultBucket).Get(key) != nil {
+		return nil, ErrWrongType
+	}
+	return tx.Bucket(sortedSetBucket).Bucket(key), nil
+}
+
+func encodeScore(score float64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(score))
+	return b
+}
+
+func decodeScore(b []byte) float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(b))
+}
+
+// sortableScore encodes a score so that byte order matches numeric order.
+func sortableScore(score float64) []byte {
+	bits := math.Float64bits(score)
+	if bits&(1<<63) == 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, bits)
+	return b
+}
+
+func fromSortableScore(b []byte) float64 {
+	bits := binary.BigEndian.Uint64(b)
+	if bits&(1<<63) != 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
+
+func scoreKey(score float64, member []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(sortableScore(score))
+	buf.Write(member)
+	return buf.Bytes()
 }
@@ -0,0 +1,238 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Every connection is mutual TLS, servers and clients present a certificate
+// signed by the CA. Files are checked for changes and reloaded so
+// certificates can be rotated without a restart, connections already
+// established keep the certificates they were made with. Peers are verified
+// against the CA loaded at handshake time rather than a fixed pool so a new
+// CA is picked up as well.
+
+const DefaultReloadInterval = 10 * time.Second
+
+var ErrIncomplete = errors.New("tls needs a cert, key and ca file")
+
+// Client certificate checks of ServerConfigAuth, named like redis'
+// tls-auth-clients.
+const (
+	ClientAuthYes      = "yes"
+	ClientAuthNo       = "no"
+	ClientAuthOptional = "optional"
+)
+
+type Config struct {
+	CertFile string `yaml:"cert-file"`
+	KeyFile  string `yaml:"key-file"`
+	CAFile   string `yaml:"ca-file"`
+	// ServerName is checked against server certificates instead of the
+	// dialed host.
+	ServerName string `yaml:"server-name"`
+}
+
+// Enabled reports whether any tls file is configured.
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.CAFile != ""
+}
+
+func (c Config) Validate() error {
+	if c.Enabled() && (c.CertFile == "" || c.KeyFile == "" || c.CAFile == "") {
+		return ErrIncomplete
+	}
+	return nil
+}
+
+// Reloader holds the current certificate and CA.
+type Reloader struct {
+	config   Config
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	roots    *x509.CertPool
+	modified time.Time
+}
+
+// New loads the certificates, the CA is only needed to verify peers.
+func New(config Config) (*Reloader, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, ErrIncomplete
+	}
+	r := &Reloader{config: config}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) load() error {
+	modified, err := r.lastModified()
+	if err != nil {
+		log.Error().Err(err).Msg("unable to stat tls files")
+		return errors.New("unable to load certificates")
+	}
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		log.Error().Err(err).Str("cert", r.config.CertFile).Msg("unable to load key pair")
+		return errors.New("unable to load certificates")
+	}
+	var roots *x509.CertPool
+	if r.config.CAFile != "" {
+		ca, err := os.ReadFile(r.config.CAFile)
+		if err != nil {
+			log.Error().Err(err).Str("ca", r.config.CAFile).Msg("unable to read ca")
+			return errors.New("unable to load certificates")
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(ca) {
+			log.Error().Str("ca", r.config.CAFile).Msg("no certificates found in ca")
+			return errors.New("unable to load certificates")
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.roots = roots
+	r.modified = modified
+	return nil
+}
+
+func (r *Reloader) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, path := range []string{r.config.CertFile, r.config.KeyFile, r.config.CAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return last, err
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, nil
+}
+
+// Watch reloads the files whenever one changes until done is closed. A
+// failed reload keeps the previous certificates, a cert and key written one
+// after the other can briefly not match.
+func (r *Reloader) Watch(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		modified, err := r.lastModified()
+		r.mu.RLock()
+		changed := err == nil && !modified.Equal(r.modified)
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := r.load(); err != nil {
+			log.Warn().Err(err).Msg("keeping previous certificates")
+			continue
+		}
+		log.Info().Str("cert", r.config.CertFile).Msg("reloaded certificates")
+	}
+}
+
+func (r *Reloader) certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// verify checks the peer chain against the current CA, name is only
+// checked when known.
+func (r *Reloader) verify(certs []*x509.Certificate, name string, usage x509.ExtKeyUsage) error {
+	if len(certs) == 0 {
+		return errors.New("peer sent no certificate")
+	}
+	r.mu.RLock()
+	roots := r.roots
+	r.mu.RUnlock()
+	if roots == nil {
+		return errors.New("no ca to verify the peer with")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       name,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+// ServerConfig accepts clients presenting a certificate signed by the CA.
+func (r *Reloader) ServerConfig() *tls.Config {
+	return r.ServerConfigAuth(ClientAuthYes)
+}
+
+// ServerConfigAuth checks client certificates against the CA when they are
+// required or, when optional, when one is sent.
+func (r *Reloader) ServerConfigAuth(auth string) *tls.Config {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+	}
+	switch auth {
+	case ClientAuthNo:
+		return config
+	case ClientAuthOptional:
+		config.ClientAuth = tls.RequestClientCert
+	default:
+		config.ClientAuth = tls.RequireAnyClientCert
+	}
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 && config.ClientAuth == tls.RequestClientCert {
+			return nil
+		}
+		return r.verify(cs.PeerCertificates, "", x509.ExtKeyUsageClientAuth)
+	}
+	return config
+}
+
+// ClientConfig presents the certificate to servers and checks theirs
+// against the CA and the server name when one is set or dialed.
+func (r *Reloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: r.config.ServerName,
+		// the chain is verified against the reloaded CA below
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return r.verify(cs.PeerCertificates, cs.ServerName, x509.ExtKeyUsageServerAuth)
+		},
+	}
+}
+
+// DialOption dials with the config or without tls when it is nil.
+func DialOption(config *tls.Config) grpc.DialOption {
+	if config == nil {
+		return grpc.WithInsecure()
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(config))
+}
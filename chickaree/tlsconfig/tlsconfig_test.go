@@ -0,0 +1,237 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue writes a certificate for localhost usable by servers and clients.
+func (ca *testCA) issue(t *testing.T, dir, name string, serial int64) Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+		CAFile:   filepath.Join(dir, name+"-ca.crt"),
+	}
+	write(t, config.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	write(t, config.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	write(t, config.CAFile, ca.pem)
+	return config
+}
+
+func write(t *testing.T, path string, b []byte) {
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshake connects a client to a server and returns the error of
+// either side.
+func handshake(t *testing.T, server, client *tls.Config) (*x509.Certificate, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		errs <- tls.Server(conn, server).Handshake()
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	conn, err := tls.Dial("tcp", net.JoinHostPort("localhost", port), client)
+	if err != nil {
+		<-errs
+		return nil, err
+	}
+	defer conn.Close()
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Config{}).Validate(); err != nil {
+		t.Errorf("expected disabled config to be valid: %s", err)
+	}
+	if err := (Config{CertFile: "a.crt", KeyFile: "a.key"}).Validate(); err != ErrIncomplete {
+		t.Errorf("expected config without ca to be incomplete got %v", err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	server, err := New(ca.issue(t, dir, "server", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := New(ca.issue(t, dir, "client", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handshake(t, server.ServerConfig(), client.ClientConfig()); err != nil {
+		t.Errorf("expected handshake to succeed: %s", err)
+	}
+
+	// a client without a certificate is refused
+	if _, err := handshake(t, server.ServerConfig(), &tls.Config{InsecureSkipVerify: true}); err == nil {
+		t.Error("expected client without certificate to be refused")
+	}
+
+	// a client signed by another CA is refused
+	other, err := New(newTestCA(t).issue(t, dir, "other", 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handshake(t, server.ServerConfig(), other.ClientConfig()); err == nil {
+		t.Error("expected client from another ca to be refused")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	config := ca.issue(t, dir, "server", 2)
+	server, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := New(ca.issue(t, dir, "client", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go server.Watch(10*time.Millisecond, done)
+
+	// rotate the server certificate in place
+	time.Sleep(20 * time.Millisecond)
+	ca.issue(t, dir, "server", 5)
+	now := time.Now().Add(time.Second)
+	for _, path := range []string{config.CertFile, config.KeyFile} {
+		if err := os.Chtimes(path, now, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cert, err := handshake(t, server.ServerConfig(), client.ClientConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.SerialNumber.Int64() == 5 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected reloaded certificate got serial %d", cert.SerialNumber.Int64())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerConfigAuth(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	server, err := New(ca.issue(t, dir, "server", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := New(ca.issue(t, dir, "client", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(newTestCA(t).issue(t, dir, "other", 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous := &tls.Config{InsecureSkipVerify: true}
+
+	optional := server.ServerConfigAuth(ClientAuthOptional)
+	if _, err := handshake(t, optional, anonymous); err != nil {
+		t.Errorf("expected optional auth to accept clients without certificate: %s", err)
+	}
+	if _, err := handshake(t, optional, client.ClientConfig()); err != nil {
+		t.Errorf("expected optional auth to accept valid certificate: %s", err)
+	}
+	if _, err := handshake(t, optional, other.ClientConfig()); err == nil {
+		t.Error("expected optional auth to refuse certificate from another ca")
+	}
+
+	if _, err := handshake(t, server.ServerConfigAuth(ClientAuthNo), anonymous); err != nil {
+		t.Errorf("expected no auth to accept clients without certificate: %s", err)
+	}
+}
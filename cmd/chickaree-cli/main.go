@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/tlsconfig"
+	"google.golang.org/grpc"
+)
+
+const usage = `usage: chickaree-cli [-addr host:port] [-tls-cert file -tls-key file -tls-ca file] [-token token] <command> [args]
+
+commands:
+  slots [-watch]                      show slot ownership and migrations
+  migrate -target <group> <slot|start-end>...
+                                      move slots to another raft group
+  rebalance [-dry-run] [-watch]       spread slots evenly across raft groups
+  replica                             only accept writes replicated from a primary
+  promote                             fail over by accepting writes again
+  keygen                              print a new gossip or at rest encryption key
+  keyring [-install|-use|-remove <key>]
+                                      list or rotate the gossip keys of every member
+  stats [-group <group>]              show raft progress and compression ratio of a server
+`
+
+func main() {
+	addr := flag.String("addr", "localhost:8400", "admin address of a storage server")
+	var tlsConfig tlsconfig.Config
+	flag.StringVar(&tlsConfig.CertFile, "tls-cert", "", "client certificate")
+	flag.StringVar(&tlsConfig.KeyFile, "tls-key", "", "client key")
+	flag.StringVar(&tlsConfig.CAFile, "tls-ca", "", "ca of the storage servers")
+	flag.StringVar(&tlsConfig.ServerName, "tls-server-name", "", "name in the server certificate")
+	token := flag.String("token", os.Getenv("CHICKAREE_TOKEN"), "bearer token of an admin principal")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if flag.Arg(0) == "keygen" {
+		if err := keygen(); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	dial := grpc.WithInsecure()
+	if tlsConfig.Enabled() {
+		certs, err := tlsconfig.New(tlsConfig)
+		if err != nil {
+			fail(err)
+		}
+		dial = tlsconfig.DialOption(certs.ClientConfig())
+	}
+	conn, err := grpc.Dial(*addr, append([]grpc.DialOption{dial}, chickaree.WithToken(*token)...)...)
+	if err != nil {
+		fail(err)
+	}
+	defer conn.Close()
+	admin := chickaree.NewAdminClient(conn)
+	db := chickaree.NewChickareeDBClient(conn)
+
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "slots", "status":
+		err = slots(admin, args)
+	case "migrate":
+		err = migrate(admin, args)
+	case "rebalance":
+		err = rebalance(admin, args)
+	case "replica":
+		err = setReadOnly(admin, db, true)
+	case "promote":
+		err = setReadOnly(admin, db, false)
+	case "keyring":
+		err = keyring(admin, args)
+	case "stats":
+		err = stats(admin, args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
+func slots(admin chickaree.AdminClient, args []string) error {
+	fs := flag.NewFlagSet("slots", flag.ExitOnError)
+	watch := fs.Bool("watch", false, "refresh until all migrations finish")
+	fs.Parse(args)
+	return status(admin, *watch)
+}
+
+func migrate(admin chickaree.AdminClient, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	target := fs.Uint("target", 0, "raft group to move the slots to")
+	watch := fs.Bool("watch", false, "refresh until all migrations finish")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no slots given")
+	}
+	req := &chickaree.MigrateSlotsRequest{Target: uint32(*target)}
+	for _, arg := range fs.Args() {
+		start, end, err := slotRange(arg)
+		if err != nil {
+			return err
+		}
+		for slot := start; slot <= end; slot++ {
+			req.Slots = append(req.Slots, slot)
+		}
+	}
+	res, err := admin.MigrateSlots(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("queued %d migrations\n", len(res.Migrations))
+	return status(admin, *watch)
+}
+
+func rebalance(admin chickaree.AdminClient, args []string) error {
+	fs := flag.NewFlagSet("rebalance", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "print the plan without queueing it")
+	watch := fs.Bool("watch", false, "refresh until all migrations finish")
+	fs.Parse(args)
+	res, err := admin.Rebalance(context.Background(), &chickaree.RebalanceRequest{DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		for _, mig := range res.Migrations {
+			fmt.Printf("slot %d: group %d -> group %d\n", mig.Slot, mig.Source, mig.Target)
+		}
+		fmt.Printf("%d migrations planned\n", len(res.Migrations))
+		return nil
+	}
+	fmt.Printf("queued %d migrations\n", len(res.Migrations))
+	return status(admin, *watch)
+}
+
+// setReadOnly changes every group, a group that fails is reported and can
+// be retried by running the command again.
+func setReadOnly(admin chickaree.AdminClient, db chickaree.ChickareeDBClient, readOnly bool) error {
+	shards, err := db.GetShards(context.Background(), &chickaree.GetShardsRequest{})
+	if err != nil {
+		return err
+	}
+	for _, shard := range shards.Shards {
+		if _, err := admin.SetReadOnly(context.Background(), &chickaree.ReadOnlyRequest{
+			Group:    shard.Group,
+			ReadOnly: readOnly,
+		}); err != nil {
+			return fmt.Errorf("group %d: %w", shard.Group, err)
+		}
+		fmt.Printf("group %d: read only %t\n", shard.Group, readOnly)
+	}
+	return nil
+}
+
+func keygen() error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(key))
+	return nil
+}
+
+// keyring lists the keys unless asked to change them. Rotating is install,
+// use and then remove of the old key once every member uses the new one.
+func keyring(admin chickaree.AdminClient, args []string) error {
+	fs := flag.NewFlagSet("keyring", flag.ExitOnError)
+	install := fs.String("install", "", "add a key to every member")
+	use := fs.String("use", "", "encrypt with an installed key")
+	remove := fs.String("remove", "", "remove a key that is no longer used")
+	fs.Parse(args)
+	ctx := context.Background()
+	var res *chickaree.KeyringResponse
+	var err error
+	switch {
+	case *install != "":
+		res, err = admin.InstallKey(ctx, &chickaree.KeyringRequest{Key: *install})
+	case *use != "":
+		res, err = admin.UseKey(ctx, &chickaree.KeyringRequest{Key: *use})
+	case *remove != "":
+		res, err = admin.RemoveKey(ctx, &chickaree.KeyringRequest{Key: *remove})
+	default:
+		res, err = admin.ListKeys(ctx, &chickaree.KeyringRequest{})
+	}
+	if err != nil {
+		return err
+	}
+	for key, n := range res.Keys {
+		primary := ""
+		if res.PrimaryKeys[key] > 0 {
+			primary = fmt.Sprintf(" (primary on %d)", res.PrimaryKeys[key])
+		}
+		fmt.Printf("%s: %d/%d members%s\n", key, n, res.NumNodes, primary)
+	}
+	for node, msg := range res.Messages {
+		fmt.Printf("%s: %s\n", node, msg)
+	}
+	if res.NumErr > 0 {
+		return fmt.Errorf("%d/%d members failed", res.NumErr, res.NumNodes)
+	}
+	return nil
+}
+
+// stats shows the server addr points at, compression counts are since it
+// started.
+func stats(admin chickaree.AdminClient, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	group := fs.Uint("group", 0, "raft group")
+	fs.Parse(args)
+	res, err := admin.ServerStats(context.Background(), &chickaree.ServerStatsRequest{Group: uint32(*group)})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s, last index %d, applied index %d\n", res.Id, res.State, res.LastIndex, res.AppliedIndex)
+	c := res.Compression
+	if c == nil || c.Algorithm == "" || c.Algorithm == "none" {
+		fmt.Println("compression: none")
+		return nil
+	}
+	ratio := 1.0
+	if c.StoredBytes > 0 {
+		ratio = float64(c.RawBytes) / float64(c.StoredBytes)
+	}
+	fmt.Printf("compression: %s over %d bytes\n", c.Algorithm, c.Threshold)
+	fmt.Printf("%d values and %d log entries compressed, %d -> %d bytes (%.2fx)\n",
+		c.CompressedValues, c.CompressedEntries, c.RawBytes, c.StoredBytes, ratio)
+	return nil
+}
+
+func slotRange(arg string) (uint32, uint32, error) {
+	parts := strings.SplitN(arg, "-", 2)
+	start, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid slot %q", arg)
+	}
+	end := start
+	if len(parts) == 2 {
+		if end, err = strconv.ParseUint(parts[1], 10, 32); err != nil {
+			return 0, 0, fmt.Errorf("invalid slot %q", arg)
+		}
+	}
+	if end < start || end >= chickaree.SlotCount {
+		return 0, 0, fmt.Errorf("invalid slot range %q", arg)
+	}
+	return uint32(start), uint32(end), nil
+}
+
+func status(admin chickaree.AdminClient, watch bool) error {
+	for {
+		config, err := admin.GetSlots(context.Background(), &chickaree.GetSlotsRequest{})
+		if err != nil {
+			return err
+		}
+		printSlots(config)
+		if !watch || len(config.Migrations) == 0 {
+			return nil
+		}
+		time.Sleep(time.Second)
+		fmt.Println()
+	}
+}
+
+func printSlots(config *chickaree.SlotConfig) {
+	counts := make(map[uint32]int)
+	groups := uint32(0)
+	for _, owner := range config.Owners {
+		counts[owner]++
+		if owner >= groups {
+			groups = owner + 1
+		}
+	}
+	for _, mig := range config.Migrations {
+		if mig.Target >= groups {
+			groups = mig.Target + 1
+		}
+	}
+	fmt.Printf("version %d\n", config.Version)
+	for g := uint32(0); g < groups; g++ {
+		fmt.Printf("group %d: %d slots\n", g, counts[g])
+	}
+	var migrating int
+	for _, mig := range config.Migrations {
+		if mig.State == chickaree.MigrationState_MIGRATION_MIGRATING {
+			migrating++
+			fmt.Printf("migrating slot %d: group %d -> group %d (attempt %d)\n", mig.Slot, mig.Source, mig.Target, mig.Attempt)
+		}
+	}
+	fmt.Printf("%d migrations pending, %d migrating\n", len(config.Migrations)-migrating, migrating)
+}
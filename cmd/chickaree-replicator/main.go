@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/holmes89/chickaree-db/chickaree"
+	"github.com/holmes89/chickaree-db/chickaree/replication"
+	"github.com/holmes89/chickaree-db/chickaree/tlsconfig"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v2"
+)
+
+func main() {
+
+	cfg, err := LoadConfiguration()
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to load config")
+	}
+
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	if cfg.TLS.Enabled() {
+		certs, err := tlsconfig.New(cfg.TLS)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to load certificates")
+		}
+		done := make(chan struct{})
+		defer close(done)
+		go certs.Watch(tlsconfig.DefaultReloadInterval, done)
+		opts = []grpc.DialOption{tlsconfig.DialOption(certs.ClientConfig())}
+	}
+	opts = append(opts, chickaree.WithToken(cfg.Token)...)
+	primary, err := grpc.Dial(cfg.Primary, opts...)
+	if err != nil {
+		log.Fatal().Err(err).Str("url", cfg.Primary).Msg("failed to dial primary")
+	}
+	defer primary.Close()
+	secondary, err := grpc.Dial(cfg.Secondary, opts...)
+	if err != nil {
+		log.Fatal().Err(err).Str("url", cfg.Secondary).Msg("failed to dial secondary")
+	}
+	defer secondary.Close()
+
+	agent, err := replication.NewAgent(primary, secondary, replication.Config{
+		Checkpoint:   cfg.Checkpoint,
+		BatchSize:    cfg.BatchSize,
+		PollInterval: cfg.PollInterval,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to create replication agent")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", agent)
+	metrics := &http.Server{Addr: fmt.Sprintf(":%d", cfg.MetricsPort), Handler: mux}
+	go func() {
+		log.Info().Int("port", cfg.MetricsPort).Msg("serving metrics...")
+		if err := metrics.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("unable to serve metrics")
+		}
+	}()
+	defer metrics.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+		<-c
+		cancel()
+	}()
+
+	log.Info().Str("primary", cfg.Primary).Str("secondary", cfg.Secondary).Msg("replicating...")
+	log.Error().Err(agent.Run(ctx)).Msg("terminated")
+}
+
+type Config struct {
+	// Primary and Secondary are the rpc addresses of a server in each cluster.
+	Primary   string `yaml:"primary"`
+	Secondary string `yaml:"secondary"`
+	// Checkpoint is the file the last replicated indexes are saved to.
+	Checkpoint   string        `yaml:"checkpoint"`
+	BatchSize    uint32        `yaml:"batch-size"`
+	PollInterval time.Duration `yaml:"poll-interval"`
+	MetricsPort  int           `yaml:"metrics-port"`
+	// TLS dials both clusters with a client certificate signed by a CA
+	// they both trust.
+	TLS tlsconfig.Config `yaml:"tls"`
+	// Token authenticates to both clusters, it needs the admin role.
+	Token string `yaml:"token"`
+}
+
+func LoadConfiguration() (Config, error) {
+	cfgfilePtr := flag.String("config-file", "", "load configurations from a file")
+	flag.Parse()
+
+	cfg := Config{
+		Primary:     ":8400",
+		Secondary:   ":8401",
+		Checkpoint:  "replication.dat",
+		MetricsPort: 9500,
+	}
+
+	if cfgfilePtr != nil && *cfgfilePtr != "" {
+		if err := cfg.LoadFromFile(*cfgfilePtr); err != nil {
+			return cfg, fmt.Errorf("unable to load configuration from file: %s", *cfgfilePtr)
+		}
+	}
+
+	cfg.LoadFromEnv()
+	if err := cfg.TLS.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (config *Config) LoadFromFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Error().Err(err).Str("path", path).Msg("unable to load configuration file")
+		return errors.New("unable to load configuration")
+	}
+	if err := yaml.Unmarshal(b, config); err != nil {
+		log.Error().Err(err).Str("path", path).Msg("unable to parse configuration file")
+		return errors.New("unable to load configuration")
+	}
+	return nil
+}
+
+func (config *Config) LoadFromEnv() {
+	if val := os.Getenv("PRIMARY_ADDR"); val != "" {
+		config.Primary = val
+	}
+	if val := os.Getenv("SECONDARY_ADDR"); val != "" {
+		config.Secondary = val
+	}
+	if val := os.Getenv("CHECKPOINT_FILE"); val != "" {
+		config.Checkpoint = val
+	}
+	if val := os.Getenv("BATCH_SIZE"); val != "" {
+		if v, err := strconv.ParseUint(val, 10, 32); err == nil {
+			config.BatchSize = uint32(v)
+		}
+	}
+	if val := os.Getenv("POLL_INTERVAL"); val != "" {
+		if v, err := time.ParseDuration(val); err == nil {
+			config.PollInterval = v
+		}
+	}
+	if val := os.Getenv("METRICS_PORT"); val != "" {
+		if v, err := strconv.Atoi(val); err == nil {
+			config.MetricsPort = v
+		}
+	}
+	if val := os.Getenv("TLS_CERT_FILE"); val != "" {
+		config.TLS.CertFile = val
+	}
+	if val := os.Getenv("TLS_KEY_FILE"); val != "" {
+		config.TLS.KeyFile = val
+	}
+	if val := os.Getenv("TLS_CA_FILE"); val != "" {
+		config.TLS.CAFile = val
+	}
+	if val := os.Getenv("TLS_SERVER_NAME"); val != "" {
+		config.TLS.ServerName = val
+	}
+	if val := os.Getenv("TOKEN"); val != "" {
+		config.Token = val
+	}
+}
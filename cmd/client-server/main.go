@@ -4,11 +4,13 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
 
 	"github.com/holmes89/chickaree-db/chickaree"
 	"github.com/holmes89/chickaree-db/chickaree/redis"
+	"github.com/holmes89/chickaree-db/chickaree/tlsconfig"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 	"gopkg.in/yaml.v2"
@@ -22,6 +24,17 @@ func main() {
 	}
 
 	opts := []grpc.DialOption{grpc.WithInsecure()}
+	if cfg.StorageTLS.Enabled() {
+		certs, err := tlsconfig.New(cfg.StorageTLS)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to load certificates")
+		}
+		done := make(chan struct{})
+		defer close(done)
+		go certs.Watch(tlsconfig.DefaultReloadInterval, done)
+		opts = []grpc.DialOption{tlsconfig.DialOption(certs.ClientConfig())}
+	}
+	opts = append(opts, chickaree.WithToken(cfg.StorageToken)...)
 	conn, err := grpc.Dial(cfg.StorageServer, opts...)
 	log.Info().Str("url", cfg.StorageServer).Msg("dialing storage...")
 	if err != nil {
@@ -33,8 +46,36 @@ func main() {
 	}()
 	client := chickaree.NewChickareeDBClient(conn)
 
-	tcpServer := redis.NewTCPServer(fmt.Sprintf(":%d", cfg.Port), client)
+	port := ""
+	if cfg.Port != 0 {
+		port = fmt.Sprintf(":%d", cfg.Port)
+	}
+	tcpServer := redis.NewTCPServer(port, client, opts...)
 	defer tcpServer.Close()
+	if cfg.RequirePass != "" {
+		tcpServer.RequirePass(cfg.RequirePass)
+	}
+	if cfg.TLSPort != 0 {
+		certs, err := tlsconfig.New(tlsconfig.Config{
+			CertFile: cfg.TLSCertFile,
+			KeyFile:  cfg.TLSKeyFile,
+			CAFile:   cfg.TLSCACertFile,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to load resp certificates")
+		}
+		done := make(chan struct{})
+		defer close(done)
+		go certs.Watch(tlsconfig.DefaultReloadInterval, done)
+		if err := tcpServer.ListenTLS(fmt.Sprintf(":%d", cfg.TLSPort), certs.ServerConfigAuth(cfg.TLSAuthClients)); err != nil {
+			log.Fatal().Err(err).Msg("unable to serve tls")
+		}
+	}
+	if cfg.ClusterEnabled {
+		if err := tcpServer.EnableCluster(cfg.ClusterAnnounceAddr); err != nil {
+			log.Fatal().Err(err).Msg("unable to enable cluster")
+		}
+	}
 
 	log.Error().Err(<-tcpServer.Run()).Msg("terminated")
 }
@@ -42,6 +83,26 @@ func main() {
 type Config struct {
 	StorageServer string `yaml:"storage-server"`
 	Port          int    `yaml:"port"`
+	// ClusterEnabled answers redis cluster commands for cluster aware clients.
+	ClusterEnabled bool `yaml:"cluster-enabled"`
+	// ClusterAnnounceAddr is the address clients are told to connect to.
+	ClusterAnnounceAddr string `yaml:"cluster-announce-addr"`
+	// TLSPort serves RESP over tls alongside Port, set Port to 0 to only
+	// accept tls. The options are named like redis'.
+	TLSPort       int    `yaml:"tls-port"`
+	TLSCertFile   string `yaml:"tls-cert-file"`
+	TLSKeyFile    string `yaml:"tls-key-file"`
+	TLSCACertFile string `yaml:"tls-ca-cert-file"`
+	// TLSAuthClients is yes, no or optional.
+	TLSAuthClients string `yaml:"tls-auth-clients"`
+	// StorageTLS dials the storage servers with a client certificate.
+	StorageTLS tlsconfig.Config `yaml:"storage-tls"`
+	// StorageToken authenticates the proxy to the storage servers, its
+	// principal needs the admin role to manage ACL users.
+	StorageToken string `yaml:"storage-token"`
+	// RequirePass is the default user's password until ACL SETUSER
+	// changes it.
+	RequirePass string `yaml:"requirepass"`
 }
 
 func LoadConfiguration() (Config, error) {
@@ -49,8 +110,9 @@ func LoadConfiguration() (Config, error) {
 	flag.Parse()
 
 	cfg := Config{
-		Port:          6379,
-		StorageServer: ":8080",
+		Port:           6379,
+		StorageServer:  ":8080",
+		TLSAuthClients: tlsconfig.ClientAuthYes,
 	}
 
 	if cfgfilePtr != nil && *cfgfilePtr != "" {
@@ -60,6 +122,37 @@ func LoadConfiguration() (Config, error) {
 	}
 
 	cfg.LoadFromEnv()
+	if err := cfg.StorageTLS.Validate(); err != nil {
+		return cfg, err
+	}
+	if cfg.Port == 0 && cfg.TLSPort == 0 {
+		return cfg, errors.New("port and tls-port can not both be 0")
+	}
+	if cfg.TLSPort != 0 {
+		if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			return cfg, errors.New("tls-port needs tls-cert-file and tls-key-file")
+		}
+		switch cfg.TLSAuthClients {
+		case tlsconfig.ClientAuthNo:
+		case tlsconfig.ClientAuthYes, tlsconfig.ClientAuthOptional:
+			if cfg.TLSCACertFile == "" {
+				return cfg, errors.New("tls-auth-clients needs tls-ca-cert-file")
+			}
+		default:
+			return cfg, fmt.Errorf("invalid tls-auth-clients: %s", cfg.TLSAuthClients)
+		}
+	}
+	if cfg.ClusterAnnounceAddr == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Error().Err(err).Msg("unable to find hostname")
+		}
+		port := cfg.Port
+		if port == 0 {
+			port = cfg.TLSPort
+		}
+		cfg.ClusterAnnounceAddr = net.JoinHostPort(hostname, strconv.Itoa(port))
+	}
 	return cfg, nil
 }
 
@@ -85,6 +178,47 @@ func (config *Config) LoadFromEnv() {
 			config.Port = v
 		}
 	}
+	if val := os.Getenv("CLUSTER_ENABLED"); val != "" {
+		config.ClusterEnabled = (val == "true" || val == "1")
+	}
+	if val := os.Getenv("CLUSTER_ANNOUNCE_ADDR"); val != "" {
+		config.ClusterAnnounceAddr = val
+	}
+	if val := os.Getenv("TLS_PORT"); val != "" {
+		if v, err := strconv.Atoi(val); err == nil {
+			config.TLSPort = v
+		}
+	}
+	if val := os.Getenv("TLS_CERT_FILE"); val != "" {
+		config.TLSCertFile = val
+	}
+	if val := os.Getenv("TLS_KEY_FILE"); val != "" {
+		config.TLSKeyFile = val
+	}
+	if val := os.Getenv("TLS_CA_CERT_FILE"); val != "" {
+		config.TLSCACertFile = val
+	}
+	if val := os.Getenv("TLS_AUTH_CLIENTS"); val != "" {
+		config.TLSAuthClients = val
+	}
+	if val := os.Getenv("REQUIREPASS"); val != "" {
+		config.RequirePass = val
+	}
+	if val := os.Getenv("STORAGE_TOKEN"); val != "" {
+		config.StorageToken = val
+	}
+	if val := os.Getenv("STORAGE_TLS_CERT_FILE"); val != "" {
+		config.StorageTLS.CertFile = val
+	}
+	if val := os.Getenv("STORAGE_TLS_KEY_FILE"); val != "" {
+		config.StorageTLS.KeyFile = val
+	}
+	if val := os.Getenv("STORAGE_TLS_CA_FILE"); val != "" {
+		config.StorageTLS.CAFile = val
+	}
+	if val := os.Getenv("STORAGE_TLS_SERVER_NAME"); val != "" {
+		config.StorageTLS.ServerName = val
+	}
 
 	return
 }
@@ -11,12 +11,11 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/soheilhy/cmux"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
 
-	gsrv := grpc.NewServer()
-
 	cfg, err := storage.LoadConfiguration()
 	if err != nil {
 		log.Fatal().Err(err).Msg("unable to load configuration")
@@ -28,9 +27,19 @@ func main() {
 	}
 	defer srv.Close()
 
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(srv.Authenticate, srv.ForwardWrites),
+		grpc.StreamInterceptor(srv.AuthenticateStream),
+	}
+	if srv.ServerTLSConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(srv.ServerTLSConfig)))
+	}
+	gsrv := grpc.NewServer(opts...)
+
 	mux := srv.Mux()
 	grpcLn := mux.Match(cmux.Any())
 	chickaree.RegisterChickareeDBServer(gsrv, srv)
+	chickaree.RegisterAdminServer(gsrv, srv.Admin())
 
 	errs := make(chan error, 2) // This is used to handle and log the reason why the application quit.
 	go func() {